@@ -0,0 +1,77 @@
+// Command import loads a Slack workspace export or a Discord JSON export into
+// the chat database (./db.db) and prints the import report as JSON, or writes
+// it to the -report file since database query logging also goes to stdout.
+//
+//	go run ./cmd/import -source slack -file export.zip -report report.json
+//	go run ./cmd/import -source discord -file channel.json
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github/sabt-dev/realtimeChat/database"
+	"github/sabt-dev/realtimeChat/importer"
+	"github/sabt-dev/realtimeChat/services"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	source := flag.String("source", "", "archive source: slack or discord")
+	file := flag.String("file", "", "path to the export archive")
+	reportPath := flag.String("report", "", "write the import report to this file instead of stdout")
+	flag.Parse()
+
+	if *source == "" || *file == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("Warning: .env file not found, using default values")
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		log.Fatalf("Failed to open archive: %v", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		log.Fatalf("Failed to read archive: %v", err)
+	}
+
+	archive, err := importer.Parse(*source, f, info.Size())
+	if err != nil {
+		log.Fatalf("Failed to parse archive: %v", err)
+	}
+
+	if err := database.InitDatabase(); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	report, err := services.NewImportService().Import(archive, nil)
+	if report != nil {
+		out := os.Stdout
+		if *reportPath != "" {
+			reportFile, createErr := os.Create(*reportPath)
+			if createErr != nil {
+				log.Fatalf("Failed to create report file: %v", createErr)
+			}
+			out = reportFile
+			defer out.Close()
+		}
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if encErr := enc.Encode(report); encErr != nil {
+			log.Printf("Failed to write report: %v", encErr)
+		}
+	}
+	if err != nil {
+		log.Fatalf("Import failed: %v", err)
+	}
+}
@@ -49,13 +49,40 @@ func InitDatabase() error {
 	// Set global DB variable
 	DB = db
 
+	if err := Migrate(db); err != nil {
+		return err
+	}
+
+	log.Println("Database initialized and migrated successfully")
+	return nil
+}
+
+// Migrate creates or updates the schema, indexes and search index in db
+func Migrate(db *gorm.DB) error {
 	// Auto-migrate the schemas
-	err = db.AutoMigrate(
+	err := db.AutoMigrate(
 		&models.Room{},
 		&models.User{},
 		&models.Message{},
 		&models.RoomMember{},
 		&models.MessageReaction{},
+		&models.ModerationAction{},
+		&models.AuditLog{},
+		&models.PinnedMessage{},
+		&models.Bookmark{},
+		&models.BotToken{},
+		&models.RoomBot{},
+		&models.IncomingWebhook{},
+		&models.OutgoingWebhook{},
+		&models.WebhookDelivery{},
+		&models.WebhookDeliveryAttempt{},
+		&models.BotCommand{},
+		&models.RoomMute{},
+		&models.LinkPreview{},
+		&models.Upload{},
+		&models.TusUpload{},
+		&models.Blob{},
+		&models.BlobReference{},
 	)
 	if err != nil {
 		return err
@@ -67,8 +94,8 @@ func InitDatabase() error {
 		log.Printf("Warning: Failed to create unique index for message reactions: %v", err)
 	}
 
-	log.Println("Database initialized and migrated successfully")
-	return nil
+	// Full-text search index over message text
+	return setupSearchIndex(db)
 }
 
 // GetDB returns the database instance
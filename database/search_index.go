@@ -0,0 +1,51 @@
+package database
+
+import (
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// searchIndexStatements create the FTS5 index over message text and file names.
+// It is an external-content table: the text lives only in messages, and the
+// triggers keep the index in sync on insert, edit and (soft or hard) delete.
+var searchIndexStatements = []string{
+	`CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(
+		text, file_name,
+		content='messages', content_rowid='id',
+		tokenize='unicode61 remove_diacritics 2'
+	)`,
+	`CREATE TRIGGER IF NOT EXISTS messages_fts_insert AFTER INSERT ON messages BEGIN
+		INSERT INTO messages_fts(rowid, text, file_name) VALUES (new.id, new.text, new.file_name);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS messages_fts_delete AFTER DELETE ON messages BEGIN
+		INSERT INTO messages_fts(messages_fts, rowid, text, file_name) VALUES ('delete', old.id, old.text, old.file_name);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS messages_fts_update AFTER UPDATE OF text, file_name ON messages BEGIN
+		INSERT INTO messages_fts(messages_fts, rowid, text, file_name) VALUES ('delete', old.id, old.text, old.file_name);
+		INSERT INTO messages_fts(rowid, text, file_name) VALUES (new.id, new.text, new.file_name);
+	END`,
+}
+
+// setupSearchIndex creates the full-text search index and its sync triggers.
+// Messages stored before the index existed are indexed on first run.
+func setupSearchIndex(db *gorm.DB) error {
+	var existing int64
+	if err := db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'messages_fts'").Scan(&existing).Error; err != nil {
+		return err
+	}
+
+	for _, stmt := range searchIndexStatements {
+		if err := db.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+
+	if existing == 0 {
+		if err := db.Exec("INSERT INTO messages_fts(messages_fts) VALUES ('rebuild')").Error; err != nil {
+			return err
+		}
+		log.Println("Built full-text search index for existing messages")
+	}
+	return nil
+}
@@ -1,8 +1,6 @@
 module github/sabt-dev/realtimeChat
 
-go 1.23.0
-
-toolchain go1.24.0
+go 1.24.0
 
 require (
 	github.com/gin-gonic/gin v1.10.1
@@ -11,6 +9,8 @@ require (
 	github.com/gorilla/websocket v1.5.3
 	github.com/joho/godotenv v1.5.1
 	github.com/markbates/goth v1.78.0
+	golang.org/x/image v0.36.0
+	golang.org/x/net v0.42.0
 	gorm.io/driver/sqlite v1.5.6
 	gorm.io/gorm v1.25.12
 	modernc.org/sqlite v1.33.1
@@ -49,10 +49,9 @@ require (
 	github.com/ugorji/go/codec v1.3.0 // indirect
 	golang.org/x/arch v0.19.0 // indirect
 	golang.org/x/crypto v0.40.0 // indirect
-	golang.org/x/net v0.42.0 // indirect
 	golang.org/x/oauth2 v0.0.0-20200902213428-5d25da1a8d43 // indirect
 	golang.org/x/sys v0.34.0 // indirect
-	golang.org/x/text v0.27.0 // indirect
+	golang.org/x/text v0.34.0 // indirect
 	google.golang.org/appengine v1.6.6 // indirect
 	google.golang.org/protobuf v1.36.6 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github/sabt-dev/realtimeChat/importer"
+	"github/sabt-dev/realtimeChat/models"
+	"github/sabt-dev/realtimeChat/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseTimeParam accepts either an RFC 3339 timestamp or a plain date (YYYY-MM-DD)
+func parseTimeParam(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// GetAuditLogs returns a filtered, paginated view of the audit log (admin only)
+func GetAuditLogs(c *gin.Context) {
+	var filter models.AuditLogFilter
+
+	if actorIDStr := c.Query("actor_id"); actorIDStr != "" {
+		actorID, err := strconv.ParseUint(actorIDStr, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid actor_id"})
+			return
+		}
+		id := uint(actorID)
+		filter.ActorID = &id
+	}
+
+	if roomIDStr := c.Query("room_id"); roomIDStr != "" {
+		roomID, err := strconv.ParseUint(roomIDStr, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid room_id"})
+			return
+		}
+		id := uint(roomID)
+		filter.RoomID = &id
+	}
+
+	filter.Action = c.Query("action")
+	filter.TargetType = c.Query("target_type")
+	filter.TargetID = c.Query("target_id")
+
+	if since := c.Query("since"); since != "" {
+		t, err := parseTimeParam(since)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid since, expected RFC 3339 or YYYY-MM-DD"})
+			return
+		}
+		filter.Since = t
+	}
+	if until := c.Query("until"); until != "" {
+		t, err := parseTimeParam(until)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid until, expected RFC 3339 or YYYY-MM-DD"})
+			return
+		}
+		filter.Until = t
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil {
+		limit = 50
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil {
+		offset = 0
+	}
+	// Echo the page that is actually served
+	limit, offset = services.ClampAuditLogPage(limit, offset)
+
+	auditService := services.NewAuditService()
+	entries, total, err := auditService.ListAuditLogs(filter, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entries": entries,
+		"total":   total,
+		"limit":   limit,
+		"offset":  offset,
+	})
+}
+
+// ImportArchive imports a Slack workspace export zip or a Discord JSON export (admin only).
+// Expects a multipart form with a "source" field ("slack" or "discord") and the archive as "file".
+func ImportArchive(c *gin.Context) {
+	dbUser, ok := currentDBUser(c)
+	if !ok {
+		return
+	}
+
+	source := c.PostForm("source")
+	if source != importer.SourceSlack && source != importer.SourceDiscord {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "source must be slack or discord"})
+		return
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No archive uploaded"})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read archive"})
+		return
+	}
+	defer file.Close()
+
+	archive, err := importer.Parse(source, file, header.Size)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	importService := services.NewImportService().WithClientIP(c.ClientIP())
+	report, err := importService.Import(archive, &dbUser.ID)
+	if err != nil {
+		log.Printf("Import of %s archive %s failed: %v", source, header.Filename, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Import failed", "report": report})
+		return
+	}
+
+	log.Printf("Imported %s archive %s: %d messages, %d skipped", source, header.Filename, report.MessagesImported, report.SkippedTotal)
+	c.JSON(http.StatusOK, report)
+}
+
+// SweepUploads removes stored files that no message uses and that are older
+// than the grace period, and reports the space reclaimed (admin only). With
+// ?dry_run=true the orphaned files are only counted.
+func SweepUploads(c *gin.Context) {
+	dbUser, ok := currentDBUser(c)
+	if !ok {
+		return
+	}
+	dryRun := c.Query("dry_run") == "true"
+
+	uploadService := services.NewUploadService().WithClientIP(c.ClientIP())
+	report, err := uploadService.SweepUploads(&dbUser.ID, dryRun)
+	if err != nil {
+		log.Printf("Upload sweep failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Upload sweep failed"})
+		return
+	}
+
+	log.Printf("Upload sweep by %s: %d of %d files orphaned, %d bytes (dry run: %t)", dbUser.Email, report.Removed, report.Scanned, report.ReclaimedBytes, dryRun)
+	c.JSON(http.StatusOK, report)
+}
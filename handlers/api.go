@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -63,31 +64,39 @@ func GetRooms(c *gin.Context) {
 			clientCount = len(activeRoom)
 		}
 
-		// Determine if current user is creator of this room (for DB-backed rooms with numeric ID)
+		// Determine if current user is creator or moderator of this room (for DB-backed rooms with numeric ID)
 		isCreator := false
+		isModerator := false
 		switch idVal := dbRoom["id"].(type) {
 		case uint:
 			if okRoom, err := roomService.IsRoomCreator(dbUser.ID, idVal); err == nil {
 				isCreator = okRoom
 			}
+			if okRoom, err := roomService.IsRoomModerator(dbUser.ID, idVal); err == nil {
+				isModerator = okRoom
+			}
 		case int:
 			if idVal >= 0 {
 				if okRoom, err := roomService.IsRoomCreator(dbUser.ID, uint(idVal)); err == nil {
 					isCreator = okRoom
 				}
+				if okRoom, err := roomService.IsRoomModerator(dbUser.ID, uint(idVal)); err == nil {
+					isModerator = okRoom
+				}
 			}
 		}
 
 		rooms = append(rooms, gin.H{
-			"id":          dbRoom["id"],
-			"name":        roomName,
-			"description": dbRoom["description"],
-			"clients":     clientNames,
-			"count":       clientCount,
-			"memberCount": dbRoom["memberCount"], // Total members from DB
-			"is_private":  dbRoom["is_private"],
-			"creator_id":  dbRoom["creator_id"],
-			"is_creator":  isCreator,
+			"id":           dbRoom["id"],
+			"name":         roomName,
+			"description":  dbRoom["description"],
+			"clients":      clientNames,
+			"count":        clientCount,
+			"memberCount":  dbRoom["memberCount"], // Total members from DB
+			"is_private":   dbRoom["is_private"],
+			"creator_id":   dbRoom["creator_id"],
+			"is_creator":   isCreator,
+			"is_moderator": isModerator,
 		})
 	}
 
@@ -173,36 +182,60 @@ func GetRoomMessages(c *gin.Context) {
 		return
 	}
 
-	// Parse pagination parameters
-	limitStr := c.DefaultQuery("limit", "50")
-	offsetStr := c.DefaultQuery("offset", "0")
-
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil {
-		limit = 50
+	// Parse pagination parameters: at most one of before/after/around (message UUIDs)
+	query := models.MessageHistoryQuery{
+		Before: c.Query("before"),
+		After:  c.Query("after"),
+		Around: c.Query("around"),
+	}
+	cursors := 0
+	for _, cursor := range []string{query.Before, query.After, query.Around} {
+		if cursor != "" {
+			cursors++
+		}
+	}
+	if cursors > 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Use only one of before, after or around"})
+		return
 	}
 
-	offset, err := strconv.Atoi(offsetStr)
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
 	if err != nil {
-		offset = 0
+		limit = 50
 	}
+	query.Limit = limit
 
 	messageService := services.NewMessageService()
-	messages, err := messageService.GetRoomMessages(roomName, limit, offset)
+	page, err := messageService.GetRoomMessages(roomName, query)
 	if err != nil {
+		if errors.Is(err, services.ErrHistoryCursorNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Cursor message not found in this room"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch messages"})
 		return
 	}
 
-	// Convert messages to response format
-	var messageResponses []interface{}
-	for _, msg := range messages {
-		messageResponses = append(messageResponses, msg.ToResponse())
+	// Convert messages to response format (oldest first within the page)
+	messageResponses := make([]models.MessageResponse, 0, len(page.Messages))
+	for _, msg := range page.Messages {
+		messageResponses = append(messageResponses, messageResponse(&msg))
+	}
+
+	// has_more refers to the direction being paged: older messages unless paging forward
+	hasMore := page.HasMoreBefore
+	if query.After != "" {
+		hasMore = page.HasMoreAfter
+	} else if query.Around != "" {
+		hasMore = page.HasMoreBefore || page.HasMoreAfter
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"room":     roomName,
-		"messages": messageResponses,
+		"room":            roomName,
+		"messages":        messageResponses,
+		"has_more":        hasMore,
+		"has_more_before": page.HasMoreBefore,
+		"has_more_after":  page.HasMoreAfter,
 	})
 }
 
@@ -246,6 +279,10 @@ func CreatePrivateRoom(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user data"})
 		return
 	}
+	if user.IsBot() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Bots cannot create rooms"})
+		return
+	}
 
 	var req models.CreatePrivateRoomRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -266,7 +303,7 @@ func CreatePrivateRoom(c *gin.Context) {
 	}
 
 	userService := services.NewUserService()
-	roomService := services.NewRoomService()
+	roomService := services.NewRoomService().WithClientIP(c.ClientIP())
 
 	// Get creator user from database
 	creator, err := userService.CreateOrGetUser(user.Name, user.Email, user.Avatar)
@@ -341,6 +378,10 @@ func CreatePublicRoom(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user data"})
 		return
 	}
+	if user.IsBot() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Bots cannot create rooms"})
+		return
+	}
 
 	var req struct {
 		RoomName string `json:"roomName" binding:"required"`
@@ -357,7 +398,7 @@ func CreatePublicRoom(c *gin.Context) {
 		return
 	}
 
-	roomService := services.NewRoomService()
+	roomService := services.NewRoomService().WithClientIP(c.ClientIP())
 	userService := services.NewUserService()
 	// Get creator db user
 	creator, err := userService.CreateOrGetUser(user.Name, user.Email, user.Avatar)
@@ -416,7 +457,7 @@ func DeleteRoom(c *gin.Context) {
 	}
 
 	userService := services.NewUserService()
-	roomService := services.NewRoomService()
+	roomService := services.NewRoomService().WithClientIP(c.ClientIP())
 
 	// Get DB user to access numeric ID
 	dbUser, err := userService.CreateOrGetUser(user.Name, user.Email, user.Avatar)
@@ -436,3 +477,109 @@ func DeleteRoom(c *gin.Context) {
 	// Broadcast update
 	go broadcastRoomUpdate("")
 }
+
+// GetModerationLog returns the moderation actions recorded for a room (creators and moderators only)
+func GetModerationLog(c *gin.Context) {
+	roomName := c.Param("room")
+
+	userInterface, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+	user, ok := userInterface.(*middleware.SessionUser)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user data"})
+		return
+	}
+
+	userService := services.NewUserService()
+	roomService := services.NewRoomService()
+
+	dbUser, err := userService.CreateOrGetUser(user.Name, user.Email, user.Avatar)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+
+	room, err := roomService.GetRoomByName(roomName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+
+	isModerator, err := roomService.IsRoomModerator(dbUser.ID, room.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify moderator"})
+		return
+	}
+	if !isModerator {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only room moderators can view the moderation log"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil {
+		limit = 50
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil {
+		offset = 0
+	}
+
+	actions, err := roomService.GetModerationActions(room.ID, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch moderation log"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"room":    room.Name,
+		"actions": actions,
+	})
+}
+
+// SetRoomMemberRole makes a member of a room a moderator or takes the role
+// back (room creator only). Expects {"role": "moderator"} or {"role": "member"}.
+func SetRoomMemberRole(c *gin.Context) {
+	dbUser, ok := currentDBUser(c)
+	if !ok {
+		return
+	}
+	roomID, ok := parseIDParam(c, "roomId")
+	if !ok {
+		return
+	}
+	userID, ok := parseIDParam(c, "userId")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role is required"})
+		return
+	}
+
+	roomService := services.NewRoomService().WithClientIP(c.ClientIP())
+	room, err := roomService.GetRoomByID(roomID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+	if err := roomService.SetMemberRole(room.ID, dbUser.ID, userID, req.Role); err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidRole):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrNotRoomMember):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "user_id": userID, "role": req.Role})
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github/sabt-dev/realtimeChat/middleware"
+	"github/sabt-dev/realtimeChat/models"
+	"github/sabt-dev/realtimeChat/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// currentDBUser resolves the authenticated session user to its database row.
+// It writes the error response itself and returns false on failure.
+func currentDBUser(c *gin.Context) (*models.User, bool) {
+	userInterface, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return nil, false
+	}
+	user, ok := userInterface.(*middleware.SessionUser)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user data"})
+		return nil, false
+	}
+
+	dbUser, err := services.NewUserService().CreateOrGetUser(user.Name, user.Email, user.Avatar)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return nil, false
+	}
+	return dbUser, true
+}
+
+// GetBookmarks lists the current user's bookmarks across all rooms they can still access
+func GetBookmarks(c *gin.Context) {
+	dbUser, ok := currentDBUser(c)
+	if !ok {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil {
+		limit = 50
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil {
+		offset = 0
+	}
+
+	// Echo the page that is actually served
+	limit, offset = services.ClampBookmarkPage(limit, offset)
+
+	bookmarks, total, err := services.NewBookmarkService().GetUserBookmarks(dbUser.ID, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch bookmarks"})
+		return
+	}
+
+	bookmarkResponses := make([]models.BookmarkResponse, 0, len(bookmarks))
+	for _, bookmark := range bookmarks {
+		response := bookmark.ToResponse()
+		signMediaURLs(&response.Message)
+		bookmarkResponses = append(bookmarkResponses, response)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"bookmarks": bookmarkResponses,
+		"total":     total,
+		"limit":     limit,
+		"offset":    offset,
+	})
+}
+
+// SaveBookmark bookmarks a message, or updates the note of an existing bookmark
+func SaveBookmark(c *gin.Context) {
+	var req struct {
+		MessageID string `json:"messageId" binding:"required"`
+		Note      string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	dbUser, ok := currentDBUser(c)
+	if !ok {
+		return
+	}
+
+	bookmark, err := services.NewBookmarkService().SaveBookmark(dbUser.ID, req.MessageID, req.Note)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := bookmark.ToResponse()
+	signMediaURLs(&response.Message)
+	c.JSON(http.StatusOK, gin.H{"bookmark": response})
+}
+
+// DeleteBookmark removes the current user's bookmark of a message
+func DeleteBookmark(c *gin.Context) {
+	dbUser, ok := currentDBUser(c)
+	if !ok {
+		return
+	}
+
+	if err := services.NewBookmarkService().RemoveBookmark(dbUser.ID, c.Param("uuid")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Bookmark removed"})
+}
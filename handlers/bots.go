@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github/sabt-dev/realtimeChat/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+)
+
+// parseIDParam parses a numeric path parameter, writing a 400 response on failure
+func parseIDParam(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// GetBots lists the bot accounts that room creators can allow into their rooms
+func GetBots(c *gin.Context) {
+	if _, ok := currentDBUser(c); !ok {
+		return
+	}
+
+	bots, err := services.NewBotService().ListBots(false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch bots"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"bots": bots})
+}
+
+// GetRoomBots lists the bots allowed in a room
+func GetRoomBots(c *gin.Context) {
+	roomName := c.Param("room")
+
+	dbUser, ok := currentDBUser(c)
+	if !ok {
+		return
+	}
+
+	roomService := services.NewRoomService()
+	canAccess, err := roomService.CanUserAccessRoom(dbUser.ID, roomName)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify room access"})
+		return
+	}
+	if !canAccess {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied to this room"})
+		return
+	}
+
+	room, err := roomService.GetRoomByName(roomName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+
+	bots, err := services.NewBotService().GetRoomBots(room.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch room bots"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"room": room.Name, "bots": bots})
+}
+
+// AllowRoomBot adds a bot to a room's allowlist (room creator only)
+func AllowRoomBot(c *gin.Context) {
+	dbUser, ok := currentDBUser(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		BotID uint `json:"botId" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "botId is required"})
+		return
+	}
+
+	room, err := services.NewRoomService().GetRoomByName(c.Param("room"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+
+	botService := services.NewBotService().WithClientIP(c.ClientIP())
+	if err := botService.AllowBotInRoom(room.ID, req.BotID, dbUser.ID); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	bots, err := botService.GetRoomBots(room.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch room bots"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"room": room.Name, "bots": bots})
+}
+
+// RemoveRoomBot removes a bot from a room's allowlist and disconnects it from the room (room creator only)
+func RemoveRoomBot(c *gin.Context) {
+	dbUser, ok := currentDBUser(c)
+	if !ok {
+		return
+	}
+	roomID, ok := parseIDParam(c, "roomId")
+	if !ok {
+		return
+	}
+	botID, ok := parseIDParam(c, "botId")
+	if !ok {
+		return
+	}
+
+	room, err := services.NewRoomService().GetRoomByID(roomID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+
+	botService := services.NewBotService().WithClientIP(c.ClientIP())
+	if err := botService.RemoveBotFromRoom(room.ID, botID, dbUser.ID); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	disconnectUserFromRoom(room.Name, botID)
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// disconnectUserFromRoom closes the user's connections to a room; their read
+// loops then unregister them as usual
+func disconnectUserFromRoom(roomName string, userID uint) {
+	chatHub.mutex.RLock()
+	defer chatHub.mutex.RUnlock()
+
+	for _, client := range chatHub.rooms[roomName] {
+		if client.UserID != userID {
+			continue
+		}
+		if conn, ok := client.Conn.(*websocket.Conn); ok {
+			log.Printf("Disconnecting %s (ID: %d) from room %s", client.Name, client.UserID, roomName)
+			conn.Close()
+		}
+	}
+}
+
+// disconnectUser closes the user's connections to every room
+func disconnectUser(userID uint) {
+	chatHub.mutex.RLock()
+	defer chatHub.mutex.RUnlock()
+
+	for roomName, clients := range chatHub.rooms {
+		for _, client := range clients {
+			if client.UserID != userID {
+				continue
+			}
+			if conn, ok := client.Conn.(*websocket.Conn); ok {
+				log.Printf("Disconnecting %s (ID: %d) from room %s", client.Name, client.UserID, roomName)
+				conn.Close()
+			}
+		}
+	}
+}
+
+// AdminListBots lists all bot accounts with their tokens (admin only)
+func AdminListBots(c *gin.Context) {
+	bots, err := services.NewBotService().ListBots(true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch bots"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"bots": bots})
+}
+
+// AdminCreateBot creates a bot account and returns its first token (admin only).
+// The token is only shown in this response.
+func AdminCreateBot(c *gin.Context) {
+	dbUser, ok := currentDBUser(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name   string `json:"name" binding:"required"`
+		Avatar string `json:"avatar"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+
+	bot, token, err := services.NewBotService().WithClientIP(c.ClientIP()).CreateBot(req.Name, req.Avatar, dbUser.ID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"bot": bot.ToBotResponse(), "token": token})
+}
+
+// AdminCreateBotToken issues an additional token for a bot (admin only)
+func AdminCreateBotToken(c *gin.Context) {
+	dbUser, ok := currentDBUser(c)
+	if !ok {
+		return
+	}
+	botID, ok := parseIDParam(c, "botId")
+	if !ok {
+		return
+	}
+
+	// The body is optional; it only carries a label for the token
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	record, token, err := services.NewBotService().WithClientIP(c.ClientIP()).CreateToken(botID, req.Name, dbUser.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"token": token, "details": record})
+}
+
+// AdminRevokeBotToken revokes a bot token and closes the bot's connections (admin only)
+func AdminRevokeBotToken(c *gin.Context) {
+	dbUser, ok := currentDBUser(c)
+	if !ok {
+		return
+	}
+	tokenID, ok := parseIDParam(c, "tokenId")
+	if !ok {
+		return
+	}
+
+	record, err := services.NewBotService().WithClientIP(c.ClientIP()).RevokeToken(tokenID, dbUser.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Connections are only authenticated when they open; the bot reconnects
+	// with another token if it still has one
+	disconnectUser(record.BotID)
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
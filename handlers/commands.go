@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github/sabt-dev/realtimeChat/models"
+	"github/sabt-dev/realtimeChat/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+)
+
+// runSlashCommand runs a command typed by a client and applies its result:
+// ephemeral replies go to that client only, posted messages to the whole room
+func runSlashCommand(client *models.Client, room *models.Room, name, args string) {
+	user, err := services.NewUserService().GetUserByID(client.UserID)
+	if err != nil {
+		log.Printf("Error getting user %d for command /%s: %v", client.UserID, name, err)
+		return
+	}
+
+	commandService := services.NewCommandService().WithClientIP(client.IP)
+	result, err := commandService.Execute(&services.CommandContext{User: user, Room: room, Name: name, Args: args})
+	if err != nil {
+		log.Printf("Command /%s by %s failed: %v", name, client.Name, err)
+		reply := err.Error()
+		if r, size := utf8.DecodeRuneInString(reply); r != utf8.RuneError {
+			reply = string(unicode.ToUpper(r)) + reply[size:]
+		}
+		sendEphemeral(client, reply)
+		return
+	}
+
+	log.Printf("Command /%s run by %s in room %s", name, client.Name, room.Name)
+
+	if result.Ephemeral != "" {
+		sendEphemeral(client, result.Ephemeral)
+	}
+	for _, message := range result.Messages {
+		response := messageResponse(message)
+		chatHub.broadcast <- &response
+	}
+	if result.Kicked != nil {
+		disconnectUserFromRoom(room.Name, result.Kicked.ID)
+	}
+}
+
+// sendEphemeral sends a notice that only this client sees; it is not stored
+func sendEphemeral(client *models.Client, text string) {
+	sendToClient(client, &models.MessageResponse{
+		ID:        uuid.New().String(),
+		Sender:    "System",
+		Room:      client.Room,
+		Text:      text,
+		Timestamp: time.Now(),
+		Type:      "ephemeral",
+	})
+}
+
+// sendToClient writes a single frame to one client's connection
+func sendToClient(client *models.Client, v interface{}) {
+	messageBytes, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Error marshaling message for client %s: %v", client.Name, err)
+		return
+	}
+	if conn, ok := client.Conn.(*websocket.Conn); ok {
+		// Use mutex to prevent concurrent writes to the same WebSocket connection
+		client.Mutex.Lock()
+		err := conn.WriteMessage(websocket.TextMessage, messageBytes)
+		client.Mutex.Unlock()
+
+		if err != nil {
+			log.Printf("Error sending message to client %s: %v", client.Name, err)
+		}
+	}
+}
+
+// GetRoomCommands lists the slash commands the caller can use in a room, for autocomplete.
+// An optional prefix parameter narrows the list, e.g. ?prefix=to
+func GetRoomCommands(c *gin.Context) {
+	roomName := c.Param("room")
+
+	dbUser, ok := currentDBUser(c)
+	if !ok {
+		return
+	}
+
+	roomService := services.NewRoomService()
+	canAccess, err := roomService.CanUserAccessRoom(dbUser.ID, roomName)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify room access"})
+		return
+	}
+	if !canAccess {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied to this room"})
+		return
+	}
+
+	room, err := roomService.GetRoomByName(roomName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+
+	commands, err := services.NewCommandService().AvailableCommands(room.ID, dbUser.ID, c.Query("prefix"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch commands"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"room": room.Name, "commands": commands})
+}
+
+// currentBot returns the calling bot account, rejecting human users
+func currentBot(c *gin.Context) (*models.User, bool) {
+	dbUser, ok := currentDBUser(c)
+	if !ok {
+		return nil, false
+	}
+	if !dbUser.IsBot {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only bot accounts can manage commands"})
+		return nil, false
+	}
+	return dbUser, true
+}
+
+// GetBotCommands lists the calling bot's registered commands (bots only)
+func GetBotCommands(c *gin.Context) {
+	bot, ok := currentBot(c)
+	if !ok {
+		return
+	}
+
+	commands, err := services.NewCommandService().ListBotCommands(bot.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch commands"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"commands": commands})
+}
+
+// RegisterBotCommand creates or updates one of the calling bot's commands (bots only).
+// The signing secret is only returned when the command is first registered.
+func RegisterBotCommand(c *gin.Context) {
+	bot, ok := currentBot(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Description string `json:"description"`
+		Usage       string `json:"usage"`
+		URL         string `json:"url" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "url is required"})
+		return
+	}
+
+	commandService := services.NewCommandService().WithClientIP(c.ClientIP())
+	command, secret, err := commandService.RegisterBotCommand(bot.ID, c.Param("name"), req.Description, req.Usage, req.URL)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if secret == "" {
+		c.JSON(http.StatusOK, gin.H{"command": command})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"command": command, "secret": secret})
+}
+
+// DeleteBotCommand removes one of the calling bot's commands (bots only)
+func DeleteBotCommand(c *gin.Context) {
+	bot, ok := currentBot(c)
+	if !ok {
+		return
+	}
+
+	if err := services.NewCommandService().DeleteBotCommand(bot.ID, c.Param("name")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github/sabt-dev/realtimeChat/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// unsafeFileNameChars matches characters replaced in export file names
+var unsafeFileNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// ExportRoom streams a room's full history as JSON, CSV or a self-contained HTML page.
+// Only the room's creator and members may export it.
+func ExportRoom(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	contentType, ok := services.ExportFormats[format]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json, csv or html"})
+		return
+	}
+
+	dbUser, ok := currentDBUser(c)
+	if !ok {
+		return
+	}
+
+	room, err := services.NewRoomService().GetRoomByName(c.Param("room"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+
+	exportService := services.NewExportService().WithClientIP(c.ClientIP())
+	canExport, err := exportService.CanExportRoom(dbUser.ID, room.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify room membership"})
+		return
+	}
+	if !canExport {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only room members can export its history"})
+		return
+	}
+
+	fileName := fmt.Sprintf("%s-%s.%s", unsafeFileNameChars.ReplaceAllString(room.Name, "_"), time.Now().UTC().Format("20060102"), format)
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileName))
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+
+	// Headers are already sent, so a failure part-way can only be logged
+	if err := exportService.ExportRoom(c.Writer, room.ID, dbUser.ID, format); err != nil {
+		log.Printf("Export of room %s failed: %v", room.Name, err)
+	}
+}
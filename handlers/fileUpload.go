@@ -1,17 +1,26 @@
 package handlers
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"mime"
 	"net/http"
 	"os"
-	"path/filepath"
+	"path"
 	"strings"
 	"time"
 
+	"github/sabt-dev/realtimeChat/media"
+	"github/sabt-dev/realtimeChat/middleware"
+	"github/sabt-dev/realtimeChat/models"
+	"github/sabt-dev/realtimeChat/services"
+	"github/sabt-dev/realtimeChat/storage"
+
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 )
 
 // FileUploadResponse represents the response after file upload
@@ -19,16 +28,47 @@ type FileUploadResponse struct {
 	Success  bool   `json:"success"`
 	FileURL  string `json:"fileUrl,omitempty"`
 	FileName string `json:"fileName,omitempty"`
-	FileType string `json:"fileType,omitempty"`
+	FileType string `json:"fileType,omitempty"` // "image", "video", "audio" or "file"
+	MimeType string `json:"mimeType,omitempty"`
+	Size     int64  `json:"size,omitempty"`
 	Error    string `json:"error,omitempty"`
+
+	// Image details, so the client can reserve space before the image loads
+	Width      int                     `json:"width,omitempty"`
+	Height     int                     `json:"height,omitempty"`
+	Blurhash   string                  `json:"blurhash,omitempty"`
+	Thumbnails []models.MediaThumbnail `json:"thumbnails,omitempty"`
+
+	// Voice recording details, so the client can draw a scrubber without downloading the file
+	Duration float64 `json:"duration,omitempty"` // Seconds
+	Waveform []int   `json:"waveform,omitempty"` // Levels from 0 to 100
+}
+
+// maxUploadSize is the largest file accepted, whole or resumable
+const maxUploadSize = 50 * 1024 * 1024 // 50MB
+
+// signedURLExpiry is how long the URLs ServeUpload redirects to stay valid
+const signedURLExpiry = 15 * time.Minute
+
+// uploadPolicy returns the allowlist and denylist of upload types, from
+// UPLOAD_ALLOWED_TYPES and UPLOAD_DENIED_TYPES or their defaults
+func uploadPolicy() *media.Policy {
+	allowed := os.Getenv("UPLOAD_ALLOWED_TYPES")
+	if allowed == "" {
+		allowed = media.DefaultAllowedTypes
+	}
+	denied, ok := os.LookupEnv("UPLOAD_DENIED_TYPES")
+	if !ok {
+		denied = media.DefaultDeniedTypes
+	}
+	return media.NewPolicy(allowed, denied)
 }
 
-// HandleFileUpload handles file uploads for chat media
+// HandleFileUpload handles file uploads for chat media and attachments
 func HandleFileUpload(c *gin.Context) {
 	// Check authentication
-	_, exists := c.Get("user")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+	dbUser, ok := currentDBUser(c)
+	if !ok {
 		return
 	}
 
@@ -44,31 +84,8 @@ func HandleFileUpload(c *gin.Context) {
 	}
 	defer file.Close()
 
-	// Validate file type
-	allowedTypes := map[string]bool{
-		"image/jpeg": true,
-		"image/jpg":  true,
-		"image/png":  true,
-		"image/gif":  true,
-		"image/webp": true,
-		"video/mp4":  true,
-		"video/webm": true,
-		"video/mov":  true,
-		"video/avi":  true,
-	}
-
-	contentType := header.Header.Get("Content-Type")
-	if !allowedTypes[contentType] {
-		c.JSON(http.StatusBadRequest, FileUploadResponse{
-			Success: false,
-			Error:   "File type not supported. Only images (JPEG, PNG, GIF, WebP) and videos (MP4, WebM, MOV, AVI) are allowed",
-		})
-		return
-	}
-
 	// Validate file size (50MB limit)
-	const maxFileSize = 50 * 1024 * 1024 // 50MB
-	if header.Size > maxFileSize {
+	if header.Size > maxUploadSize {
 		c.JSON(http.StatusBadRequest, FileUploadResponse{
 			Success: false,
 			Error:   "File too large. Maximum size is 50MB",
@@ -76,59 +93,259 @@ func HandleFileUpload(c *gin.Context) {
 		return
 	}
 
-	// Create uploads directory if it doesn't exist
-	uploadsDir := "uploads"
-	if err := os.MkdirAll(uploadsDir, 0755); err != nil {
-		log.Printf("Error creating uploads directory: %v", err)
+	storeUpload(c, dbUser.ID, file, header.Filename, header.Header.Get("Content-Type"))
+}
+
+// storeUpload checks, processes and stores an uploaded file, then writes the
+// FileUploadResponse. It returns the recorded upload, or nil when an error
+// response was written instead. The flag reports whether the file itself was
+// refused, as opposed to a failure on the server that may succeed on retry.
+func storeUpload(c *gin.Context, uploaderID uint, file io.Reader, fileName, declaredType string) (*models.Upload, bool) {
+	// Identify the file from its content rather than the Content-Type and
+	// extension chosen by the client
+	head := make([]byte, media.SniffLength)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		log.Printf("Error reading uploaded file: %v", err)
 		c.JSON(http.StatusInternalServerError, FileUploadResponse{
 			Success: false,
-			Error:   "Failed to create upload directory",
+			Error:   "Failed to read file",
 		})
-		return
+		return nil, false
 	}
+	head = head[:n]
 
-	// Generate unique filename
-	ext := filepath.Ext(header.Filename)
-	fileName := fmt.Sprintf("%s_%d%s", uuid.New().String(), time.Now().Unix(), ext)
-	filePath := filepath.Join(uploadsDir, fileName)
+	fileType := media.Sniff(head, fileName)
+	content := io.MultiReader(bytes.NewReader(head), file)
 
-	// Create the file
-	dst, err := os.Create(filePath)
-	if err != nil {
-		log.Printf("Error creating file: %v", err)
-		c.JSON(http.StatusInternalServerError, FileUploadResponse{
+	// WebM and Ogg files are read whole to tell voice recordings from other
+	// media and probe their duration and waveform
+	var audio *media.AudioInfo
+	if media.MayBeVoice(fileType) {
+		data, err := io.ReadAll(io.LimitReader(content, maxUploadSize))
+		if err != nil {
+			log.Printf("Error reading uploaded file: %v", err)
+			c.JSON(http.StatusInternalServerError, FileUploadResponse{
+				Success: false,
+				Error:   "Failed to read file",
+			})
+			return nil, false
+		}
+		if info, err := media.ProbeAudio(data); err == nil {
+			audio = info
+			fileType = info.Type
+		} else if !errors.Is(err, media.ErrNotVoice) {
+			log.Printf("Could not probe audio in %s: %v", fileName, err)
+		}
+		content = bytes.NewReader(data)
+	}
+
+	if !uploadPolicy().Allows(fileType, fileName) {
+		log.Printf("Rejected upload %s: %s is not allowed", fileName, fileType.MIMEType)
+		c.JSON(http.StatusBadRequest, FileUploadResponse{
 			Success: false,
-			Error:   "Failed to save file",
+			Error:   "File type not allowed",
 		})
-		return
+		return nil, true
+	}
+	if declared := declaredType; !media.MatchesDeclaredType(declared, fileType) {
+		log.Printf("Rejected upload %s: declared as %s but contains %s", fileName, declared, fileType.MIMEType)
+		c.JSON(http.StatusBadRequest, FileUploadResponse{
+			Success: false,
+			Error:   "File content does not match its type",
+		})
+		return nil, true
+	}
+	upload := &models.Upload{
+		UploaderID:  uploaderID,
+		FileName:    fileName,
+		ContentType: fileType.MIMEType,
+		MediaType:   fileType.Kind,
+	}
+	var thumbnails []media.Thumbnail
+
+	if fileType.Kind == "image" {
+		// Images are processed in memory: metadata such as GPS location is
+		// stripped, and thumbnails and a placeholder are made for the timeline
+		data, err := io.ReadAll(io.LimitReader(content, maxUploadSize))
+		if err != nil {
+			log.Printf("Error reading uploaded image: %v", err)
+			c.JSON(http.StatusInternalServerError, FileUploadResponse{
+				Success: false,
+				Error:   "Failed to read file",
+			})
+			return nil, false
+		}
+
+		processed, err := media.ProcessImage(data)
+		if err != nil {
+			log.Printf("Rejected image upload %s: %v", fileName, err)
+			message := "The file is not a valid image"
+			if errors.Is(err, media.ErrImageTooLarge) {
+				message = "Image dimensions are too large"
+			}
+			c.JSON(http.StatusBadRequest, FileUploadResponse{
+				Success: false,
+				Error:   message,
+			})
+			return nil, true
+		}
+
+		content = bytes.NewReader(processed.Data)
+		thumbnails = processed.Thumbnails
+		upload.Width = processed.Width
+		upload.Height = processed.Height
+		upload.Blurhash = processed.Blurhash
 	}
-	defer dst.Close()
 
-	// Copy the uploaded file to destination
-	if _, err := io.Copy(dst, file); err != nil {
-		log.Printf("Error copying file: %v", err)
+	var waveform []int
+	if audio != nil {
+		upload.Duration = audio.Duration.Seconds()
+		waveform = audio.Waveform
+	}
+
+	// Files are stored under the hash of their content, so identical uploads share one copy
+	if err := services.NewUploadService().StoreUpload(upload, content, fileType.Ext, thumbnails, waveform); err != nil {
+		log.Printf("Error saving file: %v", err)
 		c.JSON(http.StatusInternalServerError, FileUploadResponse{
 			Success: false,
 			Error:   "Failed to save file",
 		})
+		return nil, false
+	}
+
+	log.Printf("File uploaded successfully: %s", upload.URL)
+
+	c.JSON(http.StatusOK, uploadResponse(upload))
+	return upload, false
+}
+
+// uploadResponse describes a stored upload to the client that uploaded it
+func uploadResponse(upload *models.Upload) FileUploadResponse {
+	response := FileUploadResponse{
+		Success:  true,
+		FileURL:  upload.URL,
+		FileName: upload.FileName,
+		FileType: upload.MediaType,
+		MimeType: upload.ContentType,
+		Size:     upload.Size,
+		Width:    upload.Width,
+		Height:   upload.Height,
+		Blurhash: upload.Blurhash,
+		Duration: upload.Duration,
+	}
+	if len(upload.Thumbnails) > 0 {
+		if err := json.Unmarshal(upload.Thumbnails, &response.Thumbnails); err != nil {
+			log.Printf("Error decoding thumbnails of %s: %v", upload.URL, err)
+		}
+	}
+	if len(upload.Waveform) > 0 {
+		if err := json.Unmarshal(upload.Waveform, &response.Waveform); err != nil {
+			log.Printf("Error decoding waveform of %s: %v", upload.URL, err)
+		}
+	}
+	return response
+}
+
+// ServeUpload serves a stored upload. The Content-Type is pinned to the type
+// implied by the extension the server gave the file, and browsers are told not
+// to sniff it, so uploads can never be rendered as HTML or SVG from our origin.
+// Files other than images and videos are sent as downloads under the name
+// they were uploaded with. Files are only served to users who can see them,
+// or through the signed URLs messages carry. With STORAGE_REDIRECT=true,
+// stores that can sign URLs serve the file themselves, with the same
+// Content-Type and disposition.
+func ServeUpload(c *gin.Context) {
+	name := strings.TrimPrefix(path.Clean("/"+c.Param("filepath")), "/")
+	if !storage.ValidKey(name) {
+		c.Status(http.StatusNotFound)
 		return
 	}
+	if !canAccessUpload(c, name) {
+		c.Status(http.StatusForbidden)
+		return
+	}
+	// Access depends on the user, so shared caches must not keep the file
+	c.Header("Cache-Control", "private")
 
-	// Determine file type for frontend
-	fileType := "image"
-	if strings.HasPrefix(contentType, "video/") {
-		fileType = "video"
+	fileType, ok := media.StoredFileType(name)
+	if !ok {
+		fileType = media.FileType{MIMEType: "application/octet-stream", Kind: "file"}
+	}
+	contentType := fileType.MIMEType
+	if strings.HasPrefix(contentType, "text/") {
+		contentType += "; charset=utf-8"
+	}
+	var disposition string
+	if fileType.Kind == "file" {
+		downloadName := name
+		if upload, err := services.NewUploadService().GetUploadByURL("/uploads/" + name); err == nil && upload.FileName != "" {
+			downloadName = upload.FileName
+		}
+		disposition = mime.FormatMediaType("attachment", map[string]string{"filename": downloadName})
+		if disposition == "" {
+			disposition = "attachment"
+		}
 	}
 
-	// Generate file URL
-	fileURL := fmt.Sprintf("/uploads/%s", fileName)
+	store := storage.GetStorage()
+	if os.Getenv("STORAGE_REDIRECT") == "true" {
+		signedURL, err := store.SignedURL(name, signedURLExpiry, storage.SignedURLOptions{
+			ContentType:        contentType,
+			ContentDisposition: disposition,
+		})
+		if err == nil {
+			// Browsers may reuse the redirect for a while, but not past the signature
+			c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", int(signedURLExpiry.Seconds()/2)))
+			c.Redirect(http.StatusFound, signedURL)
+			return
+		}
+		if !errors.Is(err, storage.ErrSignedURLsUnsupported) {
+			log.Printf("Error signing URL for %s: %v", name, err)
+		}
+	}
 
-	log.Printf("File uploaded successfully: %s", fileName)
+	object, err := store.Get(name)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("Error opening upload %s: %v", name, err)
+		}
+		c.Status(http.StatusNotFound)
+		return
+	}
+	defer object.Close()
 
-	c.JSON(http.StatusOK, FileUploadResponse{
-		Success:  true,
-		FileURL:  fileURL,
-		FileName: header.Filename,
-		FileType: fileType,
-	})
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Security-Policy", "default-src 'none'; sandbox")
+	c.Header("Content-Type", contentType)
+	if disposition != "" {
+		c.Header("Content-Disposition", disposition)
+	}
+	http.ServeContent(c.Writer, c.Request, name, object.ModTime, object)
+}
+
+// canAccessUpload reports whether the request may download the upload stored
+// under name: its URL carries a valid signature, or the user uploaded the
+// file or can access the room of a message it is attached to
+func canAccessUpload(c *gin.Context, name string) bool {
+	if storage.VerifyMediaURL(name, c.Query("expires"), c.Query("signature")) {
+		return true
+	}
+
+	userInterface, _ := c.Get("user")
+	user, ok := userInterface.(*middleware.SessionUser)
+	if !ok {
+		return false
+	}
+	dbUser, err := services.NewUserService().CreateOrGetUser(user.Name, user.Email, user.Avatar)
+	if err != nil {
+		log.Printf("Error getting user for upload %s: %v", name, err)
+		return false
+	}
+	allowed, err := services.NewUploadService().CanUserAccessUpload(dbUser.ID, storage.MediaURLPrefix+name)
+	if err != nil {
+		log.Printf("Error checking access to upload %s: %v", name, err)
+		return false
+	}
+	return allowed
 }
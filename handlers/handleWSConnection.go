@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -12,11 +13,17 @@ import (
 	"github/sabt-dev/realtimeChat/middleware"
 	"github/sabt-dev/realtimeChat/models"
 	"github/sabt-dev/realtimeChat/services"
+	"github/sabt-dev/realtimeChat/storage"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 )
 
+// maxFrameSize caps the websocket frames clients send. Message texts are
+// limited to services.MaxMessageLength characters; the rest leaves room for
+// JSON escaping and the other fields of a message.
+const maxFrameSize = 64 << 10
+
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		return true
@@ -68,10 +75,11 @@ func (h *Hub) run() {
 	}
 }
 
+// registerClient adds the client to its room. The hub lock only guards the
+// room map; the database work that follows (membership, join message and
+// webhook events) runs without it.
 func (h *Hub) registerClient(client *models.Client) {
 	h.mutex.Lock()
-	defer h.mutex.Unlock()
-
 	// Create room if it doesn't exist
 	if _, exists := h.rooms[client.Room]; !exists {
 		h.rooms[client.Room] = make(map[string]*models.Client)
@@ -79,13 +87,15 @@ func (h *Hub) registerClient(client *models.Client) {
 
 	// Add client to room
 	h.rooms[client.Room][client.ID] = client
+	clientCount := len(h.rooms[client.Room])
+	h.mutex.Unlock()
 
 	log.Printf("Client %s (ID: %s, UserID: %d) joined room %s", client.Name, client.ID, client.UserID, client.Room)
-	log.Printf("Room %s now has %d clients", client.Room, len(h.rooms[client.Room]))
+	log.Printf("Room %s now has %d clients", client.Room, clientCount)
 
 	// Create/get room and user in database
 	userService := services.NewUserService()
-	roomService := services.NewRoomService()
+	roomService := services.NewRoomService().WithClientIP(client.IP)
 	messageService := services.NewMessageService()
 
 	user, err := userService.GetUserByID(client.UserID)
@@ -123,7 +133,7 @@ func (h *Hub) registerClient(client *models.Client) {
 
 	// Broadcast join message
 	go func() {
-		response := joinMessage.ToResponse()
+		response := messageResponse(joinMessage)
 		chatHub.broadcast <- &response
 	}()
 
@@ -131,69 +141,75 @@ func (h *Hub) registerClient(client *models.Client) {
 	go broadcastRoomUpdate(client.Room)
 }
 
+// unregisterClient removes the client from its room, then records the leave
+// outside the hub lock
 func (h *Hub) unregisterClient(client *models.Client) {
 	h.mutex.Lock()
-	defer h.mutex.Unlock()
-
-	if room, exists := h.rooms[client.Room]; exists {
-		if _, exists := room[client.ID]; exists {
-			delete(room, client.ID)
+	room, exists := h.rooms[client.Room]
+	if exists {
+		_, exists = room[client.ID]
+	}
+	if exists {
+		delete(room, client.ID)
 
-			// Close connection
-			if conn, ok := client.Conn.(*websocket.Conn); ok {
-				conn.Close()
-			}
+		// Remove room if empty
+		if len(room) == 0 {
+			delete(h.rooms, client.Room)
+		}
+	}
+	h.mutex.Unlock()
+	if !exists {
+		return
+	}
 
-			log.Printf("Client %s left room %s", client.Name, client.Room)
+	// Close connection
+	if conn, ok := client.Conn.(*websocket.Conn); ok {
+		conn.Close()
+	}
 
-			// Create leave message in database
-			userService := services.NewUserService()
-			roomService := services.NewRoomService()
-			messageService := services.NewMessageService()
+	log.Printf("Client %s left room %s", client.Name, client.Room)
 
-			user, err := userService.GetUserByID(client.UserID)
-			if err != nil {
-				log.Printf("Error getting user %d: %v", client.UserID, err)
-			} else {
-				dbRoom, err := roomService.GetRoomByName(client.Room)
-				if err != nil {
-					log.Printf("Error getting room %s: %v", client.Room, err)
-				} else {
-					// Leave room
-					if err := roomService.LeaveRoom(user.ID, dbRoom.ID); err != nil {
-						log.Printf("Error leaving room: %v", err)
-					}
+	// Create leave message in database
+	userService := services.NewUserService()
+	roomService := services.NewRoomService().WithClientIP(client.IP)
+	messageService := services.NewMessageService()
 
-					// Create leave message
-					leaveMessage, err := messageService.CreateMessage(
-						user.ID,
-						dbRoom.ID,
-						fmt.Sprintf("%s left the room", user.Name),
-						"leave",
-						"", "", "",
-						nil, "", "", // No reply for leave messages
-					)
-					if err != nil {
-						log.Printf("Error creating leave message: %v", err)
-					} else {
-						// Broadcast leave message
-						go func() {
-							response := leaveMessage.ToResponse()
-							chatHub.broadcast <- &response
-						}()
-					}
-				}
+	user, err := userService.GetUserByID(client.UserID)
+	if err != nil {
+		log.Printf("Error getting user %d: %v", client.UserID, err)
+	} else {
+		dbRoom, err := roomService.GetRoomByName(client.Room)
+		if err != nil {
+			log.Printf("Error getting room %s: %v", client.Room, err)
+		} else {
+			// Leave room
+			if err := roomService.LeaveRoom(user.ID, dbRoom.ID); err != nil {
+				log.Printf("Error leaving room: %v", err)
 			}
 
-			// Broadcast room update to all users after user leaves
-			go broadcastRoomUpdate(client.Room)
-
-			// Remove room if empty
-			if len(room) == 0 {
-				delete(h.rooms, client.Room)
+			// Create leave message
+			leaveMessage, err := messageService.CreateMessage(
+				user.ID,
+				dbRoom.ID,
+				fmt.Sprintf("%s left the room", user.Name),
+				"leave",
+				"", "", "",
+				nil, "", "", // No reply for leave messages
+			)
+			if err != nil {
+				log.Printf("Error creating leave message: %v", err)
+			} else {
+				// Broadcast leave message
+				go func() {
+					response := messageResponse(leaveMessage)
+					chatHub.broadcast <- &response
+				}()
 			}
 		}
 	}
+
+	// Broadcast room update to all users after user leaves
+	go broadcastRoomUpdate(client.Room)
 }
 
 func (h *Hub) broadcastMessage(message *models.MessageResponse) {
@@ -295,6 +311,7 @@ func HandleWSConnection(c *gin.Context) {
 		log.Printf("Failed to upgrade connection: %v", err)
 		return
 	}
+	conn.SetReadLimit(maxFrameSize)
 
 	// Read initial join message
 	var joinReq models.JoinRoomRequest
@@ -314,11 +331,14 @@ func HandleWSConnection(c *gin.Context) {
 	}
 
 	// Check if user can access the requested room
-	roomService := services.NewRoomService()
+	roomService := services.NewRoomService().WithClientIP(c.ClientIP())
 	canAccess, err := roomService.CanUserAccessRoom(dbUser.ID, joinReq.RoomName)
 	if err != nil {
 		// If room doesn't exist and it's a potential public room, create it
-		if err.Error() == "record not found" {
+		if err.Error() == "record not found" && dbUser.IsBot {
+			// Bots cannot create rooms by joining them; they must be allowed into an existing room
+			canAccess = false
+		} else if err.Error() == "record not found" {
 			log.Printf("Room %s doesn't exist, creating as public room", joinReq.RoomName)
 			_, createErr := roomService.CreateOrGetRoom(joinReq.RoomName)
 			if createErr != nil {
@@ -355,6 +375,7 @@ func HandleWSConnection(c *gin.Context) {
 		Name:   userName,
 		Avatar: user.Avatar,
 		Room:   joinReq.RoomName,
+		IP:     c.ClientIP(),
 		Conn:   conn,
 	}
 
@@ -383,7 +404,7 @@ func handleClientMessages(client *models.Client, conn *websocket.Conn) {
 		log.Printf("Received message from client %s: %+v", client.Name, messageData)
 
 		// SECURITY: Validate room access on every message to prevent localStorage manipulation attacks
-		roomService := services.NewRoomService()
+		roomService := services.NewRoomService().WithClientIP(client.IP)
 		canAccess, err := roomService.CanUserAccessRoom(client.UserID, client.Room)
 		if err != nil {
 			log.Printf("Error checking room access for user %d and room %s: %v", client.UserID, client.Room, err)
@@ -402,7 +423,7 @@ func handleClientMessages(client *models.Client, conn *websocket.Conn) {
 			msgType = "message"
 		}
 
-		messageService := services.NewMessageService()
+		messageService := services.NewMessageService().WithClientIP(client.IP)
 
 		switch msgType {
 		case "ping":
@@ -424,33 +445,74 @@ func handleClientMessages(client *models.Client, conn *websocket.Conn) {
 				continue
 			}
 
-			// Try to delete the message (this checks ownership too)
-			if err := messageService.DeleteMessage(messageID, client.UserID); err != nil {
+			// Optional reason, recorded when a moderator removes someone else's message
+			reason, _ := messageData["reason"].(string)
+
+			// Deleting a pinned message also unpins it
+			wasPinned, _ := services.NewPinService().IsMessagePinned(messageID)
+
+			// Try to delete the message (this checks ownership or moderator rights)
+			tombstone, err := messageService.DeleteMessage(messageID, client.UserID, reason)
+			if err != nil {
 				log.Printf("Failed to delete message %s: %v", messageID, err)
 				continue
 			}
 
 			// Create delete notification message response
+			deletedBy := "sender"
+			if tombstone.RemovedByModerator() {
+				deletedBy = "moderator"
+			}
 			response := &models.MessageResponse{
-				ID:        messageID,
-				Sender:    client.Name,
-				Avatar:    client.Avatar,
-				Room:      client.Room,
-				Text:      "",
-				Timestamp: time.Now(),
-				Type:      "delete",
+				ID:           messageID,
+				Sender:       client.Name,
+				Avatar:       client.Avatar,
+				Room:         tombstone.Room.Name,
+				Text:         "",
+				Timestamp:    time.Now(),
+				Type:         "delete",
+				DeletedBy:    deletedBy,
+				DeleteReason: tombstone.DeleteReason,
 			}
 
-			log.Printf("Message %s deleted by %s", messageID, client.Name)
+			log.Printf("Message %s deleted by %s (%s)", messageID, client.Name, deletedBy)
 
 			// Broadcast delete notification
 			go func() {
 				chatHub.broadcast <- response
+				if wasPinned {
+					broadcastPinUpdate(&tombstone.Room)
+				}
 			}()
 
+		case "pin", "unpin":
+			// Handle pinning and unpinning (moderators only)
+			messageID, ok := messageData["messageId"].(string)
+			if !ok || messageID == "" {
+				log.Printf("Invalid %s request from %s: missing messageId", msgType, client.Name)
+				continue
+			}
+
+			pinService := services.NewPinService().WithClientIP(client.IP)
+			var room *models.Room
+			if msgType == "pin" {
+				room, err = pinService.PinMessage(messageID, client.UserID)
+			} else {
+				room, err = pinService.UnpinMessage(messageID, client.UserID)
+			}
+			if err != nil {
+				log.Printf("Failed to %s message %s: %v", msgType, messageID, err)
+				continue
+			}
+
+			log.Printf("Message %s %sned by %s", messageID, msgType, client.Name)
+
+			go broadcastPinUpdate(room)
+
 		case "media":
 			// Handle media message
 			mediaURL, _ := messageData["mediaUrl"].(string)
+			mediaURL = storage.UnsignedMediaURL(mediaURL) // Clients may send back a URL they were given signed
 			mediaType, _ := messageData["mediaType"].(string)
 			fileName, _ := messageData["fileName"].(string)
 			text, _ := messageData["text"].(string) // Get optional text with media
@@ -459,6 +521,10 @@ func handleClientMessages(client *models.Client, conn *websocket.Conn) {
 				log.Printf("Invalid media message from %s: missing mediaUrl", client.Name)
 				continue
 			}
+			if mediaType != "image" && mediaType != "video" && mediaType != "audio" && mediaType != "file" {
+				log.Printf("Invalid media message from %s: unknown mediaType %q", client.Name, mediaType)
+				continue
+			}
 
 			// Get room
 			room, err := roomService.GetRoomByName(client.Room)
@@ -496,6 +562,19 @@ func handleClientMessages(client *models.Client, conn *websocket.Conn) {
 				fileName,
 				replyToID, replyToSender, replyToText,
 			)
+			if errors.Is(err, services.ErrUserMuted) {
+				go sendEphemeral(client, "You are muted in this room")
+				continue
+			}
+			if errors.Is(err, services.ErrMessageTooLong) {
+				go sendEphemeral(client, fmt.Sprintf("Messages can be at most %d characters", services.MaxMessageLength))
+				continue
+			}
+			if errors.Is(err, services.ErrMediaNotUploaded) {
+				log.Printf("Rejected media message from %s: %s was not uploaded by them", client.Name, mediaURL)
+				go sendEphemeral(client, "You can only share files you uploaded")
+				continue
+			}
 			if err != nil {
 				log.Printf("Error creating media message: %v", err)
 				continue
@@ -503,7 +582,7 @@ func handleClientMessages(client *models.Client, conn *websocket.Conn) {
 
 			// Broadcast message
 			go func() {
-				response := message.ToResponse()
+				response := messageResponse(message)
 				chatHub.broadcast <- &response
 			}()
 
@@ -578,7 +657,7 @@ func handleClientMessages(client *models.Client, conn *websocket.Conn) {
 
 			// Broadcast updated message with reactions
 			go func() {
-				response := updatedMessage.ToResponse()
+				response := messageResponse(updatedMessage)
 				response.Type = "reaction_update" // Special type to indicate reaction update
 				chatHub.broadcast <- &response
 			}()
@@ -598,6 +677,16 @@ func handleClientMessages(client *models.Client, conn *websocket.Conn) {
 				continue
 			}
 
+			// Slash commands go to the command registry instead of being posted;
+			// a doubled slash posts the text with a single one
+			if name, args, isCommand := services.ParseSlashCommand(text); isCommand {
+				go runSlashCommand(client, room, name, args)
+				continue
+			}
+			if trimmed := strings.TrimSpace(text); strings.HasPrefix(trimmed, "//") {
+				text = trimmed[1:]
+			}
+
 			// Handle reply information
 			var replyToID *uint
 			var replyToSender, replyToText string
@@ -625,6 +714,14 @@ func handleClientMessages(client *models.Client, conn *websocket.Conn) {
 				"", "", "",
 				replyToID, replyToSender, replyToText,
 			)
+			if errors.Is(err, services.ErrUserMuted) {
+				go sendEphemeral(client, "You are muted in this room")
+				continue
+			}
+			if errors.Is(err, services.ErrMessageTooLong) {
+				go sendEphemeral(client, fmt.Sprintf("Messages can be at most %d characters", services.MaxMessageLength))
+				continue
+			}
 			if err != nil {
 				log.Printf("Error creating message: %v", err)
 				continue
@@ -634,7 +731,7 @@ func handleClientMessages(client *models.Client, conn *websocket.Conn) {
 
 			// Broadcast message
 			go func() {
-				response := message.ToResponse()
+				response := messageResponse(message)
 				chatHub.broadcast <- &response
 			}()
 		}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github/sabt-dev/realtimeChat/models"
+	"github/sabt-dev/realtimeChat/services"
+	"github/sabt-dev/realtimeChat/storage"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxPermalinkContext caps how many messages are returned on each side of a permalink
+const maxPermalinkContext = 50
+
+// GetMessage returns a single message by ID after an access check, optionally
+// with up to context=N messages before and after it in the same room
+func GetMessage(c *gin.Context) {
+	contextSize := 0
+	if contextStr := c.Query("context"); contextStr != "" {
+		n, err := strconv.Atoi(contextStr)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid context"})
+			return
+		}
+		contextSize = min(n, maxPermalinkContext)
+	}
+
+	dbUser, ok := currentDBUser(c)
+	if !ok {
+		return
+	}
+
+	messageService := services.NewMessageService()
+	message, err := messageService.GetMessageForUser(c.Param("uuid"), dbUser.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		case errors.Is(err, services.ErrMessageAccessDenied):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied to this message"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch message"})
+		}
+		return
+	}
+
+	response := gin.H{
+		"room":    message.Room.Name,
+		"message": messageResponse(message),
+	}
+
+	if contextSize > 0 {
+		page, err := messageService.GetRoomMessages(message.Room.Name, models.MessageHistoryQuery{
+			Around: message.UUID,
+			Limit:  2*contextSize + 1,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch message context"})
+			return
+		}
+
+		before := make([]models.MessageResponse, 0, contextSize)
+		after := make([]models.MessageResponse, 0, contextSize)
+		seen := false
+		for _, msg := range page.Messages {
+			switch {
+			case msg.ID == message.ID:
+				seen = true
+			case seen:
+				after = append(after, messageResponse(&msg))
+			default:
+				before = append(before, messageResponse(&msg))
+			}
+		}
+
+		response["before"] = before
+		response["after"] = after
+		response["has_more_before"] = page.HasMoreBefore
+		response["has_more_after"] = page.HasMoreAfter
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// BroadcastMessageUpdate sends a changed message to its room as a
+// "message_update" event, e.g. once link previews have been attached
+func BroadcastMessageUpdate(message *models.Message) {
+	response := messageResponse(message)
+	response.Type = "message_update"
+	chatHub.broadcast <- &response
+}
+
+// messageResponse converts a message for browsers, signing the URLs of its
+// uploaded media so they can be loaded without a session
+func messageResponse(message *models.Message) models.MessageResponse {
+	response := message.ToResponse()
+	signMediaURLs(&response)
+	return response
+}
+
+// signMediaURLs signs the upload URLs of a message response. Webhook payloads
+// and exports carry signed absolute URLs instead.
+func signMediaURLs(response *models.MessageResponse) {
+	response.MediaURL = storage.SignMediaURL(response.MediaURL)
+	for i := range response.MediaThumbnails {
+		response.MediaThumbnails[i].URL = storage.SignMediaURL(response.MediaThumbnails[i].URL)
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github/sabt-dev/realtimeChat/models"
+	"github/sabt-dev/realtimeChat/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetRoomPins returns the pinned messages of a room in pin order
+func GetRoomPins(c *gin.Context) {
+	roomName := c.Param("room")
+
+	dbUser, ok := currentDBUser(c)
+	if !ok {
+		return
+	}
+
+	// SECURITY: Pins are part of the room's history, so apply the same access check
+	roomService := services.NewRoomService()
+	canAccess, err := roomService.CanUserAccessRoom(dbUser.ID, roomName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify room access"})
+		return
+	}
+	if !canAccess {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied to this room"})
+		return
+	}
+
+	room, err := roomService.GetRoomByName(roomName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+
+	pins, err := services.NewPinService().GetRoomPins(room.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch pinned messages"})
+		return
+	}
+
+	pinResponses := make([]models.PinnedMessageResponse, 0, len(pins))
+	for _, pin := range pins {
+		response := pin.ToResponse()
+		signMediaURLs(&response.Message)
+		pinResponses = append(pinResponses, response)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"room": room.Name,
+		"pins": pinResponses,
+	})
+}
+
+// broadcastPinUpdate sends the current pin list of a room to its clients
+func broadcastPinUpdate(room *models.Room) {
+	pins, err := services.NewPinService().GetRoomPins(room.ID)
+	if err != nil {
+		log.Printf("Failed to load pins for room %s: %v", room.Name, err)
+		return
+	}
+
+	pinResponses := make([]models.PinnedMessageResponse, 0, len(pins))
+	for _, pin := range pins {
+		response := pin.ToResponse()
+		signMediaURLs(&response.Message)
+		pinResponses = append(pinResponses, response)
+	}
+
+	// An empty pin list is omitted from the JSON; clients treat that as "no pins"
+	response := &models.MessageResponse{
+		Room:      room.Name,
+		Timestamp: time.Now(),
+		Type:      "pin_update",
+		Pins:      pinResponses,
+	}
+	chatHub.broadcast <- response
+}
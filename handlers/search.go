@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github/sabt-dev/realtimeChat/models"
+	"github/sabt-dev/realtimeChat/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SearchMessages runs a full-text search over the messages the current user can access
+func SearchMessages(c *gin.Context) {
+	filter := models.MessageSearchFilter{
+		Query:    c.Query("q"),
+		RoomName: c.Query("room"),
+		Sender:   c.Query("sender"),
+	}
+	if filter.Query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter q is required"})
+		return
+	}
+
+	if sinceStr := c.Query("since"); sinceStr != "" {
+		since, err := parseTimeParam(sinceStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid since (use RFC 3339 or YYYY-MM-DD)"})
+			return
+		}
+		filter.Since = &since
+	}
+	if untilStr := c.Query("until"); untilStr != "" {
+		until, err := parseTimeParam(untilStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid until (use RFC 3339 or YYYY-MM-DD)"})
+			return
+		}
+		filter.Until = &until
+	}
+	if hasMediaStr := c.Query("has_media"); hasMediaStr != "" {
+		hasMedia, err := strconv.ParseBool(hasMediaStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid has_media"})
+			return
+		}
+		filter.HasMedia = &hasMedia
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil {
+		limit = 20
+	}
+
+	dbUser, ok := currentDBUser(c)
+	if !ok {
+		return
+	}
+
+	results, nextCursor, err := services.NewSearchService().SearchMessages(dbUser.ID, filter, c.Query("cursor"), limit)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrSearchAccessDenied):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied to this room"})
+		case errors.Is(err, services.ErrInvalidSearchCursor):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Search failed"})
+		}
+		return
+	}
+
+	for i := range results {
+		signMediaURLs(&results[i].Message)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"results":     results,
+		"next_cursor": nextCursor,
+		"has_more":    nextCursor != "",
+	})
+}
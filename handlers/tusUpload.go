@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github/sabt-dev/realtimeChat/models"
+	"github/sabt-dev/realtimeChat/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Resumable uploads follow the tus protocol (https://tus.io/protocols/resumable-upload)
+// with the creation, expiration and termination extensions. Once the last
+// chunk arrives the file is processed like a regular upload and the final
+// PATCH answers with the same FileUploadResponse as POST /upload.
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,expiration,termination"
+	tusBasePath   = "/api/uploads/tus"
+)
+
+// setTusHeaders adds the headers every tus response carries
+func setTusHeaders(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Cache-Control", "no-store")
+}
+
+// checkTusVersion rejects requests from clients speaking another version of the protocol
+func checkTusVersion(c *gin.Context) bool {
+	setTusHeaders(c)
+	if c.GetHeader("Tus-Resumable") != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		c.AbortWithStatus(http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// setTusUploadHeaders describes the state of a resumable upload
+func setTusUploadHeaders(c *gin.Context, upload *models.TusUpload) {
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+}
+
+// parseTusMetadata decodes an Upload-Metadata header: comma-separated keys,
+// each followed by a space and a base64 value
+func parseTusMetadata(header string) (map[string]string, bool) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, false
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, true
+}
+
+// TusOptions advertises the supported protocol version, extensions and size limit
+func TusOptions(c *gin.Context) {
+	setTusHeaders(c)
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	c.Header("Tus-Max-Size", strconv.Itoa(maxUploadSize))
+	c.Status(http.StatusNoContent)
+}
+
+// CreateTusUpload starts a resumable upload. The file name and type are read
+// from the "filename" and "filetype" metadata keys.
+func CreateTusUpload(c *gin.Context) {
+	if !checkTusVersion(c) {
+		return
+	}
+	dbUser, ok := currentDBUser(c)
+	if !ok {
+		return
+	}
+
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Length must be a positive number"})
+		return
+	}
+	if length > maxUploadSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File too large. Maximum size is 50MB"})
+		return
+	}
+	metadata, ok := parseTusMetadata(c.GetHeader("Upload-Metadata"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Upload-Metadata"})
+		return
+	}
+	fileName := metadata["filename"]
+	if fileName == "" {
+		fileName = metadata["name"]
+	}
+	fileType := metadata["filetype"]
+	if fileType == "" {
+		fileType = metadata["type"]
+	}
+
+	upload, err := services.NewTusService().CreateUpload(dbUser.ID, length, fileName, fileType)
+	if errors.Is(err, services.ErrTusQuotaExceeded) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many unfinished uploads. Finish or cancel one first"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating resumable upload: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upload"})
+		return
+	}
+
+	c.Header("Location", tusBasePath+"/"+upload.ID)
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Status(http.StatusCreated)
+}
+
+// GetTusUploadOffset reports how much of a resumable upload has been received
+func GetTusUploadOffset(c *gin.Context) {
+	if !checkTusVersion(c) {
+		return
+	}
+	dbUser, ok := currentDBUser(c)
+	if !ok {
+		return
+	}
+
+	upload, err := services.NewTusService().GetUpload(c.Param("id"), dbUser.ID)
+	if err != nil {
+		c.Status(tusErrorStatus(err))
+		return
+	}
+	setTusUploadHeaders(c, upload)
+	c.Status(http.StatusOK)
+}
+
+// PatchTusUpload appends a chunk to a resumable upload. When the chunk
+// completes the upload, the file is stored and described in the response.
+func PatchTusUpload(c *gin.Context) {
+	if !checkTusVersion(c) {
+		return
+	}
+	dbUser, ok := currentDBUser(c)
+	if !ok {
+		return
+	}
+	if c.ContentType() != "application/offset+octet-stream" {
+		c.AbortWithStatus(http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	tusService := services.NewTusService()
+	unlock := services.LockUpload(c.Param("id"))
+	defer unlock()
+
+	upload, err := tusService.WriteChunk(c.Param("id"), dbUser.ID, offset, c.Request.Body)
+	if err != nil {
+		if upload != nil {
+			setTusUploadHeaders(c, upload)
+		}
+		if !errors.Is(err, services.ErrTusOffsetMismatch) && !errors.Is(err, services.ErrTusUploadNotFound) {
+			log.Printf("Error writing resumable upload %s: %v", c.Param("id"), err)
+		}
+		c.Status(tusErrorStatus(err))
+		return
+	}
+	setTusUploadHeaders(c, upload)
+
+	if upload.Offset < upload.Length {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	// The upload is complete. If storing it fails on the server, the partial
+	// file is kept and an empty PATCH at the final offset tries again.
+	file, err := os.Open(services.TusPartialPath(upload.ID))
+	if err != nil {
+		log.Printf("Error opening completed upload %s: %v", upload.ID, err)
+		c.JSON(http.StatusInternalServerError, FileUploadResponse{
+			Success: false,
+			Error:   "Failed to save file",
+		})
+		return
+	}
+	stored, refused := storeUpload(c, dbUser.ID, file, upload.FileName, upload.FileType)
+	file.Close()
+
+	if refused {
+		// The file itself was refused; there is nothing left to resume
+		if err := tusService.DeleteUpload(upload); err != nil {
+			log.Printf("Error deleting refused upload %s: %v", upload.ID, err)
+		}
+		return
+	}
+	if stored == nil {
+		return
+	}
+	if err := tusService.CompleteUpload(upload, stored.URL); err != nil {
+		log.Printf("Error completing upload %s: %v", upload.ID, err)
+	}
+}
+
+// GetTusUploadResult returns the FileUploadResponse of a completed resumable
+// upload, for clients that lost the response to their last chunk
+func GetTusUploadResult(c *gin.Context) {
+	dbUser, ok := currentDBUser(c)
+	if !ok {
+		return
+	}
+
+	upload, err := services.NewTusService().GetUpload(c.Param("id"), dbUser.ID)
+	if err != nil {
+		c.JSON(tusErrorStatus(err), FileUploadResponse{Success: false, Error: "Upload not found"})
+		return
+	}
+	if upload.UploadURL == "" {
+		c.JSON(http.StatusConflict, FileUploadResponse{Success: false, Error: "Upload is not complete"})
+		return
+	}
+
+	stored, err := services.NewUploadService().GetUserUpload(upload.UploadURL, dbUser.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, FileUploadResponse{Success: false, Error: "Upload not found"})
+		return
+	}
+	c.JSON(http.StatusOK, uploadResponse(stored))
+}
+
+// DeleteTusUpload abandons a resumable upload
+func DeleteTusUpload(c *gin.Context) {
+	if !checkTusVersion(c) {
+		return
+	}
+	dbUser, ok := currentDBUser(c)
+	if !ok {
+		return
+	}
+
+	tusService := services.NewTusService()
+	upload, err := tusService.GetUpload(c.Param("id"), dbUser.ID)
+	if err != nil {
+		c.Status(tusErrorStatus(err))
+		return
+	}
+	if err := tusService.DeleteUpload(upload); err != nil {
+		log.Printf("Error deleting resumable upload %s: %v", upload.ID, err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// tusErrorStatus maps a resumable upload error to its HTTP status
+func tusErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrTusUploadNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrTusOffsetMismatch):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github/sabt-dev/realtimeChat/models"
+	"github/sabt-dev/realtimeChat/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxWebhookBodySize caps the JSON body accepted by an incoming webhook
+const maxWebhookBodySize = 64 << 10
+
+// incomingWebhookURL returns the public URL that posts to the webhook with the given secret
+func incomingWebhookURL(token string) string {
+	baseURL := os.Getenv("BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+	return strings.TrimRight(baseURL, "/") + "/api/hooks/" + token
+}
+
+// GetRoomWebhooks lists a room's incoming webhooks (room creator only)
+func GetRoomWebhooks(c *gin.Context) {
+	dbUser, ok := currentDBUser(c)
+	if !ok {
+		return
+	}
+
+	room, err := services.NewRoomService().GetRoomByName(c.Param("room"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+
+	webhooks, err := services.NewWebhookService().GetIncomingWebhooks(room.ID, dbUser.ID)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"room": room.Name, "webhooks": webhooks})
+}
+
+// CreateRoomWebhook creates an incoming webhook for a room (room creator only).
+// The response holds the secret URL, which is only shown once.
+func CreateRoomWebhook(c *gin.Context) {
+	dbUser, ok := currentDBUser(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+
+	room, err := services.NewRoomService().GetRoomByName(c.Param("room"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+
+	webhook, token, err := services.NewWebhookService().WithClientIP(c.ClientIP()).CreateIncomingWebhook(room.ID, req.Name, dbUser.ID)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"webhook": webhook, "url": incomingWebhookURL(token)})
+}
+
+// DeleteRoomWebhook deletes an incoming webhook (room creator only)
+func DeleteRoomWebhook(c *gin.Context) {
+	dbUser, ok := currentDBUser(c)
+	if !ok {
+		return
+	}
+	roomID, ok := parseIDParam(c, "roomId")
+	if !ok {
+		return
+	}
+	webhookID, ok := parseIDParam(c, "webhookId")
+	if !ok {
+		return
+	}
+
+	if err := services.NewWebhookService().WithClientIP(c.ClientIP()).DeleteIncomingWebhook(roomID, webhookID, dbUser.ID); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// ExecuteIncomingWebhook posts a message into a room through an incoming
+// webhook. No session is needed; the secret in the URL authorizes the request.
+func ExecuteIncomingWebhook(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookBodySize)
+
+	var payload models.IncomingWebhookPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON payload"})
+		return
+	}
+
+	webhookService := services.NewWebhookService().WithClientIP(c.ClientIP())
+	messages, err := webhookService.ExecuteIncomingWebhook(c.Param("token"), payload)
+	if errors.Is(err, services.ErrInvalidWebhookToken) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown webhook"})
+		return
+	}
+	if errors.Is(err, services.ErrInvalidWebhookPayload) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Broadcast whatever was created, even if a later attachment failed
+	responses := make([]models.MessageResponse, 0, len(messages))
+	for _, message := range messages {
+		responses = append(responses, messageResponse(message))
+	}
+	go func() {
+		for i := range responses {
+			chatHub.broadcast <- &responses[i]
+		}
+	}()
+
+	if err != nil {
+		log.Printf("Error executing incoming webhook: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to post message"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "messages": responses})
+}
+
+// GetRoomOutgoingWebhooks lists a room's outgoing webhooks (room creator only)
+func GetRoomOutgoingWebhooks(c *gin.Context) {
+	dbUser, ok := currentDBUser(c)
+	if !ok {
+		return
+	}
+
+	room, err := services.NewRoomService().GetRoomByName(c.Param("room"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+
+	webhooks, err := services.NewOutgoingWebhookService().GetOutgoingWebhooks(room.ID, dbUser.ID)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"room": room.Name, "webhooks": webhooks, "events": models.WebhookEventTypes})
+}
+
+// CreateRoomOutgoingWebhook registers an endpoint for a room's events (room creator only).
+// The response holds the signing secret, which is only shown once.
+func CreateRoomOutgoingWebhook(c *gin.Context) {
+	dbUser, ok := currentDBUser(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		URL    string   `json:"url" binding:"required"`
+		Events []string `json:"events"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "url is required"})
+		return
+	}
+
+	room, err := services.NewRoomService().GetRoomByName(c.Param("room"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+
+	// Check the creator up front so validation errors below can be reported as bad requests
+	isCreator, err := services.NewRoomService().IsRoomCreator(dbUser.ID, room.ID)
+	if err != nil || !isCreator {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the room creator can manage webhooks"})
+		return
+	}
+
+	webhookService := services.NewOutgoingWebhookService().WithClientIP(c.ClientIP())
+	webhook, secret, err := webhookService.CreateOutgoingWebhook(room.ID, req.URL, req.Events, dbUser.ID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"webhook": webhook, "secret": secret})
+}
+
+// DeleteRoomOutgoingWebhook deletes an outgoing webhook and its delivery log (room creator only)
+func DeleteRoomOutgoingWebhook(c *gin.Context) {
+	dbUser, ok := currentDBUser(c)
+	if !ok {
+		return
+	}
+	roomID, ok := parseIDParam(c, "roomId")
+	if !ok {
+		return
+	}
+	webhookID, ok := parseIDParam(c, "webhookId")
+	if !ok {
+		return
+	}
+
+	webhookService := services.NewOutgoingWebhookService().WithClientIP(c.ClientIP())
+	if err := webhookService.DeleteOutgoingWebhook(roomID, webhookID, dbUser.ID); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// GetOutgoingWebhookDeliveries returns an outgoing webhook's delivery log (room creator only).
+// Optional query parameters: status (pending, delivered, dead), limit and offset.
+func GetOutgoingWebhookDeliveries(c *gin.Context) {
+	dbUser, ok := currentDBUser(c)
+	if !ok {
+		return
+	}
+	webhookID, ok := parseIDParam(c, "webhookId")
+	if !ok {
+		return
+	}
+
+	room, err := services.NewRoomService().GetRoomByName(c.Param("room"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+
+	status := c.Query("status")
+	switch status {
+	case "", models.WebhookDeliveryPending, models.WebhookDeliveryDelivered, models.WebhookDeliveryDead:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil {
+		limit = 50
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil {
+		offset = 0
+	}
+
+	deliveries, total, err := services.NewOutgoingWebhookService().GetDeliveries(room.ID, webhookID, dbUser.ID, status, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"deliveries": deliveries,
+		"total":      total,
+		"limit":      limit,
+		"offset":     offset,
+	})
+}
+
+// RetryOutgoingWebhookDelivery queues a dead or delivered delivery again (room creator only)
+func RetryOutgoingWebhookDelivery(c *gin.Context) {
+	dbUser, ok := currentDBUser(c)
+	if !ok {
+		return
+	}
+	webhookID, ok := parseIDParam(c, "webhookId")
+	if !ok {
+		return
+	}
+	deliveryID, ok := parseIDParam(c, "deliveryId")
+	if !ok {
+		return
+	}
+
+	room, err := services.NewRoomService().GetRoomByName(c.Param("room"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+
+	if err := services.NewOutgoingWebhookService().RetryDelivery(room.ID, webhookID, deliveryID, dbUser.ID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
@@ -0,0 +1,105 @@
+// Package importer reads chat history exported from other services into a
+// source-neutral Archive that services.ImportService writes to the database.
+package importer
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Supported archive sources
+const (
+	SourceSlack   = "slack"
+	SourceDiscord = "discord"
+)
+
+// User is a user as known to the source service
+type User struct {
+	ExternalID string
+	Name       string
+	Email      string // May be empty; the importer then derives a stable placeholder
+	Avatar     string
+	IsBot      bool
+}
+
+// Attachment is a file attached to a message, referenced by URL
+type Attachment struct {
+	URL      string
+	FileName string
+	MimeType string
+}
+
+// Reaction is an emoji reaction and the users who added it
+type Reaction struct {
+	Emoji           string
+	UserExternalIDs []string
+}
+
+// Message is a single message in a channel
+type Message struct {
+	ExternalID        string
+	UserExternalID    string
+	Type              string // "message", "join" or "leave"
+	Text              string
+	Timestamp         time.Time
+	ReplyToExternalID string // Thread parent or replied-to message, if any
+	Reactions         []Reaction
+	Attachments       []Attachment
+}
+
+// Channel is a channel with its messages in chronological order
+type Channel struct {
+	ExternalID        string
+	Name              string
+	Description       string
+	IsPrivate         bool
+	CreatedAt         time.Time
+	CreatorExternalID string
+	MemberExternalIDs []string
+	Messages          []Message
+}
+
+// Skip records an item the parser could not import
+type Skip struct {
+	Kind   string // "channel", "message", "attachment", "reaction", ...
+	Ref    string // Source identifier of the item
+	Reason string
+}
+
+// Archive is the parsed content of an export
+type Archive struct {
+	Source   string
+	Users    map[string]*User // Keyed by ExternalID
+	Channels []*Channel
+	Skipped  []Skip
+}
+
+func newArchive(source string) *Archive {
+	return &Archive{Source: source, Users: map[string]*User{}}
+}
+
+func (a *Archive) skip(kind, ref, reason string) {
+	a.Skipped = append(a.Skipped, Skip{Kind: kind, Ref: ref, Reason: reason})
+}
+
+// Parse reads an export of the given source. Slack exports are workspace zips;
+// Discord exports are DiscordChatExporter JSON files, alone or zipped together.
+func Parse(source string, r io.ReaderAt, size int64) (*Archive, error) {
+	switch source {
+	case SourceSlack:
+		zr, err := zip.NewReader(r, size)
+		if err != nil {
+			return nil, fmt.Errorf("slack export must be a zip archive: %w", err)
+		}
+		return ParseSlack(zr)
+	case SourceDiscord:
+		if zr, err := zip.NewReader(r, size); err == nil {
+			return ParseDiscordZip(zr)
+		}
+		return ParseDiscord(io.NewSectionReader(r, 0, size))
+	default:
+		return nil, fmt.Errorf("unsupported import source: %s", source)
+	}
+}
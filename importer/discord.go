@@ -0,0 +1,201 @@
+package importer
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// discordExport is the JSON layout produced by DiscordChatExporter
+type discordExport struct {
+	Guild struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"guild"`
+	Channel struct {
+		ID       string `json:"id"`
+		Type     string `json:"type"`
+		Category string `json:"category"`
+		Name     string `json:"name"`
+		Topic    string `json:"topic"`
+	} `json:"channel"`
+	Messages []discordMessage `json:"messages"`
+}
+
+type discordAuthor struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Nickname  string `json:"nickname"`
+	IsBot     bool   `json:"isBot"`
+	AvatarURL string `json:"avatarUrl"`
+}
+
+type discordMessage struct {
+	ID          string        `json:"id"`
+	Type        string        `json:"type"`
+	Timestamp   time.Time     `json:"timestamp"`
+	Content     string        `json:"content"`
+	Author      discordAuthor `json:"author"`
+	Attachments []struct {
+		ID       string `json:"id"`
+		URL      string `json:"url"`
+		FileName string `json:"fileName"`
+	} `json:"attachments"`
+	Reactions []struct {
+		Emoji struct {
+			Name string `json:"name"`
+		} `json:"emoji"`
+		Users []discordAuthor `json:"users"`
+	} `json:"reactions"`
+	Reference *struct {
+		MessageID string `json:"messageId"`
+	} `json:"reference"`
+}
+
+// ParseDiscord reads a single DiscordChatExporter JSON file (one channel)
+func ParseDiscord(r io.Reader) (*Archive, error) {
+	archive := newArchive(SourceDiscord)
+	if err := parseDiscordChannel(archive, r, "export"); err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+// ParseDiscordZip reads a zip holding one DiscordChatExporter JSON file per channel
+func ParseDiscordZip(zr *zip.Reader) (*Archive, error) {
+	archive := newArchive(SourceDiscord)
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if !strings.EqualFold(path.Ext(f.Name), ".json") {
+			archive.skip("file", f.Name, "not a JSON export")
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		err = parseDiscordChannel(archive, rc, f.Name)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return archive, nil
+}
+
+func parseDiscordChannel(archive *Archive, r io.Reader, name string) error {
+	var export discordExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	if export.Channel.ID == "" {
+		return fmt.Errorf("%s is not a DiscordChatExporter JSON export", name)
+	}
+	if strings.HasPrefix(export.Channel.Type, "Direct") {
+		archive.skip("channel", export.Channel.ID, "direct messages are not imported")
+		return nil
+	}
+
+	channel := &Channel{
+		ExternalID:  export.Channel.ID,
+		Name:        export.Channel.Name,
+		Description: export.Channel.Topic,
+	}
+	members := map[string]bool{}
+	addUser := func(a discordAuthor) {
+		if _, ok := archive.Users[a.ID]; !ok {
+			archive.Users[a.ID] = &User{
+				ExternalID: a.ID,
+				Name:       firstNonEmpty(a.Nickname, a.Name, a.ID),
+				Avatar:     a.AvatarURL,
+				IsBot:      a.IsBot,
+			}
+		}
+		if !members[a.ID] {
+			members[a.ID] = true
+			channel.MemberExternalIDs = append(channel.MemberExternalIDs, a.ID)
+		}
+	}
+
+	for _, dm := range export.Messages {
+		ref := channel.Name + "/" + dm.ID
+		msg := Message{
+			ExternalID:     dm.ID,
+			UserExternalID: dm.Author.ID,
+			Type:           "message",
+			Text:           dm.Content,
+			Timestamp:      dm.Timestamp.UTC(),
+		}
+		switch dm.Type {
+		case "Default", "Reply", "":
+		case "GuildMemberJoin", "RecipientAdd":
+			msg.Type = "join"
+		case "RecipientRemove":
+			msg.Type = "leave"
+		default:
+			archive.skip("message", ref, "unsupported message type "+dm.Type)
+			continue
+		}
+		if dm.Author.ID == "" {
+			archive.skip("message", ref, "message has no author")
+			continue
+		}
+		addUser(dm.Author)
+
+		if dm.Reference != nil && dm.Reference.MessageID != "" {
+			msg.ReplyToExternalID = dm.Reference.MessageID
+		}
+		for _, r := range dm.Reactions {
+			reaction := Reaction{Emoji: r.Emoji.Name}
+			for _, u := range r.Users {
+				addUser(u)
+				reaction.UserExternalIDs = append(reaction.UserExternalIDs, u.ID)
+			}
+			msg.Reactions = append(msg.Reactions, reaction)
+		}
+		for _, a := range dm.Attachments {
+			if isDiscordCDNURL(a.URL) {
+				archive.skip("attachment", ref+"/"+a.ID, "Discord CDN links expire")
+				continue
+			}
+			msg.Attachments = append(msg.Attachments, Attachment{
+				URL:      a.URL,
+				FileName: a.FileName,
+				MimeType: mime.TypeByExtension(strings.ToLower(path.Ext(a.FileName))),
+			})
+		}
+		channel.Messages = append(channel.Messages, msg)
+	}
+
+	sort.SliceStable(channel.Messages, func(i, j int) bool {
+		return channel.Messages[i].Timestamp.Before(channel.Messages[j].Timestamp)
+	})
+	if len(channel.Messages) > 0 {
+		channel.CreatedAt = channel.Messages[0].Timestamp
+	}
+	archive.Channels = append(archive.Channels, channel)
+	return nil
+}
+
+// isDiscordCDNURL reports whether u is a Discord attachment link. These are
+// signed with an expiry, so they stop working soon after the export.
+func isDiscordCDNURL(u string) bool {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(parsed.Hostname()) {
+	case "cdn.discordapp.com", "media.discordapp.net":
+		return true
+	}
+	return false
+}
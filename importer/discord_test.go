@@ -0,0 +1,131 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const discordFixture = `{
+	"guild": {"id": "900", "name": "Example"},
+	"channel": {"id": "100", "type": "GuildTextChat", "category": "Text", "name": "lobby", "topic": "Say hi"},
+	"messages": [
+		{"id": "2", "type": "Default", "timestamp": "2021-03-01T10:05:00+02:00", "content": "hello",
+		 "author": {"id": "A", "name": "alice", "nickname": "Ali", "avatarUrl": "https://cdn.discordapp.com/avatars/A/a.png"},
+		 "attachments": [
+			{"id": "a1", "url": "https://cdn.discordapp.com/attachments/100/a1/cat.png?ex=65f0&is=65de&hm=ab", "fileName": "cat.png"},
+			{"id": "a2", "url": "https://files.example.com/report.pdf", "fileName": "report.pdf"}
+		 ],
+		 "reactions": [{"emoji": {"name": "🔥"}, "users": [{"id": "B", "name": "bob"}]}]},
+		{"id": "3", "type": "Reply", "timestamp": "2021-03-01T08:10:00Z", "content": "hi Ali",
+		 "author": {"id": "B", "name": "bob"}, "reference": {"messageId": "2"}},
+		{"id": "1", "type": "GuildMemberJoin", "timestamp": "2021-03-01T08:00:00Z", "content": "",
+		 "author": {"id": "C", "name": "carol", "isBot": true}},
+		{"id": "4", "type": "ChannelPinnedMessage", "timestamp": "2021-03-01T08:20:00Z", "content": "",
+		 "author": {"id": "A", "name": "alice"}},
+		{"id": "5", "type": "Default", "timestamp": "2021-03-01T08:30:00Z", "content": "ghost", "author": {"id": ""}}
+	]
+}`
+
+func TestParseDiscord(t *testing.T) {
+	archive, err := ParseDiscord(strings.NewReader(discordFixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if archive.Source != SourceDiscord || len(archive.Channels) != 1 {
+		t.Fatalf("archive = %+v, want one Discord channel", archive)
+	}
+	lobby := archive.Channels[0]
+	if lobby.ExternalID != "100" || lobby.Name != "lobby" || lobby.Description != "Say hi" || lobby.IsPrivate {
+		t.Errorf("lobby = %+v", lobby)
+	}
+	if !lobby.CreatedAt.Equal(time.Date(2021, 3, 1, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("CreatedAt = %v, want the first message's timestamp", lobby.CreatedAt)
+	}
+	if got := strings.Join(lobby.MemberExternalIDs, ","); got != "A,B,C" {
+		t.Errorf("members = %s, want authors and reactors in order of appearance", got)
+	}
+
+	if alice := archive.Users["A"]; alice == nil || alice.Name != "Ali" || alice.Email != "" || alice.Avatar == "" {
+		t.Errorf("Users[A] = %+v", alice)
+	}
+	if carol := archive.Users["C"]; carol == nil || !carol.IsBot {
+		t.Errorf("Users[C] = %+v, want a bot", carol)
+	}
+
+	want := []struct{ id, typ, replyTo string }{
+		{id: "1", typ: "join"},
+		{id: "2", typ: "message"},
+		{id: "3", typ: "message", replyTo: "2"},
+	}
+	if len(lobby.Messages) != len(want) {
+		t.Fatalf("got %d messages, want %d: %+v", len(lobby.Messages), len(want), lobby.Messages)
+	}
+	for i, w := range want {
+		got := lobby.Messages[i]
+		if got.ExternalID != w.id || got.Type != w.typ || got.ReplyToExternalID != w.replyTo {
+			t.Errorf("message %d = %+v, want %+v", i, got, w)
+		}
+	}
+
+	hello := lobby.Messages[1]
+	if len(hello.Reactions) != 1 || hello.Reactions[0].Emoji != "🔥" || strings.Join(hello.Reactions[0].UserExternalIDs, ",") != "B" {
+		t.Errorf("reactions = %+v", hello.Reactions)
+	}
+	if len(hello.Attachments) != 1 || hello.Attachments[0].URL != "https://files.example.com/report.pdf" || hello.Attachments[0].MimeType != "application/pdf" {
+		t.Errorf("attachments = %+v, want only the non-CDN link", hello.Attachments)
+	}
+	for _, skip := range []struct{ kind, ref string }{
+		{"attachment", "lobby/2/a1"},
+		{"message", "lobby/4"},
+		{"message", "lobby/5"},
+	} {
+		if !hasSkip(archive, skip.kind, skip.ref) {
+			t.Errorf("no %s skip for %s in %+v", skip.kind, skip.ref, archive.Skipped)
+		}
+	}
+}
+
+func TestParseDiscordZip(t *testing.T) {
+	dm := `{"guild": {"id": "0"}, "channel": {"id": "200", "type": "DirectTextChat", "name": "bob"}, "messages": []}`
+	archive, err := ParseDiscordZip(newZip(t, map[string]string{
+		"Example - Text - lobby [100].json": discordFixture,
+		"Direct Messages - bob [200].json":  dm,
+		"Example - Text - lobby [100].html": "<html></html>",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archive.Channels) != 1 || archive.Channels[0].Name != "lobby" {
+		t.Errorf("channels = %+v, want only lobby", archive.Channels)
+	}
+	if !hasSkip(archive, "channel", "200") || !hasSkip(archive, "file", "Example - Text - lobby [100].html") {
+		t.Errorf("skipped = %+v, want the direct messages and the HTML file", archive.Skipped)
+	}
+
+	if _, err := ParseDiscordZip(newZip(t, map[string]string{"notes.json": `{"hello": "world"}`})); err == nil {
+		t.Error("ParseDiscordZip accepted a JSON file that is not an export")
+	}
+}
+
+func TestIsDiscordCDNURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{url: "https://cdn.discordapp.com/attachments/1/2/a.png?ex=1", want: true},
+		{url: "https://media.discordapp.net/attachments/1/2/a.png", want: true},
+		{url: "https://CDN.DiscordApp.com/attachments/1/2/a.png", want: true},
+		{url: "https://files.example.com/a.png", want: false},
+		{url: "https://cdn.discordapp.com.example.com/a.png", want: false},
+		{url: "media/a.png", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := isDiscordCDNURL(tt.url); got != tt.want {
+				t.Errorf("isDiscordCDNURL(%q) = %v, want %v", tt.url, got, tt.want)
+			}
+		})
+	}
+}
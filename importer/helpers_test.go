@@ -0,0 +1,48 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"sort"
+	"testing"
+)
+
+// newZip builds an in-memory zip archive from file names and contents
+func newZip(t *testing.T, files map[string]string) *zip.Reader {
+	t.Helper()
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range names {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(files[name])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zr
+}
+
+// hasSkip reports whether the archive skipped the item with the given kind and ref
+func hasSkip(archive *Archive, kind, ref string) bool {
+	for _, s := range archive.Skipped {
+		if s.Kind == kind && s.Ref == ref {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,287 @@
+package importer
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"html"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type slackUser struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	RealName string `json:"real_name"`
+	IsBot    bool   `json:"is_bot"`
+	Profile  struct {
+		Email       string `json:"email"`
+		RealName    string `json:"real_name"`
+		DisplayName string `json:"display_name"`
+		Image72     string `json:"image_72"`
+	} `json:"profile"`
+}
+
+type slackChannel struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Created int64    `json:"created"`
+	Creator string   `json:"creator"`
+	Members []string `json:"members"`
+	Purpose struct {
+		Value string `json:"value"`
+	} `json:"purpose"`
+	Topic struct {
+		Value string `json:"value"`
+	} `json:"topic"`
+}
+
+type slackMessage struct {
+	Type      string `json:"type"`
+	Subtype   string `json:"subtype"`
+	User      string `json:"user"`
+	Username  string `json:"username"`
+	BotID     string `json:"bot_id"`
+	Text      string `json:"text"`
+	TS        string `json:"ts"`
+	ThreadTS  string `json:"thread_ts"`
+	Reactions []struct {
+		Name  string   `json:"name"`
+		Users []string `json:"users"`
+	} `json:"reactions"`
+	Files []struct {
+		ID         string `json:"id"`
+		Name       string `json:"name"`
+		Mimetype   string `json:"mimetype"`
+		URLPrivate string `json:"url_private"`
+		Mode       string `json:"mode"`
+	} `json:"files"`
+}
+
+// ParseSlack reads a Slack workspace export: users.json, channels.json and
+// groups.json (private channels), plus one folder of daily JSON files per channel.
+// Direct messages are not imported.
+func ParseSlack(zr *zip.Reader) (*Archive, error) {
+	archive := newArchive(SourceSlack)
+
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	var users []slackUser
+	if err := readZipJSON(files, "users.json", &users); err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		name := firstNonEmpty(u.Profile.DisplayName, u.Profile.RealName, u.RealName, u.Name, u.ID)
+		archive.Users[u.ID] = &User{
+			ExternalID: u.ID,
+			Name:       name,
+			Email:      u.Profile.Email,
+			Avatar:     u.Profile.Image72,
+			IsBot:      u.IsBot,
+		}
+	}
+
+	var channels, groups []slackChannel
+	if err := readZipJSON(files, "channels.json", &channels); err != nil {
+		return nil, err
+	}
+	if _, ok := files["groups.json"]; ok {
+		if err := readZipJSON(files, "groups.json", &groups); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range []string{"dms.json", "mpims.json"} {
+		if _, ok := files[name]; ok {
+			archive.skip("conversation", name, "direct messages are not imported")
+		}
+	}
+
+	for i, sc := range append(channels, groups...) {
+		channel := &Channel{
+			ExternalID:        sc.ID,
+			Name:              sc.Name,
+			Description:       firstNonEmpty(sc.Purpose.Value, sc.Topic.Value),
+			IsPrivate:         i >= len(channels),
+			CreatedAt:         time.Unix(sc.Created, 0).UTC(),
+			CreatorExternalID: sc.Creator,
+			MemberExternalIDs: sc.Members,
+		}
+		if err := parseSlackChannelMessages(archive, channel, files); err != nil {
+			return nil, err
+		}
+		archive.Channels = append(archive.Channels, channel)
+	}
+
+	return archive, nil
+}
+
+// parseSlackChannelMessages reads the daily files in the channel's folder
+func parseSlackChannelMessages(archive *Archive, channel *Channel, files map[string]*zip.File) error {
+	var dayFiles []string
+	for name := range files {
+		if path.Dir(name) == channel.Name && strings.HasSuffix(name, ".json") {
+			dayFiles = append(dayFiles, name)
+		}
+	}
+	sort.Strings(dayFiles)
+
+	for _, name := range dayFiles {
+		var raw []slackMessage
+		if err := readZipJSON(files, name, &raw); err != nil {
+			return err
+		}
+		for _, sm := range raw {
+			ref := channel.Name + "/" + sm.TS
+			ts, err := parseSlackTS(sm.TS)
+			if err != nil {
+				archive.skip("message", ref, "invalid timestamp")
+				continue
+			}
+
+			msg := Message{
+				ExternalID:     sm.TS,
+				UserExternalID: sm.User,
+				Type:           "message",
+				Text:           convertSlackText(sm.Text, archive.Users),
+				Timestamp:      ts,
+			}
+			switch sm.Subtype {
+			case "", "thread_broadcast", "file_share", "me_message":
+			case "channel_join", "group_join":
+				msg.Type = "join"
+			case "channel_leave", "group_leave":
+				msg.Type = "leave"
+			case "bot_message":
+				if sm.User == "" {
+					// Integrations post without a user; represent them by their bot name
+					botID := "bot:" + firstNonEmpty(sm.BotID, sm.Username)
+					if _, ok := archive.Users[botID]; !ok {
+						archive.Users[botID] = &User{ExternalID: botID, Name: firstNonEmpty(sm.Username, sm.BotID), IsBot: true}
+					}
+					msg.UserExternalID = botID
+				}
+			default:
+				archive.skip("message", ref, "unsupported message subtype "+sm.Subtype)
+				continue
+			}
+			if msg.UserExternalID == "" {
+				archive.skip("message", ref, "message has no author")
+				continue
+			}
+
+			if sm.ThreadTS != "" && sm.ThreadTS != sm.TS {
+				msg.ReplyToExternalID = sm.ThreadTS
+			}
+			for _, r := range sm.Reactions {
+				msg.Reactions = append(msg.Reactions, Reaction{Emoji: slackEmoji(r.Name), UserExternalIDs: r.Users})
+			}
+			for _, f := range sm.Files {
+				if f.Mode == "tombstone" || f.Mode == "hidden_by_limit" || f.URLPrivate == "" {
+					archive.skip("attachment", ref+"/"+f.ID, "file is not available in the export")
+					continue
+				}
+				// url_private only serves the file to requests carrying a workspace token
+				archive.skip("attachment", ref+"/"+f.ID, "Slack files can only be downloaded with a workspace token")
+			}
+			channel.Messages = append(channel.Messages, msg)
+		}
+	}
+
+	sort.SliceStable(channel.Messages, func(i, j int) bool {
+		return channel.Messages[i].Timestamp.Before(channel.Messages[j].Timestamp)
+	})
+	return nil
+}
+
+// parseSlackTS parses a Slack timestamp such as "1512085950.000216"
+func parseSlackTS(ts string) (time.Time, error) {
+	secs, micros, _ := strings.Cut(ts, ".")
+	s, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var us int64
+	if micros != "" {
+		if us, err = strconv.ParseInt((micros + "000000")[:6], 10, 64); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return time.Unix(s, us*1000).UTC(), nil
+}
+
+var slackLinkPattern = regexp.MustCompile(`<([^<>|]+)(?:\|([^<>]*))?>`)
+
+// convertSlackText turns Slack's mrkdwn references into plain text:
+// <@U123> becomes @name, <#C123|general> becomes #general, and links keep their URL
+func convertSlackText(text string, users map[string]*User) string {
+	text = slackLinkPattern.ReplaceAllStringFunc(text, func(m string) string {
+		parts := slackLinkPattern.FindStringSubmatch(m)
+		target, label := parts[1], parts[2]
+		switch {
+		case strings.HasPrefix(target, "@"):
+			if u, ok := users[target[1:]]; ok {
+				return "@" + u.Name
+			}
+			return "@" + firstNonEmpty(label, target[1:])
+		case strings.HasPrefix(target, "#"):
+			return "#" + firstNonEmpty(label, target[1:])
+		case strings.HasPrefix(target, "!"):
+			return "@" + firstNonEmpty(label, strings.TrimPrefix(target, "!"))
+		case label != "" && label != target:
+			return label + " (" + strings.TrimPrefix(target, "mailto:") + ")"
+		default:
+			return strings.TrimPrefix(target, "mailto:")
+		}
+	})
+	return html.UnescapeString(text)
+}
+
+// slackEmojiNames maps common Slack reaction names to emoji; others are kept as :name:
+var slackEmojiNames = map[string]string{
+	"+1": "👍", "thumbsup": "👍", "-1": "👎", "thumbsdown": "👎",
+	"heart": "❤️", "joy": "😂", "laughing": "😆", "smile": "😄", "slightly_smiling_face": "🙂",
+	"tada": "🎉", "fire": "🔥", "eyes": "👀", "100": "💯", "pray": "🙏", "clap": "👏",
+	"rocket": "🚀", "white_check_mark": "✅", "heavy_check_mark": "✔️", "x": "❌",
+	"thinking_face": "🤔", "raised_hands": "🙌", "ok_hand": "👌", "wave": "👋",
+	"cry": "😢", "open_mouth": "😮", "sob": "😭", "muscle": "💪", "star": "⭐",
+}
+
+func slackEmoji(name string) string {
+	base, _, _ := strings.Cut(name, "::") // Drop skin tone modifiers such as "+1::skin-tone-2"
+	if emoji, ok := slackEmojiNames[base]; ok {
+		return emoji
+	}
+	return ":" + base + ":"
+}
+
+func readZipJSON(files map[string]*zip.File, name string, v interface{}) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("%s not found in archive", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if err := json.NewDecoder(rc).Decode(v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	return nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,188 @@
+package importer
+
+import (
+	"testing"
+	"time"
+)
+
+// slackFixture is a small workspace export with a public and a private channel
+var slackFixture = map[string]string{
+	"users.json": `[
+		{"id": "U1", "name": "alice", "profile": {"email": "Alice@Example.com", "display_name": "Alice", "image_72": "https://avatars.example.com/alice.png"}},
+		{"id": "U2", "name": "bob", "real_name": "Bob Builder", "profile": {"email": "bob@example.com"}},
+		{"id": "U3", "name": "helper", "is_bot": true, "profile": {}}
+	]`,
+	"channels.json": `[
+		{"id": "C1", "name": "general", "created": 1577836800, "creator": "U1", "members": ["U1", "U2"],
+		 "purpose": {"value": ""}, "topic": {"value": "Company-wide chat"}}
+	]`,
+	"groups.json": `[
+		{"id": "G1", "name": "secret", "created": 1577836900, "creator": "U2", "members": ["U2"], "purpose": {"value": "Plans"}}
+	]`,
+	"dms.json": `[]`,
+	"general/2020-01-02.json": `[
+		{"type": "message", "user": "U2", "text": "thread reply", "ts": "1577923200.000100", "thread_ts": "1577836900.000200"}
+	]`,
+	"general/2020-01-01.json": `[
+		{"type": "message", "subtype": "channel_join", "user": "U2", "text": "<@U2> has joined the channel", "ts": "1577836850.000100"},
+		{"type": "message", "user": "U1", "text": "hi <@U2>, see <https://example.com|the site> &amp; <#C1|general>", "ts": "1577836900.000200",
+		 "thread_ts": "1577836900.000200",
+		 "reactions": [{"name": "+1::skin-tone-2", "users": ["U2"]}, {"name": "partyparrot", "users": ["U1", "U2"]}]},
+		{"type": "message", "subtype": "bot_message", "username": "deploybot", "bot_id": "B1", "text": "deployed", "ts": "1577836950.000300"},
+		{"type": "message", "subtype": "file_share", "user": "U1", "text": "the plan", "ts": "1577837000.000400",
+		 "files": [
+			{"id": "F1", "name": "plan.pdf", "mimetype": "application/pdf", "url_private": "https://files.slack.com/files-pri/T1-F1/plan.pdf", "mode": "hosted"},
+			{"id": "F2", "name": "old.png", "mode": "tombstone"}
+		 ]},
+		{"type": "message", "subtype": "channel_topic", "user": "U1", "text": "set the topic", "ts": "1577837100.000500"},
+		{"type": "message", "user": "U1", "text": "bad timestamp", "ts": "later"},
+		{"type": "message", "text": "nobody", "ts": "1577837200.000600"}
+	]`,
+	"secret/2020-01-01.json": `[
+		{"type": "message", "user": "U2", "text": "private plans", "ts": "1577837300.000100"}
+	]`,
+}
+
+func TestParseSlack(t *testing.T) {
+	archive, err := ParseSlack(newZip(t, slackFixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if archive.Source != SourceSlack {
+		t.Errorf("Source = %q, want %q", archive.Source, SourceSlack)
+	}
+
+	alice := archive.Users["U1"]
+	if alice == nil || alice.Name != "Alice" || alice.Email != "Alice@Example.com" || alice.Avatar != "https://avatars.example.com/alice.png" {
+		t.Errorf("Users[U1] = %+v", alice)
+	}
+	if bob := archive.Users["U2"]; bob == nil || bob.Name != "Bob Builder" {
+		t.Errorf("Users[U2] = %+v, want name from real_name", bob)
+	}
+	if bot := archive.Users["bot:B1"]; bot == nil || bot.Name != "deploybot" || !bot.IsBot {
+		t.Errorf("Users[bot:B1] = %+v, want the integration as a bot user", bot)
+	}
+
+	if len(archive.Channels) != 2 {
+		t.Fatalf("got %d channels, want 2", len(archive.Channels))
+	}
+	general, secret := archive.Channels[0], archive.Channels[1]
+	if general.Name != "general" || general.IsPrivate || general.Description != "Company-wide chat" || general.CreatorExternalID != "U1" {
+		t.Errorf("general = %+v", general)
+	}
+	if !general.CreatedAt.Equal(time.Unix(1577836800, 0)) {
+		t.Errorf("general.CreatedAt = %v", general.CreatedAt)
+	}
+	if secret.Name != "secret" || !secret.IsPrivate || secret.Description != "Plans" || len(secret.Messages) != 1 {
+		t.Errorf("secret = %+v, want a private channel with one message", secret)
+	}
+
+	// Day files are merged and sorted by timestamp; skipped messages are left out
+	want := []struct {
+		id, user, typ, text, replyTo string
+	}{
+		{id: "1577836850.000100", user: "U2", typ: "join", text: "@Bob Builder has joined the channel"},
+		{id: "1577836900.000200", user: "U1", typ: "message", text: "hi @Bob Builder, see the site (https://example.com) & #general"},
+		{id: "1577836950.000300", user: "bot:B1", typ: "message", text: "deployed"},
+		{id: "1577837000.000400", user: "U1", typ: "message", text: "the plan"},
+		{id: "1577923200.000100", user: "U2", typ: "message", text: "thread reply", replyTo: "1577836900.000200"},
+	}
+	if len(general.Messages) != len(want) {
+		t.Fatalf("got %d messages in general, want %d: %+v", len(general.Messages), len(want), general.Messages)
+	}
+	for i, w := range want {
+		got := general.Messages[i]
+		if got.ExternalID != w.id || got.UserExternalID != w.user || got.Type != w.typ || got.Text != w.text || got.ReplyToExternalID != w.replyTo {
+			t.Errorf("message %d = %+v, want %+v", i, got, w)
+		}
+	}
+
+	reactions := general.Messages[1].Reactions
+	if len(reactions) != 2 || reactions[0].Emoji != "👍" || reactions[1].Emoji != ":partyparrot:" || len(reactions[1].UserExternalIDs) != 2 {
+		t.Errorf("reactions = %+v", reactions)
+	}
+
+	if attachments := general.Messages[3].Attachments; len(attachments) != 0 {
+		t.Errorf("attachments = %+v, want Slack files to be skipped", attachments)
+	}
+	for _, skip := range []struct{ kind, ref string }{
+		{"conversation", "dms.json"},
+		{"attachment", "general/1577837000.000400/F1"},
+		{"attachment", "general/1577837000.000400/F2"},
+		{"message", "general/1577837100.000500"},
+		{"message", "general/later"},
+		{"message", "general/1577837200.000600"},
+	} {
+		if !hasSkip(archive, skip.kind, skip.ref) {
+			t.Errorf("no %s skip for %s in %+v", skip.kind, skip.ref, archive.Skipped)
+		}
+	}
+}
+
+func TestParseSlackRequiresUsersAndChannels(t *testing.T) {
+	for _, missing := range []string{"users.json", "channels.json"} {
+		files := map[string]string{}
+		for name, content := range slackFixture {
+			if name != missing {
+				files[name] = content
+			}
+		}
+		if _, err := ParseSlack(newZip(t, files)); err == nil {
+			t.Errorf("ParseSlack without %s succeeded", missing)
+		}
+	}
+}
+
+func TestParseSlackTS(t *testing.T) {
+	tests := []struct {
+		ts      string
+		want    time.Time
+		wantErr bool
+	}{
+		{ts: "1512085950.000216", want: time.Unix(1512085950, 216000)},
+		{ts: "1512085950", want: time.Unix(1512085950, 0)},
+		{ts: "1512085950.5", want: time.Unix(1512085950, 500000000)},
+		{ts: "", wantErr: true},
+		{ts: "later", wantErr: true},
+		{ts: "1512085950.x", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ts, func(t *testing.T) {
+			got, err := parseSlackTS(tt.ts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSlackTS(%q) error = %v, wantErr %v", tt.ts, err, tt.wantErr)
+			}
+			if !tt.wantErr && !got.Equal(tt.want) {
+				t.Errorf("parseSlackTS(%q) = %v, want %v", tt.ts, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertSlackText(t *testing.T) {
+	users := map[string]*User{"U1": {ExternalID: "U1", Name: "Alice"}}
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: "hi <@U1>", want: "hi @Alice"},
+		{text: "hi <@U9|someone>", want: "hi @someone"},
+		{text: "hi <@U9>", want: "hi @U9"},
+		{text: "see <#C1|general>", want: "see #general"},
+		{text: "<!here> look", want: "@here look"},
+		{text: "<https://example.com>", want: "https://example.com"},
+		{text: "<https://example.com|https://example.com>", want: "https://example.com"},
+		{text: "<https://example.com|docs>", want: "docs (https://example.com)"},
+		{text: "<mailto:a@example.com>", want: "a@example.com"},
+		{text: "1 &lt; 2 &amp;&amp; 3 &gt; 2", want: "1 < 2 && 3 > 2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := convertSlackText(tt.text, users); got != tt.want {
+				t.Errorf("convertSlackText(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
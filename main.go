@@ -6,6 +6,8 @@ import (
 	"github/sabt-dev/realtimeChat/database"
 	"github/sabt-dev/realtimeChat/handlers"
 	"github/sabt-dev/realtimeChat/middleware"
+	"github/sabt-dev/realtimeChat/services"
+	"github/sabt-dev/realtimeChat/storage"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -23,12 +25,24 @@ func main() {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 
+	// Initialize upload storage
+	if err := storage.InitStorage(); err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+
 	// Initialize authentication
 	middleware.InitAuth()
 
 	// Start the chat hub
 	handlers.StartHub()
 
+	// Hard-delete message tombstones after the retention window
+	services.StartTombstonePurger()
+	services.StartWebhookDispatcher()
+	services.StartLinkUnfurler(handlers.BroadcastMessageUpdate)
+	services.StartTusUploadSweeper()
+	services.StartUploadSweeper()
+
 	r := gin.Default()
 
 	// 50MB limit for file uploads
@@ -37,8 +51,10 @@ func main() {
 	// Serve static files (for the chat client)
 	r.Static("/static", "./static")
 
-	// Serve uploaded files
-	r.Static("/uploads", "./uploads")
+	// Serve uploaded files with a pinned Content-Type, to users who can see them
+	// or through signed URLs
+	r.GET("/uploads/*filepath", middleware.OptionalAuthMiddleware(), handlers.ServeUpload)
+	r.HEAD("/uploads/*filepath", middleware.OptionalAuthMiddleware(), handlers.ServeUpload)
 
 	// Authentication routes
 	r.GET("/auth/:provider", middleware.BeginAuth)
@@ -50,6 +66,14 @@ func main() {
 	// File upload route (requires authentication)
 	r.POST("/upload", middleware.AuthMiddleware(), handlers.HandleFileUpload)
 
+	// Resumable uploads (tus protocol)
+	r.OPTIONS("/api/uploads/tus", handlers.TusOptions)
+	r.POST("/api/uploads/tus", middleware.AuthMiddleware(), handlers.CreateTusUpload)
+	r.HEAD("/api/uploads/tus/:id", middleware.AuthMiddleware(), handlers.GetTusUploadOffset)
+	r.PATCH("/api/uploads/tus/:id", middleware.AuthMiddleware(), handlers.PatchTusUpload)
+	r.GET("/api/uploads/tus/:id", middleware.AuthMiddleware(), handlers.GetTusUploadResult)
+	r.DELETE("/api/uploads/tus/:id", middleware.AuthMiddleware(), handlers.DeleteTusUpload)
+
 	// WebSocket endpoint (protected by auth)
 	r.GET("/ws", middleware.AuthMiddleware(), handlers.HandleWSConnection)
 
@@ -60,12 +84,62 @@ func main() {
 	// API endpoints for getting room information (protected by auth)
 	r.GET("/api/rooms", middleware.AuthMiddleware(), handlers.GetRooms)
 	r.GET("/api/rooms/:room/messages", middleware.AuthMiddleware(), handlers.GetRoomMessages)
+	r.GET("/api/rooms/:room/moderation", middleware.AuthMiddleware(), handlers.GetModerationLog)
+	r.GET("/api/rooms/:room/pins", middleware.AuthMiddleware(), handlers.GetRoomPins)
+	r.GET("/api/rooms/:room/export", middleware.AuthMiddleware(), handlers.ExportRoom)
+
+	// Bot accounts and per-room bot allowlists
+	r.GET("/api/bots", middleware.AuthMiddleware(), handlers.GetBots)
+	r.GET("/api/rooms/:room/bots", middleware.AuthMiddleware(), handlers.GetRoomBots)
+	r.POST("/api/rooms/:room/bots", middleware.AuthMiddleware(), handlers.AllowRoomBot)
+	r.DELETE("/api/rooms/:roomId/bots/:botId", middleware.AuthMiddleware(), handlers.RemoveRoomBot)
+
+	// Slash commands: autocomplete, and commands registered by the calling bot
+	r.GET("/api/rooms/:room/commands", middleware.AuthMiddleware(), handlers.GetRoomCommands)
+	r.GET("/api/bots/me/commands", middleware.AuthMiddleware(), handlers.GetBotCommands)
+	r.PUT("/api/bots/me/commands/:name", middleware.AuthMiddleware(), handlers.RegisterBotCommand)
+	r.DELETE("/api/bots/me/commands/:name", middleware.AuthMiddleware(), handlers.DeleteBotCommand)
+
+	// Incoming webhooks; posting needs no session, only the secret in the URL
+	r.GET("/api/rooms/:room/webhooks", middleware.AuthMiddleware(), handlers.GetRoomWebhooks)
+	r.POST("/api/rooms/:room/webhooks", middleware.AuthMiddleware(), handlers.CreateRoomWebhook)
+	r.DELETE("/api/rooms/:roomId/webhooks/:webhookId", middleware.AuthMiddleware(), handlers.DeleteRoomWebhook)
+	r.POST("/api/hooks/:token", handlers.ExecuteIncomingWebhook)
+
+	// Outgoing webhooks and their delivery log
+	r.GET("/api/rooms/:room/outgoing-webhooks", middleware.AuthMiddleware(), handlers.GetRoomOutgoingWebhooks)
+	r.POST("/api/rooms/:room/outgoing-webhooks", middleware.AuthMiddleware(), handlers.CreateRoomOutgoingWebhook)
+	r.DELETE("/api/rooms/:roomId/outgoing-webhooks/:webhookId", middleware.AuthMiddleware(), handlers.DeleteRoomOutgoingWebhook)
+	r.GET("/api/rooms/:room/outgoing-webhooks/:webhookId/deliveries", middleware.AuthMiddleware(), handlers.GetOutgoingWebhookDeliveries)
+	r.POST("/api/rooms/:room/outgoing-webhooks/:webhookId/deliveries/:deliveryId/retry", middleware.AuthMiddleware(), handlers.RetryOutgoingWebhookDelivery)
 
 	// New API endpoints for private rooms
 	r.GET("/api/users/search", middleware.AuthMiddleware(), handlers.SearchUsers)
 	r.POST("/api/rooms/private", middleware.AuthMiddleware(), handlers.CreatePrivateRoom)
 	r.POST("/api/rooms/public", middleware.AuthMiddleware(), handlers.CreatePublicRoom)
 	r.DELETE("/api/rooms/:roomId", middleware.AuthMiddleware(), handlers.DeleteRoom)
+	r.PUT("/api/rooms/:roomId/members/:userId/role", middleware.AuthMiddleware(), handlers.SetRoomMemberRole)
+
+	// Message permalinks
+	r.GET("/api/messages/:uuid", middleware.AuthMiddleware(), handlers.GetMessage)
+
+	// Full-text message search
+	r.GET("/api/search", middleware.AuthMiddleware(), handlers.SearchMessages)
+
+	// Personal bookmarks
+	r.GET("/api/bookmarks", middleware.AuthMiddleware(), handlers.GetBookmarks)
+	r.POST("/api/bookmarks", middleware.AuthMiddleware(), handlers.SaveBookmark)
+	r.DELETE("/api/bookmarks/:uuid", middleware.AuthMiddleware(), handlers.DeleteBookmark)
+
+	// Admin endpoints (users listed in ADMIN_EMAILS)
+	admin := r.Group("/api/admin", middleware.AuthMiddleware(), middleware.AdminMiddleware())
+	admin.GET("/audit", handlers.GetAuditLogs)
+	admin.POST("/import", handlers.ImportArchive)
+	admin.GET("/bots", handlers.AdminListBots)
+	admin.POST("/bots", handlers.AdminCreateBot)
+	admin.POST("/bots/:botId/tokens", handlers.AdminCreateBotToken)
+	admin.DELETE("/bot-tokens/:tokenId", handlers.AdminRevokeBotToken)
+	admin.POST("/uploads/sweep", handlers.SweepUploads)
 
 	log.Println("Server starting on :8080")
 	r.Run(":8080")
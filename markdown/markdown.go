@@ -0,0 +1,520 @@
+// Package markdown renders the Markdown subset supported in chat messages to
+// sanitized HTML and extracts the links, mentions and code it contains.
+//
+// Supported syntax:
+//
+//	**bold**  *italic*  _italic_  ~~strikethrough~~  `code`
+//	[label](https://example.com)  bare http(s) URLs  @mentions
+//	```lang fenced code blocks```  > quotes  - or * list items
+//
+// All text is HTML-escaped and only the tags produced here are emitted, so the
+// output is safe to insert into a page as is. Links are limited to http, https
+// and mailto URLs.
+package markdown
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github/sabt-dev/realtimeChat/models"
+)
+
+// Result is the rendering of a message text
+type Result struct {
+	HTML     string
+	Entities []models.MessageEntity
+}
+
+// maxLinkText is the number of characters of a bare URL shown before it is shortened
+const maxLinkText = 50
+
+var (
+	languagePattern = regexp.MustCompile(`^[A-Za-z0-9_+#.-]{1,20}$`)
+	mentionPattern  = regexp.MustCompile(`^@([\p{L}\p{N}_.-]{1,32})`)
+)
+
+// span is a range of bytes in the source text
+type span struct {
+	start, end int
+}
+
+type renderer struct {
+	text     string
+	out      strings.Builder
+	entities []models.MessageEntity // Offsets in bytes until Render converts them
+	inLink   bool                   // Rendering a link label, where nested links are not allowed
+	searches map[searchKey]searchResult
+	runs     map[int][]int // Starts of backtick runs by length, see backtickRuns
+	fence    *searchResult // Last search for a closing code fence, by line
+}
+
+// searchKey identifies a search for closing syntax before the same end
+type searchKey struct {
+	what string
+	end  int
+}
+
+// searchResult records that a search starting at from first matched at, or
+// nowhere before the end if found is false
+type searchResult struct {
+	from, at int
+	found    bool
+}
+
+// Render converts text to sanitized HTML and extracts its entities
+func Render(text string) Result {
+	r := &renderer{text: text, searches: make(map[searchKey]searchResult)}
+	lines := splitLines(text)
+
+	inlineLine := false // The previous line was rendered inline and needs a line break
+	for i := 0; i < len(lines); {
+		line := text[lines[i].start:lines[i].end]
+		switch {
+		case strings.HasPrefix(line, "```"):
+			if next, ok := r.codeBlock(lines, i); ok {
+				i = next
+				inlineLine = false
+				continue
+			}
+		case strings.HasPrefix(line, ">"):
+			i = r.quote(lines, i)
+			inlineLine = false
+			continue
+		case isListItem(line):
+			i = r.list(lines, i)
+			inlineLine = false
+			continue
+		}
+
+		if inlineLine {
+			r.out.WriteString("<br>")
+		}
+		r.inline(lines[i].start, lines[i].end)
+		inlineLine = true
+		i++
+	}
+
+	return Result{HTML: r.out.String(), Entities: r.utf16Entities()}
+}
+
+// splitLines returns the lines of text without their line endings
+func splitLines(text string) []span {
+	var lines []span
+	start := 0
+	for i := 0; i <= len(text); i++ {
+		if i < len(text) && text[i] != '\n' {
+			continue
+		}
+		end := i
+		if end > start && text[end-1] == '\r' {
+			end--
+		}
+		lines = append(lines, span{start, end})
+		start = i + 1
+	}
+	return lines
+}
+
+// codeBlock renders a fenced code block starting at lines[i]. It returns the
+// index of the line after the closing fence, or false if the fence is never closed.
+func (r *renderer) codeBlock(lines []span, i int) (int, bool) {
+	// Fences are tried from the top down, so the last search is reused while
+	// it still applies instead of scanning the rest of the text for every opener
+	if prev := r.fence; prev == nil || i+1 < prev.from || prev.found && i+1 > prev.at {
+		r.fence = &searchResult{from: i + 1}
+		for j := i + 1; j < len(lines); j++ {
+			if strings.TrimSpace(r.text[lines[j].start:lines[j].end]) == "```" {
+				r.fence.at, r.fence.found = j, true
+				break
+			}
+		}
+	}
+	if !r.fence.found {
+		return i, false
+	}
+	closing := r.fence.at
+
+	language := strings.TrimSpace(r.text[lines[i].start+3 : lines[i].end])
+	if !languagePattern.MatchString(language) {
+		language = ""
+	}
+
+	content := span{lines[i].end, lines[i].end}
+	if closing > i+1 {
+		content = span{lines[i+1].start, lines[closing-1].end}
+	}
+
+	r.out.WriteString("<pre><code")
+	if language != "" {
+		r.out.WriteString(` class="language-` + html.EscapeString(language) + `"`)
+	}
+	r.out.WriteString(">")
+	r.out.WriteString(html.EscapeString(r.text[content.start:content.end]))
+	r.out.WriteString("</code></pre>")
+
+	r.addEntity(models.MessageEntity{Type: "pre", Language: language}, content)
+	return closing + 1, true
+}
+
+// quote renders consecutive lines starting with ">" as a block quote
+func (r *renderer) quote(lines []span, i int) int {
+	r.out.WriteString("<blockquote>")
+	for first := true; i < len(lines); i++ {
+		line := lines[i]
+		if !strings.HasPrefix(r.text[line.start:line.end], ">") {
+			break
+		}
+		start := line.start + 1
+		if start < line.end && r.text[start] == ' ' {
+			start++
+		}
+		if !first {
+			r.out.WriteString("<br>")
+		}
+		r.inline(start, line.end)
+		first = false
+	}
+	r.out.WriteString("</blockquote>")
+	return i
+}
+
+// isListItem reports whether a line is an unordered list item
+func isListItem(line string) bool {
+	return strings.HasPrefix(line, "- ") || strings.HasPrefix(line, "* ")
+}
+
+// list renders consecutive list items as an unordered list
+func (r *renderer) list(lines []span, i int) int {
+	r.out.WriteString("<ul>")
+	for ; i < len(lines) && isListItem(r.text[lines[i].start:lines[i].end]); i++ {
+		r.out.WriteString("<li>")
+		r.inline(lines[i].start+2, lines[i].end)
+		r.out.WriteString("</li>")
+	}
+	r.out.WriteString("</ul>")
+	return i
+}
+
+// inline renders the inline syntax between start and end. Each construct
+// returns the position after it and a function writing its output, or no
+// function when the text at i is not that construct; in that case a non-zero
+// position skips an unmatched delimiter run.
+func (r *renderer) inline(start, end int) {
+	plain := start
+	for i := start; i < end; {
+		var next int
+		var render func()
+		switch c := r.text[i]; {
+		case c == '`':
+			next, render = r.codeSpan(i, end)
+		case c == '[' && !r.inLink:
+			next, render = r.link(i, end)
+		case (c == 'h' || c == 'H') && !r.inLink && !isWordByte(r.text, i-1):
+			next, render = r.autolink(i, end)
+		case c == '@' && !r.inLink && !isWordByte(r.text, i-1):
+			next, render = r.mention(i, end)
+		case c == '*' || c == '_' || c == '~':
+			next, render = r.emphasis(i, end)
+		}
+
+		if render == nil {
+			if next > i {
+				i = next
+			} else {
+				i++
+			}
+			continue
+		}
+		r.out.WriteString(html.EscapeString(r.text[plain:i]))
+		render()
+		i, plain = next, next
+	}
+	r.out.WriteString(html.EscapeString(r.text[plain:end]))
+}
+
+// codeSpan matches text between two equally long runs of backticks
+func (r *renderer) codeSpan(i, end int) (int, func()) {
+	n := backtickRun(r.text, i, end)
+	// Runs never cross the end of the text being rendered, which is a line
+	// end or a delimiter other than a backtick
+	j := -1
+	starts := r.backtickRuns()[n]
+	if k := sort.SearchInts(starts, i+n); k < len(starts) && starts[k] < end {
+		j = starts[k]
+	}
+	if j < 0 {
+		return i + n, nil
+	}
+	content := span{i + n, j}
+	return j + n, func() {
+		r.out.WriteString("<code>")
+		r.out.WriteString(html.EscapeString(r.text[content.start:content.end]))
+		r.out.WriteString("</code>")
+		r.addEntity(models.MessageEntity{Type: "code"}, content)
+	}
+}
+
+// backtickRuns returns the starts of the runs of backticks in the text, by
+// the length of the run
+func (r *renderer) backtickRuns() map[int][]int {
+	if r.runs != nil {
+		return r.runs
+	}
+	r.runs = make(map[int][]int)
+	for j := 0; j < len(r.text); {
+		if r.text[j] != '`' {
+			j++
+			continue
+		}
+		n := backtickRun(r.text, j, len(r.text))
+		r.runs[n] = append(r.runs[n], j)
+		j += n
+	}
+	return r.runs
+}
+
+// backtickRun returns the number of backticks starting at i
+func backtickRun(text string, i, end int) int {
+	n := 0
+	for i+n < end && text[i+n] == '`' {
+		n++
+	}
+	return n
+}
+
+// link matches [label](url) with a safe URL
+func (r *renderer) link(i, end int) (int, func()) {
+	closeLabel := r.search("](", i, end, func(j int) bool {
+		return strings.HasPrefix(r.text[j:end], "](")
+	})
+	if closeLabel <= i+1 {
+		return 0, nil
+	}
+	closeURL := r.search(")", closeLabel+2, end, func(j int) bool {
+		return r.text[j] == ')'
+	})
+	if closeURL < 0 {
+		return 0, nil
+	}
+
+	target := strings.TrimSpace(r.text[closeLabel+2 : closeURL])
+	if strings.ContainsAny(target, " \t") || !safeURL(target) {
+		return 0, nil
+	}
+
+	label := span{i + 1, closeLabel}
+	return closeURL + 1, func() {
+		r.writeLinkOpen(target)
+		r.inLink = true
+		r.inline(label.start, label.end)
+		r.inLink = false
+		r.out.WriteString("</a>")
+		r.addEntity(models.MessageEntity{Type: "link", URL: target}, span{i, closeURL + 1})
+	}
+}
+
+// autolink matches a bare http(s) URL
+func (r *renderer) autolink(i, end int) (int, func()) {
+	scheme := strings.ToLower(r.text[i:min(end, i+len("https://"))])
+	if !strings.HasPrefix(scheme, "http://") && !strings.HasPrefix(scheme, "https://") {
+		return 0, nil
+	}
+
+	j := i
+	for j < end && !strings.ContainsRune(" \t<>\"", rune(r.text[j])) {
+		j++
+	}
+	// Trailing punctuation and emphasis markers usually belong to the sentence
+	opening, closing := strings.Count(r.text[i:j], "("), strings.Count(r.text[i:j], ")")
+	for j > i {
+		c := r.text[j-1]
+		if c == ')' && opening >= closing {
+			break
+		}
+		if !strings.ContainsRune(".,;:!?'*_~)", rune(c)) {
+			break
+		}
+		if c == ')' {
+			closing--
+		}
+		j--
+	}
+
+	target := r.text[i:j]
+	if !safeURL(target) {
+		return 0, nil
+	}
+	return j, func() {
+		display := target
+		if utf8.RuneCountInString(display) > maxLinkText {
+			display = string([]rune(display)[:maxLinkText-3]) + "..."
+		}
+		r.writeLinkOpen(target)
+		r.out.WriteString(html.EscapeString(display))
+		r.out.WriteString("</a>")
+		r.addEntity(models.MessageEntity{Type: "link", URL: target}, span{i, j})
+	}
+}
+
+// writeLinkOpen writes the opening tag of a link to target
+func (r *renderer) writeLinkOpen(target string) {
+	r.out.WriteString(`<a href="`)
+	r.out.WriteString(html.EscapeString(target))
+	r.out.WriteString(`" target="_blank" rel="noopener noreferrer nofollow" class="message-link">`)
+}
+
+// safeURL reports whether target is an absolute http, https or mailto URL
+func safeURL(target string) bool {
+	u, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return u.Host != ""
+	case "mailto":
+		return u.Opaque != ""
+	}
+	return false
+}
+
+// mention matches @name
+func (r *renderer) mention(i, end int) (int, func()) {
+	match := mentionPattern.FindStringSubmatch(r.text[i:end])
+	if match == nil {
+		return 0, nil
+	}
+	name := strings.TrimRight(match[1], ".-")
+	if name == "" {
+		return 0, nil
+	}
+	next := i + 1 + len(name)
+	return next, func() {
+		r.out.WriteString(`<span class="mention">@`)
+		r.out.WriteString(html.EscapeString(name))
+		r.out.WriteString("</span>")
+		r.addEntity(models.MessageEntity{Type: "mention", Username: name}, span{i, next})
+	}
+}
+
+// emphasis matches **bold**, ~~strikethrough~~, *italic* and _italic_
+func (r *renderer) emphasis(i, end int) (int, func()) {
+	delim, tag := r.text[i:i+1], "em"
+	switch {
+	case strings.HasPrefix(r.text[i:end], "**"):
+		delim, tag = "**", "strong"
+	case strings.HasPrefix(r.text[i:end], "~~"):
+		delim, tag = "~~", "del"
+	case delim == "~":
+		return 0, nil
+	}
+	// Underscores inside words, as in snake_case, are not emphasis
+	if delim == "_" && isWordByte(r.text, i-1) {
+		return 0, nil
+	}
+
+	innerStart := i + len(delim)
+	if innerStart >= end || isSpace(r.text[innerStart]) {
+		return 0, nil
+	}
+	j := r.search(delim, innerStart+1, end, func(j int) bool {
+		if !strings.HasPrefix(r.text[j:end], delim) || isSpace(r.text[j-1]) {
+			return false
+		}
+		// A single delimiter must not be part of a double one
+		if len(delim) == 1 && (r.text[j-1] == delim[0] || (j+1 < end && r.text[j+1] == delim[0])) {
+			return false
+		}
+		return delim != "_" || !isWordByte(r.text, j+1) || j+1 >= end
+	})
+	if j < 0 {
+		return 0, nil
+	}
+
+	inner := span{innerStart, j}
+	return j + len(delim), func() {
+		r.out.WriteString("<" + tag + ">")
+		r.inline(inner.start, inner.end)
+		r.out.WriteString("</" + tag + ">")
+	}
+}
+
+// search returns the first position in [from, end) where match reports true,
+// or -1. The closing syntax found at a position does not depend on where its
+// opener is, and openers are tried from left to right, so results are reused
+// by later searches for the same thing instead of scanning the rest of the
+// line again for every unmatched opener.
+func (r *renderer) search(what string, from, end int, match func(j int) bool) int {
+	key := searchKey{what, end}
+	if prev, ok := r.searches[key]; ok && from >= prev.from && (!prev.found || from <= prev.at) {
+		if !prev.found {
+			return -1
+		}
+		return prev.at
+	}
+
+	result := searchResult{from: from}
+	for j := from; j < end; j++ {
+		if match(j) {
+			result.at, result.found = j, true
+			break
+		}
+	}
+	r.searches[key] = result
+	if !result.found {
+		return -1
+	}
+	return result.at
+}
+
+// isWordByte reports whether text[i] is a letter, digit or underscore
+func isWordByte(text string, i int) bool {
+	if i < 0 || i >= len(text) {
+		return false
+	}
+	c := text[i]
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// isSpace reports whether c is a space or tab
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
+// addEntity records an entity covering the bytes in s
+func (r *renderer) addEntity(entity models.MessageEntity, s span) {
+	entity.Offset, entity.Length = s.start, s.end-s.start
+	r.entities = append(r.entities, entity)
+}
+
+// utf16Entities returns the entities sorted by position, with their byte
+// offsets converted to UTF-16 code units
+func (r *renderer) utf16Entities() []models.MessageEntity {
+	sort.SliceStable(r.entities, func(a, b int) bool {
+		return r.entities[a].Offset < r.entities[b].Offset
+	})
+	pos, units := 0, 0 // Offsets converted so far, in bytes and in UTF-16 code units
+	for k := range r.entities {
+		e := &r.entities[k]
+		start, end := e.Offset, e.Offset+e.Length
+		units += utf16Len(r.text[pos:start])
+		pos = start
+		e.Offset = units
+		e.Length = utf16Len(r.text[start:end])
+	}
+	return r.entities
+}
+
+// utf16Len returns the length of s in UTF-16 code units
+func utf16Len(s string) int {
+	n := 0
+	for _, c := range s {
+		n += utf16.RuneLen(c)
+	}
+	return n
+}
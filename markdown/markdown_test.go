@@ -0,0 +1,180 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const linkAttrs = `" target="_blank" rel="noopener noreferrer nofollow" class="message-link">`
+
+func TestRenderEscapesHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "script tag",
+			text: `<script>alert("x")</script>`,
+			want: `&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;`,
+		},
+		{
+			name: "event handler attribute",
+			text: `<img src=x onerror=alert(1)>`,
+			want: `&lt;img src=x onerror=alert(1)&gt;`,
+		},
+		{
+			name: "script inside emphasis",
+			text: `**<script>x</script>**`,
+			want: `<strong>&lt;script&gt;x&lt;/script&gt;</strong>`,
+		},
+		{
+			name: "script inside code span",
+			text: "`<script>`",
+			want: `<code>&lt;script&gt;</code>`,
+		},
+		{
+			name: "script inside code block",
+			text: "```html\n<script>x</script>\n```",
+			want: `<pre><code class="language-html">&lt;script&gt;x&lt;/script&gt;</code></pre>`,
+		},
+		{
+			name: "code block language cannot break out of the attribute",
+			text: "```\"><script>\nx\n```",
+			want: `<pre><code>x</code></pre>`,
+		},
+		{
+			name: "script inside quote",
+			text: `> <script>`,
+			want: `<blockquote>&lt;script&gt;</blockquote>`,
+		},
+		{
+			name: "script inside list item",
+			text: `- <b>bold</b>`,
+			want: `<ul><li>&lt;b&gt;bold&lt;/b&gt;</li></ul>`,
+		},
+		{
+			name: "script inside link label",
+			text: `[<script>](https://example.com)`,
+			want: `<a href="https://example.com` + linkAttrs + `&lt;script&gt;</a>`,
+		},
+		{
+			name: "quote in link target",
+			text: `[x](https://example.com/"onmouseover="alert(1))`,
+			want: `<a href="https://example.com/&#34;onmouseover=&#34;alert(1` + linkAttrs + `x</a>)`,
+		},
+		{
+			name: "ampersand",
+			text: `Tom & Jerry`,
+			want: `Tom &amp; Jerry`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Render(tt.text).HTML; got != tt.want {
+				t.Errorf("Render(%q).HTML = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderRejectsUnsafeLinks(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{name: "javascript link", text: `[click](javascript:alert(1))`},
+		{name: "javascript link in upper case", text: `[click](JavaScript:alert(1))`},
+		{name: "javascript link with leading space", text: `[click]( javascript:alert(1))`},
+		{name: "data link", text: `[click](data:text/html;base64,PHNjcmlwdD4=)`},
+		{name: "vbscript link", text: `[click](vbscript:msgbox(1))`},
+		{name: "relative link", text: `[click](/admin)`},
+		{name: "protocol relative link", text: `[click](//evil.example)`},
+		{name: "http link without host", text: `[click](http:alert(1))`},
+		{name: "javascript after http prefix", text: `http:javascript:alert(1)`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Render(tt.text)
+			if strings.Contains(result.HTML, "<a ") {
+				t.Errorf("Render(%q).HTML = %q, want no link", tt.text, result.HTML)
+			}
+			for _, entity := range result.Entities {
+				if entity.Type == "link" {
+					t.Errorf("Render(%q) has link entity %+v", tt.text, entity)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderSafeLinks(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		wantURL string
+	}{
+		{name: "https link", text: `[docs](https://example.com/docs)`, wantURL: "https://example.com/docs"},
+		{name: "http link", text: `[docs](http://example.com)`, wantURL: "http://example.com"},
+		{name: "mailto link", text: `[mail](mailto:someone@example.com)`, wantURL: "mailto:someone@example.com"},
+		{name: "bare URL", text: `see https://example.com/a?b=1.`, wantURL: "https://example.com/a?b=1"},
+		{name: "bare URL in parentheses", text: `(https://example.com/wiki/Go_(language))`, wantURL: "https://example.com/wiki/Go_(language)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Render(tt.text)
+			if len(result.Entities) != 1 || result.Entities[0].Type != "link" || result.Entities[0].URL != tt.wantURL {
+				t.Fatalf("Render(%q).Entities = %+v, want one link to %q", tt.text, result.Entities, tt.wantURL)
+			}
+			if !strings.Contains(result.HTML, `<a href="`+tt.wantURL+linkAttrs) {
+				t.Errorf("Render(%q).HTML = %q, want a link to %q", tt.text, result.HTML, tt.wantURL)
+			}
+		})
+	}
+}
+
+// backtickRuns builds runs of backticks of increasing length, each of which
+// has no closing run
+func backtickRuns(size int) string {
+	var b strings.Builder
+	for n := 1; b.Len() < size; n++ {
+		b.WriteString(strings.Repeat("`", n) + " a ")
+	}
+	return b.String()
+}
+
+func TestRenderUnmatchedSyntaxIsLinear(t *testing.T) {
+	const size = 160 << 10
+	tests := []struct {
+		name string
+		text string
+	}{
+		{name: "bold", text: strings.Repeat("**a ", size/4)},
+		{name: "italic", text: strings.Repeat("*a ", size/3)},
+		{name: "underscore", text: strings.Repeat("_a ", size/3)},
+		{name: "strikethrough", text: strings.Repeat("~~a ", size/4)},
+		{name: "link without closing parenthesis", text: strings.Repeat("[a](b ", size/6)},
+		{name: "brackets", text: strings.Repeat("[", size)},
+		{name: "words starting with h", text: strings.Repeat("h ", size/2)},
+		{name: "URL with closing parentheses", text: "http://a" + strings.Repeat(")", size)},
+		{name: "backtick runs", text: backtickRuns(size)},
+		{name: "code fences", text: strings.Repeat("```a\n", size/5)},
+		{name: "mixed", text: strings.Repeat("**_~~*`[a](", size/11)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			Render(tt.text)
+			// A linear renderer takes milliseconds; rescanning the rest of the
+			// text for every unmatched opener takes many seconds
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("Render() of %d bytes took %v", len(tt.text), elapsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,422 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+)
+
+// WaveformSamples is the most values a voice message waveform has
+const WaveformSamples = 100
+
+// ErrNotVoice is returned for audio that is not Opus in a WebM or Ogg container
+var ErrNotVoice = errors.New("not an Opus audio recording")
+
+var (
+	typeWebMAudio = FileType{MIMEType: "audio/webm", Ext: ".weba", Kind: "audio"}
+	typeOggOpus   = FileType{MIMEType: "audio/ogg", Ext: ".opus", Kind: "audio"}
+)
+
+// AudioInfo describes a voice recording
+type AudioInfo struct {
+	Type     FileType
+	Duration time.Duration
+	Waveform []int // Up to WaveformSamples levels from 0 to 100, evenly spread over Duration
+}
+
+// opusPacket is one Opus packet of a recording and when it starts
+type opusPacket struct {
+	start time.Duration
+	data  []byte
+}
+
+// MayBeVoice reports whether files of the given type can hold a voice
+// recording that ProbeAudio understands
+func MayBeVoice(fileType FileType) bool {
+	return fileType == typeWebM || fileType == typeOgg
+}
+
+// ProbeAudio reads the duration of an Opus recording in a WebM or Ogg file
+// and computes its waveform without decoding the audio. Opus is encoded with
+// a variable bitrate, so the bitrate of each packet follows the loudness of
+// the speech closely enough to draw the waveform from.
+func ProbeAudio(data []byte) (*AudioInfo, error) {
+	var (
+		info     AudioInfo
+		packets  []opusPacket
+		duration time.Duration
+		err      error
+	)
+	switch {
+	case bytes.HasPrefix(data, ebmlMagic):
+		info.Type = typeWebMAudio
+		packets, duration, err = webmOpusPackets(data)
+	case bytes.HasPrefix(data, []byte("OggS")):
+		info.Type = typeOggOpus
+		packets, duration, err = oggOpusPackets(data)
+	default:
+		return nil, ErrNotVoice
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(packets) == 0 {
+		return nil, ErrNotVoice
+	}
+
+	if duration <= 0 {
+		last := packets[len(packets)-1]
+		duration = last.start + opusPacketDuration(last.data)
+	}
+	info.Duration = duration
+	info.Waveform = waveform(packets, duration)
+	return &info, nil
+}
+
+// waveform spreads the bitrate of each packet over evenly sized buckets and
+// scales the result to 0-100 between the quietest and loudest bucket
+func waveform(packets []opusPacket, duration time.Duration) []int {
+	samples := min(WaveformSamples, len(packets))
+	if samples == 0 || duration <= 0 {
+		return nil
+	}
+
+	sums := make([]float64, samples)
+	counts := make([]int, samples)
+	for _, packet := range packets {
+		packetDuration := opusPacketDuration(packet.data)
+		if packetDuration <= 0 {
+			continue
+		}
+		bucket := int(int64(packet.start) * int64(samples) / int64(duration))
+		bucket = max(0, min(samples-1, bucket))
+		sums[bucket] += float64(len(packet.data)) / packetDuration.Seconds()
+		counts[bucket]++
+	}
+
+	levels := make([]float64, samples)
+	low, high := math.Inf(1), math.Inf(-1)
+	for i := range levels {
+		switch {
+		case counts[i] > 0:
+			levels[i] = sums[i] / float64(counts[i])
+		case i > 0:
+			levels[i] = levels[i-1] // A gap in the recording
+		}
+		low, high = math.Min(low, levels[i]), math.Max(high, levels[i])
+	}
+
+	result := make([]int, samples)
+	if high > low {
+		for i, level := range levels {
+			result[i] = int(math.Round((level - low) / (high - low) * 100))
+		}
+	}
+	return result
+}
+
+// opusPacketDuration reads the duration of an Opus packet from its TOC byte
+// (RFC 6716, section 3.1)
+func opusPacketDuration(packet []byte) time.Duration {
+	if len(packet) == 0 {
+		return 0
+	}
+	toc := packet[0]
+	config := toc >> 3
+
+	var frame time.Duration
+	switch {
+	case config < 12: // SILK
+		frame = []time.Duration{10, 20, 40, 60}[config%4] * time.Millisecond
+	case config < 16: // Hybrid
+		frame = []time.Duration{10, 20}[config%2] * time.Millisecond
+	default: // CELT
+		frame = []time.Duration{2500, 5000, 10000, 20000}[config%4] * time.Microsecond
+	}
+
+	frames := 1
+	switch toc & 3 {
+	case 1, 2:
+		frames = 2
+	case 3:
+		if len(packet) < 2 {
+			return 0
+		}
+		frames = int(packet[1] & 0x3F)
+	}
+	return frame * time.Duration(frames)
+}
+
+// oggOpusPackets extracts the audio packets of an Ogg file with a single
+// Opus stream. The duration comes from the granule position
+// of the last page, less the encoder's pre-skip.
+func oggOpusPackets(data []byte) ([]opusPacket, time.Duration, error) {
+	var (
+		packets  []opusPacket
+		partial  []byte
+		serial   uint32
+		headers  int
+		preSkip  int64
+		granule  int64 = -1
+		position time.Duration
+	)
+
+	for i := 0; i < len(data); {
+		if i+27 > len(data) || string(data[i:i+4]) != "OggS" {
+			return nil, 0, errMalformed
+		}
+		pageGranule := int64(binary.LittleEndian.Uint64(data[i+6 : i+14]))
+		pageSerial := binary.LittleEndian.Uint32(data[i+14 : i+18])
+		segments := int(data[i+26])
+		body := i + 27 + segments
+		if body > len(data) {
+			return nil, 0, errMalformed
+		}
+		lacing := data[i+27 : body]
+		end := body
+		for _, size := range lacing {
+			end += int(size)
+		}
+		if end > len(data) {
+			return nil, 0, errMalformed
+		}
+
+		if i == 0 {
+			serial = pageSerial
+		}
+		if pageSerial != serial {
+			// Recordings with more than one stream (e.g. with video) are not voice messages
+			return nil, 0, ErrNotVoice
+		}
+		if pageGranule != -1 {
+			granule = pageGranule
+		}
+
+		offset := body
+		for _, size := range lacing {
+			partial = append(partial, data[offset:offset+int(size)]...)
+			offset += int(size)
+			if size == 255 {
+				continue // The packet continues in the next segment
+			}
+			packet := partial
+			partial = nil
+
+			switch headers {
+			case 0:
+				if len(packet) < 19 || !bytes.HasPrefix(packet, []byte("OpusHead")) {
+					return nil, 0, ErrNotVoice
+				}
+				preSkip = int64(binary.LittleEndian.Uint16(packet[10:12]))
+				headers++
+			case 1:
+				// OpusTags
+				headers++
+			default:
+				packets = append(packets, opusPacket{start: position, data: packet})
+				position += opusPacketDuration(packet)
+			}
+		}
+		i = end
+	}
+
+	if headers == 0 {
+		return nil, 0, ErrNotVoice
+	}
+	var duration time.Duration
+	if granule > preSkip {
+		// Opus granule positions always count 48kHz samples
+		duration = time.Duration(granule-preSkip) * time.Second / 48000
+	}
+	return packets, duration, nil
+}
+
+// ebmlMagic starts every WebM and Matroska file
+var ebmlMagic = []byte{0x1A, 0x45, 0xDF, 0xA3}
+
+// WebM element IDs used to find the audio
+const (
+	ebmlSegment       = 0x18538067
+	ebmlInfo          = 0x1549A966
+	ebmlTimecodeScale = 0x2AD7B1
+	ebmlDuration      = 0x4489
+	ebmlTracks        = 0x1654AE6B
+	ebmlTrackEntry    = 0xAE
+	ebmlTrackNumber   = 0xD7
+	ebmlTrackType     = 0x83
+	ebmlCodecID       = 0x86
+	ebmlCluster       = 0x1F43B675
+	ebmlTimecode      = 0xE7
+	ebmlBlockGroup    = 0xA0
+	ebmlBlock         = 0xA1
+	ebmlSimpleBlock   = 0xA3
+)
+
+// webmTrack is a track declared in a WebM file
+type webmTrack struct {
+	number    uint64
+	trackType uint64 // 1 for video, 2 for audio
+	codec     string
+}
+
+// webmBlock is a frame of a WebM track and its timestamp in timecode units
+type webmBlock struct {
+	track uint64
+	time  int64
+	data  []byte
+}
+
+// webmOpusPackets extracts the Opus packets of a WebM file that has a single
+// Opus audio track and no video. Browsers record WebM as a live stream, with
+// unknown element sizes and often no duration, so elements are read in order
+// instead of as a tree, and the duration falls back to the end of the last packet.
+func webmOpusPackets(data []byte) ([]opusPacket, time.Duration, error) {
+	var (
+		tracks       []webmTrack
+		blocks       []webmBlock
+		scale        = uint64(time.Millisecond) // Nanoseconds per timecode unit
+		infoDuration float64
+		clusterTime  int64
+	)
+
+	for i := 0; i < len(data); {
+		id, idLength, ok := readVint(data[i:], true)
+		if !ok {
+			return nil, 0, errMalformed
+		}
+		size, sizeLength, ok := readVint(data[i+idLength:], false)
+		if !ok {
+			return nil, 0, errMalformed
+		}
+		body := i + idLength + sizeLength
+		end := len(data)
+		if !isUnknownSize(size, sizeLength) && size <= uint64(len(data)-body) {
+			end = body + int(size)
+		}
+		payload := data[body:end]
+
+		switch id {
+		case ebmlSegment, ebmlInfo, ebmlTracks, ebmlCluster, ebmlBlockGroup:
+			// Read the children in place
+			i = body
+			continue
+		case ebmlTrackEntry:
+			tracks = append(tracks, webmTrack{})
+			i = body
+			continue
+		case ebmlTimecodeScale:
+			if value := readUint(payload); value > 0 {
+				scale = value
+			}
+		case ebmlDuration:
+			infoDuration = readFloat(payload)
+		case ebmlTrackNumber, ebmlTrackType, ebmlCodecID:
+			if len(tracks) == 0 {
+				break
+			}
+			track := &tracks[len(tracks)-1]
+			switch id {
+			case ebmlTrackNumber:
+				track.number = readUint(payload)
+			case ebmlTrackType:
+				track.trackType = readUint(payload)
+			default:
+				track.codec = string(bytes.TrimRight(payload, "\x00"))
+			}
+		case ebmlTimecode:
+			clusterTime = int64(readUint(payload))
+		case ebmlBlock, ebmlSimpleBlock:
+			track, trackLength, ok := readVint(payload, false)
+			if !ok || len(payload) < trackLength+3 {
+				return nil, 0, errMalformed
+			}
+			relative := int16(binary.BigEndian.Uint16(payload[trackLength : trackLength+2]))
+			blocks = append(blocks, webmBlock{
+				track: track,
+				time:  clusterTime + int64(relative),
+				data:  payload[trackLength+3:],
+			})
+		}
+		i = end
+	}
+
+	var audio *webmTrack
+	for k := range tracks {
+		switch {
+		case tracks[k].trackType == 1:
+			return nil, 0, ErrNotVoice
+		case tracks[k].codec == "A_OPUS" && audio == nil:
+			audio = &tracks[k]
+		}
+	}
+	if audio == nil {
+		return nil, 0, ErrNotVoice
+	}
+
+	var packets []opusPacket
+	var first int64
+	for _, block := range blocks {
+		if block.track != audio.number {
+			continue
+		}
+		if len(packets) == 0 {
+			first = block.time
+		}
+		packets = append(packets, opusPacket{
+			start: time.Duration(uint64(max(0, block.time-first)) * scale),
+			data:  block.data,
+		})
+	}
+	return packets, time.Duration(infoDuration * float64(scale)), nil
+}
+
+// readVint reads an EBML variable-length integer. Element IDs keep their
+// length marker bit; sizes do not.
+func readVint(data []byte, keepMarker bool) (uint64, int, bool) {
+	if len(data) == 0 || data[0] == 0 {
+		return 0, 0, false
+	}
+	length := 1
+	for mask := byte(0x80); data[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > 8 || len(data) < length {
+		return 0, 0, false
+	}
+
+	value := uint64(data[0])
+	if !keepMarker {
+		value &= uint64(0xFF >> length)
+	}
+	for _, b := range data[1:length] {
+		value = value<<8 | uint64(b)
+	}
+	return value, length, true
+}
+
+// isUnknownSize reports whether an element size has all its bits set, which
+// marks an element that runs to the end of its parent
+func isUnknownSize(size uint64, length int) bool {
+	return size == 1<<(7*length)-1
+}
+
+func readUint(data []byte) uint64 {
+	var value uint64
+	for _, b := range data {
+		value = value<<8 | uint64(b)
+	}
+	return value
+}
+
+func readFloat(data []byte) float64 {
+	switch len(data) {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data)))
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(data))
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,313 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// opusFrame is a 20ms CELT packet with a single frame of the given size
+func opusFrame(size int) []byte {
+	packet := make([]byte, size)
+	packet[0] = 31 << 3
+	return packet
+}
+
+// voicePackets are 20ms packets that get louder over the recording
+func voicePackets(count int) [][]byte {
+	packets := make([][]byte, count)
+	for k := range packets {
+		packets[k] = opusFrame(10 + 10*k)
+	}
+	return packets
+}
+
+// ebml builds a WebM element with an 8-byte size, or an unknown size when
+// payload is nil
+func ebml(id []byte, payload []byte) []byte {
+	element := append([]byte(nil), id...)
+	if payload == nil {
+		return append(element, 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF)
+	}
+	size := binary.BigEndian.AppendUint64(nil, uint64(len(payload)))
+	size[0] = 0x01
+	return append(append(element, size...), payload...)
+}
+
+func concat(parts ...[]byte) []byte {
+	var out []byte
+	for _, part := range parts {
+		out = append(out, part...)
+	}
+	return out
+}
+
+var (
+	idSegment     = []byte{0x18, 0x53, 0x80, 0x67}
+	idInfo        = []byte{0x15, 0x49, 0xA9, 0x66}
+	idScale       = []byte{0x2A, 0xD7, 0xB1}
+	idDuration    = []byte{0x44, 0x89}
+	idTracks      = []byte{0x16, 0x54, 0xAE, 0x6B}
+	idTrackEntry  = []byte{0xAE}
+	idTrackNumber = []byte{0xD7}
+	idTrackType   = []byte{0x83}
+	idCodecID     = []byte{0x86}
+	idCluster     = []byte{0x1F, 0x43, 0xB6, 0x75}
+	idTimecode    = []byte{0xE7}
+	idSimpleBlock = []byte{0xA3}
+)
+
+func webmHeader() []byte {
+	return ebml(ebmlMagic, ebml([]byte{0x42, 0x82}, []byte("webm")))
+}
+
+func webmTrackEntry(number, trackType byte, codec string) []byte {
+	return ebml(idTrackEntry, concat(
+		ebml(idTrackNumber, []byte{number}),
+		ebml(idTrackType, []byte{trackType}),
+		ebml(idCodecID, []byte(codec)),
+	))
+}
+
+// webmCluster builds a cluster of 20ms blocks on track 1 starting at timecode
+func webmCluster(timecode uint16, packets [][]byte) []byte {
+	body := ebml(idTimecode, binary.BigEndian.AppendUint16(nil, timecode))
+	for k, packet := range packets {
+		block := binary.BigEndian.AppendUint16([]byte{0x81}, uint16(20*k))
+		block = append(block, 0x80)
+		body = append(body, ebml(idSimpleBlock, append(block, packet...))...)
+	}
+	return ebml(idCluster, body)
+}
+
+// webmFile builds a WebM recording as browsers write it, with a Segment and
+// Cluster of unknown size, and an Info duration in milliseconds when duration > 0
+func webmFile(duration float64, tracks []byte, packets [][]byte) []byte {
+	info := ebml(idScale, []byte{0x0F, 0x42, 0x40})
+	if duration > 0 {
+		info = append(info, ebml(idDuration, binary.BigEndian.AppendUint64(nil, math.Float64bits(duration)))...)
+	}
+	segment := concat(ebml(idInfo, info), ebml(idTracks, tracks))
+	cluster := webmCluster(0, packets)
+	// A live recording's cluster has no size: drop the known size for an unknown one
+	cluster = concat(idCluster, []byte{0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, cluster[len(idCluster)+8:])
+	return concat(webmHeader(), ebml(idSegment, nil), segment, cluster)
+}
+
+// oggPage builds an Ogg page holding whole packets
+func oggPage(serial uint32, granule int64, packets ...[]byte) []byte {
+	var lacing, body []byte
+	for _, packet := range packets {
+		size := len(packet)
+		for ; size >= 255; size -= 255 {
+			lacing = append(lacing, 255)
+		}
+		lacing = append(lacing, byte(size))
+		body = append(body, packet...)
+	}
+	page := []byte("OggS\x00\x00")
+	page = binary.LittleEndian.AppendUint64(page, uint64(granule))
+	page = binary.LittleEndian.AppendUint32(page, serial)
+	page = append(page, make([]byte, 8)...) // Sequence number and CRC
+	page = append(page, byte(len(lacing)))
+	return concat(page, lacing, body)
+}
+
+const oggPreSkip = 312
+
+func opusHead() []byte {
+	head := []byte("OpusHead\x01\x01")
+	head = binary.LittleEndian.AppendUint16(head, oggPreSkip)
+	head = binary.LittleEndian.AppendUint32(head, 48000)
+	return append(head, 0, 0, 0)
+}
+
+// oggFile builds an Ogg Opus recording with up to 10 audio packets per page
+func oggFile(packets [][]byte) []byte {
+	data := concat(
+		oggPage(1, 0, opusHead()),
+		oggPage(1, 0, []byte("OpusTags\x00\x00\x00\x00\x00\x00\x00\x00")),
+	)
+	for start := 0; start < len(packets); start += 10 {
+		end := min(start+10, len(packets))
+		data = append(data, oggPage(1, int64(oggPreSkip+end*960), packets[start:end]...)...)
+	}
+	return data
+}
+
+func TestProbeAudio(t *testing.T) {
+	opusTrack := webmTrackEntry(1, 2, "A_OPUS")
+	long := append(voicePackets(3), opusFrame(600))
+
+	tests := []struct {
+		name         string
+		data         []byte
+		wantType     FileType
+		wantDuration time.Duration
+		wantSamples  int
+	}{
+		{name: "WebM with a duration", data: webmFile(250, opusTrack, voicePackets(10)), wantType: typeWebMAudio, wantDuration: 250 * time.Millisecond, wantSamples: 10},
+		{name: "WebM without a duration", data: webmFile(0, opusTrack, voicePackets(10)), wantType: typeWebMAudio, wantDuration: 200 * time.Millisecond, wantSamples: 10},
+		{
+			name:         "WebM with a second audio track",
+			data:         webmFile(0, concat(opusTrack, webmTrackEntry(2, 2, "A_VORBIS")), voicePackets(4)),
+			wantType:     typeWebMAudio,
+			wantDuration: 80 * time.Millisecond,
+			wantSamples:  4,
+		},
+		{name: "Ogg", data: oggFile(voicePackets(10)), wantType: typeOggOpus, wantDuration: 200 * time.Millisecond, wantSamples: 10},
+		{name: "Ogg packet spanning lacing segments", data: oggFile(long), wantType: typeOggOpus, wantDuration: 80 * time.Millisecond, wantSamples: 4},
+		{name: "many packets", data: oggFile(voicePackets(250)), wantType: typeOggOpus, wantDuration: 5 * time.Second, wantSamples: WaveformSamples},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := ProbeAudio(tt.data)
+			if err != nil {
+				t.Fatalf("ProbeAudio() error = %v", err)
+			}
+			if info.Type != tt.wantType {
+				t.Errorf("ProbeAudio() type = %+v, want %+v", info.Type, tt.wantType)
+			}
+			if info.Duration != tt.wantDuration {
+				t.Errorf("ProbeAudio() duration = %v, want %v", info.Duration, tt.wantDuration)
+			}
+			if len(info.Waveform) != tt.wantSamples {
+				t.Fatalf("ProbeAudio() waveform has %d samples, want %d", len(info.Waveform), tt.wantSamples)
+			}
+			// Packets get larger, so the recording gets louder
+			if first, last := info.Waveform[0], info.Waveform[len(info.Waveform)-1]; first != 0 || last != 100 {
+				t.Errorf("ProbeAudio() waveform runs from %d to %d, want 0 to 100", first, last)
+			}
+		})
+	}
+}
+
+func TestProbeAudioMalformed(t *testing.T) {
+	opusTrack := webmTrackEntry(1, 2, "A_OPUS")
+	webm := webmFile(0, opusTrack, voicePackets(3))
+	ogg := oggFile(voicePackets(3))
+	firstPage := len(oggPage(1, 0, opusHead()))
+	badCapture := append([]byte(nil), ogg...)
+	copy(badCapture[firstPage:], "Oggs")
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{name: "not a container", data: []byte("ID3\x04\x00"), wantErr: ErrNotVoice},
+		{name: "empty", data: nil, wantErr: ErrNotVoice},
+
+		{name: "WebM magic only", data: ebmlMagic, wantErr: errMalformed},
+		{name: "WebM truncated in an element size", data: webm[:len(webmHeader())+6], wantErr: errMalformed},
+		{name: "WebM zero byte instead of an element ID", data: concat(webmHeader(), []byte{0x00, 0x81, 0x00}), wantErr: errMalformed},
+		{name: "WebM element size too long", data: concat(webmHeader(), []byte{0xEC, 0x00, 0x00}), wantErr: errMalformed},
+		{
+			name:    "WebM block shorter than its header",
+			data:    concat(webmHeader(), ebml(idTracks, opusTrack), ebml(idCluster, ebml(idSimpleBlock, []byte{0x81, 0x00}))),
+			wantErr: errMalformed,
+		},
+		{name: "WebM header only", data: webmHeader(), wantErr: ErrNotVoice},
+		{name: "WebM with video", data: webmFile(0, concat(webmTrackEntry(1, 1, "V_VP8"), webmTrackEntry(2, 2, "A_OPUS")), voicePackets(3)), wantErr: ErrNotVoice},
+		{name: "WebM with Vorbis audio", data: webmFile(0, webmTrackEntry(1, 2, "A_VORBIS"), voicePackets(3)), wantErr: ErrNotVoice},
+		{name: "WebM without blocks", data: webmFile(0, opusTrack, nil), wantErr: ErrNotVoice},
+		{name: "WebM blocks on another track", data: webmFile(0, webmTrackEntry(2, 2, "A_OPUS"), voicePackets(3)), wantErr: ErrNotVoice},
+
+		{name: "Ogg page header truncated", data: ogg[:20], wantErr: errMalformed},
+		{name: "Ogg lacing table truncated", data: ogg[:27], wantErr: errMalformed},
+		{name: "Ogg page body truncated", data: ogg[:len(ogg)-1], wantErr: errMalformed},
+		{name: "Ogg bad capture pattern", data: badCapture, wantErr: errMalformed},
+		{name: "Ogg trailing garbage", data: concat(ogg, []byte("garbage")), wantErr: errMalformed},
+		{name: "Ogg Vorbis", data: oggPage(1, 0, []byte("\x01vorbis\x00\x00\x00\x00\x01\x44\xAC\x00\x00")), wantErr: ErrNotVoice},
+		{name: "Ogg short OpusHead", data: oggPage(1, 0, []byte("OpusHead\x01")), wantErr: ErrNotVoice},
+		{name: "Ogg with a second stream", data: concat(ogg, oggPage(2, 0, []byte("\x80theora"))), wantErr: ErrNotVoice},
+		{name: "Ogg headers only", data: oggFile(nil), wantErr: ErrNotVoice},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := ProbeAudio(tt.data)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ProbeAudio() = %+v, %v, want error %v", info, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProbeAudioTruncated(t *testing.T) {
+	files := map[string][]byte{
+		"WebM": webmFile(60, webmTrackEntry(1, 2, "A_OPUS"), voicePackets(3)),
+		"Ogg":  oggFile(voicePackets(3)),
+	}
+
+	// Every prefix of a recording must be rejected or probed without panicking
+	for name, data := range files {
+		t.Run(name, func(t *testing.T) {
+			for n := 0; n < len(data); n++ {
+				info, err := ProbeAudio(data[:n])
+				if err == nil && (info.Duration < 0 || len(info.Waveform) == 0) {
+					t.Errorf("ProbeAudio() of %d bytes = %+v", n, info)
+				}
+			}
+		})
+	}
+}
+
+func TestOpusPacketDuration(t *testing.T) {
+	tests := []struct {
+		name   string
+		packet []byte
+		want   time.Duration
+	}{
+		{name: "empty", packet: nil, want: 0},
+		{name: "SILK 10ms", packet: []byte{0 << 3}, want: 10 * time.Millisecond},
+		{name: "SILK 60ms", packet: []byte{3 << 3}, want: 60 * time.Millisecond},
+		{name: "hybrid 20ms", packet: []byte{13 << 3}, want: 20 * time.Millisecond},
+		{name: "CELT 2.5ms", packet: []byte{16 << 3}, want: 2500 * time.Microsecond},
+		{name: "CELT 20ms", packet: []byte{31 << 3}, want: 20 * time.Millisecond},
+		{name: "two frames", packet: []byte{31<<3 | 1}, want: 40 * time.Millisecond},
+		{name: "two frames of different sizes", packet: []byte{31<<3 | 2}, want: 40 * time.Millisecond},
+		{name: "frame count", packet: []byte{31<<3 | 3, 0x80 | 3}, want: 60 * time.Millisecond},
+		{name: "frame count missing", packet: []byte{31<<3 | 3}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := opusPacketDuration(tt.packet); got != tt.want {
+				t.Errorf("opusPacketDuration(% x) = %v, want %v", tt.packet, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadVint(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       []byte
+		keepMarker bool
+		want       uint64
+		wantLength int
+		wantOK     bool
+	}{
+		{name: "one byte size", data: []byte{0x81}, want: 1, wantLength: 1, wantOK: true},
+		{name: "one byte ID", data: []byte{0xA3}, keepMarker: true, want: 0xA3, wantLength: 1, wantOK: true},
+		{name: "four byte ID", data: []byte{0x1A, 0x45, 0xDF, 0xA3}, keepMarker: true, want: 0x1A45DFA3, wantLength: 4, wantOK: true},
+		{name: "two byte size", data: []byte{0x40, 0x02}, want: 2, wantLength: 2, wantOK: true},
+		{name: "eight byte size", data: []byte{0x01, 0, 0, 0, 0, 0, 0x01, 0x00}, want: 256, wantLength: 8, wantOK: true},
+		{name: "empty", data: nil},
+		{name: "zero first byte", data: []byte{0x00, 0x81}},
+		{name: "truncated", data: []byte{0x20, 0x01}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, length, ok := readVint(tt.data, tt.keepMarker)
+			if got != tt.want || length != tt.wantLength || ok != tt.wantOK {
+				t.Errorf("readVint(% x) = %d, %d, %v, want %d, %d, %v", tt.data, got, length, ok, tt.want, tt.wantLength, tt.wantOK)
+			}
+		})
+	}
+}
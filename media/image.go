@@ -0,0 +1,205 @@
+// Package media processes uploaded files: it removes metadata from images and
+// creates their thumbnails and placeholders.
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif" // Register the GIF decoder
+	"image/jpeg"
+	"image/png"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // Register the WebP decoder
+)
+
+// ThumbnailSizes are the longest edges, in pixels, of the thumbnails made for
+// each image. Sizes that are not smaller than the image are skipped.
+var ThumbnailSizes = []int{320, 800}
+
+const (
+	maxImagePixels       = 50_000_000 // Larger images are refused rather than decoded
+	thumbnailJPEGQuality = 80
+	orientedJPEGQuality  = 92
+	blurhashSourceSize   = 32
+)
+
+var (
+	// ErrUnsupportedImage is returned for data that is not a JPEG, PNG, GIF or WebP image
+	ErrUnsupportedImage = errors.New("unsupported or corrupt image")
+	// ErrImageTooLarge is returned for images with too many pixels to process
+	ErrImageTooLarge = errors.New("image dimensions are too large")
+)
+
+// Thumbnail is a downscaled copy of an image
+type Thumbnail struct {
+	Size   int // Longest edge requested, one of ThumbnailSizes
+	Width  int
+	Height int
+	Ext    string // ".jpg", or ".png" for images with transparency
+	Data   []byte
+}
+
+// ProcessedImage is an uploaded image ready to be stored
+type ProcessedImage struct {
+	Data       []byte // The image with its metadata removed
+	Format     string // "jpeg", "png", "gif" or "webp"
+	Width      int    // Dimensions as displayed, after applying the EXIF orientation
+	Height     int
+	Blurhash   string // Placeholder shown while the image loads
+	Thumbnails []Thumbnail
+}
+
+// ProcessImage removes EXIF, XMP and similar metadata (such as GPS location)
+// from an image and creates its thumbnails and blurhash. Metadata is removed
+// without re-encoding, except for JPEGs with an EXIF orientation, which are
+// rotated upright and re-encoded since the orientation tag is removed too.
+func ProcessImage(data []byte) (*ProcessedImage, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, ErrUnsupportedImage
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return nil, ErrImageTooLarge
+	}
+
+	stripped, orientation := data, 1
+	switch format {
+	case "jpeg":
+		stripped, orientation, err = stripJPEG(data)
+	case "png":
+		stripped, err = stripPNG(data)
+	case "webp":
+		stripped, err = stripWebP(data)
+	case "gif":
+		// GIFs have no EXIF; comments and application blocks are left alone
+	default:
+		return nil, ErrUnsupportedImage
+	}
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(stripped))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	if orientation != 1 {
+		img = orient(img, orientation)
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: orientedJPEGQuality}); err != nil {
+			return nil, err
+		}
+		stripped = buf.Bytes()
+	}
+
+	bounds := img.Bounds()
+	processed := &ProcessedImage{
+		Data:   stripped,
+		Format: format,
+		Width:  bounds.Dx(),
+		Height: bounds.Dy(),
+	}
+
+	for _, size := range ThumbnailSizes {
+		if size >= processed.Width && size >= processed.Height {
+			continue
+		}
+		thumbnail, err := makeThumbnail(img, size)
+		if err != nil {
+			return nil, err
+		}
+		processed.Thumbnails = append(processed.Thumbnails, *thumbnail)
+	}
+
+	xComponents, yComponents := 4, 3
+	if processed.Height > processed.Width {
+		xComponents, yComponents = 3, 4
+	}
+	processed.Blurhash = blurhash(scaleToFit(img, blurhashSourceSize, xdraw.ApproxBiLinear), xComponents, yComponents)
+	return processed, nil
+}
+
+// makeThumbnail scales img so its longest edge is size pixels
+func makeThumbnail(img image.Image, size int) (*Thumbnail, error) {
+	scaled := scaleToFit(img, size, xdraw.BiLinear)
+	thumbnail := &Thumbnail{Size: size, Width: scaled.Bounds().Dx(), Height: scaled.Bounds().Dy()}
+
+	var buf bytes.Buffer
+	if scaled.Opaque() {
+		thumbnail.Ext = ".jpg"
+		if err := jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: thumbnailJPEGQuality}); err != nil {
+			return nil, err
+		}
+	} else {
+		thumbnail.Ext = ".png"
+		if err := png.Encode(&buf, scaled); err != nil {
+			return nil, err
+		}
+	}
+	thumbnail.Data = buf.Bytes()
+	return thumbnail, nil
+}
+
+// scaleToFit scales img down so that neither edge exceeds size pixels
+func scaleToFit(img image.Image, size int, scaler xdraw.Scaler) *image.NRGBA {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width >= height {
+		height = max(1, height*size/width)
+		width = size
+	} else {
+		width = max(1, width*size/height)
+		height = size
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	scaler.Scale(dst, dst.Bounds(), img, bounds, xdraw.Src, nil)
+	return dst
+}
+
+// orient applies an EXIF orientation (2-8) so the image displays upright
+func orient(img image.Image, orientation int) image.Image {
+	bounds := img.Bounds()
+	src := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	w, h := bounds.Dx(), bounds.Dy()
+
+	dstW, dstH := w, h
+	if orientation >= 5 {
+		dstW, dstH = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dstW, dstH))
+
+	for y := 0; y < dstH; y++ {
+		for x := 0; x < dstW; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // Mirrored horizontally
+				sx, sy = w-1-x, y
+			case 3: // Rotated 180°
+				sx, sy = w-1-x, h-1-y
+			case 4: // Mirrored vertically
+				sx, sy = x, h-1-y
+			case 5: // Transposed
+				sx, sy = y, x
+			case 6: // Rotated 90° clockwise
+				sx, sy = y, h-1-x
+			case 7: // Transversed
+				sx, sy = w-1-y, h-1-x
+			case 8: // Rotated 90° counter-clockwise
+				sx, sy = w-1-y, x
+			default:
+				sx, sy = x, y
+			}
+			si, di := src.PixOffset(sx, sy), dst.PixOffset(x, y)
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+	return dst
+}
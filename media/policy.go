@@ -0,0 +1,68 @@
+package media
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// DefaultAllowedTypes are accepted for upload unless UPLOAD_ALLOWED_TYPES is set
+const DefaultAllowedTypes = "image/*,video/*,audio/*,text/*,application/pdf,application/json," +
+	"application/zip,application/gzip,application/x-tar,application/x-bzip2,application/x-xz," +
+	"application/x-7z-compressed,application/vnd.rar," +
+	"application/msword,application/vnd.ms-excel,application/vnd.ms-powerpoint," +
+	"application/vnd.openxmlformats-officedocument.*,application/vnd.oasis.opendocument.*"
+
+// DefaultDeniedTypes are refused for upload unless UPLOAD_DENIED_TYPES is set
+const DefaultDeniedTypes = "application/x-msdownload,application/x-executable,application/x-mach-binary," +
+	".exe,.dll,.scr,.msi,.com,.bat,.cmd,.vbs,.ps1"
+
+// Policy decides which files may be uploaded. Each rule is a MIME type, a
+// prefix ending in "*" such as "image/*", or a file extension such as ".exe"
+// matched against the uploader's file name. Denied rules win over allowed ones.
+type Policy struct {
+	allowed []string
+	denied  []string
+}
+
+// NewPolicy creates a policy from comma-separated lists of rules
+func NewPolicy(allowed, denied string) *Policy {
+	return &Policy{allowed: parseRules(allowed), denied: parseRules(denied)}
+}
+
+// Allows reports whether a file of the detected type, uploaded under fileName,
+// may be stored
+func (p *Policy) Allows(fileType FileType, fileName string) bool {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	for _, rule := range p.denied {
+		if ruleMatches(rule, fileType.MIMEType, ext) {
+			return false
+		}
+	}
+	for _, rule := range p.allowed {
+		if ruleMatches(rule, fileType.MIMEType, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseRules(list string) []string {
+	var rules []string
+	for _, rule := range strings.Split(list, ",") {
+		if rule = strings.ToLower(strings.TrimSpace(rule)); rule != "" {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+func ruleMatches(rule, mimeType, ext string) bool {
+	switch {
+	case strings.HasPrefix(rule, "."):
+		return rule == ext
+	case strings.HasSuffix(rule, "*"):
+		return strings.HasPrefix(mimeType, strings.TrimSuffix(rule, "*"))
+	default:
+		return rule == mimeType
+	}
+}
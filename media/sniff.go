@@ -0,0 +1,273 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"mime"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// SniffLength is the number of leading bytes Sniff needs to identify a file
+const SniffLength = 512
+
+// FileType is a file format recognised from its content
+type FileType struct {
+	MIMEType string // Canonical MIME type, used when the file is served
+	Ext      string // Extension given to stored files of this type
+	Kind     string // "image", "video", "audio" (voice messages) or "file"
+}
+
+var (
+	typeJPEG = FileType{MIMEType: "image/jpeg", Ext: ".jpg", Kind: "image"}
+	typePNG  = FileType{MIMEType: "image/png", Ext: ".png", Kind: "image"}
+	typeGIF  = FileType{MIMEType: "image/gif", Ext: ".gif", Kind: "image"}
+	typeWebP = FileType{MIMEType: "image/webp", Ext: ".webp", Kind: "image"}
+	typeMP4  = FileType{MIMEType: "video/mp4", Ext: ".mp4", Kind: "video"}
+	typeMOV  = FileType{MIMEType: "video/quicktime", Ext: ".mov", Kind: "video"}
+	typeWebM = FileType{MIMEType: "video/webm", Ext: ".webm", Kind: "video"}
+	typeAVI  = FileType{MIMEType: "video/x-msvideo", Ext: ".avi", Kind: "video"}
+
+	typePDF   = FileType{MIMEType: "application/pdf", Ext: ".pdf", Kind: "file"}
+	typeZip   = FileType{MIMEType: "application/zip", Ext: ".zip", Kind: "file"}
+	typeGzip  = FileType{MIMEType: "application/gzip", Ext: ".gz", Kind: "file"}
+	typeBzip2 = FileType{MIMEType: "application/x-bzip2", Ext: ".bz2", Kind: "file"}
+	typeXZ    = FileType{MIMEType: "application/x-xz", Ext: ".xz", Kind: "file"}
+	typeTar   = FileType{MIMEType: "application/x-tar", Ext: ".tar", Kind: "file"}
+	type7z    = FileType{MIMEType: "application/x-7z-compressed", Ext: ".7z", Kind: "file"}
+	typeRAR   = FileType{MIMEType: "application/vnd.rar", Ext: ".rar", Kind: "file"}
+	typeMP3   = FileType{MIMEType: "audio/mpeg", Ext: ".mp3", Kind: "file"}
+	typeOgg   = FileType{MIMEType: "audio/ogg", Ext: ".ogg", Kind: "file"}
+	typeWAV   = FileType{MIMEType: "audio/wav", Ext: ".wav", Kind: "file"}
+	typeFLAC  = FileType{MIMEType: "audio/flac", Ext: ".flac", Kind: "file"}
+	typeM4A   = FileType{MIMEType: "audio/mp4", Ext: ".m4a", Kind: "file"}
+	typeText  = FileType{MIMEType: "text/plain", Ext: ".txt", Kind: "file"}
+
+	typeWindowsExecutable = FileType{MIMEType: "application/x-msdownload", Ext: ".bin", Kind: "file"}
+	typeELF               = FileType{MIMEType: "application/x-executable", Ext: ".bin", Kind: "file"}
+	typeMachO             = FileType{MIMEType: "application/x-mach-binary", Ext: ".bin", Kind: "file"}
+	typeBinary            = FileType{MIMEType: "application/octet-stream", Ext: ".bin", Kind: "file"}
+)
+
+// zipDocumentTypes refine ZIP files by the uploader's extension, since office
+// documents are ZIP archives
+var zipDocumentTypes = map[string]FileType{
+	".docx": {MIMEType: "application/vnd.openxmlformats-officedocument.wordprocessingml.document", Ext: ".docx", Kind: "file"},
+	".xlsx": {MIMEType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", Ext: ".xlsx", Kind: "file"},
+	".pptx": {MIMEType: "application/vnd.openxmlformats-officedocument.presentationml.presentation", Ext: ".pptx", Kind: "file"},
+	".odt":  {MIMEType: "application/vnd.oasis.opendocument.text", Ext: ".odt", Kind: "file"},
+	".ods":  {MIMEType: "application/vnd.oasis.opendocument.spreadsheet", Ext: ".ods", Kind: "file"},
+	".odp":  {MIMEType: "application/vnd.oasis.opendocument.presentation", Ext: ".odp", Kind: "file"},
+}
+
+// oleDocumentTypes refine legacy Office files, which share the OLE2 container
+var oleDocumentTypes = map[string]FileType{
+	".doc": {MIMEType: "application/msword", Ext: ".doc", Kind: "file"},
+	".xls": {MIMEType: "application/vnd.ms-excel", Ext: ".xls", Kind: "file"},
+	".ppt": {MIMEType: "application/vnd.ms-powerpoint", Ext: ".ppt", Kind: "file"},
+}
+
+// textTypes refine plain text by the uploader's extension
+var textTypes = map[string]FileType{
+	".log":  {MIMEType: "text/plain", Ext: ".log", Kind: "file"},
+	".csv":  {MIMEType: "text/csv", Ext: ".csv", Kind: "file"},
+	".tsv":  {MIMEType: "text/tab-separated-values", Ext: ".tsv", Kind: "file"},
+	".md":   {MIMEType: "text/markdown", Ext: ".md", Kind: "file"},
+	".json": {MIMEType: "application/json", Ext: ".json", Kind: "file"},
+}
+
+// storedTypes maps the extensions of stored files to the type they are served
+// as. It includes the extensions older uploads kept from the client.
+var storedTypes = map[string]FileType{
+	".jpeg": typeJPEG,
+	".m4v":  typeMP4,
+}
+
+func init() {
+	for _, fileType := range []FileType{
+		typeJPEG, typePNG, typeGIF, typeWebP, typeMP4, typeMOV, typeWebM, typeAVI,
+		typePDF, typeZip, typeGzip, typeBzip2, typeXZ, typeTar, type7z, typeRAR,
+		typeMP3, typeOgg, typeWAV, typeFLAC, typeM4A, typeText, typeBinary,
+		typeWebMAudio, typeOggOpus,
+	} {
+		storedTypes[fileType.Ext] = fileType
+	}
+	for _, refined := range []map[string]FileType{zipDocumentTypes, oleDocumentTypes, textTypes} {
+		for ext, fileType := range refined {
+			storedTypes[ext] = fileType
+		}
+	}
+}
+
+// mimeAliases maps non-standard MIME types sent by browsers to the canonical one
+var mimeAliases = map[string]string{
+	"image/jpg":       "image/jpeg",
+	"image/pjpeg":     "image/jpeg",
+	"video/mov":       "video/quicktime",
+	"video/avi":       "video/x-msvideo",
+	"video/msvideo":   "video/x-msvideo",
+	"video/x-m4v":     "video/mp4",
+	"application/mp4": "video/mp4",
+}
+
+// Sniff identifies a file from its leading bytes (at least SniffLength of them
+// when available). Images and videos are recognised from their content alone;
+// documents that share a container format (office files in ZIP or OLE2, and
+// the various kinds of plain text) are told apart by the uploader's file name.
+// Content that is not recognised is reported as application/octet-stream.
+func Sniff(head []byte, fileName string) FileType {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	switch {
+	case bytes.HasPrefix(head, []byte{0xFF, 0xD8, 0xFF}):
+		return typeJPEG
+	case bytes.HasPrefix(head, pngSignature):
+		return typePNG
+	case bytes.HasPrefix(head, []byte("GIF87a")), bytes.HasPrefix(head, []byte("GIF89a")):
+		return typeGIF
+	case len(head) >= 12 && string(head[:4]) == "RIFF":
+		switch string(head[8:12]) {
+		case "WEBP":
+			return typeWebP
+		case "AVI ":
+			return typeAVI
+		case "WAVE":
+			return typeWAV
+		}
+	case bytes.HasPrefix(head, ebmlMagic):
+		// EBML header: Matroska and WebM share it, only WebM is accepted as video
+		if bytes.Contains(head[:min(len(head), 64)], []byte("webm")) {
+			return typeWebM
+		}
+	case len(head) >= 12 && string(head[4:8]) == "ftyp":
+		if fileType, ok := sniffISOBaseMedia(head); ok {
+			return fileType
+		}
+
+	case bytes.HasPrefix(head, []byte("%PDF-")):
+		return typePDF
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		if fileType, ok := zipDocumentTypes[ext]; ok {
+			return fileType
+		}
+		return typeZip
+	case bytes.HasPrefix(head, []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}):
+		if fileType, ok := oleDocumentTypes[ext]; ok {
+			return fileType
+		}
+	case bytes.HasPrefix(head, []byte{0x1F, 0x8B}):
+		return typeGzip
+	case len(head) >= 4 && string(head[:3]) == "BZh" && head[3] >= '1' && head[3] <= '9':
+		return typeBzip2
+	case bytes.HasPrefix(head, []byte{0xFD, '7', 'z', 'X', 'Z', 0x00}):
+		return typeXZ
+	case bytes.HasPrefix(head, []byte{'7', 'z', 0xBC, 0xAF, 0x27, 0x1C}):
+		return type7z
+	case bytes.HasPrefix(head, []byte("Rar!\x1A\x07")):
+		return typeRAR
+	case len(head) >= 262 && string(head[257:262]) == "ustar":
+		return typeTar
+
+	case bytes.HasPrefix(head, []byte("ID3")),
+		len(head) >= 2 && head[0] == 0xFF && (head[1] == 0xFB || head[1] == 0xF3 || head[1] == 0xF2):
+		return typeMP3
+	case bytes.HasPrefix(head, []byte("OggS")):
+		return typeOgg
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		return typeFLAC
+
+	case bytes.HasPrefix(head, []byte("MZ")):
+		return typeWindowsExecutable
+	case bytes.HasPrefix(head, []byte("\x7FELF")):
+		return typeELF
+	case bytes.HasPrefix(head, []byte{0xFE, 0xED, 0xFA, 0xCE}), bytes.HasPrefix(head, []byte{0xFE, 0xED, 0xFA, 0xCF}),
+		bytes.HasPrefix(head, []byte{0xCE, 0xFA, 0xED, 0xFE}), bytes.HasPrefix(head, []byte{0xCF, 0xFA, 0xED, 0xFE}):
+		return typeMachO
+	}
+
+	if isText(head) {
+		if fileType, ok := textTypes[ext]; ok {
+			return fileType
+		}
+		return typeText
+	}
+	return typeBinary
+}
+
+// isText reports whether data looks like UTF-8 text: no NUL bytes and valid
+// UTF-8, allowing for a character cut off at the end
+func isText(data []byte) bool {
+	if len(data) == 0 || bytes.IndexByte(data, 0) >= 0 {
+		return false
+	}
+	for i := 0; i < utf8.UTFMax && len(data) > 0 && !utf8.Valid(data); i++ {
+		data = data[:len(data)-1]
+	}
+	return len(data) > 0 && utf8.Valid(data)
+}
+
+// sniffISOBaseMedia tells QuickTime movies from MP4 videos by the brands of
+// their ftyp box
+func sniffISOBaseMedia(head []byte) (FileType, bool) {
+	size := int(binary.BigEndian.Uint32(head[:4]))
+	if size < 16 || size > len(head) {
+		size = len(head)
+	}
+	brands := []string{string(head[8:12])}
+	for i := 16; i+4 <= size; i += 4 {
+		brands = append(brands, string(head[i:i+4]))
+	}
+
+	for _, brand := range brands {
+		switch brand {
+		case "qt  ":
+			return typeMOV, true
+		case "M4A ":
+			return typeM4A, true
+		}
+	}
+	for _, brand := range brands {
+		switch {
+		case strings.HasPrefix(brand, "iso"), strings.HasPrefix(brand, "mp4"),
+			strings.HasPrefix(brand, "avc"), brand == "M4V ", brand == "M4VH",
+			brand == "M4VP", brand == "dash", brand == "MSNV":
+			return typeMP4, true
+		}
+	}
+	// HEIC, AVIF, 3GP and other ISO formats are left to the caller
+	return FileType{}, false
+}
+
+// MatchesDeclaredType reports whether the Content-Type a client declared for
+// a file agrees with the type found in its content. Images and videos must
+// match exactly, so nothing else can be passed off as media. Other files,
+// including voice recordings, are accepted as declared unless they claim to
+// be images or videos, since browsers guess their types from the extension
+// and often send generic ones. An empty declaration is always accepted.
+func MatchesDeclaredType(declared string, detected FileType) bool {
+	if strings.TrimSpace(declared) == "" {
+		return true
+	}
+	declared, _, err := mime.ParseMediaType(declared)
+	if err != nil {
+		return false
+	}
+	if alias, ok := mimeAliases[declared]; ok {
+		declared = alias
+	}
+	if detected.Kind == "audio" && strings.TrimPrefix(declared, "video/") == strings.TrimPrefix(detected.MIMEType, "audio/") {
+		// Browsers label WebM and Ogg by extension, so voice recordings may be declared as video
+		return true
+	}
+	if detected.Kind == "file" || detected.Kind == "audio" {
+		return !strings.HasPrefix(declared, "image/") && !strings.HasPrefix(declared, "video/")
+	}
+	return declared == detected.MIMEType || declared == "application/octet-stream"
+}
+
+// StoredFileType returns the type a stored file is served as, chosen by the
+// extension the server gave it
+func StoredFileType(name string) (FileType, bool) {
+	fileType, ok := storedTypes[strings.ToLower(filepath.Ext(name))]
+	return fileType, ok
+}
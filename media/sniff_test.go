@@ -0,0 +1,161 @@
+package media
+
+import "testing"
+
+// ftyp builds the start of an ISO base media file with the given brands
+func ftyp(major string, compatible ...string) []byte {
+	box := []byte{0, 0, 0, byte(16 + 4*len(compatible))}
+	box = append(box, "ftyp"+major+"\x00\x00\x00\x00"...)
+	for _, brand := range compatible {
+		box = append(box, brand...)
+	}
+	return append(box, "\x00\x00\x00\x08free"...)
+}
+
+func tarHeader() []byte {
+	head := make([]byte, SniffLength)
+	copy(head, "notes.txt")
+	copy(head[257:], "ustar\x0000")
+	return head
+}
+
+func TestSniff(t *testing.T) {
+	tests := []struct {
+		name     string
+		head     []byte
+		fileName string
+		want     FileType
+	}{
+		{name: "JPEG", head: []byte{0xFF, 0xD8, 0xFF, 0xE0, 0, 0x10, 'J', 'F', 'I', 'F'}, want: typeJPEG},
+		{name: "PNG", head: append(append([]byte{}, pngSignature...), 0, 0, 0, 0x0D, 'I', 'H', 'D', 'R'), want: typePNG},
+		{name: "GIF87a", head: []byte("GIF87a\x01\x00\x01\x00"), want: typeGIF},
+		{name: "GIF89a", head: []byte("GIF89a\x01\x00\x01\x00"), want: typeGIF},
+		{name: "WebP", head: []byte("RIFF\x24\x00\x00\x00WEBPVP8 "), want: typeWebP},
+		{name: "AVI", head: []byte("RIFF\x24\x00\x00\x00AVI LIST"), want: typeAVI},
+		{name: "WAV", head: []byte("RIFF\x24\x00\x00\x00WAVEfmt "), want: typeWAV},
+		{name: "WebM", head: append(append([]byte{}, ebmlMagic...), "\x9F\x42\x86\x81\x01\x42\x82\x84webm"...), want: typeWebM},
+		{name: "Matroska is not accepted as video", head: append(append([]byte{}, ebmlMagic...), "\x9F\x42\x82\x88matroska"...), want: typeBinary},
+		{name: "MP4", head: ftyp("isom", "isom", "iso2", "mp41"), want: typeMP4},
+		{name: "MP4 by compatible brand", head: ftyp("XAVC", "mp42"), want: typeMP4},
+		{name: "M4V", head: ftyp("M4V "), want: typeMP4},
+		{name: "QuickTime", head: ftyp("qt  "), want: typeMOV},
+		{name: "QuickTime brand wins over MP4", head: ftyp("isom", "qt  "), want: typeMOV},
+		{name: "M4A", head: ftyp("M4A ", "mp42", "isom"), want: typeM4A},
+		{name: "HEIC is not accepted", head: ftyp("heic", "mif1"), want: typeBinary},
+		{name: "PDF", head: []byte("%PDF-1.7\n"), want: typePDF},
+		{name: "ZIP", head: []byte("PK\x03\x04\x14\x00"), fileName: "archive.zip", want: typeZip},
+		{name: "empty ZIP", head: []byte("PK\x05\x06\x00\x00"), want: typeZip},
+		{name: "ZIP with office extension", head: []byte("PK\x03\x04\x14\x00"), fileName: "Report.DOCX", want: zipDocumentTypes[".docx"]},
+		{name: "ZIP with image extension", head: []byte("PK\x03\x04\x14\x00"), fileName: "photo.jpg", want: typeZip},
+		{name: "OLE2 with office extension", head: []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1, 0}, fileName: "sheet.xls", want: oleDocumentTypes[".xls"]},
+		{name: "OLE2 without office extension", head: []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1, 0}, fileName: "sheet.bin", want: typeBinary},
+		{name: "gzip", head: []byte{0x1F, 0x8B, 0x08, 0x00}, want: typeGzip},
+		{name: "bzip2", head: []byte("BZh91AY&SY"), want: typeBzip2},
+		{name: "bzip2 with a bad block size", head: []byte("BZh0\x00"), want: typeBinary},
+		{name: "xz", head: []byte{0xFD, '7', 'z', 'X', 'Z', 0x00, 0x00}, want: typeXZ},
+		{name: "7z", head: []byte{'7', 'z', 0xBC, 0xAF, 0x27, 0x1C, 0x00}, want: type7z},
+		{name: "RAR", head: []byte("Rar!\x1A\x07\x01\x00"), want: typeRAR},
+		{name: "tar", head: tarHeader(), want: typeTar},
+		{name: "MP3 with ID3 tag", head: []byte("ID3\x04\x00\x00"), want: typeMP3},
+		{name: "MP3 frame", head: []byte{0xFF, 0xFB, 0x90, 0x64}, want: typeMP3},
+		{name: "Ogg", head: []byte("OggS\x00\x02"), want: typeOgg},
+		{name: "FLAC", head: []byte("fLaC\x00\x00\x00\x22"), want: typeFLAC},
+		{name: "Windows executable", head: []byte("MZ\x90\x00"), fileName: "setup.txt", want: typeWindowsExecutable},
+		{name: "ELF", head: []byte("\x7FELF\x02\x01\x01"), want: typeELF},
+		{name: "Mach-O", head: []byte{0xCF, 0xFA, 0xED, 0xFE, 0x07}, want: typeMachO},
+		{name: "plain text", head: []byte("hello, world\n"), fileName: "hello.txt", want: typeText},
+		{name: "text with a refined extension", head: []byte("a,b\n1,2\n"), fileName: "data.CSV", want: textTypes[".csv"]},
+		{name: "text with an unknown extension", head: []byte("hello"), fileName: "hello.html", want: typeText},
+		{name: "text with a character cut off", head: []byte("caf\xC3"), want: typeText},
+		{name: "text with a NUL byte", head: []byte("hello\x00world"), want: typeBinary},
+		{name: "invalid UTF-8", head: []byte("\xC3\x28 not text"), want: typeBinary},
+		{name: "empty", head: nil, want: typeBinary},
+		{name: "image extension does not matter", head: []byte("<svg xmlns=\"http://www.w3.org/2000/svg\"/>"), fileName: "logo.png", want: typeText},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sniff(tt.head, tt.fileName); got != tt.want {
+				t.Errorf("Sniff(% x, %q) = %+v, want %+v", tt.head[:min(len(tt.head), 16)], tt.fileName, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSniffTruncatedHeaders(t *testing.T) {
+	tests := []struct {
+		name string
+		head []byte
+	}{
+		{name: "RIFF", head: []byte("RIFF\x24\x00")},
+		{name: "ftyp", head: []byte("\x00\x00\x00\x18ftyp")},
+		{name: "ftyp with an oversized box", head: []byte("\x00\x00\xFF\xFFftypXXXX\x00")},
+		{name: "EBML", head: ebmlMagic},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Sniff(tt.head, "")
+			if got.Kind != "file" {
+				t.Errorf("Sniff(% x) = %+v, want a file type", tt.head, got)
+			}
+		})
+	}
+}
+
+func TestMatchesDeclaredType(t *testing.T) {
+	tests := []struct {
+		name     string
+		declared string
+		detected FileType
+		want     bool
+	}{
+		{name: "empty declaration", declared: "", detected: typePNG, want: true},
+		{name: "exact image type", declared: "image/png", detected: typePNG, want: true},
+		{name: "image type with parameters", declared: "image/png; charset=binary", detected: typePNG, want: true},
+		{name: "image alias", declared: "image/jpg", detected: typeJPEG, want: true},
+		{name: "octet-stream for an image", declared: "application/octet-stream", detected: typePNG, want: true},
+		{name: "wrong image type", declared: "image/gif", detected: typePNG, want: false},
+		{name: "video alias", declared: "video/mov", detected: typeMOV, want: true},
+		{name: "video declared as another video", declared: "video/mp4", detected: typeWebM, want: false},
+		{name: "file declared as an image", declared: "image/png", detected: typeText, want: false},
+		{name: "file declared as a video", declared: "video/mp4", detected: typeZip, want: false},
+		{name: "file declared as a generic type", declared: "application/x-zip-compressed", detected: typeZip, want: true},
+		{name: "voice recording declared as video", declared: "video/webm", detected: typeWebMAudio, want: true},
+		{name: "voice recording declared as another video", declared: "video/mp4", detected: typeWebMAudio, want: false},
+		{name: "malformed declaration", declared: "image/", detected: typePNG, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchesDeclaredType(tt.declared, tt.detected); got != tt.want {
+				t.Errorf("MatchesDeclaredType(%q, %s) = %v, want %v", tt.declared, tt.detected.MIMEType, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStoredFileType(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   FileType
+		wantOK bool
+	}{
+		{name: "abc.jpg", want: typeJPEG, wantOK: true},
+		{name: "legacy.JPEG", want: typeJPEG, wantOK: true},
+		{name: "legacy.m4v", want: typeMP4, wantOK: true},
+		{name: "abc_thumb.webp", want: typeWebP, wantOK: true},
+		{name: "abc.docx", want: zipDocumentTypes[".docx"], wantOK: true},
+		{name: "abc.html", wantOK: false},
+		{name: "abc", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := StoredFileType(tt.name)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("StoredFileType(%q) = %+v, %v, want %+v, %v", tt.name, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var errMalformed = errors.New("malformed file data")
+
+// stripJPEG removes metadata segments from a JPEG: EXIF and XMP (APP1),
+// IPTC (APP13), comments and any other application segment except JFIF
+// (APP0), ICC color profiles (APP2) and Adobe color information (APP14).
+// It also returns the EXIF orientation found before stripping (1 if none).
+func stripJPEG(data []byte) ([]byte, int, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, 1, errMalformed
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+	orientation := 1
+
+	for i := 2; ; {
+		if i+4 > len(data) || data[i] != 0xFF {
+			return nil, 1, errMalformed
+		}
+		marker := data[i+1]
+		// Fill bytes before a marker are allowed
+		if marker == 0xFF {
+			i++
+			continue
+		}
+		// Start of scan: the entropy-coded data and everything after it is kept as is
+		if marker == 0xDA {
+			out.Write(data[i:])
+			return out.Bytes(), orientation, nil
+		}
+		// Markers without a length
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			out.Write(data[i : i+2])
+			i += 2
+			continue
+		}
+
+		length := int(binary.BigEndian.Uint16(data[i+2 : i+4]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, 1, errMalformed
+		}
+		payload := data[i+4 : end]
+
+		keep := true
+		switch {
+		case marker == 0xE1:
+			if bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+				orientation = exifOrientation(payload[6:])
+			}
+			keep = false
+		case marker == 0xE0 || marker == 0xEE:
+		case marker == 0xE2:
+			keep = bytes.HasPrefix(payload, []byte("ICC_PROFILE\x00"))
+		case marker >= 0xE3 && marker <= 0xEF, marker == 0xFE:
+			keep = false
+		}
+		if keep {
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+}
+
+// exifOrientation reads the orientation tag (0x0112) from the first IFD of
+// TIFF-formatted EXIF data, returning 1 when it is missing or invalid
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[ifd : ifd+2]))
+	for k := 0; k < count; k++ {
+		entry := ifd + 2 + k*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:entry+2]) == 0x0112 {
+			value := int(order.Uint16(tiff[entry+8 : entry+10]))
+			if value >= 1 && value <= 8 {
+				return value
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// pngSignature starts every PNG file
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// pngMetadataChunks are the ancillary chunks removed from PNGs
+var pngMetadataChunks = map[string]bool{
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+// stripPNG removes EXIF, text and timestamp chunks from a PNG
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, errMalformed
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(pngSignature)
+	for i := len(pngSignature); i < len(data); {
+		if i+8 > len(data) {
+			return nil, errMalformed
+		}
+		length := int(binary.BigEndian.Uint32(data[i : i+4]))
+		chunkType := string(data[i+4 : i+8])
+		end := i + 12 + length // Length, type, data and CRC
+		if length < 0 || end > len(data) {
+			return nil, errMalformed
+		}
+		if !pngMetadataChunks[chunkType] {
+			out.Write(data[i:end])
+		}
+		i = end
+		if chunkType == "IEND" {
+			break
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// stripWebP removes the EXIF and XMP chunks from a WebP file and clears
+// their flags in the extended header
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errMalformed
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:12])
+	for i := 12; i < len(data); {
+		if i+8 > len(data) {
+			return nil, errMalformed
+		}
+		chunkType := string(data[i : i+4])
+		size := int(binary.LittleEndian.Uint32(data[i+4 : i+8]))
+		end := i + 8 + size + size%2 // Chunks are padded to an even size
+		if size < 0 || end > len(data) {
+			if i+8+size != len(data) {
+				return nil, errMalformed
+			}
+			end = len(data) // Tolerate a missing final pad byte
+		}
+
+		switch chunkType {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte(nil), data[i:end]...)
+			if len(chunk) > 8 {
+				chunk[8] &^= 0x08 | 0x04 // EXIF and XMP present flags
+			}
+			out.Write(chunk)
+		default:
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+
+	stripped := out.Bytes()
+	binary.LittleEndian.PutUint32(stripped[4:8], uint32(len(stripped)-8))
+	return stripped, nil
+}
@@ -0,0 +1,408 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// halvesImage is a width x height image whose left half is red and right half blue
+func halvesImage(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.NRGBA{R: 255, A: 255}
+			if x >= width/2 {
+				c = color.NRGBA{B: 255, A: 255}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// exifTIFF builds TIFF-formatted EXIF data whose first IFD has an orientation
+// tag and a GPS IFD pointer
+func exifTIFF(order binary.ByteOrder, orientation uint16) []byte {
+	tiff := make([]byte, 8+2+2*12+4)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 2)
+
+	entry := tiff[10:]
+	order.PutUint16(entry[0:], 0x8825) // GPS IFD pointer
+	order.PutUint16(entry[2:], 4)
+	order.PutUint32(entry[4:], 1)
+	order.PutUint32(entry[8:], 0)
+
+	entry = tiff[22:]
+	order.PutUint16(entry[0:], 0x0112)
+	order.PutUint16(entry[2:], 3) // SHORT
+	order.PutUint32(entry[4:], 1)
+	order.PutUint16(entry[8:], orientation)
+	return tiff
+}
+
+// jpegSegment builds a JPEG marker segment
+func jpegSegment(marker byte, payload []byte) []byte {
+	segment := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// withSegments inserts segments right after the SOI marker of a JPEG
+func withSegments(data []byte, segments ...[]byte) []byte {
+	out := append([]byte(nil), data[:2]...)
+	for _, segment := range segments {
+		out = append(out, segment...)
+	}
+	return append(out, data[2:]...)
+}
+
+func exifSegment(order binary.ByteOrder, orientation uint16) []byte {
+	return jpegSegment(0xE1, append([]byte("Exif\x00\x00"), exifTIFF(order, orientation)...))
+}
+
+func TestStripJPEG(t *testing.T) {
+	base := encodeJPEG(t, halvesImage(16, 8))
+	icc := jpegSegment(0xE2, []byte("ICC_PROFILE\x00\x01\x01profile"))
+	adobe := jpegSegment(0xEE, []byte("Adobe\x00\x64\x00\x00\x00\x00\x01"))
+
+	tests := []struct {
+		name            string
+		data            []byte
+		want            []byte
+		wantOrientation int
+	}{
+		{name: "no metadata", data: base, want: base, wantOrientation: 1},
+		{name: "little-endian EXIF", data: withSegments(base, exifSegment(binary.LittleEndian, 6)), want: base, wantOrientation: 6},
+		{name: "big-endian EXIF", data: withSegments(base, exifSegment(binary.BigEndian, 3)), want: base, wantOrientation: 3},
+		{name: "EXIF without rotation", data: withSegments(base, exifSegment(binary.BigEndian, 1)), want: base, wantOrientation: 1},
+		{name: "invalid orientation", data: withSegments(base, exifSegment(binary.LittleEndian, 9)), want: base, wantOrientation: 1},
+		{name: "XMP", data: withSegments(base, jpegSegment(0xE1, []byte("http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta/>"))), want: base, wantOrientation: 1},
+		{name: "IPTC", data: withSegments(base, jpegSegment(0xED, []byte("Photoshop 3.0\x008BIM"))), want: base, wantOrientation: 1},
+		{name: "comment", data: withSegments(base, jpegSegment(0xFE, []byte("taken at home"))), want: base, wantOrientation: 1},
+		{name: "non-ICC APP2", data: withSegments(base, jpegSegment(0xE2, []byte("MPF\x00data"))), want: base, wantOrientation: 1},
+		{name: "fill bytes before a marker", data: withSegments(base, []byte{0xFF, 0xFF}, exifSegment(binary.LittleEndian, 8)), want: base, wantOrientation: 8},
+		{
+			name:            "color information is kept",
+			data:            withSegments(base, exifSegment(binary.LittleEndian, 6), icc, adobe),
+			want:            withSegments(base, icc, adobe),
+			wantOrientation: 6,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, orientation, err := stripJPEG(tt.data)
+			if err != nil {
+				t.Fatalf("stripJPEG() error = %v", err)
+			}
+			if orientation != tt.wantOrientation {
+				t.Errorf("stripJPEG() orientation = %d, want %d", orientation, tt.wantOrientation)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("stripJPEG() returned %d bytes, want %d bytes", len(got), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestStripJPEGMalformed(t *testing.T) {
+	base := encodeJPEG(t, halvesImage(16, 8))
+	overlong := jpegSegment(0xE1, []byte("Exif\x00\x00"))
+	binary.BigEndian.PutUint16(overlong[2:], 0xFFFF)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: nil},
+		{name: "not a JPEG", data: []byte("\x89PNG\r\n\x1a\n")},
+		{name: "only SOI", data: base[:2]},
+		{name: "truncated before the scan", data: base[:20]},
+		{name: "segment longer than the file", data: withSegments(base[:2], overlong)},
+		{name: "segment length below 2", data: withSegments(base, []byte{0xFF, 0xE1, 0x00, 0x01})},
+		{name: "garbage instead of a marker", data: withSegments(base, []byte{0x00, 0x00, 0x00, 0x00})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := stripJPEG(tt.data); err != errMalformed {
+				t.Errorf("stripJPEG() error = %v, want %v", err, errMalformed)
+			}
+		})
+	}
+}
+
+func TestExifOrientation(t *testing.T) {
+	valid := exifTIFF(binary.LittleEndian, 6)
+	withIFD := func(offset uint32) []byte {
+		tiff := append([]byte(nil), valid...)
+		binary.LittleEndian.PutUint32(tiff[4:], offset)
+		return tiff
+	}
+	withCount := func(count uint16) []byte {
+		tiff := append([]byte(nil), valid...)
+		binary.LittleEndian.PutUint16(tiff[8:], count)
+		return tiff
+	}
+
+	tests := []struct {
+		name string
+		tiff []byte
+		want int
+	}{
+		{name: "little-endian", tiff: valid, want: 6},
+		{name: "big-endian", tiff: exifTIFF(binary.BigEndian, 7), want: 7},
+		{name: "rotated counter-clockwise", tiff: exifTIFF(binary.BigEndian, 8), want: 8},
+		{name: "zero", tiff: exifTIFF(binary.LittleEndian, 0), want: 1},
+		{name: "out of range", tiff: exifTIFF(binary.LittleEndian, 42), want: 1},
+		{name: "unknown byte order", tiff: append([]byte("XX"), valid[2:]...), want: 1},
+		{name: "too short", tiff: valid[:6], want: 1},
+		{name: "IFD inside the header", tiff: withIFD(4), want: 1},
+		{name: "IFD past the end", tiff: withIFD(1 << 20), want: 1},
+		{name: "count past the end after the tag", tiff: withCount(200), want: 6},
+		{name: "tag missing", tiff: withCount(1), want: 1},
+		{name: "truncated entry", tiff: valid[:len(valid)-10], want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exifOrientation(tt.tiff); got != tt.want {
+				t.Errorf("exifOrientation() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// pngChunk builds a PNG chunk with its CRC
+func pngChunk(chunkType string, data []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(chunk, chunkType...)
+	chunk = append(chunk, data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+// withChunks inserts chunks right after the IHDR chunk of a PNG
+func withChunks(data []byte, chunks ...[]byte) []byte {
+	const afterIHDR = 8 + 12 + 13
+	out := append([]byte(nil), data[:afterIHDR]...)
+	for _, chunk := range chunks {
+		out = append(out, chunk...)
+	}
+	return append(out, data[afterIHDR:]...)
+}
+
+func TestStripPNG(t *testing.T) {
+	base := encodePNG(t, halvesImage(16, 8))
+	gamma := pngChunk("gAMA", []byte{0, 0, 0xB1, 0x8F})
+
+	tests := []struct {
+		name string
+		data []byte
+		want []byte
+	}{
+		{name: "no metadata", data: base, want: base},
+		{name: "EXIF", data: withChunks(base, pngChunk("eXIf", exifTIFF(binary.BigEndian, 6))), want: base},
+		{
+			name: "text and time",
+			data: withChunks(base,
+				pngChunk("tEXt", []byte("Comment\x00taken at home")),
+				pngChunk("zTXt", []byte("Author\x00\x00x")),
+				pngChunk("iTXt", []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00<x:xmpmeta/>")),
+				pngChunk("tIME", []byte{0x07, 0xEA, 1, 2, 3, 4, 5})),
+			want: base,
+		},
+		{name: "other ancillary chunks are kept", data: withChunks(base, gamma, pngChunk("tEXt", []byte("a\x00b"))), want: withChunks(base, gamma)},
+		{name: "data after IEND is dropped", data: append(append([]byte(nil), base...), "trailing"...), want: base},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := stripPNG(tt.data)
+			if err != nil {
+				t.Fatalf("stripPNG() error = %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("stripPNG() returned %d bytes, want %d bytes", len(got), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestStripPNGMalformed(t *testing.T) {
+	base := encodePNG(t, halvesImage(16, 8))
+	overlong := append([]byte(nil), base...)
+	binary.BigEndian.PutUint32(overlong[8:], 1<<20)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "not a PNG", data: []byte{0xFF, 0xD8, 0xFF}},
+		{name: "truncated chunk header", data: base[:12]},
+		{name: "truncated chunk", data: base[:len(base)-4]},
+		{name: "chunk longer than the file", data: overlong},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := stripPNG(tt.data); err != errMalformed {
+				t.Errorf("stripPNG() error = %v, want %v", err, errMalformed)
+			}
+		})
+	}
+}
+
+// webpChunk builds a RIFF chunk, padded to an even size
+func webpChunk(chunkType string, data []byte) []byte {
+	chunk := append([]byte(chunkType), binary.LittleEndian.AppendUint32(nil, uint32(len(data)))...)
+	chunk = append(chunk, data...)
+	if len(data)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+// webpFile wraps chunks in a RIFF WEBP header
+func webpFile(chunks ...[]byte) []byte {
+	body := []byte("WEBP")
+	for _, chunk := range chunks {
+		body = append(body, chunk...)
+	}
+	return append(append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...), body...)
+}
+
+func TestStripWebP(t *testing.T) {
+	vp8x := func(flags byte) []byte {
+		return webpChunk("VP8X", []byte{flags, 0, 0, 0, 15, 0, 0, 7, 0, 0})
+	}
+	bitstream := webpChunk("VP8L", []byte{0x2F, 0x0F, 0xC0, 0x01, 0x00})
+	exif := webpChunk("EXIF", exifTIFF(binary.LittleEndian, 6))
+	xmp := webpChunk("XMP ", []byte("<x:xmpmeta/>"))
+	icc := webpChunk("ICCP", []byte("profile"))
+
+	tests := []struct {
+		name string
+		data []byte
+		want []byte
+	}{
+		{name: "simple file", data: webpFile(bitstream), want: webpFile(bitstream)},
+		{name: "EXIF and XMP", data: webpFile(vp8x(0x08|0x04), bitstream, exif, xmp), want: webpFile(vp8x(0), bitstream)},
+		{name: "other flags are kept", data: webpFile(vp8x(0x20|0x10|0x08), icc, bitstream, exif), want: webpFile(vp8x(0x20|0x10), icc, bitstream)},
+		{name: "missing final pad byte", data: webpFile(bitstream[:len(bitstream)-1]), want: webpFile(bitstream[:len(bitstream)-1])},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := stripWebP(tt.data)
+			if err != nil {
+				t.Fatalf("stripWebP() error = %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("stripWebP() = % x, want % x", got, tt.want)
+			}
+		})
+	}
+
+	for name, data := range map[string][]byte{
+		"not a WebP":             []byte("RIFF\x04\x00\x00\x00WAVE"),
+		"truncated chunk header": webpFile(bitstream)[:16],
+		"chunk longer than file": webpFile(append([]byte("VP8L\xFF\x00\x00\x00"), 1, 2)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := stripWebP(data); err != errMalformed {
+				t.Errorf("stripWebP() error = %v, want %v", err, errMalformed)
+			}
+		})
+	}
+}
+
+// isRed reports whether a decoded JPEG pixel is mostly red rather than blue
+func isRed(c color.Color) bool {
+	r, _, b, _ := c.RGBA()
+	return r > 0xC000 && b < 0x4000
+}
+
+func TestProcessImageOrientation(t *testing.T) {
+	base := encodeJPEG(t, halvesImage(64, 32))
+
+	tests := []struct {
+		name        string
+		orientation uint16
+		wantWidth   int
+		wantHeight  int
+		// Where the red half of the source ends up
+		redAt, blueAt image.Point
+	}{
+		{name: "upright", orientation: 1, wantWidth: 64, wantHeight: 32, redAt: image.Pt(8, 16), blueAt: image.Pt(56, 16)},
+		{name: "mirrored horizontally", orientation: 2, wantWidth: 64, wantHeight: 32, redAt: image.Pt(56, 16), blueAt: image.Pt(8, 16)},
+		{name: "rotated 180", orientation: 3, wantWidth: 64, wantHeight: 32, redAt: image.Pt(56, 16), blueAt: image.Pt(8, 16)},
+		{name: "mirrored vertically", orientation: 4, wantWidth: 64, wantHeight: 32, redAt: image.Pt(8, 16), blueAt: image.Pt(56, 16)},
+		{name: "transposed", orientation: 5, wantWidth: 32, wantHeight: 64, redAt: image.Pt(16, 8), blueAt: image.Pt(16, 56)},
+		{name: "rotated 90 clockwise", orientation: 6, wantWidth: 32, wantHeight: 64, redAt: image.Pt(16, 8), blueAt: image.Pt(16, 56)},
+		{name: "transversed", orientation: 7, wantWidth: 32, wantHeight: 64, redAt: image.Pt(16, 56), blueAt: image.Pt(16, 8)},
+		{name: "rotated 90 counter-clockwise", orientation: 8, wantWidth: 32, wantHeight: 64, redAt: image.Pt(16, 56), blueAt: image.Pt(16, 8)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processed, err := ProcessImage(withSegments(base, exifSegment(binary.LittleEndian, tt.orientation)))
+			if err != nil {
+				t.Fatalf("ProcessImage() error = %v", err)
+			}
+			if processed.Width != tt.wantWidth || processed.Height != tt.wantHeight {
+				t.Errorf("ProcessImage() size = %dx%d, want %dx%d", processed.Width, processed.Height, tt.wantWidth, tt.wantHeight)
+			}
+			if bytes.Contains(processed.Data, []byte("Exif\x00\x00")) {
+				t.Error("ProcessImage() kept the EXIF segment")
+			}
+			if tt.orientation == 1 && !bytes.Equal(processed.Data, base) {
+				t.Error("ProcessImage() re-encoded an upright image")
+			}
+
+			img, err := jpeg.Decode(bytes.NewReader(processed.Data))
+			if err != nil {
+				t.Fatalf("decoding the processed image: %v", err)
+			}
+			if got := img.Bounds().Size(); got != image.Pt(tt.wantWidth, tt.wantHeight) {
+				t.Errorf("processed image is %v, want %dx%d", got, tt.wantWidth, tt.wantHeight)
+			}
+			if !isRed(img.At(tt.redAt.X, tt.redAt.Y)) {
+				t.Errorf("pixel at %v = %v, want red", tt.redAt, img.At(tt.redAt.X, tt.redAt.Y))
+			}
+			if isRed(img.At(tt.blueAt.X, tt.blueAt.Y)) {
+				t.Errorf("pixel at %v = %v, want blue", tt.blueAt, img.At(tt.blueAt.X, tt.blueAt.Y))
+			}
+		})
+	}
+}
@@ -2,12 +2,15 @@ package middleware
 
 import (
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"strings"
 
+	"github/sabt-dev/realtimeChat/services"
+
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/sessions"
 	"github.com/markbates/goth"
@@ -31,8 +34,14 @@ func init() {
 	gob.Register(map[string]interface{}{})
 }
 
+// BotProvider is the SessionUser provider of requests authenticated with a bot token
+const BotProvider = "bot"
+
 var store *sessions.CookieStore
 
+// adminEmails holds the addresses listed in ADMIN_EMAILS
+var adminEmails = map[string]bool{}
+
 // InitAuth initializes the authentication providers
 func InitAuth() {
 	// Set up session store with secret from environment
@@ -40,6 +49,13 @@ func InitAuth() {
 	store = sessions.NewCookieStore([]byte(sessionSecret))
 	gothic.Store = store
 
+	// Administrators are identified by the email of their OAuth account
+	for _, email := range strings.Split(getEnv("ADMIN_EMAILS", ""), ",") {
+		if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+			adminEmails[email] = true
+		}
+	}
+
 	// Get base URL from environment or default to localhost
 	baseURL := getEnv("BASE_URL", "http://localhost:8080")
 
@@ -65,9 +81,32 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
-// AuthMiddleware checks if user is authenticated
+// AuthMiddleware checks if user is authenticated, either through the session
+// cookie or, for bot accounts, an "Authorization: Bearer <token>" header
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if token, ok := bearerToken(c); ok {
+			bot, err := services.NewBotService().Authenticate(token)
+			if err != nil {
+				if !errors.Is(err, services.ErrInvalidBotToken) {
+					log.Printf("Bot token check failed: %v", err)
+				}
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid bot token"})
+				c.Abort()
+				return
+			}
+
+			c.Set("user", &SessionUser{
+				ID:       fmt.Sprint(bot.ID),
+				Name:     bot.Name,
+				Email:    bot.Email,
+				Avatar:   bot.Avatar,
+				Provider: BotProvider,
+			})
+			c.Next()
+			return
+		}
+
 		session, err := store.Get(c.Request, "auth-session")
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Session error"})
@@ -96,6 +135,80 @@ func AuthMiddleware() gin.HandlerFunc {
 	}
 }
 
+// OptionalAuthMiddleware identifies the user like AuthMiddleware when the
+// request carries a session cookie or bot token, but lets anonymous requests through
+func OptionalAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token, ok := bearerToken(c); ok {
+			if bot, err := services.NewBotService().Authenticate(token); err == nil {
+				c.Set("user", &SessionUser{
+					ID:       fmt.Sprint(bot.ID),
+					Name:     bot.Name,
+					Email:    bot.Email,
+					Avatar:   bot.Avatar,
+					Provider: BotProvider,
+				})
+			}
+			c.Next()
+			return
+		}
+
+		if session, err := store.Get(c.Request, "auth-session"); err == nil {
+			if user, ok := session.Values["user"].(*SessionUser); ok && user != nil {
+				c.Set("user", user)
+			}
+		}
+		c.Next()
+	}
+}
+
+// bearerToken extracts the token of an "Authorization: Bearer" header
+func bearerToken(c *gin.Context) (string, bool) {
+	header := c.GetHeader("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return "", false
+	}
+	token := strings.TrimSpace(header[7:])
+	return token, token != ""
+}
+
+// IsBot reports whether the request was authenticated with a bot token
+func (u *SessionUser) IsBot() bool {
+	return u.Provider == BotProvider
+}
+
+// IsAdmin reports whether the email belongs to an administrator listed in ADMIN_EMAILS
+func IsAdmin(email string) bool {
+	return email != "" && adminEmails[strings.ToLower(email)]
+}
+
+// AdminMiddleware restricts a route to administrators; it must run after AuthMiddleware
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userData, exists := c.Get("user")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+			c.Abort()
+			return
+		}
+
+		user, ok := userData.(*SessionUser)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user data"})
+			c.Abort()
+			return
+		}
+
+		if user.IsBot() || !IsAdmin(user.Email) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
 // BeginAuth starts the authentication process
 func BeginAuth(c *gin.Context) {
 	provider := c.Param("provider")
@@ -121,6 +234,13 @@ func AuthCallback(c *gin.Context) {
 	user, err := gothic.CompleteUserAuth(c.Writer, c.Request)
 	if err != nil {
 		log.Printf("Error completing auth: %v", err)
+		if auditErr := services.NewAuditService().Record(services.AuditEntry{
+			Action:   "auth.login_failed",
+			Metadata: map[string]interface{}{"provider": provider, "error": err.Error()},
+			IP:       c.ClientIP(),
+		}); auditErr != nil {
+			log.Printf("Error recording audit entry: %v", auditErr)
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Authentication failed"})
 		return
 	}
@@ -165,6 +285,20 @@ func AuthCallback(c *gin.Context) {
 		return
 	}
 
+	// Record the login against the database user
+	if dbUser, err := services.NewUserService().CreateOrGetUser(displayName, user.Email, user.AvatarURL); err != nil {
+		log.Printf("Error getting user for audit: %v", err)
+	} else if err := services.NewAuditService().Record(services.AuditEntry{
+		ActorID:    &dbUser.ID,
+		Action:     "auth.login",
+		TargetType: "user",
+		TargetID:   fmt.Sprint(dbUser.ID),
+		Metadata:   map[string]interface{}{"provider": user.Provider},
+		IP:         c.ClientIP(),
+	}); err != nil {
+		log.Printf("Error recording audit entry: %v", err)
+	}
+
 	// Redirect to chat with user info
 	c.Redirect(http.StatusTemporaryRedirect, fmt.Sprintf("/?authenticated=true&user=%s", user.Name))
 }
@@ -177,6 +311,12 @@ func Logout(c *gin.Context) {
 		return
 	}
 
+	// Remember who is logging out for the audit log
+	var loggedOut *SessionUser
+	if userData, ok := session.Values["user"]; ok && userData != nil {
+		loggedOut, _ = userData.(*SessionUser)
+	}
+
 	session.Values["user"] = nil
 	session.Options.MaxAge = -1
 
@@ -186,6 +326,20 @@ func Logout(c *gin.Context) {
 		return
 	}
 
+	if loggedOut != nil {
+		if dbUser, err := services.NewUserService().GetUserByEmail(loggedOut.Email); err == nil {
+			if err := services.NewAuditService().Record(services.AuditEntry{
+				ActorID:    &dbUser.ID,
+				Action:     "auth.logout",
+				TargetType: "user",
+				TargetID:   fmt.Sprint(dbUser.ID),
+				IP:         c.ClientIP(),
+			}); err != nil {
+				log.Printf("Error recording audit entry: %v", err)
+			}
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
 }
 
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrAuditLogImmutable is returned when something tries to modify or remove an audit entry
+var ErrAuditLogImmutable = errors.New("audit log entries are append-only")
+
+// AuditLog is an append-only record of a security-relevant action
+type AuditLog struct {
+	ID         uint            `gorm:"primaryKey" json:"id"`
+	ActorID    *uint           `gorm:"index" json:"actor_id,omitempty"`    // nil for system or anonymous actions (e.g. failed logins)
+	Action     string          `gorm:"not null;index" json:"action"`       // e.g. "room.create", "message.delete", "auth.login"
+	TargetType string          `gorm:"index" json:"target_type,omitempty"` // "room", "message", "membership", "user", ...
+	TargetID   string          `gorm:"index" json:"target_id,omitempty"`
+	RoomID     *uint           `gorm:"index" json:"room_id,omitempty"`
+	Metadata   json.RawMessage `gorm:"type:text" json:"metadata,omitempty"` // Action-specific details as a JSON object
+	IP         string          `json:"ip,omitempty"`
+	CreatedAt  time.Time       `gorm:"index" json:"created_at"`
+
+	// Relationships
+	Actor *User `gorm:"foreignKey:ActorID" json:"actor,omitempty"`
+}
+
+// TableName keeps the audit table name stable
+func (AuditLog) TableName() string {
+	return "audit_logs"
+}
+
+// BeforeUpdate prevents audit entries from being modified
+func (a *AuditLog) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditLogImmutable
+}
+
+// BeforeDelete prevents audit entries from being removed
+func (a *AuditLog) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditLogImmutable
+}
+
+// AuditLogFilter narrows down an audit log query; zero values are ignored
+type AuditLogFilter struct {
+	ActorID    *uint
+	Action     string // Exact action, or a prefix when it ends with "*" (e.g. "room.*")
+	TargetType string
+	TargetID   string
+	RoomID     *uint
+	Since      time.Time
+	Until      time.Time
+}
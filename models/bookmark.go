@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Bookmark is a message a user saved for later, with an optional personal note
+type Bookmark struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_bookmarks_user_message" json:"user_id"`
+	MessageID uint      `gorm:"not null;uniqueIndex:idx_bookmarks_user_message;index" json:"message_id"`
+	Note      string    `gorm:"type:text" json:"note"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Relationships
+	User    User    `gorm:"foreignKey:UserID" json:"-"`
+	Message Message `gorm:"foreignKey:MessageID" json:"message"`
+}
+
+// BookmarkResponse represents a bookmark for JSON serialization
+type BookmarkResponse struct {
+	ID        uint            `json:"id"`
+	Note      string          `json:"note,omitempty"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Message   MessageResponse `json:"message"`
+}
+
+// ToResponse converts a Bookmark to BookmarkResponse for JSON output
+func (b *Bookmark) ToResponse() BookmarkResponse {
+	return BookmarkResponse{
+		ID:        b.ID,
+		Note:      b.Note,
+		CreatedAt: b.CreatedAt,
+		Message:   b.Message.ToResponse(),
+	}
+}
@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// BotToken is a long-lived bearer token of a bot account. Only a SHA-256 hash
+// of the token is stored; the token itself is shown once when it is created.
+type BotToken struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	BotID       uint       `gorm:"not null;index" json:"bot_id"`
+	Name        string     `json:"name,omitempty"` // Label to tell tokens apart, e.g. "ci"
+	TokenHash   string     `gorm:"uniqueIndex;not null" json:"-"`
+	Prefix      string     `gorm:"not null" json:"prefix"` // First characters of the token, for identification
+	CreatedByID *uint      `json:"created_by_id,omitempty"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+
+	// Relationships
+	Bot User `gorm:"foreignKey:BotID" json:"-"`
+}
+
+// RoomBot allows a bot to join a room; entries are managed by the room creator
+type RoomBot struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	RoomID    uint      `gorm:"not null;uniqueIndex:idx_room_bots_room_bot" json:"room_id"`
+	BotID     uint      `gorm:"not null;uniqueIndex:idx_room_bots_room_bot" json:"bot_id"`
+	AddedByID uint      `gorm:"not null" json:"added_by_id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Relationships
+	Bot     User `gorm:"foreignKey:BotID" json:"bot"`
+	AddedBy User `gorm:"foreignKey:AddedByID" json:"-"`
+}
+
+// BotResponse describes a bot account
+type BotResponse struct {
+	ID        uint       `json:"id"`
+	Name      string     `json:"name"`
+	Avatar    string     `json:"avatar,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	Tokens    []BotToken `json:"tokens,omitempty"` // Only included for admins
+}
+
+// ToBotResponse converts a bot user to BotResponse for JSON output
+func (u *User) ToBotResponse() BotResponse {
+	return BotResponse{ID: u.ID, Name: u.Name, Avatar: u.Avatar, CreatedAt: u.CreatedAt}
+}
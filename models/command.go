@@ -0,0 +1,63 @@
+package models
+
+import "time"
+
+// BotCommand is a slash command registered by a bot. Invoking it in a room the
+// bot is allowed in POSTs the invocation to the bot's URL, signed with Secret.
+type BotCommand struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	BotID       uint      `gorm:"not null;uniqueIndex:idx_bot_commands_bot_name" json:"bot_id"`
+	Name        string    `gorm:"not null;uniqueIndex:idx_bot_commands_bot_name" json:"name"` // Without the leading slash
+	Description string    `json:"description,omitempty"`
+	Usage       string    `json:"usage,omitempty"` // Argument hint, e.g. "<service> [version]"
+	URL         string    `gorm:"not null" json:"url"`
+	Secret      string    `gorm:"not null" json:"-"` // HMAC key for invocation signatures; shown once
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	// Relationships
+	Bot User `gorm:"foreignKey:BotID" json:"-"`
+}
+
+// RoomMute silences a user in a room until it expires or is lifted
+type RoomMute struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	RoomID    uint       `gorm:"not null;uniqueIndex:idx_room_mutes_room_user" json:"room_id"`
+	UserID    uint       `gorm:"not null;uniqueIndex:idx_room_mutes_room_user" json:"user_id"`
+	MutedByID uint       `gorm:"not null" json:"muted_by_id"`
+	Reason    string     `json:"reason,omitempty"`
+	Until     *time.Time `json:"until,omitempty"` // Nil mutes until a moderator unmutes
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// CommandInfo describes a slash command available in a room, for autocomplete
+type CommandInfo struct {
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	Usage         string `json:"usage,omitempty"`
+	Source        string `json:"source"` // "builtin" or the name of the bot providing it
+	ModeratorOnly bool   `json:"moderatorOnly,omitempty"`
+}
+
+// BotCommandRequest is the JSON body POSTed to a bot when its command is invoked
+type BotCommandRequest struct {
+	InvocationID string           `json:"invocation_id"`
+	Command      string           `json:"command"`
+	Text         string           `json:"text"` // Everything after the command name
+	Room         WebhookEventRoom `json:"room"`
+	User         BotCommandUser   `json:"user"`
+	Timestamp    time.Time        `json:"timestamp"`
+}
+
+// BotCommandUser identifies the user who invoked a bot command
+type BotCommandUser struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+// BotCommandResponse is the optional JSON reply of a bot to a command. Replies
+// are ephemeral unless ResponseType is "in_channel", which posts them to the room as the bot.
+type BotCommandResponse struct {
+	Text         string `json:"text"`
+	ResponseType string `json:"response_type"`
+}
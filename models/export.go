@@ -0,0 +1,78 @@
+package models
+
+import "time"
+
+// Room export schema identifiers. The version is bumped on any incompatible
+// change so importers can reject or adapt older documents.
+const (
+	ExportSchemaName    = "realtimechat.room-export"
+	ExportSchemaVersion = 1
+)
+
+// ExportHeader is the part of a JSON room export that precedes the messages.
+// A full document is the header's fields followed by a "messages" array of
+// ExportMessage, in chronological order.
+type ExportHeader struct {
+	Schema     string         `json:"schema"`
+	Version    int            `json:"version"`
+	ExportedAt time.Time      `json:"exported_at"`
+	Room       ExportRoom     `json:"room"`
+	Members    []ExportMember `json:"members"`
+}
+
+// ExportUser identifies a user; the email is the stable key for re-import
+type ExportUser struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// ExportRoom describes the exported room
+type ExportRoom struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	IsPrivate   bool        `json:"is_private"`
+	CreatedAt   time.Time   `json:"created_at"`
+	Creator     *ExportUser `json:"creator,omitempty"`
+}
+
+// ExportMember is a room membership
+type ExportMember struct {
+	User     ExportUser `json:"user"`
+	Role     string     `json:"role"`
+	JoinedAt time.Time  `json:"joined_at"`
+	IsActive bool       `json:"is_active"`
+}
+
+// ExportMedia references a message attachment
+type ExportMedia struct {
+	URL      string `json:"url"`
+	Type     string `json:"type"`
+	FileName string `json:"file_name,omitempty"`
+}
+
+// ExportReply links a reply to the message it answers
+type ExportReply struct {
+	ID     string `json:"id,omitempty"` // Empty if the original message no longer exists
+	Sender string `json:"sender"`
+	Text   string `json:"text"`
+}
+
+// ExportReaction is one user's reaction to a message
+type ExportReaction struct {
+	Emoji string     `json:"emoji"`
+	User  ExportUser `json:"user"`
+}
+
+// ExportMessage is a single message in a room export
+type ExportMessage struct {
+	ID           string           `json:"id"`
+	Type         string           `json:"type"` // "message", "media", "join" or "leave"
+	Sender       ExportUser       `json:"sender"`
+	Text         string           `json:"text"`
+	CreatedAt    time.Time        `json:"created_at"`
+	Media        *ExportMedia     `json:"media,omitempty"`
+	ReplyTo      *ExportReply     `json:"reply_to,omitempty"`
+	Reactions    []ExportReaction `json:"reactions,omitempty"`
+	Deleted      bool             `json:"deleted,omitempty"`
+	DeleteReason string           `json:"delete_reason,omitempty"`
+}
@@ -0,0 +1,22 @@
+package models
+
+// ImportSkippedItem is an item from an import archive that was not imported
+type ImportSkippedItem struct {
+	Kind   string `json:"kind"` // "channel", "message", "attachment", "reaction", ...
+	Ref    string `json:"ref"`  // Identifier of the item in the source archive
+	Reason string `json:"reason"`
+}
+
+// ImportReport summarizes an import run. Counts only include rows written by
+// this run, so re-running the same archive reports everything as already imported.
+type ImportReport struct {
+	Source                  string              `json:"source"`
+	RoomsCreated            int                 `json:"rooms_created"`
+	RoomsReused             int                 `json:"rooms_reused"`
+	UsersCreated            int                 `json:"users_created"`
+	MessagesImported        int                 `json:"messages_imported"`
+	MessagesAlreadyImported int                 `json:"messages_already_imported"`
+	ReactionsImported       int                 `json:"reactions_imported"`
+	SkippedTotal            int                 `json:"skipped_total"`
+	Skipped                 []ImportSkippedItem `json:"skipped"` // Capped; see SkippedTotal
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// LinkPreview is the OpenGraph or oEmbed metadata of a URL. Rows cache fetch
+// results per URL; messages keep a JSON copy of the previews attached to them.
+type LinkPreview struct {
+	ID          uint      `gorm:"primaryKey" json:"-"`
+	URL         string    `gorm:"uniqueIndex;not null" json:"url"`
+	Title       string    `json:"title,omitempty"`
+	Description string    `json:"description,omitempty"`
+	ImageURL    string    `json:"image,omitempty"`
+	SiteName    string    `json:"siteName,omitempty"`
+	Failed      bool      `gorm:"not null;default:false" json:"-"` // The page could not be fetched or had no metadata
+	FetchedAt   time.Time `gorm:"index" json:"-"`
+}
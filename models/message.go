@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"sync"
 	"time"
 
@@ -13,6 +14,7 @@ type User struct {
 	Name      string    `gorm:"not null" json:"name"`
 	Email     string    `gorm:"uniqueIndex;not null" json:"email"`
 	Avatar    string    `json:"avatar,omitempty"`
+	IsBot     bool      `gorm:"not null;default:false" json:"is_bot"` // Bot account created by an admin; authenticates with bearer tokens
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 
@@ -39,21 +41,46 @@ type Room struct {
 
 // Message represents a chat message
 type Message struct {
-	ID        uint   `gorm:"primaryKey" json:"id"`
-	UUID      string `gorm:"uniqueIndex;not null" json:"uuid"` // For client-side identification
-	SenderID  uint   `gorm:"not null" json:"sender_id"`
-	RoomID    uint   `gorm:"not null" json:"room_id"`
-	Text      string `json:"text"`
-	Type      string `gorm:"not null;default:message" json:"type"` // "join", "leave", "message", "media", "delete"
-	MediaURL  string `json:"media_url,omitempty"`
-	MediaType string `json:"media_type,omitempty"` // "image", "video"
-	FileName  string `json:"file_name,omitempty"`
+	ID        uint            `gorm:"primaryKey" json:"id"`
+	UUID      string          `gorm:"uniqueIndex;not null" json:"uuid"` // For client-side identification
+	SenderID  uint            `gorm:"not null" json:"sender_id"`
+	RoomID    uint            `gorm:"not null" json:"room_id"`
+	Text      string          `json:"text"`
+	HTML      string          `json:"html,omitempty"`                       // Sanitized rendering of the Markdown in Text
+	Entities  json.RawMessage `gorm:"type:text" json:"entities,omitempty"`  // Links, mentions and code in Text as a JSON array of MessageEntity
+	Type      string          `gorm:"not null;default:message" json:"type"` // "join", "leave", "message", "emote", "system", "media", "delete"
+	MediaURL  string          `json:"media_url,omitempty"`
+	MediaType string          `json:"media_type,omitempty"` // "image", "video", "audio" or "file"
+	FileName  string          `json:"file_name,omitempty"`
+
+	// Details recorded at upload: size and type of the file, and for images the
+	// dimensions, placeholder and thumbnails so clients can lay them out before they load
+	MediaSize       int64           `json:"media_size,omitempty"`
+	MediaMimeType   string          `json:"media_mime_type,omitempty"`
+	MediaWidth      int             `json:"media_width,omitempty"`
+	MediaHeight     int             `json:"media_height,omitempty"`
+	MediaBlurhash   string          `json:"media_blurhash,omitempty"`
+	MediaThumbnails json.RawMessage `gorm:"type:text" json:"media_thumbnails,omitempty"` // JSON array of MediaThumbnail
+
+	// Duration in seconds and waveform (levels from 0 to 100) of voice recordings
+	MediaDuration float64         `json:"media_duration,omitempty"`
+	MediaWaveform json.RawMessage `gorm:"type:text" json:"media_waveform,omitempty"`
+
+	// Name shown instead of the sender's, set by incoming webhooks that override their display name
+	SenderName string `json:"sender_name,omitempty"`
+
+	// Previews of the links in Text as a JSON array of LinkPreview, added in the background after sending
+	LinkPreviews json.RawMessage `gorm:"type:text" json:"link_previews,omitempty"`
 
 	// Reply functionality
 	ReplyToID     *uint  `json:"reply_to_id,omitempty"`     // ID of the message being replied to
 	ReplyToSender string `json:"reply_to_sender,omitempty"` // Sender name of the original message
 	ReplyToText   string `json:"reply_to_text,omitempty"`   // Text of the original message
 
+	// Deletion details for tombstones
+	DeletedByID  *uint  `json:"deleted_by_id,omitempty"` // User who deleted the message (sender or moderator)
+	DeleteReason string `json:"delete_reason,omitempty"` // Optional reason given by a moderator
+
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
@@ -84,6 +111,38 @@ func (MessageReaction) TableName() string {
 	return "message_reactions"
 }
 
+// PinnedMessage represents a message pinned in a room by a moderator
+type PinnedMessage struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	RoomID     uint      `gorm:"not null;uniqueIndex:idx_pinned_messages_room_message" json:"room_id"`
+	MessageID  uint      `gorm:"not null;uniqueIndex:idx_pinned_messages_room_message" json:"message_id"`
+	PinnedByID uint      `gorm:"not null" json:"pinned_by_id"`
+	Position   int       `gorm:"not null" json:"position"` // Pin order within the room, starting at 1
+	CreatedAt  time.Time `json:"created_at"`
+
+	// Relationships
+	Message  Message `gorm:"foreignKey:MessageID" json:"message"`
+	PinnedBy User    `gorm:"foreignKey:PinnedByID" json:"pinned_by"`
+}
+
+// PinnedMessageResponse represents a pinned message for JSON serialization
+type PinnedMessageResponse struct {
+	Message  MessageResponse `json:"message"`
+	PinnedBy string          `json:"pinnedBy"` // Name of the moderator who pinned it
+	PinnedAt time.Time       `json:"pinnedAt"`
+	Position int             `json:"position"`
+}
+
+// ToResponse converts a PinnedMessage to PinnedMessageResponse for JSON output
+func (p *PinnedMessage) ToResponse() PinnedMessageResponse {
+	return PinnedMessageResponse{
+		Message:  p.Message.ToResponse(),
+		PinnedBy: p.PinnedBy.Name,
+		PinnedAt: p.CreatedAt,
+		Position: p.Position,
+	}
+}
+
 // RoomMember represents the many-to-many relationship between users and rooms
 type RoomMember struct {
 	ID       uint      `gorm:"primaryKey" json:"id"`
@@ -98,6 +157,22 @@ type RoomMember struct {
 	Room Room `gorm:"foreignKey:RoomID" json:"room"`
 }
 
+// ModerationAction records an action taken by a room moderator for later review
+type ModerationAction struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	RoomID       uint      `gorm:"not null;index" json:"room_id"`
+	ModeratorID  uint      `gorm:"not null" json:"moderator_id"`
+	TargetUserID uint      `json:"target_user_id"`
+	MessageUUID  string    `json:"message_uuid,omitempty"` // Kept as UUID so the record survives tombstone purges
+	Action       string    `gorm:"not null" json:"action"` // "delete_message", "kick", "mute", "unmute", "grant_moderator", "revoke_moderator"
+	Reason       string    `json:"reason,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+
+	// Relationships
+	Moderator  User `gorm:"foreignKey:ModeratorID" json:"moderator"`
+	TargetUser User `gorm:"foreignKey:TargetUserID" json:"target_user"`
+}
+
 // Client represents a connected WebSocket client (not stored in DB)
 type Client struct {
 	ID     string      `json:"id"`
@@ -105,6 +180,7 @@ type Client struct {
 	Name   string      `json:"name"`
 	Avatar string      `json:"avatar,omitempty"`
 	Room   string      `json:"room"`
+	IP     string      `json:"-"` // Remote address, recorded in audit entries
 	Conn   interface{} `json:"-"` // WebSocket connection
 	Mutex  sync.Mutex  `json:"-"` // Mutex for safe concurrent WebSocket writes
 }
@@ -136,11 +212,35 @@ type UserSearchResult struct {
 	Avatar string `json:"avatar,omitempty"`
 }
 
+// MessageHistoryQuery selects a page of room history relative to a message.
+// At most one of Before, After and Around (message UUIDs) may be set; with none
+// set the newest messages are returned.
+type MessageHistoryQuery struct {
+	Before string
+	After  string
+	Around string
+	Limit  int
+}
+
+// MessagePage is a page of room history in chronological order
+type MessagePage struct {
+	Messages      []Message
+	HasMoreBefore bool // Older messages exist before the first one
+	HasMoreAfter  bool // Newer messages exist after the last one
+}
+
+// DeletedMessageText is shown in place of the content of a deleted message
+const DeletedMessageText = "message deleted"
+
+// RemovedByModeratorText is shown in place of a message removed by a room moderator
+const RemovedByModeratorText = "message removed by moderator"
+
 // ReplyInfo represents reply information for a message
 type ReplyInfo struct {
-	ID     string `json:"id"`
-	Sender string `json:"sender"`
-	Text   string `json:"text"`
+	ID      string `json:"id"`
+	Sender  string `json:"sender"`
+	Text    string `json:"text"`
+	Deleted bool   `json:"deleted,omitempty"` // The original message has been deleted
 }
 
 // ReactionSummary represents aggregated reaction data for a message
@@ -151,6 +251,18 @@ type ReactionSummary struct {
 	UserID []uint   `json:"userIds"` // User IDs for backend logic
 }
 
+// MessageEntity marks a link, mention or piece of code in a message's text.
+// Offset and Length count UTF-16 code units, like JavaScript string indexes.
+type MessageEntity struct {
+	Type     string `json:"type"` // "link", "mention", "code", "pre"
+	Offset   int    `json:"offset"`
+	Length   int    `json:"length"`
+	URL      string `json:"url,omitempty"`      // Target of a link
+	Language string `json:"language,omitempty"` // Language of a fenced code block, if given
+	Username string `json:"username,omitempty"` // Mentioned name, without the @
+	UserID   *uint  `json:"userId,omitempty"`   // Mentioned user, when the name matches exactly one user
+}
+
 // MessageResponse represents a message response for JSON serialization
 type MessageResponse struct {
 	ID        string            `json:"id"`     // UUID for client compatibility
@@ -159,13 +271,40 @@ type MessageResponse struct {
 	Receiver  string            `json:"receiver,omitempty"`
 	Room      string            `json:"room"` // Room name
 	Text      string            `json:"text"`
+	HTML      string            `json:"html,omitempty"`     // Sanitized rendering of the Markdown in Text
+	Entities  []MessageEntity   `json:"entities,omitempty"` // Links, mentions and code in Text
 	Timestamp time.Time         `json:"timestamp"`
 	Type      string            `json:"type"`
+	IsBot     bool              `json:"isBot,omitempty"` // Sent by a bot account
 	MediaURL  string            `json:"mediaUrl,omitempty"`
 	MediaType string            `json:"mediaType,omitempty"`
 	FileName  string            `json:"fileName,omitempty"`
 	ReplyTo   *ReplyInfo        `json:"replyTo,omitempty"`
 	Reactions []ReactionSummary `json:"reactions,omitempty"`
+	Deleted   bool              `json:"deleted,omitempty"` // Tombstone of a deleted message
+
+	// Deletion details: "sender" or "moderator", plus the moderator's reason if any
+	DeletedBy    string `json:"deletedBy,omitempty"`
+	DeleteReason string `json:"deleteReason,omitempty"`
+
+	// Current pins of the room, sent with "pin_update" events
+	Pins []PinnedMessageResponse `json:"pins,omitempty"`
+
+	// Previews of the links in Text, sent again with "message_update" events once fetched
+	LinkPreviews []LinkPreview `json:"linkPreviews,omitempty"`
+
+	// Size and type of uploaded files, plus dimensions, a blurhash placeholder
+	// and thumbnails of uploaded images
+	MediaSize       int64            `json:"mediaSize,omitempty"`
+	MediaMimeType   string           `json:"mediaMimeType,omitempty"`
+	MediaWidth      int              `json:"mediaWidth,omitempty"`
+	MediaHeight     int              `json:"mediaHeight,omitempty"`
+	MediaBlurhash   string           `json:"mediaBlurhash,omitempty"`
+	MediaThumbnails []MediaThumbnail `json:"mediaThumbnails,omitempty"`
+
+	// Duration in seconds and waveform of voice recordings
+	MediaDuration float64 `json:"mediaDuration,omitempty"`
+	MediaWaveform []int   `json:"mediaWaveform,omitempty"`
 }
 
 // ToResponse converts a Message to MessageResponse for JSON output
@@ -177,6 +316,9 @@ func (m *Message) ToResponse() MessageResponse {
 		senderName = m.Sender.Name
 		senderAvatar = m.Sender.Avatar
 	}
+	if m.SenderName != "" {
+		senderName = m.SenderName
+	}
 
 	// Handle cases where room might not be loaded
 	roomName := ""
@@ -196,6 +338,16 @@ func (m *Message) ToResponse() MessageResponse {
 		// If we have the reply relationship loaded, get the UUID
 		if m.ReplyTo != nil {
 			replyInfo.ID = m.ReplyTo.UUID
+
+			// Replies to a tombstone keep the thread link but not the content
+			if m.ReplyTo.DeletedAt.Valid {
+				replyInfo.Text = DeletedMessageText
+				replyInfo.Deleted = true
+			}
+		} else if m.ReplyToID == nil && m.ReplyToText == "" {
+			// The link and quote are both gone once the original tombstone is purged
+			replyInfo.Text = DeletedMessageText
+			replyInfo.Deleted = true
 		}
 	}
 
@@ -222,18 +374,74 @@ func (m *Message) ToResponse() MessageResponse {
 		reactions = append(reactions, *summary)
 	}
 
+	// Deleted messages are kept as tombstones with their content scrubbed
+	text := m.Text
+	htmlText := m.HTML
+	entities := decodeJSONArray[MessageEntity](m.Entities)
+	linkPreviews := decodeJSONArray[LinkPreview](m.LinkPreviews)
+	thumbnails := decodeJSONArray[MediaThumbnail](m.MediaThumbnails)
+	deletedBy := ""
+	if m.DeletedAt.Valid {
+		htmlText = ""
+		entities = nil
+		linkPreviews = nil
+		thumbnails = nil
+		text = DeletedMessageText
+		deletedBy = "sender"
+		if m.RemovedByModerator() {
+			text = RemovedByModeratorText
+			deletedBy = "moderator"
+		}
+	}
+
 	return MessageResponse{
 		ID:        m.UUID,
 		Sender:    senderName,
 		Avatar:    senderAvatar,
 		Room:      roomName,
-		Text:      m.Text,
+		Text:      text,
+		HTML:      htmlText,
+		Entities:  entities,
 		Timestamp: m.CreatedAt,
 		Type:      m.Type,
+		IsBot:     m.Sender.IsBot,
 		MediaURL:  m.MediaURL,
 		MediaType: m.MediaType,
 		FileName:  m.FileName,
 		ReplyTo:   replyInfo,
 		Reactions: reactions,
+		Deleted:   m.DeletedAt.Valid,
+
+		DeletedBy:    deletedBy,
+		DeleteReason: m.DeleteReason,
+
+		LinkPreviews: linkPreviews,
+
+		MediaSize:       m.MediaSize,
+		MediaMimeType:   m.MediaMimeType,
+		MediaWidth:      m.MediaWidth,
+		MediaHeight:     m.MediaHeight,
+		MediaBlurhash:   m.MediaBlurhash,
+		MediaThumbnails: thumbnails,
+
+		MediaDuration: m.MediaDuration,
+		MediaWaveform: decodeJSONArray[int](m.MediaWaveform),
 	}
 }
+
+// decodeJSONArray decodes a JSON array column, treating malformed data as empty
+func decodeJSONArray[T any](data json.RawMessage) []T {
+	if len(data) == 0 {
+		return nil
+	}
+	var items []T
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil
+	}
+	return items
+}
+
+// RemovedByModerator reports whether the message was deleted by someone other than its sender
+func (m *Message) RemovedByModerator() bool {
+	return m.DeletedByID != nil && *m.DeletedByID != m.SenderID
+}
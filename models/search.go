@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// MessageSearchFilter narrows a full-text message search
+type MessageSearchFilter struct {
+	Query    string     // Words to match; the last word also matches as a prefix
+	RoomName string     // Only search this room
+	Sender   string     // Only messages sent by users with this display name (case-insensitive)
+	Since    *time.Time // Sent at or after
+	Until    *time.Time // Sent before
+	HasMedia *bool      // Only messages with (true) or without (false) an attachment
+}
+
+// MessageSearchResult is a single search hit
+type MessageSearchResult struct {
+	Message MessageResponse `json:"message"`
+	Snippet string          `json:"snippet"` // HTML-escaped excerpt with matches wrapped in <mark>
+}
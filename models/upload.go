@@ -0,0 +1,82 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Upload records a file stored by the upload endpoint, with the details found
+// while processing it. Media messages copy these details when they are sent.
+// Identical files share a blob, so several uploads can have the same URL.
+type Upload struct {
+	ID          uint            `gorm:"primaryKey" json:"-"`
+	URL         string          `gorm:"index;not null" json:"url"`
+	UploaderID  uint            `gorm:"not null;index" json:"uploader_id"`
+	FileName    string          `json:"file_name"`    // Name of the file on the uploader's device
+	ContentType string          `json:"content_type"` // Detected from the content, not the uploader's claim
+	MediaType   string          `json:"media_type"`   // "image", "video", "audio" or "file"
+	Size        int64           `json:"size"`
+	Width       int             `json:"width,omitempty"`
+	Height      int             `json:"height,omitempty"`
+	Blurhash    string          `json:"blurhash,omitempty"`
+	Thumbnails  json.RawMessage `gorm:"type:text" json:"thumbnails,omitempty"` // JSON array of MediaThumbnail
+	Duration    float64         `json:"duration,omitempty"`                    // Seconds, for voice recordings
+	Waveform    json.RawMessage `gorm:"type:text" json:"waveform,omitempty"`   // JSON array of levels from 0 to 100
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// Blob is a stored file, kept under the SHA-256 hash of its content followed
+// by the extension of its type. Its thumbnails are stored under the same hash.
+type Blob struct {
+	Key        string          `gorm:"primaryKey" json:"key"`
+	Size       int64           `json:"size"`
+	Thumbnails json.RawMessage `gorm:"type:text" json:"thumbnails,omitempty"` // JSON array of MediaThumbnail
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// BlobReference keeps a blob stored. An upload holds a reference until it is
+// sent, then the message it was sent in takes the reference over; a blob is
+// deleted with its last reference.
+type BlobReference struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	BlobKey   string    `gorm:"not null;index" json:"blob_key"`
+	MessageID *uint     `gorm:"index" json:"message_id,omitempty"`
+	UploadID  *uint     `gorm:"index" json:"upload_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MediaThumbnail is a downscaled copy of an uploaded image
+type MediaThumbnail struct {
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// TusUpload is a resumable upload in progress. Chunks are appended to a
+// partial file on disk until Offset reaches Length, then the file is stored
+// like any other upload and UploadURL points at it.
+type TusUpload struct {
+	ID         string    `gorm:"primaryKey" json:"id"`
+	UploaderID uint      `gorm:"not null;index" json:"uploader_id"`
+	Length     int64     `gorm:"not null" json:"length"`
+	Offset     int64     `gorm:"not null;default:0" json:"offset"`
+	FileName   string    `json:"file_name"`            // From the upload metadata
+	FileType   string    `json:"file_type"`            // Content type declared in the upload metadata
+	UploadURL  string    `json:"upload_url,omitempty"` // URL of the stored file once complete
+	ExpiresAt  time.Time `gorm:"index" json:"expires_at"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// UploadSweepReport describes a pass of the sweeper that removes stored files
+// no message uses
+type UploadSweepReport struct {
+	DryRun         bool      `json:"dry_run"`         // Files were only counted, not removed
+	GracePeriod    string    `json:"grace_period"`    // Files younger than this were kept
+	Scanned        int       `json:"scanned"`         // Files in the store
+	Removed        int       `json:"removed"`         // Orphaned files removed, or that would be on a dry run
+	ReclaimedBytes int64     `json:"reclaimed_bytes"` // Combined size of the removed files
+	Failed         int       `json:"failed"`          // Orphaned files that could not be removed
+	StartedAt      time.Time `json:"started_at"`
+	FinishedAt     time.Time `json:"finished_at"`
+}
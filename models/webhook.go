@@ -0,0 +1,124 @@
+package models
+
+import "time"
+
+// IncomingWebhook lets external systems post into a room through a secret URL.
+// Only a SHA-256 hash of the secret is stored; the URL is shown once when created.
+type IncomingWebhook struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	RoomID      uint       `gorm:"not null;index" json:"room_id"`
+	UserID      uint       `gorm:"not null" json:"user_id"` // Bot user the webhook's messages are sent as
+	Name        string     `gorm:"not null" json:"name"`
+	TokenHash   string     `gorm:"uniqueIndex;not null" json:"-"`
+	Prefix      string     `gorm:"not null" json:"prefix"` // First characters of the secret, for identification
+	CreatedByID uint       `gorm:"not null" json:"created_by_id"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+
+	// Relationships
+	Room Room `gorm:"foreignKey:RoomID" json:"-"`
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+// IncomingWebhookAttachment is a file referenced by URL in a webhook payload
+type IncomingWebhookAttachment struct {
+	URL      string `json:"url"`
+	FileName string `json:"file_name"`
+	Type     string `json:"type"` // "image", "video" or "file"; image or video is guessed from the file extension when empty
+}
+
+// IncomingWebhookPayload is the JSON body accepted by an incoming webhook
+type IncomingWebhookPayload struct {
+	Text        string                      `json:"text"`
+	Username    string                      `json:"username"` // Display name override for this message
+	Attachments []IncomingWebhookAttachment `json:"attachments"`
+}
+
+// Outgoing webhook event types
+const (
+	WebhookEventMessageCreated  = "message.created"
+	WebhookEventMessageUpdated  = "message.updated"
+	WebhookEventMessageDeleted  = "message.deleted"
+	WebhookEventReactionAdded   = "reaction.added"
+	WebhookEventReactionRemoved = "reaction.removed"
+	WebhookEventMemberJoined    = "member.joined"
+	WebhookEventMemberLeft      = "member.left"
+)
+
+// WebhookEventTypes lists every event an outgoing webhook can subscribe to
+var WebhookEventTypes = []string{
+	WebhookEventMessageCreated,
+	WebhookEventMessageUpdated,
+	WebhookEventMessageDeleted,
+	WebhookEventReactionAdded,
+	WebhookEventReactionRemoved,
+	WebhookEventMemberJoined,
+	WebhookEventMemberLeft,
+}
+
+// OutgoingWebhook sends signed JSON events about a room to an HTTP endpoint
+type OutgoingWebhook struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	RoomID      uint      `gorm:"not null;index" json:"room_id"`
+	URL         string    `gorm:"not null" json:"url"`
+	Events      string    `gorm:"not null" json:"events"` // Comma-separated event types
+	Secret      string    `gorm:"not null" json:"-"`      // HMAC-SHA256 signing key, shown once when created
+	CreatedByID uint      `gorm:"not null" json:"created_by_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Outgoing webhook delivery states
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryDead      = "dead" // Gave up after the maximum number of attempts
+)
+
+// WebhookDelivery is one event queued for one outgoing webhook. The table is
+// the persistent outbox the dispatcher works from.
+type WebhookDelivery struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	WebhookID      uint       `gorm:"not null;index" json:"webhook_id"`
+	EventID        string     `gorm:"not null;index" json:"event_id"` // Same for every webhook receiving the event
+	EventType      string     `gorm:"not null" json:"event_type"`
+	Payload        string     `gorm:"type:text;not null" json:"-"`
+	Status         string     `gorm:"not null;default:pending;index:idx_webhook_deliveries_due,priority:1" json:"status"`
+	Attempts       int        `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt  time.Time  `gorm:"not null;index:idx_webhook_deliveries_due,priority:2" json:"next_attempt_at"`
+	LastStatusCode int        `json:"last_status_code,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+
+	// Relationships
+	AttemptLog []WebhookDeliveryAttempt `gorm:"foreignKey:DeliveryID" json:"attempt_log,omitempty"`
+}
+
+// WebhookDeliveryAttempt records a single HTTP attempt of a delivery
+type WebhookDeliveryAttempt struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	DeliveryID uint      `gorm:"not null;index" json:"delivery_id"`
+	WebhookID  uint      `gorm:"not null;index" json:"webhook_id"`
+	Attempt    int       `gorm:"not null" json:"attempt"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// WebhookEvent is the JSON body POSTed to outgoing webhooks
+type WebhookEvent struct {
+	ID        string                 `json:"id"`
+	Type      string                 `json:"type"`
+	CreatedAt time.Time              `json:"created_at"`
+	Room      WebhookEventRoom       `json:"room"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+// WebhookEventRoom identifies the room an event happened in
+type WebhookEventRoom struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github/sabt-dev/realtimeChat/database"
+	"github/sabt-dev/realtimeChat/models"
+
+	"gorm.io/gorm"
+)
+
+// AuditEntry describes a security-relevant action to be appended to the audit log
+type AuditEntry struct {
+	ActorID    *uint
+	Action     string
+	TargetType string
+	TargetID   string
+	RoomID     *uint
+	Metadata   map[string]interface{}
+	IP         string
+}
+
+// AuditService handles the append-only audit log
+type AuditService struct {
+	db *gorm.DB
+}
+
+// NewAuditService creates a new AuditService
+func NewAuditService() *AuditService {
+	return &AuditService{db: database.GetDB()}
+}
+
+// Record appends an entry to the audit log
+func (s *AuditService) Record(entry AuditEntry) error {
+	return recordAudit(s.db, entry)
+}
+
+// ClampAuditLogPage returns the page ListAuditLogs serves for the requested
+// limit and offset: at most 200 entries, 50 if the limit is out of range
+func ClampAuditLogPage(limit, offset int) (int, int) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
+
+// ListAuditLogs returns audit entries matching the filter, newest first, along with the total match count
+func (s *AuditService) ListAuditLogs(filter models.AuditLogFilter, limit, offset int) ([]models.AuditLog, int64, error) {
+	limit, offset = ClampAuditLogPage(limit, offset)
+
+	query := s.db.Model(&models.AuditLog{})
+	if filter.ActorID != nil {
+		query = query.Where("actor_id = ?", *filter.ActorID)
+	}
+	if filter.Action != "" {
+		if strings.HasSuffix(filter.Action, "*") {
+			query = query.Where("action LIKE ?", strings.TrimSuffix(filter.Action, "*")+"%")
+		} else {
+			query = query.Where("action = ?", filter.Action)
+		}
+	}
+	if filter.TargetType != "" {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		query = query.Where("target_id = ?", filter.TargetID)
+	}
+	if filter.RoomID != nil {
+		query = query.Where("room_id = ?", *filter.RoomID)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("created_at < ?", filter.Until)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var entries []models.AuditLog
+	if err := query.Preload("Actor").
+		Order("created_at DESC, id DESC").
+		Limit(limit).Offset(offset).
+		Find(&entries).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return entries, total, nil
+}
+
+// recordAudit appends an entry using db, which may be a transaction so the entry commits with the action
+func recordAudit(db *gorm.DB, entry AuditEntry) error {
+	log := models.AuditLog{
+		ActorID:    entry.ActorID,
+		Action:     entry.Action,
+		TargetType: entry.TargetType,
+		TargetID:   entry.TargetID,
+		RoomID:     entry.RoomID,
+		IP:         entry.IP,
+	}
+
+	if len(entry.Metadata) > 0 {
+		metadata, err := json.Marshal(entry.Metadata)
+		if err != nil {
+			return fmt.Errorf("failed to encode audit metadata: %w", err)
+		}
+		log.Metadata = metadata
+	}
+
+	if err := db.Create(&log).Error; err != nil {
+		return fmt.Errorf("failed to record audit entry %s: %w", entry.Action, err)
+	}
+	return nil
+}
+
+// uintPtr returns a pointer to a copy of v, for optional audit fields
+func uintPtr(v uint) *uint {
+	return &v
+}
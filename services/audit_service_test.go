@@ -0,0 +1,48 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+
+	"github/sabt-dev/realtimeChat/models"
+)
+
+func TestClampAuditLogPage(t *testing.T) {
+	tests := []struct {
+		limit, offset         int
+		wantLimit, wantOffset int
+	}{
+		{limit: 50, offset: 0, wantLimit: 50, wantOffset: 0},
+		{limit: 1, offset: 10, wantLimit: 1, wantOffset: 10},
+		{limit: 200, offset: 0, wantLimit: 200, wantOffset: 0},
+		{limit: 201, offset: 0, wantLimit: 50, wantOffset: 0},
+		{limit: 0, offset: 0, wantLimit: 50, wantOffset: 0},
+		{limit: -5, offset: -1, wantLimit: 50, wantOffset: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d,%d", tt.limit, tt.offset), func(t *testing.T) {
+			limit, offset := ClampAuditLogPage(tt.limit, tt.offset)
+			if limit != tt.wantLimit || offset != tt.wantOffset {
+				t.Errorf("ClampAuditLogPage(%d, %d) = %d, %d, want %d, %d", tt.limit, tt.offset, limit, offset, tt.wantLimit, tt.wantOffset)
+			}
+		})
+	}
+}
+
+func TestListAuditLogsClampsLimit(t *testing.T) {
+	db := newTestDB(t)
+	for i := 0; i < 60; i++ {
+		if err := recordAudit(db, AuditEntry{Action: "auth.login", IP: "203.0.113.7"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, total, err := NewAuditService().ListAuditLogs(models.AuditLogFilter{}, 500, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 60 || len(entries) != 50 {
+		t.Errorf("ListAuditLogs(limit 500) = %d entries of %d, want 50 of 60", len(entries), total)
+	}
+}
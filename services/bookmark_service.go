@@ -0,0 +1,142 @@
+package services
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github/sabt-dev/realtimeChat/database"
+	"github/sabt-dev/realtimeChat/models"
+
+	"gorm.io/gorm"
+)
+
+// maxBookmarkNoteLength caps the personal note stored with a bookmark
+const maxBookmarkNoteLength = 500
+
+// BookmarkService handles users' saved messages
+type BookmarkService struct {
+	db *gorm.DB
+}
+
+// NewBookmarkService creates a new BookmarkService
+func NewBookmarkService() *BookmarkService {
+	return &BookmarkService{db: database.GetDB()}
+}
+
+// SaveBookmark bookmarks a message the user can access, or updates the note of
+// an existing bookmark
+func (s *BookmarkService) SaveBookmark(userID uint, uuid, note string) (*models.Bookmark, error) {
+	if utf8.RuneCountInString(note) > maxBookmarkNoteLength {
+		return nil, fmt.Errorf("note must be at most %d characters", maxBookmarkNoteLength)
+	}
+
+	var message models.Message
+	if err := s.db.Preload("Room").Where("uuid = ?", uuid).First(&message).Error; err != nil {
+		return nil, fmt.Errorf("message not found: %w", err)
+	}
+
+	canAccess, err := NewRoomService().CanUserAccessRoom(userID, message.Room.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify room access: %w", err)
+	}
+	if !canAccess {
+		return nil, fmt.Errorf("access denied to this message")
+	}
+
+	var bookmark models.Bookmark
+	err = s.db.Where("user_id = ? AND message_id = ?", userID, message.ID).First(&bookmark).Error
+	switch {
+	case err == nil:
+		bookmark.Note = note
+		if err := s.db.Save(&bookmark).Error; err != nil {
+			return nil, fmt.Errorf("failed to update bookmark: %w", err)
+		}
+	case err == gorm.ErrRecordNotFound:
+		bookmark = models.Bookmark{UserID: userID, MessageID: message.ID, Note: note}
+		if err := s.db.Create(&bookmark).Error; err != nil {
+			return nil, fmt.Errorf("failed to create bookmark: %w", err)
+		}
+	default:
+		return nil, err
+	}
+
+	if err := preloadNestedMessageAssociations(s.db.Preload("Message"), "Message.").First(&bookmark, bookmark.ID).Error; err != nil {
+		return nil, err
+	}
+	return &bookmark, nil
+}
+
+// RemoveBookmark removes the user's bookmark of a message
+func (s *BookmarkService) RemoveBookmark(userID uint, uuid string) error {
+	result := s.db.Where("user_id = ? AND message_id IN (?)", userID,
+		s.db.Unscoped().Model(&models.Message{}).Select("id").Where("uuid = ?", uuid)).
+		Delete(&models.Bookmark{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to remove bookmark: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("bookmark not found")
+	}
+	return nil
+}
+
+// ClampBookmarkPage returns the page GetUserBookmarks serves for the requested
+// limit and offset: at most 100 bookmarks, 50 if the limit is out of range
+func ClampBookmarkPage(limit, offset int) (int, int) {
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
+
+// GetUserBookmarks returns the user's bookmarks across all rooms, newest first.
+// Bookmarks in rooms the user can no longer access are left out.
+func (s *BookmarkService) GetUserBookmarks(userID uint, limit, offset int) ([]models.Bookmark, int64, error) {
+	limit, offset = ClampBookmarkPage(limit, offset)
+
+	// Re-check access once per room the user has bookmarks in
+	var rooms []models.Room
+	if err := s.db.Distinct("rooms.id", "rooms.name").
+		Joins("JOIN messages ON messages.room_id = rooms.id").
+		Joins("JOIN bookmarks ON bookmarks.message_id = messages.id").
+		Where("bookmarks.user_id = ?", userID).
+		Find(&rooms).Error; err != nil {
+		return nil, 0, err
+	}
+
+	roomService := NewRoomService()
+	var accessibleRoomIDs []uint
+	for _, room := range rooms {
+		canAccess, err := roomService.CanUserAccessRoom(userID, room.Name)
+		if err != nil {
+			return nil, 0, err
+		}
+		if canAccess {
+			accessibleRoomIDs = append(accessibleRoomIDs, room.ID)
+		}
+	}
+	if len(accessibleRoomIDs) == 0 {
+		return []models.Bookmark{}, 0, nil
+	}
+
+	accessibleBookmarks := func() *gorm.DB {
+		return s.db.Model(&models.Bookmark{}).
+			Joins("JOIN messages ON messages.id = bookmarks.message_id").
+			Where("bookmarks.user_id = ? AND messages.room_id IN ?", userID, accessibleRoomIDs)
+	}
+
+	var total int64
+	if err := accessibleBookmarks().Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var bookmarks []models.Bookmark
+	err := preloadNestedMessageAssociations(accessibleBookmarks().Select("bookmarks.*").Preload("Message"), "Message.").
+		Order("bookmarks.created_at DESC, bookmarks.id DESC").
+		Limit(limit).Offset(offset).
+		Find(&bookmarks).Error
+	return bookmarks, total, err
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSaveBookmarkNoteLengthCountsCharacters(t *testing.T) {
+	db := newTestDB(t)
+	alice := createTestUser(t, db, "alice", false)
+	room := createTestRoom(t, db, "general", false, alice)
+	message, err := NewMessageService().CreateMessage(alice.ID, room.ID, "hello", "message", "", "", "", nil, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		note    string
+		wantErr bool
+	}{
+		{name: "ascii at limit", note: strings.Repeat("a", maxBookmarkNoteLength)},
+		{name: "accents at limit", note: strings.Repeat("é", maxBookmarkNoteLength)},
+		{name: "emoji at limit", note: strings.Repeat("🔖", maxBookmarkNoteLength)},
+		{name: "ascii over limit", note: strings.Repeat("a", maxBookmarkNoteLength+1), wantErr: true},
+		{name: "emoji over limit", note: strings.Repeat("🔖", maxBookmarkNoteLength+1), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bookmark, err := NewBookmarkService().SaveBookmark(alice.ID, message.UUID, tt.note)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SaveBookmark() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && bookmark.Note != tt.note {
+				t.Errorf("saved note has %d bytes, want %d", len(bookmark.Note), len(tt.note))
+			}
+		})
+	}
+}
+
+func TestClampBookmarkPage(t *testing.T) {
+	tests := []struct {
+		limit, offset         int
+		wantLimit, wantOffset int
+	}{
+		{limit: 20, offset: 40, wantLimit: 20, wantOffset: 40},
+		{limit: 100, offset: 0, wantLimit: 100, wantOffset: 0},
+		{limit: 101, offset: 0, wantLimit: 50, wantOffset: 0},
+		{limit: 0, offset: -3, wantLimit: 50, wantOffset: 0},
+	}
+
+	for _, tt := range tests {
+		if limit, offset := ClampBookmarkPage(tt.limit, tt.offset); limit != tt.wantLimit || offset != tt.wantOffset {
+			t.Errorf("ClampBookmarkPage(%d, %d) = %d, %d, want %d, %d", tt.limit, tt.offset, limit, offset, tt.wantLimit, tt.wantOffset)
+		}
+	}
+}
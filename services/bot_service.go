@@ -0,0 +1,397 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github/sabt-dev/realtimeChat/database"
+	"github/sabt-dev/realtimeChat/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// botTokenPrefix marks bot tokens so they are easy to recognize in logs and secret scanners
+const botTokenPrefix = "rcbot_"
+
+// botTokenTouchInterval limits how often a token's last-used time is written
+const botTokenTouchInterval = time.Minute
+
+// ErrInvalidBotToken is returned for unknown or revoked bot tokens
+var ErrInvalidBotToken = errors.New("invalid bot token")
+
+// BotService handles bot accounts, their tokens and the rooms they may join
+type BotService struct {
+	db       *gorm.DB
+	clientIP string // Recorded in audit entries
+}
+
+// NewBotService creates a new BotService
+func NewBotService() *BotService {
+	return &BotService{db: database.GetDB()}
+}
+
+// WithClientIP returns a copy of the service that records ip in its audit entries
+func (s *BotService) WithClientIP(ip string) *BotService {
+	return &BotService{db: s.db, clientIP: ip}
+}
+
+// hashSecretToken returns the stored form of a bot token or webhook secret
+func hashSecretToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newSecretToken generates a random token with the given prefix
+func newSecretToken(prefix string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(b), nil
+}
+
+// CreateBot creates a bot account along with its first token (admin only).
+// The token is returned in plain text and cannot be retrieved again.
+func (s *BotService) CreateBot(name, avatar string, adminID uint) (*models.User, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 50 {
+		return nil, "", fmt.Errorf("bot name must be between 1 and 50 characters")
+	}
+
+	tx := s.db.Begin()
+	if tx.Error != nil {
+		return nil, "", tx.Error
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Bots have no mailbox; the placeholder address only keeps the email column unique
+	bot := models.User{
+		Name:   name,
+		Email:  fmt.Sprintf("bot-%s@bots.invalid", uuid.New().String()),
+		Avatar: avatar,
+		IsBot:  true,
+	}
+	if err := tx.Create(&bot).Error; err != nil {
+		tx.Rollback()
+		return nil, "", err
+	}
+
+	token, _, err := s.createToken(tx, bot.ID, "default", adminID)
+	if err != nil {
+		tx.Rollback()
+		return nil, "", err
+	}
+
+	if err := recordAudit(tx, AuditEntry{
+		ActorID:    uintPtr(adminID),
+		Action:     "bot.create",
+		TargetType: "user",
+		TargetID:   fmt.Sprint(bot.ID),
+		Metadata:   map[string]interface{}{"name": bot.Name},
+		IP:         s.clientIP,
+	}); err != nil {
+		tx.Rollback()
+		return nil, "", err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, "", err
+	}
+	return &bot, token, nil
+}
+
+// CreateToken issues an additional token for a bot (admin only)
+func (s *BotService) CreateToken(botID uint, name string, adminID uint) (*models.BotToken, string, error) {
+	bot, err := s.GetBot(botID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	tx := s.db.Begin()
+	if tx.Error != nil {
+		return nil, "", tx.Error
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	token, record, err := s.createToken(tx, bot.ID, name, adminID)
+	if err != nil {
+		tx.Rollback()
+		return nil, "", err
+	}
+	if err := recordAudit(tx, AuditEntry{
+		ActorID:    uintPtr(adminID),
+		Action:     "bot.token.create",
+		TargetType: "bot_token",
+		TargetID:   fmt.Sprint(record.ID),
+		Metadata:   map[string]interface{}{"bot_id": bot.ID, "name": record.Name},
+		IP:         s.clientIP,
+	}); err != nil {
+		tx.Rollback()
+		return nil, "", err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, "", err
+	}
+	return record, token, nil
+}
+
+func (s *BotService) createToken(tx *gorm.DB, botID uint, name string, adminID uint) (string, *models.BotToken, error) {
+	token, err := newSecretToken(botTokenPrefix)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+	record := models.BotToken{
+		BotID:       botID,
+		Name:        strings.TrimSpace(name),
+		TokenHash:   hashSecretToken(token),
+		Prefix:      token[:len(botTokenPrefix)+6],
+		CreatedByID: uintPtr(adminID),
+	}
+	if err := tx.Create(&record).Error; err != nil {
+		return "", nil, err
+	}
+	return token, &record, nil
+}
+
+// RevokeToken revokes a bot token (admin only) and returns it; revoking twice is a no-op
+func (s *BotService) RevokeToken(tokenID, adminID uint) (*models.BotToken, error) {
+	var record models.BotToken
+	if err := s.db.First(&record, tokenID).Error; err != nil {
+		return nil, fmt.Errorf("token not found: %w", err)
+	}
+	if record.RevokedAt != nil {
+		return &record, nil
+	}
+
+	tx := s.db.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Model(&record).Update("revoked_at", time.Now()).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := recordAudit(tx, AuditEntry{
+		ActorID:    uintPtr(adminID),
+		Action:     "bot.token.revoke",
+		TargetType: "bot_token",
+		TargetID:   fmt.Sprint(record.ID),
+		Metadata:   map[string]interface{}{"bot_id": record.BotID},
+		IP:         s.clientIP,
+	}); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// Authenticate resolves a bearer token to its bot account
+func (s *BotService) Authenticate(token string) (*models.User, error) {
+	if !strings.HasPrefix(token, botTokenPrefix) {
+		return nil, ErrInvalidBotToken
+	}
+
+	var record models.BotToken
+	err := s.db.Preload("Bot").
+		Where("token_hash = ? AND revoked_at IS NULL", hashSecretToken(token)).
+		First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && !record.Bot.IsBot) {
+		return nil, ErrInvalidBotToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if record.LastUsedAt == nil || time.Since(*record.LastUsedAt) > botTokenTouchInterval {
+		if err := s.db.Model(&record).Update("last_used_at", time.Now()).Error; err != nil {
+			fmt.Printf("Warning: failed to update bot token last use: %v\n", err)
+		}
+	}
+	return &record.Bot, nil
+}
+
+// GetBot returns a bot account by ID
+func (s *BotService) GetBot(botID uint) (*models.User, error) {
+	var bot models.User
+	if err := s.db.Where("id = ? AND is_bot = ?", botID, true).First(&bot).Error; err != nil {
+		return nil, fmt.Errorf("bot not found: %w", err)
+	}
+	return &bot, nil
+}
+
+// ListBots returns all bot accounts, optionally with their tokens (never the token values)
+func (s *BotService) ListBots(withTokens bool) ([]models.BotResponse, error) {
+	var bots []models.User
+	// Webhook senders and imported bots are bot users too, but have never had
+	// a token; every bot account created here gets one
+	if err := s.db.Where("is_bot = ? AND id IN (?)", true, s.db.Model(&models.BotToken{}).Select("bot_id")).
+		Order("name ASC").Find(&bots).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]models.BotResponse, 0, len(bots))
+	for _, bot := range bots {
+		response := bot.ToBotResponse()
+		if withTokens {
+			if err := s.db.Where("bot_id = ?", bot.ID).Order("created_at ASC").Find(&response.Tokens).Error; err != nil {
+				return nil, err
+			}
+		}
+		result = append(result, response)
+	}
+	return result, nil
+}
+
+// IsBot reports whether the user is a bot account
+func (s *BotService) IsBot(userID uint) (bool, error) {
+	var count int64
+	err := s.db.Model(&models.User{}).Where("id = ? AND is_bot = ?", userID, true).Count(&count).Error
+	return count > 0, err
+}
+
+// IsBotAllowedInRoom reports whether the room's allowlist contains the bot
+func (s *BotService) IsBotAllowedInRoom(botID, roomID uint) (bool, error) {
+	var count int64
+	err := s.db.Model(&models.RoomBot{}).Where("bot_id = ? AND room_id = ?", botID, roomID).Count(&count).Error
+	return count > 0, err
+}
+
+// GetRoomBots lists the bots allowed in a room
+func (s *BotService) GetRoomBots(roomID uint) ([]models.BotResponse, error) {
+	var entries []models.RoomBot
+	if err := s.db.Preload("Bot").Where("room_id = ?", roomID).Order("created_at ASC").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	result := make([]models.BotResponse, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, entry.Bot.ToBotResponse())
+	}
+	return result, nil
+}
+
+// AllowBotInRoom adds a bot to a room's allowlist (room creator only).
+// Allowing an already allowed bot is a no-op.
+func (s *BotService) AllowBotInRoom(roomID, botID, userID uint) error {
+	if err := requireRoomCreator(roomID, userID, "manage bots"); err != nil {
+		return err
+	}
+	bot, err := s.GetBot(botID)
+	if err != nil {
+		return err
+	}
+
+	allowed, err := s.IsBotAllowedInRoom(bot.ID, roomID)
+	if err != nil || allowed {
+		return err
+	}
+
+	tx := s.db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Create(&models.RoomBot{RoomID: roomID, BotID: bot.ID, AddedByID: userID}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := recordAudit(tx, AuditEntry{
+		ActorID:    uintPtr(userID),
+		Action:     "room.bot.allow",
+		TargetType: "user",
+		TargetID:   fmt.Sprint(bot.ID),
+		RoomID:     uintPtr(roomID),
+		Metadata:   map[string]interface{}{"bot": bot.Name},
+		IP:         s.clientIP,
+	}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// RemoveBotFromRoom removes a bot from a room's allowlist (room creator only).
+// The bot's membership is deactivated; a connected bot is refused on its next frame.
+func (s *BotService) RemoveBotFromRoom(roomID, botID, userID uint) error {
+	if err := requireRoomCreator(roomID, userID, "manage bots"); err != nil {
+		return err
+	}
+
+	tx := s.db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	result := tx.Where("room_id = ? AND bot_id = ?", roomID, botID).Delete(&models.RoomBot{})
+	if result.Error != nil {
+		tx.Rollback()
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return fmt.Errorf("bot is not allowed in this room")
+	}
+	if err := tx.Model(&models.RoomMember{}).
+		Where("room_id = ? AND user_id = ?", roomID, botID).
+		Update("is_active", false).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := recordAudit(tx, AuditEntry{
+		ActorID:    uintPtr(userID),
+		Action:     "room.bot.remove",
+		TargetType: "user",
+		TargetID:   fmt.Sprint(botID),
+		RoomID:     uintPtr(roomID),
+		IP:         s.clientIP,
+	}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// requireRoomCreator returns an error naming the action unless the user created the room
+func requireRoomCreator(roomID, userID uint, action string) error {
+	isCreator, err := NewRoomService().IsRoomCreator(userID, roomID)
+	if err != nil {
+		return fmt.Errorf("failed to verify room creator: %w", err)
+	}
+	if !isCreator {
+		return fmt.Errorf("only the room creator can %s", action)
+	}
+	return nil
+}
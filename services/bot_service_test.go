@@ -0,0 +1,75 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestListBotsOnlyListsTokenBots(t *testing.T) {
+	db := newTestDB(t)
+	admin := createTestUser(t, db, "admin", false)
+	service := NewBotService()
+
+	deploybot, _, err := service.CreateBot("deploybot", "", admin.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, _, err := service.CreateBot("oldbot", "", admin.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bots, err := service.ListBots(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.RevokeToken(bots[1].Tokens[0].ID, admin.ID); err != nil {
+		t.Fatal(err)
+	}
+	// An imported Slack integration is a bot user without tokens
+	createTestUser(t, db, "slackbot", true)
+
+	bots, err = service.ListBots(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bots) != 2 || bots[0].ID != deploybot.ID || bots[1].ID != revoked.ID {
+		t.Errorf("ListBots() = %+v, want deploybot and oldbot", bots)
+	}
+}
+
+func TestRevokeToken(t *testing.T) {
+	db := newTestDB(t)
+	admin := createTestUser(t, db, "admin", false)
+	service := NewBotService()
+
+	bot, token, err := service.CreateBot("deploybot", "", admin.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authenticated, err := service.Authenticate(token); err != nil || authenticated.ID != bot.ID {
+		t.Fatalf("Authenticate() = %v, %v, want the bot", authenticated, err)
+	}
+
+	bots, err := service.ListBots(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err := service.RevokeToken(bots[0].Tokens[0].ID, admin.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.BotID != bot.ID {
+		t.Errorf("RevokeToken() returned token of bot %d, want %d", record.BotID, bot.ID)
+	}
+	if _, err := service.Authenticate(token); !errors.Is(err, ErrInvalidBotToken) {
+		t.Errorf("Authenticate() after revoke error = %v, want ErrInvalidBotToken", err)
+	}
+
+	// Revoking again is a no-op that still reports the bot
+	if record, err := service.RevokeToken(record.ID, admin.ID); err != nil || record.BotID != bot.ID {
+		t.Errorf("second RevokeToken() = %+v, %v", record, err)
+	}
+	if _, err := service.RevokeToken(record.ID+100, admin.ID); err == nil {
+		t.Error("RevokeToken() of an unknown token succeeded")
+	}
+}
@@ -0,0 +1,720 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github/sabt-dev/realtimeChat/database"
+	"github/sabt-dev/realtimeChat/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Slash command settings
+const (
+	botCommandSecretPrefix   = "rccmd_"
+	botCommandTimeout        = 5 * time.Second
+	botCommandResponseLimit  = 16 << 10
+	maxCommandReplyLength    = 4000
+	maxCommandDescriptionLen = 100
+	maxTopicLength           = 250
+	shrugText                = `¯\_(ツ)_/¯`
+)
+
+// commandNamePattern matches command names; "/etc/hosts" and the like are not commands
+var commandNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// ErrUserMuted is returned when a muted user tries to post in a room
+var ErrUserMuted = errors.New("you are muted in this room")
+
+// CommandContext describes one slash command invocation
+type CommandContext struct {
+	User *models.User
+	Room *models.Room
+	Name string // Command name without the slash
+	Args string // Everything after the name, trimmed
+}
+
+// CommandResult tells the caller what to do once a command has run
+type CommandResult struct {
+	Ephemeral string            // Reply shown only to the invoking user
+	Messages  []*models.Message // Messages posted to the room, to be broadcast
+	Kicked    *models.User      // User to disconnect from the room
+}
+
+// builtinCommand is a command handled by the server itself
+type builtinCommand struct {
+	description   string
+	usage         string
+	moderatorOnly bool
+	run           func(s *CommandService, ctx *CommandContext) (*CommandResult, error)
+}
+
+// builtinCommands are available in every room; bots cannot register these names
+var builtinCommands = map[string]builtinCommand{
+	"me":     {description: "Post an action, e.g. /me waves", usage: "<action>", run: (*CommandService).runMe},
+	"shrug":  {description: "Append " + shrugText + " to your message", usage: "[message]", run: (*CommandService).runShrug},
+	"topic":  {description: "Show the room topic, or set it (moderators)", usage: "[new topic]", run: (*CommandService).runTopic},
+	"invite": {description: "Add a user to this private room", usage: "<@name or email>", moderatorOnly: true, run: (*CommandService).runInvite},
+	"kick":   {description: "Remove a user from the room", usage: "<@name or email> [reason]", moderatorOnly: true, run: (*CommandService).runKick},
+	"mute":   {description: "Stop a user from posting, optionally for a while", usage: "<@name or email> [duration, e.g. 30m] [reason]", moderatorOnly: true, run: (*CommandService).runMute},
+	"unmute": {description: "Let a muted user post again", usage: "<@name or email>", moderatorOnly: true, run: (*CommandService).runUnmute},
+}
+
+// CommandService parses and runs slash commands and manages bot-registered commands
+type CommandService struct {
+	db       *gorm.DB
+	clientIP string // Recorded in audit entries
+}
+
+// NewCommandService creates a new CommandService
+func NewCommandService() *CommandService {
+	return &CommandService{db: database.GetDB()}
+}
+
+// WithClientIP returns a copy of the service that records ip in its audit entries
+func (s *CommandService) WithClientIP(ip string) *CommandService {
+	return &CommandService{db: s.db, clientIP: ip}
+}
+
+// ParseSlashCommand splits "/name args" into its parts. Text that does not
+// start with a single slash followed by a command name is not a command.
+func ParseSlashCommand(text string) (name, args string, ok bool) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "/") || strings.HasPrefix(text, "//") {
+		return "", "", false
+	}
+	text = text[1:]
+	end := strings.IndexFunc(text, unicode.IsSpace)
+	if end < 0 {
+		end = len(text)
+	}
+	name = strings.ToLower(text[:end])
+	if !commandNamePattern.MatchString(name) {
+		return "", "", false
+	}
+	return name, strings.TrimSpace(text[end:]), true
+}
+
+// Execute runs a built-in or bot command. Errors are meant to be shown to the invoking user.
+func (s *CommandService) Execute(ctx *CommandContext) (*CommandResult, error) {
+	if cmd, ok := builtinCommands[ctx.Name]; ok {
+		if cmd.moderatorOnly {
+			isModerator, err := NewRoomService().IsRoomModerator(ctx.User.ID, ctx.Room.ID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to verify moderator: %w", err)
+			}
+			if !isModerator {
+				return nil, fmt.Errorf("/%s is only available to room moderators", ctx.Name)
+			}
+		}
+		return cmd.run(s, ctx)
+	}
+
+	botCommand, err := s.findBotCommand(ctx.Room.ID, ctx.Name)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("unknown command /%s", ctx.Name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.invokeBotCommand(botCommand, ctx)
+}
+
+// AvailableCommands lists the commands the user can run in the room whose
+// names start with prefix, for autocomplete
+func (s *CommandService) AvailableCommands(roomID, userID uint, prefix string) ([]models.CommandInfo, error) {
+	prefix = strings.ToLower(strings.TrimPrefix(prefix, "/"))
+	isModerator, err := NewRoomService().IsRoomModerator(userID, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	commands := make([]models.CommandInfo, 0, len(builtinCommands))
+	for name, cmd := range builtinCommands {
+		if !strings.HasPrefix(name, prefix) || (cmd.moderatorOnly && !isModerator) {
+			continue
+		}
+		commands = append(commands, models.CommandInfo{
+			Name:          name,
+			Description:   cmd.description,
+			Usage:         cmd.usage,
+			Source:        "builtin",
+			ModeratorOnly: cmd.moderatorOnly,
+		})
+	}
+
+	var botCommands []models.BotCommand
+	if err := s.roomBotCommands(roomID).Preload("Bot").Find(&botCommands).Error; err != nil {
+		return nil, err
+	}
+	listed := make(map[string]bool, len(botCommands))
+	for _, cmd := range botCommands {
+		if !strings.HasPrefix(cmd.Name, prefix) || listed[cmd.Name] {
+			continue
+		}
+		listed[cmd.Name] = true
+		commands = append(commands, models.CommandInfo{
+			Name:        cmd.Name,
+			Description: cmd.Description,
+			Usage:       cmd.Usage,
+			Source:      cmd.Bot.Name,
+		})
+	}
+
+	sort.Slice(commands, func(i, j int) bool { return commands[i].Name < commands[j].Name })
+	return commands, nil
+}
+
+// roomBotCommands selects the commands of the bots allowed in the room. When
+// several of those bots register the same name, the room gets the command of
+// the bot that was allowed in it first.
+func (s *CommandService) roomBotCommands(roomID uint) *gorm.DB {
+	return s.db.Model(&models.BotCommand{}).
+		Joins("JOIN room_bots ON room_bots.bot_id = bot_commands.bot_id AND room_bots.room_id = ?", roomID).
+		Order("room_bots.id ASC")
+}
+
+// findBotCommand looks up a command of a bot allowed in the room
+func (s *CommandService) findBotCommand(roomID uint, name string) (*models.BotCommand, error) {
+	var cmd models.BotCommand
+	if err := s.roomBotCommands(roomID).Preload("Bot").Where("bot_commands.name = ?", name).First(&cmd).Error; err != nil {
+		return nil, err
+	}
+	return &cmd, nil
+}
+
+// runMe posts an action in the third person
+func (s *CommandService) runMe(ctx *CommandContext) (*CommandResult, error) {
+	if ctx.Args == "" {
+		return nil, fmt.Errorf("usage: /me <action>")
+	}
+	return s.post(ctx.User.ID, ctx.Room.ID, ctx.Args, "emote")
+}
+
+// runShrug posts the message followed by a shrug
+func (s *CommandService) runShrug(ctx *CommandContext) (*CommandResult, error) {
+	text := shrugText
+	if ctx.Args != "" {
+		text = ctx.Args + " " + shrugText
+	}
+	return s.post(ctx.User.ID, ctx.Room.ID, text, "message")
+}
+
+// runTopic shows the room topic, or sets it when given one (moderators only)
+func (s *CommandService) runTopic(ctx *CommandContext) (*CommandResult, error) {
+	if ctx.Args == "" {
+		if ctx.Room.Description == "" {
+			return &CommandResult{Ephemeral: "No topic is set for this room"}, nil
+		}
+		return &CommandResult{Ephemeral: "Topic: " + ctx.Room.Description}, nil
+	}
+
+	isModerator, err := NewRoomService().IsRoomModerator(ctx.User.ID, ctx.Room.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify moderator: %w", err)
+	}
+	if !isModerator {
+		return nil, fmt.Errorf("only room moderators can change the topic")
+	}
+	if len([]rune(ctx.Args)) > maxTopicLength {
+		return nil, fmt.Errorf("the topic can be at most %d characters", maxTopicLength)
+	}
+
+	if err := s.db.Model(ctx.Room).Update("description", ctx.Args).Error; err != nil {
+		return nil, fmt.Errorf("failed to set topic: %w", err)
+	}
+	s.audit(ctx, "room.topic", "room", fmt.Sprint(ctx.Room.ID), map[string]interface{}{"topic": ctx.Args})
+
+	return s.post(ctx.User.ID, ctx.Room.ID, fmt.Sprintf("%s set the topic: %s", ctx.User.Name, ctx.Args), "system")
+}
+
+// runInvite adds a user to a private room
+func (s *CommandService) runInvite(ctx *CommandContext) (*CommandResult, error) {
+	if !ctx.Room.IsPrivate {
+		return &CommandResult{Ephemeral: "This room is public; anyone can join it by name"}, nil
+	}
+	ref, _ := splitFirstArg(ctx.Args)
+	target, err := s.resolveUser(ref)
+	if err != nil {
+		return nil, err
+	}
+	if target.IsBot {
+		return nil, fmt.Errorf("bots are added with the room's Manage bots menu")
+	}
+
+	var count int64
+	if err := s.db.Model(&models.RoomMember{}).Where("room_id = ? AND user_id = ?", ctx.Room.ID, target.ID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return &CommandResult{Ephemeral: target.Name + " is already a member of this room"}, nil
+	}
+
+	// Invited users are members but not connected yet. IsActive defaults to
+	// true on create, so it is cleared in the same transaction.
+	tx := s.db.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+	member := models.RoomMember{UserID: target.ID, RoomID: ctx.Room.ID, Role: "member"}
+	if err := tx.Create(&member).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to add member: %w", err)
+	}
+	if err := tx.Model(&member).Update("is_active", false).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to add member: %w", err)
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to add member: %w", err)
+	}
+	s.audit(ctx, "room.member.invite", "user", fmt.Sprint(target.ID), nil)
+	emitWebhookEvent(ctx.Room.ID, models.WebhookEventMemberJoined, map[string]interface{}{"user": webhookEventUser(target.ID)})
+
+	return s.post(ctx.User.ID, ctx.Room.ID, fmt.Sprintf("%s invited %s", ctx.User.Name, target.Name), "system")
+}
+
+// runKick disconnects a user from the room and, for private rooms, revokes their membership
+func (s *CommandService) runKick(ctx *CommandContext) (*CommandResult, error) {
+	ref, reason := splitFirstArg(ctx.Args)
+	target, err := s.resolveModerationTarget(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.moderate(ctx, target, "kick", reason, func(tx *gorm.DB) error {
+		if !ctx.Room.IsPrivate {
+			return nil
+		}
+		return tx.Where("room_id = ? AND user_id = ?", ctx.Room.ID, target.ID).Delete(&models.RoomMember{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if ctx.Room.IsPrivate {
+		emitWebhookEvent(ctx.Room.ID, models.WebhookEventMemberLeft, map[string]interface{}{"user": webhookEventUser(target.ID)})
+	}
+
+	result, err := s.post(ctx.User.ID, ctx.Room.ID, withReason(fmt.Sprintf("%s was removed by %s", target.Name, ctx.User.Name), reason), "system")
+	if err != nil {
+		return nil, err
+	}
+	result.Kicked = target
+	return result, nil
+}
+
+// runMute stops a user from posting in the room until the mute expires or is lifted
+func (s *CommandService) runMute(ctx *CommandContext) (*CommandResult, error) {
+	ref, rest := splitFirstArg(ctx.Args)
+	target, err := s.resolveModerationTarget(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	var until *time.Time
+	var duration time.Duration
+	reason := rest
+	if first, after := splitFirstArg(rest); first != "" {
+		if d, err := time.ParseDuration(first); err == nil {
+			if d <= 0 {
+				return nil, fmt.Errorf("the mute duration must be positive")
+			}
+			t := time.Now().Add(d)
+			until, duration = &t, d
+			reason = after
+		}
+	}
+
+	err = s.moderate(ctx, target, "mute", reason, func(tx *gorm.DB) error {
+		if err := tx.Where("room_id = ? AND user_id = ?", ctx.Room.ID, target.ID).Delete(&models.RoomMute{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.RoomMute{
+			RoomID:    ctx.Room.ID,
+			UserID:    target.ID,
+			MutedByID: ctx.User.ID,
+			Reason:    reason,
+			Until:     until,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	text := fmt.Sprintf("%s was muted by %s", target.Name, ctx.User.Name)
+	if until != nil {
+		text += " for " + formatMuteDuration(duration)
+	}
+	return s.post(ctx.User.ID, ctx.Room.ID, withReason(text, reason), "system")
+}
+
+// runUnmute lifts a user's mute in the room
+func (s *CommandService) runUnmute(ctx *CommandContext) (*CommandResult, error) {
+	ref, _ := splitFirstArg(ctx.Args)
+	target, err := s.resolveUser(ref)
+	if err != nil {
+		return nil, err
+	}
+	mute, err := activeMute(s.db, ctx.Room.ID, target.ID)
+	if err != nil {
+		return nil, err
+	}
+	if mute == nil {
+		return &CommandResult{Ephemeral: target.Name + " is not muted"}, nil
+	}
+
+	err = s.moderate(ctx, target, "unmute", "", func(tx *gorm.DB) error {
+		return tx.Where("room_id = ? AND user_id = ?", ctx.Room.ID, target.ID).Delete(&models.RoomMute{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.post(ctx.User.ID, ctx.Room.ID, fmt.Sprintf("%s was unmuted by %s", target.Name, ctx.User.Name), "system")
+}
+
+// post creates a message from the command and returns it for broadcasting
+func (s *CommandService) post(senderID, roomID uint, text, msgType string) (*CommandResult, error) {
+	message, err := NewMessageService().WithClientIP(s.clientIP).CreateMessage(senderID, roomID, text, msgType, "", "", "", nil, "", "")
+	if err != nil {
+		return nil, err
+	}
+	return &CommandResult{Messages: []*models.Message{message}}, nil
+}
+
+// moderate applies a moderation action in a transaction and records it in the
+// room's moderation log and the audit log
+func (s *CommandService) moderate(ctx *CommandContext, target *models.User, action, reason string, apply func(tx *gorm.DB) error) error {
+	tx := s.db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := apply(tx); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to %s %s: %w", action, target.Name, err)
+	}
+	if err := tx.Create(&models.ModerationAction{
+		RoomID:       ctx.Room.ID,
+		ModeratorID:  ctx.User.ID,
+		TargetUserID: target.ID,
+		Action:       action,
+		Reason:       reason,
+	}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to record moderation action: %w", err)
+	}
+	if err := recordAudit(tx, AuditEntry{
+		ActorID:    uintPtr(ctx.User.ID),
+		Action:     "room.member." + action,
+		TargetType: "user",
+		TargetID:   fmt.Sprint(target.ID),
+		RoomID:     uintPtr(ctx.Room.ID),
+		Metadata:   map[string]interface{}{"reason": reason},
+		IP:         s.clientIP,
+	}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// audit records a command's effect; failures are only logged
+func (s *CommandService) audit(ctx *CommandContext, action, targetType, targetID string, metadata map[string]interface{}) {
+	if err := recordAudit(s.db, AuditEntry{
+		ActorID:    uintPtr(ctx.User.ID),
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		RoomID:     uintPtr(ctx.Room.ID),
+		Metadata:   metadata,
+		IP:         s.clientIP,
+	}); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+}
+
+// resolveUser finds a user by "@name", "name" or email. Names must be unambiguous.
+func (s *CommandService) resolveUser(ref string) (*models.User, error) {
+	ref = strings.TrimPrefix(ref, "@")
+	if ref == "" {
+		return nil, fmt.Errorf("name a user, e.g. @alice or alice@example.com")
+	}
+
+	var users []models.User
+	query := s.db.Limit(2)
+	if strings.Contains(ref, "@") {
+		query = query.Where("LOWER(email) = LOWER(?)", ref)
+	} else {
+		query = query.Where("LOWER(name) = LOWER(?)", ref)
+	}
+	if err := query.Find(&users).Error; err != nil {
+		return nil, err
+	}
+	switch len(users) {
+	case 0:
+		return nil, fmt.Errorf("no user named %s", ref)
+	case 1:
+		return &users[0], nil
+	default:
+		return nil, fmt.Errorf("several users are named %s; use their email instead", ref)
+	}
+}
+
+// resolveModerationTarget resolves a user the moderator may act on: not
+// themselves, never the room creator, and other moderators only by the creator
+func (s *CommandService) resolveModerationTarget(ctx *CommandContext, ref string) (*models.User, error) {
+	target, err := s.resolveUser(ref)
+	if err != nil {
+		return nil, err
+	}
+	if target.ID == ctx.User.ID {
+		return nil, fmt.Errorf("you cannot do that to yourself")
+	}
+	if target.IsBot {
+		return nil, fmt.Errorf("bots are managed with the room's Manage bots menu")
+	}
+
+	roomService := NewRoomService()
+	targetIsCreator, err := roomService.IsRoomCreator(target.ID, ctx.Room.ID)
+	if err != nil {
+		return nil, err
+	}
+	if targetIsCreator {
+		return nil, fmt.Errorf("the room creator cannot be moderated")
+	}
+	targetIsModerator, err := roomService.IsRoomModerator(target.ID, ctx.Room.ID)
+	if err != nil {
+		return nil, err
+	}
+	if targetIsModerator {
+		isCreator, err := roomService.IsRoomCreator(ctx.User.ID, ctx.Room.ID)
+		if err != nil {
+			return nil, err
+		}
+		if !isCreator {
+			return nil, fmt.Errorf("only the room creator can moderate other moderators")
+		}
+	}
+	return target, nil
+}
+
+// activeMute returns the user's unexpired mute in the room, or nil
+func activeMute(db *gorm.DB, roomID, userID uint) (*models.RoomMute, error) {
+	var mute models.RoomMute
+	err := db.Where("room_id = ? AND user_id = ? AND (until IS NULL OR until > ?)", roomID, userID, time.Now()).First(&mute).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &mute, nil
+}
+
+// splitFirstArg splits off the first whitespace-separated argument
+func splitFirstArg(args string) (first, rest string) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		return "", ""
+	}
+	return fields[0], strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(args), fields[0]))
+}
+
+func withReason(text, reason string) string {
+	if reason == "" {
+		return text
+	}
+	return text + ": " + reason
+}
+
+// formatMuteDuration renders a duration without zero units, e.g. "1h" rather than "1h0m0s"
+func formatMuteDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	hours, minutes, seconds := int64(d/time.Hour), int64(d%time.Hour/time.Minute), int64(d%time.Minute/time.Second)
+
+	var text strings.Builder
+	if hours > 0 {
+		fmt.Fprintf(&text, "%dh", hours)
+	}
+	if minutes > 0 {
+		fmt.Fprintf(&text, "%dm", minutes)
+	}
+	if seconds > 0 || text.Len() == 0 {
+		fmt.Fprintf(&text, "%ds", seconds)
+	}
+	return text.String()
+}
+
+// RegisterBotCommand creates or updates one of a bot's slash commands. Other
+// bots may use the same name; see roomBotCommands for which one a room gets.
+// The signing secret is only returned when the command is first registered.
+func (s *CommandService) RegisterBotCommand(botID uint, name, description, usage, rawURL string) (*models.BotCommand, string, error) {
+	name = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), "/"))
+	if !commandNamePattern.MatchString(name) {
+		return nil, "", fmt.Errorf("command names use lowercase letters, digits, '-' and '_' (at most 32)")
+	}
+	if _, builtin := builtinCommands[name]; builtin {
+		return nil, "", fmt.Errorf("/%s is a built-in command", name)
+	}
+	description = strings.TrimSpace(description)
+	usage = strings.TrimSpace(usage)
+	if len([]rune(description)) > maxCommandDescriptionLen || len([]rune(usage)) > maxCommandDescriptionLen {
+		return nil, "", fmt.Errorf("description and usage can be at most %d characters", maxCommandDescriptionLen)
+	}
+	u, err := validateOutboundURL(strings.TrimSpace(rawURL))
+	if err != nil {
+		return nil, "", err
+	}
+
+	var cmd models.BotCommand
+	err = s.db.Where("bot_id = ? AND name = ?", botID, name).First(&cmd).Error
+	switch {
+	case err == nil:
+		cmd.Description = description
+		cmd.Usage = usage
+		cmd.URL = u.String()
+		if err := s.db.Save(&cmd).Error; err != nil {
+			return nil, "", err
+		}
+		return &cmd, "", nil
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, "", err
+	}
+
+	secret, err := newSecretToken(botCommandSecretPrefix)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate command secret: %w", err)
+	}
+	cmd = models.BotCommand{
+		BotID:       botID,
+		Name:        name,
+		Description: description,
+		Usage:       usage,
+		URL:         u.String(),
+		Secret:      secret,
+	}
+	if err := s.db.Create(&cmd).Error; err != nil {
+		return nil, "", err
+	}
+	if err := recordAudit(s.db, AuditEntry{
+		ActorID:    uintPtr(botID),
+		Action:     "bot.command.register",
+		TargetType: "command",
+		TargetID:   name,
+		Metadata:   map[string]interface{}{"url": cmd.URL},
+		IP:         s.clientIP,
+	}); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	return &cmd, secret, nil
+}
+
+// ListBotCommands lists a bot's registered commands
+func (s *CommandService) ListBotCommands(botID uint) ([]models.BotCommand, error) {
+	var commands []models.BotCommand
+	err := s.db.Where("bot_id = ?", botID).Order("name ASC").Find(&commands).Error
+	return commands, err
+}
+
+// DeleteBotCommand removes one of a bot's commands
+func (s *CommandService) DeleteBotCommand(botID uint, name string) error {
+	result := s.db.Where("bot_id = ? AND name = ?", botID, strings.ToLower(name)).Delete(&models.BotCommand{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("command not found")
+	}
+	return nil
+}
+
+var (
+	botCommandClientOnce sync.Once
+	botCommandClient     *http.Client
+)
+
+// invokeBotCommand POSTs the invocation to the bot and turns its reply into a result
+func (s *CommandService) invokeBotCommand(cmd *models.BotCommand, ctx *CommandContext) (*CommandResult, error) {
+	botCommandClientOnce.Do(func() {
+		botCommandClient = newOutboundHTTPClient(botCommandTimeout, 0)
+	})
+
+	body, err := json.Marshal(models.BotCommandRequest{
+		InvocationID: uuid.New().String(),
+		Command:      cmd.Name,
+		Text:         ctx.Args,
+		Room:         models.WebhookEventRoom{ID: ctx.Room.ID, Name: ctx.Room.Name},
+		User:         models.BotCommandUser{ID: ctx.User.ID, Name: ctx.User.Name},
+		Timestamp:    time.Now().UTC(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp := time.Now().Unix()
+	req, err := http.NewRequest(http.MethodPost, cmd.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "realtimeChat-Commands/1.0")
+	req.Header.Set("X-Command-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Command-Signature", "sha256="+signWebhookPayload(cmd.Secret, timestamp, body))
+
+	resp, err := botCommandClient.Do(req)
+	if err != nil {
+		fmt.Printf("Warning: bot command /%s failed: %v\n", cmd.Name, err)
+		return nil, fmt.Errorf("/%s did not respond", cmd.Name)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("/%s failed (%s)", cmd.Name, resp.Status)
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, botCommandResponseLimit))
+	if err != nil {
+		return nil, fmt.Errorf("/%s did not respond", cmd.Name)
+	}
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return &CommandResult{}, nil
+	}
+	var reply models.BotCommandResponse
+	if err := json.Unmarshal(raw, &reply); err != nil {
+		return nil, fmt.Errorf("/%s sent an invalid reply", cmd.Name)
+	}
+
+	text := strings.TrimSpace(reply.Text)
+	if runes := []rune(text); len(runes) > maxCommandReplyLength {
+		text = string(runes[:maxCommandReplyLength])
+	}
+	if text == "" {
+		return &CommandResult{}, nil
+	}
+	if reply.ResponseType == "in_channel" {
+		return s.post(cmd.BotID, ctx.Room.ID, text, "message")
+	}
+	return &CommandResult{Ephemeral: text}, nil
+}
@@ -0,0 +1,426 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github/sabt-dev/realtimeChat/models"
+)
+
+func TestParseSlashCommand(t *testing.T) {
+	tests := []struct {
+		text     string
+		wantName string
+		wantArgs string
+		wantOK   bool
+	}{
+		{text: "/me waves", wantName: "me", wantArgs: "waves", wantOK: true},
+		{text: "  /shrug  ", wantName: "shrug", wantOK: true},
+		{text: "/MUTE @bob 30m  spamming ", wantName: "mute", wantArgs: "@bob 30m  spamming", wantOK: true},
+		{text: "/topic\tNew topic", wantName: "topic", wantArgs: "New topic", wantOK: true},
+		{text: "/deploy-app_2 prod", wantName: "deploy-app_2", wantArgs: "prod", wantOK: true},
+		{text: "hello /me", wantOK: false},
+		{text: "//not a command", wantOK: false},
+		{text: "/", wantOK: false},
+		{text: "/etc/hosts", wantOK: false},
+		{text: "/_private", wantOK: false},
+		{text: "/" + strings.Repeat("a", 33), wantOK: false},
+		{text: "/café", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			name, args, ok := ParseSlashCommand(tt.text)
+			if name != tt.wantName || args != tt.wantArgs || ok != tt.wantOK {
+				t.Errorf("ParseSlashCommand(%q) = %q, %q, %v, want %q, %q, %v", tt.text, name, args, ok, tt.wantName, tt.wantArgs, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestFormatMuteDuration(t *testing.T) {
+	tests := []struct {
+		duration time.Duration
+		want     string
+	}{
+		{duration: 30 * time.Minute, want: "30m"},
+		{duration: 10 * time.Minute, want: "10m"},
+		{duration: time.Hour, want: "1h"},
+		{duration: 2*time.Hour + 30*time.Minute, want: "2h30m"},
+		{duration: 90 * time.Second, want: "1m30s"},
+		{duration: 20 * time.Second, want: "20s"},
+		{duration: 100*time.Hour + 5*time.Second, want: "100h5s"},
+		{duration: 10*time.Minute + 400*time.Millisecond, want: "10m"},
+		{duration: 100 * time.Millisecond, want: "0s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.duration.String(), func(t *testing.T) {
+			if got := formatMuteDuration(tt.duration); got != tt.want {
+				t.Errorf("formatMuteDuration(%v) = %q, want %q", tt.duration, got, tt.want)
+			}
+		})
+	}
+}
+
+// moderationRoom is a room with a creator, two moderators and a member
+type moderationRoom struct {
+	room                                   *models.Room
+	creator, moderator, moderator2, member *models.User
+	bot                                    *models.User
+}
+
+func newModerationRoom(t *testing.T, private bool) *moderationRoom {
+	t.Helper()
+	db := newTestDB(t)
+	r := &moderationRoom{
+		creator:    createTestUser(t, db, "carol", false),
+		moderator:  createTestUser(t, db, "mona", false),
+		moderator2: createTestUser(t, db, "max", false),
+		member:     createTestUser(t, db, "bob", false),
+		bot:        createTestUser(t, db, "deploybot", true),
+	}
+	r.room = createTestRoom(t, db, "general", private, r.creator)
+	addTestMember(t, db, r.room, r.moderator, "moderator")
+	addTestMember(t, db, r.room, r.moderator2, "moderator")
+	addTestMember(t, db, r.room, r.member, "member")
+	return r
+}
+
+func TestResolveModerationTarget(t *testing.T) {
+	r := newModerationRoom(t, false)
+	db := NewCommandService().db
+	createTestUser(t, db, "twin", false)
+	if err := db.Create(&models.User{Name: "Twin", Email: "twin2@example.com"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		actor   *models.User
+		ref     string
+		want    *models.User
+		wantErr string
+	}{
+		{name: "moderator on member", actor: r.moderator, ref: "@bob", want: r.member},
+		{name: "by email", actor: r.moderator, ref: "BOB@example.com", want: r.member},
+		{name: "creator on moderator", actor: r.creator, ref: "@mona", want: r.moderator},
+		{name: "self", actor: r.moderator, ref: "@mona", wantErr: "yourself"},
+		{name: "creator on self", actor: r.creator, ref: "carol", wantErr: "yourself"},
+		{name: "moderator on creator", actor: r.moderator, ref: "@carol", wantErr: "room creator cannot be moderated"},
+		{name: "moderator on moderator", actor: r.moderator, ref: "@max", wantErr: "only the room creator"},
+		{name: "bot", actor: r.moderator, ref: "@deploybot", wantErr: "Manage bots"},
+		{name: "unknown user", actor: r.moderator, ref: "@nobody", wantErr: "no user named nobody"},
+		{name: "ambiguous name", actor: r.moderator, ref: "@twin", wantErr: "several users"},
+		{name: "no user", actor: r.moderator, ref: "", wantErr: "name a user"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := &CommandContext{User: tt.actor, Room: r.room}
+			got, err := NewCommandService().resolveModerationTarget(ctx, tt.ref)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("resolveModerationTarget(%q) error = %v, want one containing %q", tt.ref, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveModerationTarget(%q) error = %v", tt.ref, err)
+			}
+			if got.ID != tt.want.ID {
+				t.Errorf("resolveModerationTarget(%q) = %s, want %s", tt.ref, got.Name, tt.want.Name)
+			}
+		})
+	}
+}
+
+func TestActiveMute(t *testing.T) {
+	r := newModerationRoom(t, false)
+	db := NewCommandService().db
+	otherRoom := createTestRoom(t, db, "other", false, r.creator)
+
+	past, future := time.Now().Add(-time.Minute), time.Now().Add(time.Hour)
+	tests := []struct {
+		name  string
+		until *time.Time
+		room  *models.Room // Room the mute is in; the check is always for r.room
+		want  bool
+	}{
+		{name: "until unmuted", until: nil, room: r.room, want: true},
+		{name: "unexpired", until: &future, room: r.room, want: true},
+		{name: "expired", until: &past, room: r.room, want: false},
+		{name: "other room", until: nil, room: otherRoom, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := db.Where("user_id = ?", r.member.ID).Delete(&models.RoomMute{}).Error; err != nil {
+				t.Fatal(err)
+			}
+			mute := models.RoomMute{RoomID: tt.room.ID, UserID: r.member.ID, MutedByID: r.moderator.ID, Until: tt.until}
+			if err := db.Create(&mute).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := activeMute(db, r.room.ID, r.member.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (got != nil) != tt.want {
+				t.Errorf("activeMute() = %+v, want a mute: %v", got, tt.want)
+			}
+
+			_, err = NewMessageService().CreateMessage(r.member.ID, r.room.ID, "hello", "message", "", "", "", nil, "", "")
+			if tt.want && err != ErrUserMuted {
+				t.Errorf("CreateMessage() by a muted user error = %v, want %v", err, ErrUserMuted)
+			}
+			if !tt.want && err != nil {
+				t.Errorf("CreateMessage() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestRunMuteAnnouncesDuration(t *testing.T) {
+	r := newModerationRoom(t, false)
+	ctx := &CommandContext{User: r.moderator, Room: r.room, Name: "mute", Args: "@bob 30m spamming"}
+	result, err := NewCommandService().Execute(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Messages) != 1 || result.Messages[0].Text != "bob was muted by mona for 30m: spamming" {
+		t.Errorf("Execute(/mute) posted %+v", result.Messages)
+	}
+
+	mute, err := activeMute(NewCommandService().db, r.room.ID, r.member.ID)
+	if err != nil || mute == nil || mute.Until == nil {
+		t.Fatalf("activeMute() = %+v, %v, want a mute with an expiry", mute, err)
+	}
+	if left := time.Until(*mute.Until); left < 29*time.Minute || left > 30*time.Minute {
+		t.Errorf("mute expires in %v, want 30m", left)
+	}
+
+	ctx = &CommandContext{User: r.member, Room: r.room, Name: "mute", Args: "@mona"}
+	if _, err := NewCommandService().Execute(ctx); err == nil || !strings.Contains(err.Error(), "only available to room moderators") {
+		t.Errorf("Execute(/mute) by a member error = %v", err)
+	}
+}
+
+func TestRunInvite(t *testing.T) {
+	r := newModerationRoom(t, true)
+	db := NewCommandService().db
+	guest := createTestUser(t, db, "gina", false)
+
+	invite := func(actor *models.User, args string) (*CommandResult, error) {
+		return NewCommandService().Execute(&CommandContext{User: actor, Room: r.room, Name: "invite", Args: args})
+	}
+
+	result, err := invite(r.moderator, "@gina")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Messages) != 1 || result.Messages[0].Text != "mona invited gina" {
+		t.Errorf("Execute(/invite) posted %+v", result.Messages)
+	}
+	var member models.RoomMember
+	if err := db.Where("room_id = ? AND user_id = ?", r.room.ID, guest.ID).First(&member).Error; err != nil {
+		t.Fatalf("invited user is not a member: %v", err)
+	}
+	if member.IsActive || member.Role != "member" {
+		t.Errorf("invited member = %+v, want an inactive member", member)
+	}
+
+	result, err = invite(r.moderator, "gina@example.com")
+	if err != nil || result.Ephemeral != "gina is already a member of this room" {
+		t.Errorf("second Execute(/invite) = %+v, %v", result, err)
+	}
+	if _, err := invite(r.moderator, "@deploybot"); err == nil {
+		t.Error("Execute(/invite) of a bot succeeded")
+	}
+	if _, err := invite(r.member, "@gina"); err == nil {
+		t.Error("Execute(/invite) by a member succeeded")
+	}
+
+	public := createTestRoom(t, db, "lobby", false, r.creator)
+	result, err = NewCommandService().Execute(&CommandContext{User: r.creator, Room: public, Name: "invite", Args: "@gina"})
+	if err != nil || !strings.Contains(result.Ephemeral, "This room is public") {
+		t.Errorf("Execute(/invite) in a public room = %+v, %v", result, err)
+	}
+}
+
+// botServer answers bot command invocations and records the last one
+type botServer struct {
+	*httptest.Server
+	status    int
+	reply     string
+	request   models.BotCommandRequest
+	signature string
+	timestamp string
+	body      []byte
+}
+
+func newBotServer(t *testing.T) *botServer {
+	t.Helper()
+	b := &botServer{status: http.StatusOK}
+	b.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b.body, _ = io.ReadAll(r.Body)
+		json.Unmarshal(b.body, &b.request)
+		b.signature = r.Header.Get("X-Command-Signature")
+		b.timestamp = r.Header.Get("X-Command-Timestamp")
+		w.WriteHeader(b.status)
+		fmt.Fprint(w, b.reply)
+	}))
+	t.Cleanup(b.Close)
+	return b
+}
+
+// allowTestBot allows bot in room
+func allowTestBot(t *testing.T, room *models.Room, bot, addedBy *models.User) {
+	t.Helper()
+	if err := NewCommandService().db.Create(&models.RoomBot{RoomID: room.ID, BotID: bot.ID, AddedByID: addedBy.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBotCommandReplies(t *testing.T) {
+	t.Setenv("OUTBOUND_ALLOW_PRIVATE_NETWORKS", "true")
+	r := newModerationRoom(t, false)
+	server := newBotServer(t)
+	allowTestBot(t, r.room, r.bot, r.creator)
+
+	commands := NewCommandService()
+	cmd, secret, err := commands.RegisterBotCommand(r.bot.ID, "/Deploy", "Deploy a service", "<service>", server.URL+"/deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd.Name != "deploy" || !strings.HasPrefix(secret, botCommandSecretPrefix) {
+		t.Fatalf("RegisterBotCommand() = %+v, %q", cmd, secret)
+	}
+
+	tests := []struct {
+		name          string
+		status        int
+		reply         string
+		wantEphemeral string
+		wantPosted    string
+		wantErr       string
+	}{
+		{name: "ephemeral reply", reply: `{"text":"Deploying api"}`, wantEphemeral: "Deploying api"},
+		{name: "reply in channel", reply: `{"text":" Deployed api ","response_type":"in_channel"}`, wantPosted: "Deployed api"},
+		{name: "empty body", reply: ""},
+		{name: "empty text", reply: `{"text":"   ","response_type":"in_channel"}`},
+		{name: "long reply is cut", reply: `{"text":"` + strings.Repeat("é", maxCommandReplyLength+10) + `"}`, wantEphemeral: strings.Repeat("é", maxCommandReplyLength)},
+		{name: "invalid JSON", reply: `{"text":`, wantErr: "/deploy sent an invalid reply"},
+		{name: "error status", status: http.StatusInternalServerError, reply: `{"text":"boom"}`, wantErr: "/deploy failed (500 Internal Server Error)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server.status, server.reply = http.StatusOK, tt.reply
+			if tt.status != 0 {
+				server.status = tt.status
+			}
+
+			result, err := commands.Execute(&CommandContext{User: r.member, Room: r.room, Name: "deploy", Args: "api --force"})
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("Execute() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Ephemeral != tt.wantEphemeral {
+				t.Errorf("Ephemeral = %q, want %q", result.Ephemeral, tt.wantEphemeral)
+			}
+			if tt.wantPosted == "" {
+				if len(result.Messages) != 0 {
+					t.Errorf("Messages = %+v, want none", result.Messages)
+				}
+			} else if len(result.Messages) != 1 || result.Messages[0].Text != tt.wantPosted || result.Messages[0].SenderID != r.bot.ID {
+				t.Errorf("Messages = %+v, want %q from the bot", result.Messages, tt.wantPosted)
+			}
+
+			if server.request.Command != "deploy" || server.request.Text != "api --force" || server.request.User.ID != r.member.ID || server.request.Room.ID != r.room.ID {
+				t.Errorf("bot received %+v", server.request)
+			}
+			timestamp, _ := strconv.ParseInt(server.timestamp, 10, 64)
+			if want := "sha256=" + signWebhookPayload(secret, timestamp, server.body); server.signature != want {
+				t.Errorf("X-Command-Signature = %q, want %q", server.signature, want)
+			}
+		})
+	}
+
+	// Commands of bots that are not allowed in the room do not exist there
+	other := createTestRoom(t, commands.db, "other", false, r.creator)
+	if _, err := commands.Execute(&CommandContext{User: r.member, Room: other, Name: "deploy"}); err == nil || err.Error() != "unknown command /deploy" {
+		t.Errorf("Execute() in a room without the bot error = %v", err)
+	}
+}
+
+func TestBotCommandNamesArePerBot(t *testing.T) {
+	t.Setenv("OUTBOUND_ALLOW_PRIVATE_NETWORKS", "true")
+	r := newModerationRoom(t, false)
+	db := NewCommandService().db
+	firstServer, secondServer := newBotServer(t), newBotServer(t)
+	firstServer.reply, secondServer.reply = `{"text":"first"}`, `{"text":"second"}`
+	second := createTestUser(t, db, "otherbot", true)
+
+	commands := NewCommandService()
+	if _, _, err := commands.RegisterBotCommand(r.bot.ID, "deploy", "", "", firstServer.URL); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := commands.RegisterBotCommand(second.ID, "deploy", "", "", secondServer.URL); err != nil {
+		t.Fatalf("RegisterBotCommand() of a name another bot uses error = %v", err)
+	}
+	if _, secret, err := commands.RegisterBotCommand(r.bot.ID, "deploy", "Updated", "", firstServer.URL); err != nil || secret != "" {
+		t.Fatalf("updating a command = %q, %v, want no new secret", secret, err)
+	}
+	if _, _, err := commands.RegisterBotCommand(r.bot.ID, "kick", "", "", firstServer.URL); err == nil {
+		t.Error("RegisterBotCommand() of a built-in name succeeded")
+	}
+
+	// Both bots are in the first room; the one allowed first wins there
+	both := r.room
+	allowTestBot(t, both, second, r.creator)
+	allowTestBot(t, both, r.bot, r.creator)
+	onlyFirst := createTestRoom(t, db, "first-only", false, r.creator)
+	allowTestBot(t, onlyFirst, r.bot, r.creator)
+
+	tests := []struct {
+		room       *models.Room
+		want       string
+		wantSource string
+	}{
+		{room: both, want: "second", wantSource: "otherbot"},
+		{room: onlyFirst, want: "first", wantSource: "deploybot"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.room.Name, func(t *testing.T) {
+			result, err := commands.Execute(&CommandContext{User: r.creator, Room: tt.room, Name: "deploy"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Ephemeral != tt.want {
+				t.Errorf("/deploy answered %q, want %q", result.Ephemeral, tt.want)
+			}
+
+			available, err := commands.AvailableCommands(tt.room.ID, r.creator.ID, "dep")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(available) != 1 || available[0].Name != "deploy" || available[0].Source != tt.wantSource {
+				t.Errorf("AvailableCommands() = %+v, want one /deploy from %s", available, tt.wantSource)
+			}
+		})
+	}
+}
@@ -3,13 +3,12 @@ package services
 import (
 	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
 	"github/sabt-dev/realtimeChat/database"
 	"github/sabt-dev/realtimeChat/models"
+	"github/sabt-dev/realtimeChat/storage"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -103,6 +102,15 @@ func (s *UserService) GetUserByID(userID uint) (*models.User, error) {
 	return &user, nil
 }
 
+// GetUserByEmail gets a user by email address
+func (s *UserService) GetUserByEmail(email string) (*models.User, error) {
+	var user models.User
+	if err := s.db.Where("email = ?", email).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
 // SearchUsers searches for users by name or email
 func (s *UserService) SearchUsers(query string, limit int) ([]models.UserSearchResult, error) {
 	if limit <= 0 {
@@ -140,7 +148,8 @@ func (s *UserService) GetUsersByEmails(emails []string) ([]models.User, error) {
 
 // RoomService handles room-related database operations
 type RoomService struct {
-	db *gorm.DB
+	db       *gorm.DB
+	clientIP string // Recorded in audit entries
 }
 
 // NewRoomService creates a new RoomService
@@ -148,6 +157,11 @@ func NewRoomService() *RoomService {
 	return &RoomService{db: database.GetDB()}
 }
 
+// WithClientIP returns a copy of the service that records ip in its audit entries
+func (s *RoomService) WithClientIP(ip string) *RoomService {
+	return &RoomService{db: s.db, clientIP: ip}
+}
+
 // CreateOrGetRoom creates a new room or returns existing one
 func (s *RoomService) CreateOrGetRoom(name string) (*models.Room, error) {
 	var room models.Room
@@ -167,6 +181,18 @@ func (s *RoomService) CreateOrGetRoom(name string) (*models.Room, error) {
 		return nil, err
 	}
 
+	// Rooms created implicitly by joining have no recorded creator
+	if err := recordAudit(s.db, AuditEntry{
+		Action:     "room.create",
+		TargetType: "room",
+		TargetID:   fmt.Sprint(room.ID),
+		RoomID:     uintPtr(room.ID),
+		Metadata:   map[string]interface{}{"name": room.Name, "private": false, "implicit": true},
+		IP:         s.clientIP,
+	}); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+
 	return &room, nil
 }
 
@@ -212,6 +238,19 @@ func (s *RoomService) CreatePublicRoom(name, description string, creatorID uint)
 		return nil, err
 	}
 
+	if err := recordAudit(tx, AuditEntry{
+		ActorID:    uintPtr(creatorID),
+		Action:     "room.create",
+		TargetType: "room",
+		TargetID:   fmt.Sprint(room.ID),
+		RoomID:     uintPtr(room.ID),
+		Metadata:   map[string]interface{}{"name": room.Name, "private": false},
+		IP:         s.clientIP,
+	}); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
 	if err := tx.Commit().Error; err != nil {
 		return nil, err
 	}
@@ -258,6 +297,7 @@ func (s *RoomService) CreatePrivateRoom(name, description string, creatorID uint
 	}
 
 	// Add other members
+	addedMembers := make([]uint, 0, len(memberUserIDs))
 	for _, userID := range memberUserIDs {
 		if userID != creatorID { // Don't add creator twice
 			member := models.RoomMember{
@@ -271,9 +311,23 @@ func (s *RoomService) CreatePrivateRoom(name, description string, creatorID uint
 				tx.Rollback()
 				return nil, err
 			}
+			addedMembers = append(addedMembers, userID)
 		}
 	}
 
+	if err := recordAudit(tx, AuditEntry{
+		ActorID:    uintPtr(creatorID),
+		Action:     "room.create",
+		TargetType: "room",
+		TargetID:   fmt.Sprint(room.ID),
+		RoomID:     uintPtr(room.ID),
+		Metadata:   map[string]interface{}{"name": room.Name, "private": true, "member_ids": addedMembers},
+		IP:         s.clientIP,
+	}); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
 	// Commit transaction
 	if err := tx.Commit().Error; err != nil {
 		return nil, err
@@ -389,6 +443,16 @@ func (s *RoomService) CanUserAccessRoom(userID uint, roomName string) (bool, err
 		return false, err
 	}
 
+	// Bots may only enter rooms whose creator allowed them, public or not
+	botService := NewBotService()
+	isBot, err := botService.IsBot(userID)
+	if err != nil {
+		return false, err
+	}
+	if isBot {
+		return botService.IsBotAllowedInRoom(userID, room.ID)
+	}
+
 	// If it's a public room, anyone can access
 	if !room.IsPrivate {
 		return true, nil
@@ -397,12 +461,24 @@ func (s *RoomService) CanUserAccessRoom(userID uint, roomName string) (bool, err
 	// For private rooms, check if user was ever a member (including inactive)
 	// This allows users to rejoin private rooms they were previously in
 	var count int64
-	err := s.db.Model(&models.RoomMember{}).
+	err = s.db.Model(&models.RoomMember{}).
 		Where("user_id = ? AND room_id = ?", userID, room.ID).
 		Count(&count).Error
 	return count > 0, err
 }
 
+// accessibleRoomIDs is a subquery selecting the IDs of every room the user can
+// access. It applies the same rules as CanUserAccessRoom for use in bulk queries.
+func (s *RoomService) accessibleRoomIDs(userID uint) *gorm.DB {
+	// Bots only see their allowlisted rooms; fail closed if the lookup errors
+	if isBot, err := NewBotService().IsBot(userID); isBot || err != nil {
+		return s.db.Model(&models.RoomBot{}).Select("room_id").Where("bot_id = ?", userID)
+	}
+	return s.db.Model(&models.Room{}).Select("id").
+		Where("is_private = ? OR id IN (?)", false,
+			s.db.Model(&models.RoomMember{}).Select("room_id").Where("user_id = ?", userID))
+}
+
 // JoinRoom adds a user to a room
 func (s *RoomService) JoinRoom(userID, roomID uint) error {
 	// Check if membership already exists
@@ -413,7 +489,10 @@ func (s *RoomService) JoinRoom(userID, roomID uint) error {
 		// Membership exists, make sure it's active
 		if !existing.IsActive {
 			existing.IsActive = true
-			return s.db.Save(&existing).Error
+			if err := s.db.Save(&existing).Error; err != nil {
+				return err
+			}
+			s.recordMembershipChange("membership.rejoin", userID, roomID)
 		}
 		return nil
 	}
@@ -426,19 +505,49 @@ func (s *RoomService) JoinRoom(userID, roomID uint) error {
 		IsActive: true,
 	}
 
-	return s.db.Create(&member).Error
+	if err := s.db.Create(&member).Error; err != nil {
+		return err
+	}
+	s.recordMembershipChange("membership.join", userID, roomID)
+	emitWebhookEvent(roomID, models.WebhookEventMemberJoined, map[string]interface{}{"user": webhookEventUser(userID)})
+	return nil
 }
 
 // LeaveRoom removes a user from a room (sets inactive)
 func (s *RoomService) LeaveRoom(userID, roomID uint) error {
-	return s.db.Model(&models.RoomMember{}).
-		Where("user_id = ? AND room_id = ?", userID, roomID).
-		Update("is_active", false).Error
+	result := s.db.Model(&models.RoomMember{}).
+		Where("user_id = ? AND room_id = ? AND is_active = ?", userID, roomID, true).
+		Update("is_active", false)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		s.recordMembershipChange("membership.leave", userID, roomID)
+	}
+	return nil
+}
+
+// recordMembershipChange audits a user's own membership change; failures are
+// only logged. Connecting and disconnecting toggle an existing membership, so
+// only a new membership is announced to outgoing webhooks.
+func (s *RoomService) recordMembershipChange(action string, userID, roomID uint) {
+	if err := recordAudit(s.db, AuditEntry{
+		ActorID:    uintPtr(userID),
+		Action:     action,
+		TargetType: "membership",
+		TargetID:   fmt.Sprintf("%d:%d", roomID, userID),
+		RoomID:     uintPtr(roomID),
+		IP:         s.clientIP,
+	}); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
 }
 
 // MessageService handles message-related database operations
 type MessageService struct {
-	db *gorm.DB
+	db          *gorm.DB
+	clientIP    string // Recorded in audit entries
+	displayName string // Shown instead of the sender's name on created messages
 }
 
 // NewMessageService creates a new MessageService
@@ -446,8 +555,50 @@ func NewMessageService() *MessageService {
 	return &MessageService{db: database.GetDB()}
 }
 
+// WithClientIP returns a copy of the service that records ip in its audit entries
+func (s *MessageService) WithClientIP(ip string) *MessageService {
+	c := *s
+	c.clientIP = ip
+	return &c
+}
+
+// WithDisplayName returns a copy of the service whose created messages show
+// name instead of their sender's name
+func (s *MessageService) WithDisplayName(name string) *MessageService {
+	c := *s
+	c.displayName = name
+	return &c
+}
+
 // CreateMessage creates a new message
 func (s *MessageService) CreateMessage(senderID, roomID uint, text, msgType, mediaURL, mediaType, fileName string, replyToID *uint, replyToSender, replyToText string) (*models.Message, error) {
+	if err := checkMessageLength(text); err != nil {
+		return nil, err
+	}
+
+	// Muted users cannot post; join, leave and system notices are unaffected
+	if msgType == "message" || msgType == "emote" || msgType == "media" {
+		mute, err := activeMute(s.db, roomID, senderID)
+		if err != nil {
+			return nil, err
+		}
+		if mute != nil {
+			return nil, ErrUserMuted
+		}
+	}
+
+	// Stored files can only be shared by their uploader; anyone else could
+	// otherwise post a URL they guessed or saw and gain access to the file
+	if msgType == "media" && strings.HasPrefix(mediaURL, storage.MediaURLPrefix) {
+		_, err := NewUploadService().GetUserUpload(mediaURL, senderID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMediaNotUploaded
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	message := models.Message{
 		UUID:          uuid.New().String(),
 		SenderID:      senderID,
@@ -457,45 +608,201 @@ func (s *MessageService) CreateMessage(senderID, roomID uint, text, msgType, med
 		MediaURL:      mediaURL,
 		MediaType:     mediaType,
 		FileName:      fileName,
+		SenderName:    s.displayName,
 		ReplyToID:     replyToID,
 		ReplyToSender: replyToSender,
 		ReplyToText:   replyToText,
 	}
+	if err := renderMessageText(s.db, &message); err != nil {
+		return nil, err
+	}
+	if err := attachUploadDetails(s.db, &message); err != nil {
+		return nil, err
+	}
 
-	if err := s.db.Create(&message).Error; err != nil {
+	if err := createMessageWithBlob(s.db, &message); err != nil {
 		return nil, err
 	}
 
 	// Load the message with associations
-	return s.GetMessageByUUID(message.UUID)
+	created, err := s.GetMessageByUUID(message.UUID)
+	if err != nil {
+		return nil, err
+	}
+	if msgType == "message" || msgType == "emote" || msgType == "media" {
+		emitWebhookEvent(roomID, models.WebhookEventMessageCreated, map[string]interface{}{"message": webhookEventMessage(created)})
+	}
+	enqueueLinkPreviews(created)
+	return created, nil
+}
+
+// preloadMessageAssociations loads the associations needed to build a MessageResponse.
+// Reply targets are loaded unscoped so replies to tombstones keep their thread link.
+func preloadMessageAssociations(db *gorm.DB) *gorm.DB {
+	return preloadNestedMessageAssociations(db, "")
+}
+
+// preloadNestedMessageAssociations preloads the same associations for a message
+// reached through a relation, e.g. prefix "Message." for bookmarks and pins
+func preloadNestedMessageAssociations(db *gorm.DB, prefix string) *gorm.DB {
+	return db.Preload(prefix+"Sender").Preload(prefix+"Room").
+		Preload(prefix+"ReplyTo", func(db *gorm.DB) *gorm.DB {
+			return db.Unscoped()
+		}).
+		Preload(prefix + "Reactions").Preload(prefix + "Reactions.User")
 }
 
 // GetMessageByUUID gets a message by UUID with associations
 func (s *MessageService) GetMessageByUUID(uuid string) (*models.Message, error) {
 	var message models.Message
-	if err := s.db.Preload("Sender").Preload("Room").Preload("ReplyTo").
-		Preload("Reactions").Preload("Reactions.User").
+	if err := preloadMessageAssociations(s.db).
 		Where("uuid = ?", uuid).First(&message).Error; err != nil {
 		return nil, err
 	}
 	return &message, nil
 }
 
-// GetRoomMessages gets all messages for a room
-func (s *MessageService) GetRoomMessages(roomName string, limit, offset int) ([]models.Message, error) {
-	var messages []models.Message
+// ErrMessageAccessDenied is returned when a user asks for a message in a room they cannot access
+var ErrMessageAccessDenied = errors.New("access denied to this message")
 
-	if err := s.db.Preload("Sender").Preload("Room").Preload("ReplyTo").
-		Preload("Reactions").Preload("Reactions.User").
-		Joins("JOIN rooms ON messages.room_id = rooms.id").
-		Where("rooms.name = ?", roomName).
-		Order("messages.created_at ASC").
-		Limit(limit).Offset(offset).
-		Find(&messages).Error; err != nil {
+// GetMessageForUser gets a message by UUID, including tombstones, after checking
+// that the user can access its room
+func (s *MessageService) GetMessageForUser(uuid string, userID uint) (*models.Message, error) {
+	var message models.Message
+	if err := preloadMessageAssociations(s.db.Unscoped()).
+		Where("uuid = ?", uuid).First(&message).Error; err != nil {
+		return nil, err
+	}
+
+	canAccess, err := NewRoomService().CanUserAccessRoom(userID, message.Room.Name)
+	if err != nil {
 		return nil, err
 	}
+	if !canAccess {
+		return nil, ErrMessageAccessDenied
+	}
+	return &message, nil
+}
+
+// ErrHistoryCursorNotFound is returned when a history cursor does not name a message in the room
+var ErrHistoryCursorNotFound = errors.New("cursor message not found in this room")
+
+// GetRoomMessages gets a page of a room's history, including tombstones of deleted messages
+func (s *MessageService) GetRoomMessages(roomName string, query models.MessageHistoryQuery) (*models.MessagePage, error) {
+	limit := query.Limit
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	var room models.Room
+	if err := s.db.Where("name = ?", roomName).First(&room).Error; err != nil {
+		return nil, fmt.Errorf("room not found: %w", err)
+	}
+
+	// The cursor message may itself be a tombstone, which still has a place in history
+	var anchor *models.Message
+	anchorUUID := query.Before + query.After + query.Around
+	if anchorUUID != "" {
+		anchor = &models.Message{}
+		if err := s.db.Unscoped().Where("uuid = ? AND room_id = ?", anchorUUID, room.ID).First(anchor).Error; err != nil {
+			return nil, ErrHistoryCursorNotFound
+		}
+	}
+
+	page := &models.MessagePage{}
+	switch {
+	case query.Before != "":
+		older, more, err := s.historyPage(room.ID, anchor, true, limit)
+		if err != nil {
+			return nil, err
+		}
+		page.Messages, page.HasMoreBefore, page.HasMoreAfter = older, more, true
+	case query.After != "":
+		newer, more, err := s.historyPage(room.ID, anchor, false, limit)
+		if err != nil {
+			return nil, err
+		}
+		page.Messages, page.HasMoreBefore, page.HasMoreAfter = newer, true, more
+	case query.Around != "":
+		// Split the page around the anchor, giving any odd slot to the older side
+		olderLimit := limit / 2
+		newerLimit := limit - olderLimit - 1
+		older, moreBefore, err := s.historyPage(room.ID, anchor, true, olderLimit)
+		if err != nil {
+			return nil, err
+		}
+		newer, moreAfter, err := s.historyPage(room.ID, anchor, false, newerLimit)
+		if err != nil {
+			return nil, err
+		}
+		if err := preloadMessageAssociations(s.db.Unscoped()).First(anchor, anchor.ID).Error; err != nil {
+			return nil, err
+		}
+		page.Messages = append(append(older, *anchor), newer...)
+		page.HasMoreBefore, page.HasMoreAfter = moreBefore, moreAfter
+	default:
+		latest, more, err := s.historyPage(room.ID, nil, true, limit)
+		if err != nil {
+			return nil, err
+		}
+		page.Messages, page.HasMoreBefore = latest, more
+	}
+
+	return page, nil
+}
+
+// historyPage loads up to limit messages of a room directly before (older) or
+// after the anchor, or the newest messages when anchor is nil. Messages are
+// ordered by (created_at, id) so ties on the timestamp page stably, and are
+// returned in chronological order along with whether more exist beyond them.
+func (s *MessageService) historyPage(roomID uint, anchor *models.Message, older bool, limit int) ([]models.Message, bool, error) {
+	if limit <= 0 {
+		if anchor == nil {
+			return []models.Message{}, false, nil
+		}
+		var count int64
+		err := s.db.Unscoped().Model(&models.Message{}).Scopes(historyBeyond(roomID, anchor, older)).Limit(1).Count(&count).Error
+		return []models.Message{}, count > 0, err
+	}
+
+	order := "messages.created_at ASC, messages.id ASC"
+	if older {
+		order = "messages.created_at DESC, messages.id DESC"
+	}
+
+	var messages []models.Message
+	if err := preloadMessageAssociations(s.db.Unscoped()).
+		Scopes(historyBeyond(roomID, anchor, older)).
+		Order(order).
+		Limit(limit + 1).
+		Find(&messages).Error; err != nil {
+		return nil, false, err
+	}
+
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+	if older {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+	return messages, hasMore, nil
+}
 
-	return messages, nil
+// historyBeyond limits a query to the room's messages strictly older or newer than the anchor
+func historyBeyond(roomID uint, anchor *models.Message, older bool) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db = db.Where("messages.room_id = ?", roomID)
+		if anchor == nil {
+			return db
+		}
+		if older {
+			return db.Where("messages.created_at < ? OR (messages.created_at = ? AND messages.id < ?)", anchor.CreatedAt, anchor.CreatedAt, anchor.ID)
+		}
+		return db.Where("messages.created_at > ? OR (messages.created_at = ? AND messages.id > ?)", anchor.CreatedAt, anchor.CreatedAt, anchor.ID)
+	}
 }
 
 // GetMessageIDByUUID gets a message ID by UUID
@@ -507,44 +814,257 @@ func (s *MessageService) GetMessageIDByUUID(uuid string) (uint, error) {
 	return message.ID, nil
 }
 
-// DeleteMessage permanently deletes a message from the database (only if user is the sender)
-func (s *MessageService) DeleteMessage(uuid string, userID uint) error {
+// DeleteMessage soft-deletes a message, leaving a tombstone. The sender can always delete
+// their own message; room creators and moderators can delete any message in their room,
+// optionally giving a reason. The content is scrubbed while the row, its ordering and
+// reply chains are preserved. The returned tombstone is ready to be broadcast.
+func (s *MessageService) DeleteMessage(uuid string, userID uint, reason string) (*models.Message, error) {
 	var message models.Message
 
-	// First check if message exists and user is the sender
-	if err := s.db.Where("uuid = ? AND sender_id = ?", uuid, userID).First(&message).Error; err != nil {
-		return fmt.Errorf("message not found or not authorized: %w", err)
+	// First check if message exists
+	if err := s.db.Where("uuid = ?", uuid).First(&message).Error; err != nil {
+		return nil, fmt.Errorf("message not found: %w", err)
 	}
 
-	// If this is a media message, delete the associated file
-	if message.Type == "media" && message.MediaURL != "" {
-		if err := s.deleteMediaFile(message.MediaURL); err != nil {
-			// Log the error but don't fail the message deletion
-			fmt.Printf("Warning: Failed to delete media file %s: %v\n", message.MediaURL, err)
+	// Anyone other than the sender must moderate the message's room
+	byModerator := message.SenderID != userID
+	if byModerator {
+		isModerator, err := NewRoomService().IsRoomModerator(userID, message.RoomID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to verify moderator: %w", err)
 		}
+		if !isModerator {
+			return nil, fmt.Errorf("not authorized to delete this message")
+		}
+	} else {
+		// Reasons are only recorded for moderator removals
+		reason = ""
 	}
 
-	// Handle messages that reply to this message - set their reply_to_id to NULL
-	if err := s.db.Model(&models.Message{}).Where("reply_to_id = ?", message.ID).Update("reply_to_id", nil).Error; err != nil {
-		return fmt.Errorf("failed to update reply references: %w", err)
+	tx := s.db.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Scrub quoted copies of this message from its replies; the reply_to_id link is kept
+	if err := tx.Model(&models.Message{}).Where("reply_to_id = ?", message.ID).Update("reply_to_text", "").Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to scrub reply references: %w", err)
 	}
 
 	// Delete all reactions associated with this message
-	if err := s.db.Where("message_id = ?", message.ID).Delete(&models.MessageReaction{}).Error; err != nil {
-		return fmt.Errorf("failed to delete message reactions: %w", err)
+	if err := tx.Where("message_id = ?", message.ID).Delete(&models.MessageReaction{}).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to delete message reactions: %w", err)
 	}
 
-	// Hard delete the message from the database (permanently remove)
-	if err := s.db.Unscoped().Delete(&message).Error; err != nil {
-		return fmt.Errorf("failed to delete message: %w", err)
+	// A tombstone cannot stay pinned or bookmarked
+	if err := removePins(tx, "message_id = ?", message.ID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Where("message_id = ?", message.ID).Delete(&models.Bookmark{}).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to delete bookmarks: %w", err)
 	}
 
-	fmt.Printf("Successfully deleted message %s and its associated data\n", uuid)
-	return nil
+	// A media message gives up its file with the tombstone; the file itself is
+	// only deleted once that is committed, unless other messages or uploads
+	// still share it
+	var blobKey, legacyMediaURL string
+	if message.Type == "media" && message.MediaURL != "" {
+		key, isBlob, err := releaseBlob(tx, message.ID, message.MediaURL)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if isBlob {
+			blobKey = key
+		} else {
+			legacyMediaURL = message.MediaURL
+		}
+	}
+
+	// Scrub the content of the message itself and record who deleted it
+	if err := tx.Model(&message).Updates(map[string]interface{}{
+		"text":             "",
+		"html":             "",
+		"entities":         nil,
+		"link_previews":    nil,
+		"media_url":        "",
+		"media_type":       "",
+		"file_name":        "",
+		"media_size":       0,
+		"media_mime_type":  "",
+		"media_width":      0,
+		"media_height":     0,
+		"media_blurhash":   "",
+		"media_thumbnails": nil,
+		"media_duration":   0,
+		"media_waveform":   nil,
+		"reply_to_text":    "",
+		"deleted_by_id":    userID,
+		"delete_reason":    reason,
+	}).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to scrub message content: %w", err)
+	}
+
+	// Soft delete the message so it remains as a tombstone until purged
+	if err := tx.Delete(&message).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to delete message: %w", err)
+	}
+
+	auditAction := "message.delete"
+	if byModerator {
+		auditAction = "message.moderate_delete"
+	}
+	if err := recordAudit(tx, AuditEntry{
+		ActorID:    uintPtr(userID),
+		Action:     auditAction,
+		TargetType: "message",
+		TargetID:   message.UUID,
+		RoomID:     uintPtr(message.RoomID),
+		Metadata:   map[string]interface{}{"sender_id": message.SenderID, "type": message.Type, "reason": reason},
+		IP:         s.clientIP,
+	}); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Record moderator removals for later review
+	if byModerator {
+		action := models.ModerationAction{
+			RoomID:       message.RoomID,
+			ModeratorID:  userID,
+			TargetUserID: message.SenderID,
+			MessageUUID:  message.UUID,
+			Action:       "delete_message",
+			Reason:       reason,
+		}
+		if err := tx.Create(&action).Error; err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to record moderation action: %w", err)
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	// Log media errors but don't fail the message deletion
+	if blobKey != "" {
+		if err := NewUploadService().DeleteUnreferencedBlob(blobKey); err != nil {
+			fmt.Printf("Warning: Failed to delete media file %s: %v\n", blobKey, err)
+		}
+	} else if legacyMediaURL != "" {
+		if err := s.deleteMediaFile(s.db, legacyMediaURL); err != nil {
+			fmt.Printf("Warning: Failed to delete media file %s: %v\n", legacyMediaURL, err)
+		}
+	}
+
+	fmt.Printf("Successfully deleted message %s and scrubbed its content\n", uuid)
+
+	// Reload the tombstone with its associations for broadcasting
+	var tombstone models.Message
+	if err := preloadMessageAssociations(s.db.Unscoped()).
+		Where("uuid = ?", uuid).First(&tombstone).Error; err != nil {
+		return nil, err
+	}
+	emitWebhookEvent(tombstone.RoomID, models.WebhookEventMessageDeleted, map[string]interface{}{
+		"message":    webhookEventMessage(&tombstone),
+		"deleted_by": webhookEventUser(userID),
+		"moderated":  byModerator,
+	})
+	return &tombstone, nil
+}
+
+// PurgeDeletedMessages permanently removes tombstones of messages deleted before the cutoff
+func (s *MessageService) PurgeDeletedMessages(cutoff time.Time) (int64, error) {
+	var messageIDs []uint
+	if err := s.db.Unscoped().Model(&models.Message{}).
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+		Pluck("id", &messageIDs).Error; err != nil {
+		return 0, err
+	}
+	if len(messageIDs) == 0 {
+		return 0, nil
+	}
+
+	tx := s.db.Begin()
+	if tx.Error != nil {
+		return 0, tx.Error
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Replies (including other tombstones) can no longer point at the purged rows
+	if err := tx.Unscoped().Model(&models.Message{}).Where("reply_to_id IN ?", messageIDs).Update("reply_to_id", nil).Error; err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("failed to clear reply references: %w", err)
+	}
+
+	if err := tx.Where("message_id IN ?", messageIDs).Delete(&models.MessageReaction{}).Error; err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("failed to delete message reactions: %w", err)
+	}
+
+	if err := removePins(tx, "message_id IN ?", messageIDs); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err := tx.Where("message_id IN ?", messageIDs).Delete(&models.Bookmark{}).Error; err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("failed to delete bookmarks: %w", err)
+	}
+
+	result := tx.Unscoped().Where("id IN ?", messageIDs).Delete(&models.Message{})
+	if result.Error != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("failed to purge messages: %w", result.Error)
+	}
+
+	if err := recordAudit(tx, AuditEntry{
+		Action:     "message.purge",
+		TargetType: "message",
+		Metadata:   map[string]interface{}{"count": result.RowsAffected, "cutoff": cutoff},
+	}); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return 0, err
+	}
+	return result.RowsAffected, nil
+}
+
+// releaseMediaFile drops the reference a media message holds on its file and
+// returns the key of the blob it was stored in, for DeleteUnreferencedBlob to
+// remove once no transaction is open. Files stored before uploads were
+// deduplicated are deleted right away.
+func (s *MessageService) releaseMediaFile(db *gorm.DB, message *models.Message) (string, error) {
+	blobKey, isBlob, err := releaseBlob(db, message.ID, message.MediaURL)
+	if err != nil || isBlob {
+		return blobKey, err
+	}
+	return "", s.deleteMediaFile(db, message.MediaURL)
 }
 
-// deleteMediaFile removes the physical file from the uploads directory
-func (s *MessageService) deleteMediaFile(mediaURL string) error {
+// deleteMediaFile removes the physical file from upload storage, along
+// with its thumbnails and upload record. db is the handle to record the removal
+// with, so callers inside a transaction can pass it.
+func (s *MessageService) deleteMediaFile(db *gorm.DB, mediaURL string) error {
 	// Extract filename from URL (e.g., "/uploads/filename.jpg" -> "filename.jpg")
 	if !strings.HasPrefix(mediaURL, "/uploads/") {
 		return fmt.Errorf("invalid media URL format: %s", mediaURL)
@@ -556,21 +1076,22 @@ func (s *MessageService) deleteMediaFile(mediaURL string) error {
 		return fmt.Errorf("empty filename in media URL: %s", mediaURL)
 	}
 
-	// Construct full file path
-	filePath := filepath.Join("uploads", filename)
-
-	// Check if file exists before attempting to delete
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		// File doesn't exist, which is fine (maybe already deleted)
-		return nil
+	// Thumbnails go with the original
+	thumbnailURLs, err := removeUploadRecord(db, mediaURL)
+	if err != nil {
+		return fmt.Errorf("failed to remove upload record for %s: %w", mediaURL, err)
+	}
+	for _, thumbnailURL := range thumbnailURLs {
+		if err := s.deleteMediaFile(db, thumbnailURL); err != nil {
+			fmt.Printf("Warning: failed to delete thumbnail %s: %v\n", thumbnailURL, err)
+		}
 	}
 
-	// Delete the file
-	if err := os.Remove(filePath); err != nil {
-		return fmt.Errorf("failed to delete file %s: %w", filePath, err)
+	if err := storage.GetStorage().Delete(filename); err != nil {
+		return fmt.Errorf("failed to delete file %s: %w", filename, err)
 	}
 
-	fmt.Printf("Successfully deleted media file: %s\n", filePath)
+	fmt.Printf("Successfully deleted media file: %s\n", filename)
 	return nil
 }
 
@@ -593,6 +1114,118 @@ func (s *RoomService) IsRoomCreator(userID, roomID uint) (bool, error) {
 	return count > 0, nil
 }
 
+// IsRoomModerator checks if the given user can moderate the room (its creator or a member with the moderator role)
+func (s *RoomService) IsRoomModerator(userID, roomID uint) (bool, error) {
+	isCreator, err := s.IsRoomCreator(userID, roomID)
+	if err != nil || isCreator {
+		return isCreator, err
+	}
+
+	var count int64
+	if err := s.db.Model(&models.RoomMember{}).
+		Where("room_id = ? AND user_id = ? AND role = ?", roomID, userID, "moderator").
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+var (
+	// ErrInvalidRole is returned for roles other than "moderator" and "member"
+	ErrInvalidRole = errors.New("role must be moderator or member")
+	// ErrNotRoomMember is returned when the user is not an active member of the room
+	ErrNotRoomMember = errors.New("user is not a member of this room")
+)
+
+// SetMemberRole makes a member of a room a moderator ("moderator") or
+// takes the role back ("member"). Only the room creator can change roles, and
+// the change is recorded in the room's moderation log and the audit log.
+func (s *RoomService) SetMemberRole(roomID, actorID, targetUserID uint, role string) error {
+	if role != "moderator" && role != "member" {
+		return ErrInvalidRole
+	}
+	if err := requireRoomCreator(roomID, actorID, "change member roles"); err != nil {
+		return err
+	}
+
+	tx := s.db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var member models.RoomMember
+	if err := tx.Where("room_id = ? AND user_id = ?", roomID, targetUserID).First(&member).Error; err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotRoomMember
+		}
+		return err
+	}
+	if member.Role == "creator" {
+		tx.Rollback()
+		return fmt.Errorf("the room creator's role cannot be changed")
+	}
+	if member.Role == role {
+		tx.Rollback()
+		return nil
+	}
+
+	previous := member.Role
+	if err := tx.Model(&member).Update("role", role).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to change role: %w", err)
+	}
+	action := "grant_moderator"
+	if role == "member" {
+		action = "revoke_moderator"
+	}
+	if err := tx.Create(&models.ModerationAction{
+		RoomID:       roomID,
+		ModeratorID:  actorID,
+		TargetUserID: targetUserID,
+		Action:       action,
+	}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to record moderation action: %w", err)
+	}
+	if err := recordAudit(tx, AuditEntry{
+		ActorID:    uintPtr(actorID),
+		Action:     "room.member.role",
+		TargetType: "user",
+		TargetID:   fmt.Sprint(targetUserID),
+		RoomID:     uintPtr(roomID),
+		Metadata:   map[string]interface{}{"role": role, "previous_role": previous},
+		IP:         s.clientIP,
+	}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// GetModerationActions returns the moderation log of a room, newest first
+func (s *RoomService) GetModerationActions(roomID uint, limit, offset int) ([]models.ModerationAction, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	var actions []models.ModerationAction
+	err := s.db.Preload("Moderator").Preload("TargetUser").
+		Where("room_id = ?", roomID).
+		Order("created_at DESC").
+		Limit(limit).Offset(offset).
+		Find(&actions).Error
+	return actions, err
+}
+
 // DeleteRoom deletes a room and cascades deletion to messages, reactions, media files and memberships
 func (s *RoomService) DeleteRoom(roomID, userID uint) error {
 	// Authorization: only creator can delete
@@ -621,9 +1254,9 @@ func (s *RoomService) DeleteRoom(roomID, userID uint) error {
 		return err
 	}
 
-	// Collect message IDs for this room
+	// Collect message IDs for this room (tombstones included)
 	var messages []models.Message
-	if err := tx.Where("room_id = ?", roomID).Find(&messages).Error; err != nil {
+	if err := tx.Unscoped().Where("room_id = ?", roomID).Find(&messages).Error; err != nil {
 		tx.Rollback()
 		return err
 	}
@@ -638,6 +1271,11 @@ func (s *RoomService) DeleteRoom(roomID, userID uint) error {
 			tx.Rollback()
 			return fmt.Errorf("failed to delete message reactions: %w", err)
 		}
+		// Delete users' bookmarks of these messages
+		if err := tx.Where("message_id IN ?", messageIDs).Delete(&models.Bookmark{}).Error; err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to delete bookmarks: %w", err)
+		}
 		// Clear reply references to these messages
 		if err := tx.Model(&models.Message{}).Where("reply_to_id IN ?", messageIDs).Update("reply_to_id", nil).Error; err != nil {
 			tx.Rollback()
@@ -645,13 +1283,19 @@ func (s *RoomService) DeleteRoom(roomID, userID uint) error {
 		}
 	}
 
-	// Delete media files for media messages
+	// Release media files for media messages. Shared files are only deleted
+	// once the room is gone and nothing else references them.
+	var blobKeys []string
 	if len(messages) > 0 {
 		ms := NewMessageService()
-		for _, m := range messages {
+		for i := range messages {
+			m := &messages[i]
 			if m.Type == "media" && m.MediaURL != "" {
-				if err := ms.deleteMediaFile(m.MediaURL); err != nil {
+				blobKey, err := ms.releaseMediaFile(tx, m)
+				if err != nil {
 					fmt.Printf("Warning: failed to delete media file %s: %v\n", m.MediaURL, err)
+				} else if blobKey != "" {
+					blobKeys = append(blobKeys, blobKey)
 				}
 			}
 		}
@@ -663,6 +1307,46 @@ func (s *RoomService) DeleteRoom(roomID, userID uint) error {
 		return fmt.Errorf("failed to delete messages: %w", err)
 	}
 
+	// Delete the room's pins
+	if err := tx.Where("room_id = ?", roomID).Delete(&models.PinnedMessage{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete pinned messages: %w", err)
+	}
+
+	// Delete the room's moderation log
+	if err := tx.Where("room_id = ?", roomID).Delete(&models.ModerationAction{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete moderation actions: %w", err)
+	}
+
+	// Delete the room's incoming webhooks
+	if err := tx.Where("room_id = ?", roomID).Delete(&models.IncomingWebhook{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete webhooks: %w", err)
+	}
+
+	// Delete the room's outgoing webhooks and their delivery log
+	if err := removeWebhookDeliveries(tx, "webhook_id IN (?)", tx.Model(&models.OutgoingWebhook{}).Select("id").Where("room_id = ?", roomID)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Where("room_id = ?", roomID).Delete(&models.OutgoingWebhook{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete outgoing webhooks: %w", err)
+	}
+
+	// Delete the room's mutes
+	if err := tx.Where("room_id = ?", roomID).Delete(&models.RoomMute{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete room mutes: %w", err)
+	}
+
+	// Delete the room's bot allowlist
+	if err := tx.Where("room_id = ?", roomID).Delete(&models.RoomBot{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete room bots: %w", err)
+	}
+
 	// Delete room memberships
 	if err := tx.Where("room_id = ?", roomID).Delete(&models.RoomMember{}).Error; err != nil {
 		tx.Rollback()
@@ -675,9 +1359,29 @@ func (s *RoomService) DeleteRoom(roomID, userID uint) error {
 		return fmt.Errorf("failed to delete room: %w", err)
 	}
 
+	if err := recordAudit(tx, AuditEntry{
+		ActorID:    uintPtr(userID),
+		Action:     "room.delete",
+		TargetType: "room",
+		TargetID:   fmt.Sprint(room.ID),
+		RoomID:     uintPtr(room.ID),
+		Metadata:   map[string]interface{}{"name": room.Name, "private": room.IsPrivate, "messages": len(messages)},
+		IP:         s.clientIP,
+	}); err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	if err := tx.Commit().Error; err != nil {
 		return err
 	}
+
+	uploadService := NewUploadService()
+	for _, blobKey := range blobKeys {
+		if err := uploadService.DeleteUnreferencedBlob(blobKey); err != nil {
+			fmt.Printf("Warning: failed to delete media file %s: %v\n", blobKey, err)
+		}
+	}
 	return nil
 }
 
@@ -721,7 +1425,12 @@ func (s *MessageService) AddReaction(messageUUID string, userID uint, emoji stri
 	}
 
 	// Return updated message with reactions
-	return s.GetMessageByUUID(messageUUID)
+	message, err := s.GetMessageByUUID(messageUUID)
+	if err != nil {
+		return nil, err
+	}
+	emitReactionEvent(models.WebhookEventReactionAdded, message, userID, emoji)
+	return message, nil
 }
 
 // RemoveReaction removes a reaction from a message
@@ -733,12 +1442,29 @@ func (s *MessageService) RemoveReaction(messageUUID string, userID uint, emoji s
 	}
 
 	// Delete the reaction
-	if err := s.db.Where("message_id = ? AND user_id = ? AND emoji = ?", messageID, userID, emoji).Delete(&models.MessageReaction{}).Error; err != nil {
-		return nil, fmt.Errorf("failed to remove reaction: %w", err)
+	result := s.db.Where("message_id = ? AND user_id = ? AND emoji = ?", messageID, userID, emoji).Delete(&models.MessageReaction{})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to remove reaction: %w", result.Error)
 	}
 
 	// Return updated message with reactions
-	return s.GetMessageByUUID(messageUUID)
+	message, err := s.GetMessageByUUID(messageUUID)
+	if err != nil {
+		return nil, err
+	}
+	if result.RowsAffected > 0 {
+		emitReactionEvent(models.WebhookEventReactionRemoved, message, userID, emoji)
+	}
+	return message, nil
+}
+
+// emitReactionEvent queues a reaction webhook event for the message's room
+func emitReactionEvent(eventType string, message *models.Message, userID uint, emoji string) {
+	emitWebhookEvent(message.RoomID, eventType, map[string]interface{}{
+		"message": webhookEventMessage(message),
+		"emoji":   emoji,
+		"user":    webhookEventUser(userID),
+	})
 }
 
 // ToggleReaction toggles a reaction (add if not exists, remove if exists)
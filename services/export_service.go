@@ -0,0 +1,368 @@
+package services
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github/sabt-dev/realtimeChat/database"
+	"github/sabt-dev/realtimeChat/models"
+
+	"gorm.io/gorm"
+)
+
+// exportBatchSize is how many messages are loaded and written at a time
+const exportBatchSize = 500
+
+// ExportFormats lists the supported room export formats
+var ExportFormats = map[string]string{
+	"json": "application/json; charset=utf-8",
+	"csv":  "text/csv; charset=utf-8",
+	"html": "text/html; charset=utf-8",
+}
+
+// ExportService streams room history to archive formats
+type ExportService struct {
+	db       *gorm.DB
+	clientIP string // Recorded in audit entries
+}
+
+// NewExportService creates a new ExportService
+func NewExportService() *ExportService {
+	return &ExportService{db: database.GetDB()}
+}
+
+// WithClientIP returns a copy of the service that records ip in its audit entries
+func (s *ExportService) WithClientIP(ip string) *ExportService {
+	return &ExportService{db: s.db, clientIP: ip}
+}
+
+// CanExportRoom reports whether the user may export the room: its creator or a
+// member. Memberships turn inactive whenever a user disconnects, so any
+// membership counts, as in CanUserAccessRoom.
+func (s *ExportService) CanExportRoom(userID, roomID uint) (bool, error) {
+	// Bots only reach rooms they are allowed in, whatever memberships they hold
+	botService := NewBotService()
+	isBot, err := botService.IsBot(userID)
+	if err != nil {
+		return false, err
+	}
+	if isBot {
+		return botService.IsBotAllowedInRoom(userID, roomID)
+	}
+
+	isCreator, err := NewRoomService().IsRoomCreator(userID, roomID)
+	if err != nil || isCreator {
+		return isCreator, err
+	}
+
+	var count int64
+	err = s.db.Model(&models.RoomMember{}).
+		Where("user_id = ? AND room_id = ?", userID, roomID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// roomExportWriter renders an export in one format
+type roomExportWriter interface {
+	begin(header models.ExportHeader) error
+	message(msg models.ExportMessage) error
+	end() error
+}
+
+// ExportRoom writes the full history of a room to w in the given format,
+// flushing after each batch when w supports it
+func (s *ExportService) ExportRoom(w io.Writer, roomID, userID uint, format string) error {
+	var writer roomExportWriter
+	switch format {
+	case "json":
+		writer = &jsonExportWriter{w: w}
+	case "csv":
+		writer = &csvExportWriter{w: csv.NewWriter(w)}
+	case "html":
+		writer = &htmlExportWriter{w: w}
+	default:
+		return fmt.Errorf("unsupported export format: %s", format)
+	}
+
+	var room models.Room
+	if err := s.db.Preload("Creator").First(&room, roomID).Error; err != nil {
+		return fmt.Errorf("room not found: %w", err)
+	}
+
+	var members []models.RoomMember
+	if err := s.db.Preload("User").Where("room_id = ?", roomID).Order("joined_at ASC").Find(&members).Error; err != nil {
+		return err
+	}
+
+	if err := recordAudit(s.db, AuditEntry{
+		ActorID:    uintPtr(userID),
+		Action:     "room.export",
+		TargetType: "room",
+		TargetID:   strconv.FormatUint(uint64(roomID), 10),
+		RoomID:     uintPtr(roomID),
+		Metadata:   map[string]interface{}{"format": format},
+		IP:         s.clientIP,
+	}); err != nil {
+		return err
+	}
+
+	if err := writer.begin(exportHeader(&room, members)); err != nil {
+		return err
+	}
+
+	// Walk the history oldest first using the same keyset paging as GetRoomMessages
+	messageService := &MessageService{db: s.db}
+	var anchor *models.Message
+	for {
+		batch, hasMore, err := messageService.historyPage(roomID, anchor, false, exportBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for i := range batch {
+			if err := writer.message(exportMessage(&batch[i])); err != nil {
+				return err
+			}
+		}
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+
+		if !hasMore || len(batch) == 0 {
+			break
+		}
+		anchor = &batch[len(batch)-1]
+	}
+
+	return writer.end()
+}
+
+// exportHeader builds the export header for a room
+func exportHeader(room *models.Room, members []models.RoomMember) models.ExportHeader {
+	header := models.ExportHeader{
+		Schema:     models.ExportSchemaName,
+		Version:    models.ExportSchemaVersion,
+		ExportedAt: time.Now().UTC(),
+		Room: models.ExportRoom{
+			Name:        room.Name,
+			Description: room.Description,
+			IsPrivate:   room.IsPrivate,
+			CreatedAt:   room.CreatedAt,
+		},
+		Members: make([]models.ExportMember, 0, len(members)),
+	}
+	if room.Creator != nil {
+		header.Room.Creator = &models.ExportUser{Name: room.Creator.Name, Email: room.Creator.Email}
+	}
+	for _, member := range members {
+		header.Members = append(header.Members, models.ExportMember{
+			User:     models.ExportUser{Name: member.User.Name, Email: member.User.Email},
+			Role:     member.Role,
+			JoinedAt: member.JoinedAt,
+			IsActive: member.IsActive,
+		})
+	}
+	return header
+}
+
+// exportMessage converts a stored message to its export form
+func exportMessage(m *models.Message) models.ExportMessage {
+	msg := models.ExportMessage{
+		ID:           m.UUID,
+		Type:         m.Type,
+		Sender:       models.ExportUser{Name: m.Sender.Name, Email: m.Sender.Email},
+		Text:         m.Text,
+		CreatedAt:    m.CreatedAt,
+		Deleted:      m.DeletedAt.Valid,
+		DeleteReason: m.DeleteReason,
+	}
+	if m.SenderName != "" {
+		msg.Sender.Name = m.SenderName // Display name chosen by an incoming webhook
+	}
+	if m.MediaURL != "" {
+		msg.Media = &models.ExportMedia{URL: externalMediaURL(m.MediaURL), Type: m.MediaType, FileName: m.FileName}
+	}
+	if m.ReplyToID != nil || m.ReplyToSender != "" {
+		msg.ReplyTo = &models.ExportReply{Sender: m.ReplyToSender, Text: m.ReplyToText}
+		if m.ReplyTo != nil {
+			msg.ReplyTo.ID = m.ReplyTo.UUID
+		}
+	}
+	for _, reaction := range m.Reactions {
+		msg.Reactions = append(msg.Reactions, models.ExportReaction{
+			Emoji: reaction.Emoji,
+			User:  models.ExportUser{Name: reaction.User.Name, Email: reaction.User.Email},
+		})
+	}
+	return msg
+}
+
+// jsonExportWriter streams the versioned JSON document one message at a time
+type jsonExportWriter struct {
+	w     io.Writer
+	count int
+}
+
+func (e *jsonExportWriter) begin(header models.ExportHeader) error {
+	data, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	// Reopen the header object to append the messages array
+	if _, err := e.w.Write(data[:len(data)-1]); err != nil {
+		return err
+	}
+	_, err = io.WriteString(e.w, `,"messages":[`)
+	return err
+}
+
+func (e *jsonExportWriter) message(msg models.ExportMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if e.count > 0 {
+		if _, err := io.WriteString(e.w, ","); err != nil {
+			return err
+		}
+	}
+	e.count++
+	_, err = e.w.Write(append([]byte("\n"), data...))
+	return err
+}
+
+func (e *jsonExportWriter) end() error {
+	_, err := io.WriteString(e.w, "\n]}\n")
+	return err
+}
+
+// csvExportWriter writes one row per message
+type csvExportWriter struct {
+	w *csv.Writer
+}
+
+func (e *csvExportWriter) begin(models.ExportHeader) error {
+	return e.w.Write([]string{
+		"id", "timestamp", "type", "sender", "text",
+		"reply_to_id", "reply_to_sender", "reply_to_text",
+		"media_url", "media_type", "file_name",
+		"reactions", "deleted", "delete_reason",
+	})
+}
+
+func (e *csvExportWriter) message(msg models.ExportMessage) error {
+	var replyID, replySender, replyText string
+	if msg.ReplyTo != nil {
+		replyID, replySender, replyText = msg.ReplyTo.ID, msg.ReplyTo.Sender, msg.ReplyTo.Text
+	}
+	var mediaURL, mediaType, fileName string
+	if msg.Media != nil {
+		mediaURL, mediaType, fileName = msg.Media.URL, msg.Media.Type, msg.Media.FileName
+	}
+
+	err := e.w.Write([]string{
+		msg.ID, msg.CreatedAt.UTC().Format(time.RFC3339), msg.Type, msg.Sender.Name, msg.Text,
+		replyID, replySender, replyText,
+		mediaURL, mediaType, fileName,
+		summarizeExportReactions(msg.Reactions), strconv.FormatBool(msg.Deleted), msg.DeleteReason,
+	})
+	if err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvExportWriter) end() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// summarizeExportReactions renders reactions as "👍 Alice, Bob; 🎉 Carol"
+func summarizeExportReactions(reactions []models.ExportReaction) string {
+	var order []string
+	users := map[string][]string{}
+	for _, reaction := range reactions {
+		if _, ok := users[reaction.Emoji]; !ok {
+			order = append(order, reaction.Emoji)
+		}
+		users[reaction.Emoji] = append(users[reaction.Emoji], reaction.User.Name)
+	}
+	parts := make([]string, 0, len(order))
+	for _, emoji := range order {
+		parts = append(parts, emoji+" "+strings.Join(users[emoji], ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// htmlExportWriter renders a single self-contained page with inline styling
+type htmlExportWriter struct {
+	w io.Writer
+}
+
+var htmlExportTemplates = template.Must(template.New("export").Funcs(template.FuncMap{
+	"formatTime": func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04 UTC") },
+	"reactions":  summarizeExportReactions,
+}).Parse(`
+{{define "begin"}}<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>#{{.Room.Name}} – chat export</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Roboto, sans-serif; background: #f5f5f7; color: #1f2937; margin: 0; padding: 2rem; }
+main { max-width: 760px; margin: 0 auto; }
+header { border-bottom: 1px solid #d1d5db; margin-bottom: 1.5rem; padding-bottom: 1rem; }
+h1 { margin: 0 0 .25rem; font-size: 1.5rem; }
+.meta { color: #6b7280; font-size: .85rem; }
+.message { background: #fff; border: 1px solid #e5e7eb; border-radius: 8px; margin: .5rem 0; padding: .6rem .8rem; }
+.message .info { color: #6b7280; font-size: .8rem; margin-bottom: .25rem; }
+.message .sender { color: #4f46e5; font-weight: 600; }
+.message .text { white-space: pre-wrap; word-break: break-word; }
+.system { color: #6b7280; font-size: .85rem; font-style: italic; text-align: center; margin: .5rem 0; }
+.deleted { opacity: .6; border-style: dashed; font-style: italic; }
+.reply { border-left: 3px solid #a5b4fc; color: #6b7280; font-size: .85rem; margin-bottom: .35rem; padding-left: .5rem; }
+.media { font-size: .85rem; margin-top: .35rem; }
+.reactions { color: #6b7280; font-size: .8rem; margin-top: .35rem; }
+</style>
+</head>
+<body>
+<main>
+<header>
+<h1>#{{.Room.Name}}</h1>
+{{if .Room.Description}}<div>{{.Room.Description}}</div>{{end}}
+<div class="meta">{{if .Room.IsPrivate}}Private room{{else}}Public room{{end}} · {{len .Members}} members · exported {{formatTime .ExportedAt}}</div>
+</header>
+{{end}}
+{{define "message"}}{{if or (eq .Type "join") (eq .Type "leave")}}<div class="system">{{.Text}} · {{formatTime .CreatedAt}}</div>
+{{else}}<div class="message{{if .Deleted}} deleted{{end}}" id="m-{{.ID}}">
+<div class="info"><span class="sender">{{.Sender.Name}}</span> · {{formatTime .CreatedAt}}</div>
+{{with .ReplyTo}}<div class="reply">{{if .ID}}<a href="#m-{{.ID}}">↩ {{.Sender}}</a>{{else}}↩ {{.Sender}}{{end}}: {{.Text}}</div>{{end}}
+{{if .Deleted}}<div class="text">message deleted{{if .DeleteReason}} ({{.DeleteReason}}){{end}}</div>{{else}}{{if .Text}}<div class="text">{{.Text}}</div>{{end}}
+{{with .Media}}<div class="media">📎 {{.Type}}: {{if .FileName}}{{.FileName}}{{else}}{{.URL}}{{end}} <span class="meta">({{.URL}})</span></div>{{end}}{{end}}
+{{if .Reactions}}<div class="reactions">{{reactions .Reactions}}</div>{{end}}
+</div>
+{{end}}{{end}}
+{{define "end"}}</main>
+</body>
+</html>
+{{end}}`))
+
+func (e *htmlExportWriter) begin(header models.ExportHeader) error {
+	return htmlExportTemplates.ExecuteTemplate(e.w, "begin", header)
+}
+
+func (e *htmlExportWriter) message(msg models.ExportMessage) error {
+	return htmlExportTemplates.ExecuteTemplate(e.w, "message", msg)
+}
+
+func (e *htmlExportWriter) end() error {
+	return htmlExportTemplates.ExecuteTemplate(e.w, "end", nil)
+}
@@ -0,0 +1,43 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github/sabt-dev/realtimeChat/models"
+)
+
+func TestExportRoomSignsMediaURLs(t *testing.T) {
+	db := newTestDB(t)
+	initTestMediaSigning(t)
+	alice := createTestUser(t, db, "alice", false)
+	room := createTestRoom(t, db, "general", false, alice)
+	mediaURL := uploadTestBlob(t, db, alice, "0123abcd.png")
+
+	messages := NewMessageService()
+	if _, err := messages.CreateMessage(alice.ID, room.ID, "", "media", mediaURL, "image", "cat.png", nil, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := messages.CreateMessage(alice.ID, room.ID, "", "media", "https://files.example.com/a.png", "image", "a.png", nil, "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := NewExportService().ExportRoom(&out, room.ID, alice.ID, "json"); err != nil {
+		t.Fatal(err)
+	}
+	var export struct {
+		Messages []models.ExportMessage `json:"messages"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &export); err != nil {
+		t.Fatal(err)
+	}
+	if len(export.Messages) != 2 || export.Messages[0].Media == nil || export.Messages[1].Media == nil {
+		t.Fatalf("exported messages = %+v, want two media messages", export.Messages)
+	}
+	checkExternalMediaURL(t, export.Messages[0].Media.URL, "0123abcd.png")
+	if got := export.Messages[1].Media.URL; got != "https://files.example.com/a.png" {
+		t.Errorf("external media URL = %q, want it unchanged", got)
+	}
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"testing"
+
+	"github/sabt-dev/realtimeChat/database"
+	"github/sabt-dev/realtimeChat/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	_ "modernc.org/sqlite"
+)
+
+// newTestDB opens an in-memory database with the full schema and makes it
+// the database services use until the test ends
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Dialector{DriverName: "sqlite", DSN: "file::memory:"}, &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = previous
+		sqlDB.Close()
+	})
+	return db
+}
+
+// createTestUser creates a user named name with the email name@example.com
+func createTestUser(t *testing.T, db *gorm.DB, name string, isBot bool) *models.User {
+	t.Helper()
+	user := models.User{Name: name, Email: name + "@example.com", IsBot: isBot}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &user
+}
+
+// createTestRoom creates a room with creator as its creator and member
+func createTestRoom(t *testing.T, db *gorm.DB, name string, private bool, creator *models.User) *models.Room {
+	t.Helper()
+	room := models.Room{Name: name, IsPrivate: private, CreatorID: &creator.ID}
+	if err := db.Create(&room).Error; err != nil {
+		t.Fatal(err)
+	}
+	addTestMember(t, db, &room, creator, "creator")
+	return &room
+}
+
+// addTestMember adds user to room with the given role
+func addTestMember(t *testing.T, db *gorm.DB, room *models.Room, user *models.User, role string) {
+	t.Helper()
+	if err := db.Create(&models.RoomMember{RoomID: room.ID, UserID: user.ID, Role: role}).Error; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,466 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github/sabt-dev/realtimeChat/database"
+	"github/sabt-dev/realtimeChat/importer"
+	"github/sabt-dev/realtimeChat/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// importNamespace seeds the deterministic UUIDs of imported messages, so
+// importing the same archive twice finds the rows written the first time
+var importNamespace = uuid.MustParse("6f1c2a94-3c1e-4f1a-9d7b-2b8e5f0c4a71")
+
+// maxImportSkippedItems caps the skipped items listed in a report
+const maxImportSkippedItems = 500
+
+// ImportService writes parsed export archives into the database
+type ImportService struct {
+	db       *gorm.DB
+	clientIP string // Recorded in audit entries
+}
+
+// NewImportService creates a new ImportService
+func NewImportService() *ImportService {
+	return &ImportService{db: database.GetDB()}
+}
+
+// WithClientIP returns a copy of the service that records ip in its audit entries
+func (s *ImportService) WithClientIP(ip string) *ImportService {
+	return &ImportService{db: s.db, clientIP: ip}
+}
+
+// importRun holds the state of a single Import call
+type importRun struct {
+	db      *gorm.DB
+	archive *importer.Archive
+	actorID *uint
+	report  *models.ImportReport
+	users   map[string]*models.User // External user ID -> local user
+}
+
+func (r *importRun) skip(kind, ref, reason string) {
+	r.report.SkippedTotal++
+	if len(r.report.Skipped) < maxImportSkippedItems {
+		r.report.Skipped = append(r.report.Skipped, models.ImportSkippedItem{Kind: kind, Ref: ref, Reason: reason})
+	}
+}
+
+// Import writes the archive's users, rooms, members, messages and reactions.
+// Users are matched by email and rooms by name; messages get UUIDs derived from
+// their source IDs, so re-running an import only adds what is missing.
+// Each channel is imported in its own transaction.
+func (s *ImportService) Import(archive *importer.Archive, actorID *uint) (*models.ImportReport, error) {
+	run := &importRun{
+		db:      s.db,
+		archive: archive,
+		actorID: actorID,
+		report:  &models.ImportReport{Source: archive.Source, Skipped: []models.ImportSkippedItem{}},
+		users:   map[string]*models.User{},
+	}
+	for _, item := range archive.Skipped {
+		run.skip(item.Kind, item.Ref, item.Reason)
+	}
+
+	for _, channel := range archive.Channels {
+		if err := run.importChannel(channel); err != nil {
+			return run.report, fmt.Errorf("failed to import channel %s: %w", channel.Name, err)
+		}
+	}
+
+	if err := recordAudit(s.db, AuditEntry{
+		ActorID:    actorID,
+		Action:     "admin.import",
+		TargetType: "import",
+		TargetID:   archive.Source,
+		Metadata: map[string]interface{}{
+			"source":            archive.Source,
+			"rooms_created":     run.report.RoomsCreated,
+			"users_created":     run.report.UsersCreated,
+			"messages_imported": run.report.MessagesImported,
+			"skipped":           run.report.SkippedTotal,
+		},
+		IP: s.clientIP,
+	}); err != nil {
+		return run.report, err
+	}
+
+	return run.report, nil
+}
+
+func (r *importRun) importChannel(channel *importer.Channel) error {
+	if strings.TrimSpace(channel.Name) == "" {
+		r.skip("channel", channel.ExternalID, "channel has no name")
+		return nil
+	}
+
+	tx := r.db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	defer func() {
+		if rec := recover(); rec != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Counters are only kept once the transaction commits
+	committed := *r.report
+	committed.Skipped = append([]models.ImportSkippedItem(nil), r.report.Skipped...)
+	cachedUsers := len(r.users)
+
+	if err := r.writeChannel(tx, channel); err != nil {
+		tx.Rollback()
+		*r.report = committed
+		if len(r.users) != cachedUsers {
+			r.users = map[string]*models.User{} // Users created in the rolled back transaction are gone
+		}
+		return err
+	}
+	return tx.Commit().Error
+}
+
+func (r *importRun) writeChannel(tx *gorm.DB, channel *importer.Channel) error {
+	room, err := r.ensureRoom(tx, channel)
+	if err != nil {
+		return err
+	}
+	if room == nil {
+		return nil
+	}
+
+	for _, externalID := range channel.MemberExternalIDs {
+		user, err := r.ensureUser(tx, externalID)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			r.skip("member", channel.Name+"/"+externalID, "unknown user")
+			continue
+		}
+		if err := ensureImportedMember(tx, room, user.ID); err != nil {
+			return err
+		}
+	}
+
+	// Source message ID -> imported message, for reply links
+	imported := map[string]*models.Message{}
+	for _, msg := range channel.Messages {
+		if err := r.importMessage(tx, channel, room, msg, imported); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureRoom reuses a room with the channel's name or creates it. A room
+// whose privacy differs from the channel's is not reused; the channel is
+// skipped and nil is returned, so private history never lands in a public room.
+func (r *importRun) ensureRoom(tx *gorm.DB, channel *importer.Channel) (*models.Room, error) {
+	var room models.Room
+	err := tx.Where("name = ?", channel.Name).First(&room).Error
+	if err == nil {
+		if room.IsPrivate != channel.IsPrivate {
+			r.skip("channel", channel.Name, fmt.Sprintf("a %s room with this name already exists", roomVisibility(room.IsPrivate)))
+			return nil, nil
+		}
+		r.report.RoomsReused++
+		return &room, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	creatorID := r.actorID
+	if channel.CreatorExternalID != "" {
+		creator, err := r.ensureUser(tx, channel.CreatorExternalID)
+		if err != nil {
+			return nil, err
+		}
+		if creator != nil {
+			creatorID = uintPtr(creator.ID)
+		}
+	}
+
+	room = models.Room{
+		Name:        channel.Name,
+		Description: channel.Description,
+		IsPrivate:   channel.IsPrivate,
+		CreatorID:   creatorID,
+		CreatedAt:   channel.CreatedAt,
+	}
+	if err := tx.Create(&room).Error; err != nil {
+		return nil, err
+	}
+	if creatorID != nil {
+		if err := tx.Create(&models.RoomMember{UserID: *creatorID, RoomID: room.ID, Role: "creator"}).Error; err != nil {
+			return nil, err
+		}
+		// Members are created inactive; gorm skips the false zero value on create
+		if err := tx.Model(&models.RoomMember{}).Where("user_id = ? AND room_id = ?", *creatorID, room.ID).Update("is_active", false).Error; err != nil {
+			return nil, err
+		}
+	}
+	r.report.RoomsCreated++
+	return &room, nil
+}
+
+func roomVisibility(private bool) string {
+	if private {
+		return "private"
+	}
+	return "public"
+}
+
+// ensureImportedMember adds an inactive membership unless the user already has one
+func ensureImportedMember(tx *gorm.DB, room *models.Room, userID uint) error {
+	var count int64
+	if err := tx.Model(&models.RoomMember{}).Where("user_id = ? AND room_id = ?", userID, room.ID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	member := models.RoomMember{UserID: userID, RoomID: room.ID, Role: "member"}
+	if err := tx.Create(&member).Error; err != nil {
+		return err
+	}
+	return tx.Model(&member).Update("is_active", false).Error
+}
+
+// ensureUser maps an archive user to a local user, matching by email and
+// creating the user if needed. Existing users keep their name and avatar.
+// Returns nil if the archive does not know the user.
+func (r *importRun) ensureUser(tx *gorm.DB, externalID string) (*models.User, error) {
+	if user, ok := r.users[externalID]; ok {
+		return user, nil
+	}
+	source, ok := r.archive.Users[externalID]
+	if !ok {
+		return nil, nil
+	}
+
+	email := strings.ToLower(strings.TrimSpace(source.Email))
+	if email == "" {
+		// Sources without emails get a stable placeholder address that can never receive mail
+		email = fmt.Sprintf("%s-%s@imported.invalid", r.archive.Source, strings.ToLower(strings.ReplaceAll(externalID, ":", "-")))
+	}
+
+	var user models.User
+	err := tx.Where("email = ?", email).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		user = models.User{Name: source.Name, Email: email, Avatar: source.Avatar, IsBot: source.IsBot}
+		if err := tx.Create(&user).Error; err != nil {
+			return nil, err
+		}
+		r.report.UsersCreated++
+	} else if err != nil {
+		return nil, err
+	}
+
+	r.users[externalID] = &user
+	return &user, nil
+}
+
+// importMessage writes one source message, plus one extra media message per
+// additional attachment, skipping rows that already exist
+func (r *importRun) importMessage(tx *gorm.DB, channel *importer.Channel, room *models.Room, msg importer.Message, imported map[string]*models.Message) error {
+	ref := channel.Name + "/" + msg.ExternalID
+	sender, err := r.ensureUser(tx, msg.UserExternalID)
+	if err != nil {
+		return err
+	}
+	if sender == nil {
+		r.skip("message", ref, "unknown author")
+		return nil
+	}
+
+	// Parsers drop attachments that need source credentials or expire; the
+	// rest stay where the source hosts them, so only absolute links are kept,
+	// as a path on this server could point at someone else's upload
+	var media []importer.Attachment
+	for _, a := range msg.Attachments {
+		if u, err := url.Parse(a.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			r.skip("attachment", ref, "attachment is not an http(s) link")
+			continue
+		}
+		media = append(media, a)
+	}
+
+	message := models.Message{
+		UUID:      uuid.NewSHA1(importNamespace, []byte(r.archive.Source+":"+channel.ExternalID+":"+msg.ExternalID)).String(),
+		SenderID:  sender.ID,
+		RoomID:    room.ID,
+		Text:      msg.Text,
+		Type:      msg.Type,
+		CreatedAt: msg.Timestamp,
+		UpdatedAt: msg.Timestamp,
+	}
+	switch msg.Type {
+	case "join":
+		message.Text = fmt.Sprintf("%s joined the room", sender.Name)
+	case "leave":
+		message.Text = fmt.Sprintf("%s left the room", sender.Name)
+	default:
+		if len(media) > 0 {
+			setImportedMedia(&message, media[0])
+			media = media[1:]
+		} else if strings.TrimSpace(msg.Text) == "" {
+			r.skip("message", ref, "message has no text or importable attachments")
+			return nil
+		}
+	}
+
+	if msg.ReplyToExternalID != "" {
+		parent, err := r.findImportedMessage(tx, channel, msg.ReplyToExternalID, imported)
+		if err != nil {
+			return err
+		}
+		if parent != nil {
+			message.ReplyToID = &parent.ID
+			message.ReplyToSender = parent.Sender.Name
+			message.ReplyToText = truncateReplyText(parent.Text)
+		} else {
+			r.skip("reply", ref, "replied-to message "+msg.ReplyToExternalID+" is not in the archive")
+		}
+	}
+
+	if err := renderMessageText(tx, &message); err != nil {
+		return err
+	}
+
+	stored, err := r.createMessageOnce(tx, &message)
+	if err != nil {
+		return err
+	}
+	stored.Sender = *sender
+	imported[msg.ExternalID] = stored
+
+	// Extra attachments follow as media messages from the same sender
+	for i, a := range media {
+		extra := models.Message{
+			UUID:      uuid.NewSHA1(importNamespace, []byte(fmt.Sprintf("%s:%s:%s:%d", r.archive.Source, channel.ExternalID, msg.ExternalID, i+1))).String(),
+			SenderID:  sender.ID,
+			RoomID:    room.ID,
+			Type:      "media",
+			CreatedAt: msg.Timestamp,
+			UpdatedAt: msg.Timestamp,
+		}
+		setImportedMedia(&extra, a)
+		if _, err := r.createMessageOnce(tx, &extra); err != nil {
+			return err
+		}
+	}
+
+	return r.importReactions(tx, ref, stored.ID, msg.Reactions)
+}
+
+// createMessageOnce inserts the message unless a row with its UUID exists,
+// including as a tombstone, and returns the stored row
+func (r *importRun) createMessageOnce(tx *gorm.DB, message *models.Message) (*models.Message, error) {
+	var existing models.Message
+	err := tx.Unscoped().Where("uuid = ?", message.UUID).First(&existing).Error
+	if err == nil {
+		r.report.MessagesAlreadyImported++
+		return &existing, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if err := tx.Create(message).Error; err != nil {
+		return nil, err
+	}
+	r.report.MessagesImported++
+	return message, nil
+}
+
+// findImportedMessage resolves a reply target, first among the messages of
+// this run and then among rows written by an earlier run
+func (r *importRun) findImportedMessage(tx *gorm.DB, channel *importer.Channel, externalID string, imported map[string]*models.Message) (*models.Message, error) {
+	if parent, ok := imported[externalID]; ok {
+		return parent, nil
+	}
+	var parent models.Message
+	parentUUID := uuid.NewSHA1(importNamespace, []byte(r.archive.Source+":"+channel.ExternalID+":"+externalID)).String()
+	err := tx.Unscoped().Preload("Sender").Where("uuid = ?", parentUUID).First(&parent).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &parent, nil
+}
+
+func (r *importRun) importReactions(tx *gorm.DB, ref string, messageID uint, reactions []importer.Reaction) error {
+	for _, reaction := range reactions {
+		if reaction.Emoji == "" {
+			r.skip("reaction", ref, "reaction has no emoji")
+			continue
+		}
+		for _, externalID := range reaction.UserExternalIDs {
+			user, err := r.ensureUser(tx, externalID)
+			if err != nil {
+				return err
+			}
+			if user == nil {
+				r.skip("reaction", ref+"/"+reaction.Emoji, "unknown user "+externalID)
+				continue
+			}
+
+			var count int64
+			if err := tx.Model(&models.MessageReaction{}).
+				Where("message_id = ? AND user_id = ? AND emoji = ?", messageID, user.ID, reaction.Emoji).
+				Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				continue
+			}
+			if err := tx.Create(&models.MessageReaction{MessageID: messageID, UserID: user.ID, Emoji: reaction.Emoji}).Error; err != nil {
+				return err
+			}
+			r.report.ReactionsImported++
+		}
+	}
+	return nil
+}
+
+// importMediaType maps an attachment MIME type to a message media type.
+// Anything that is not an image or video is shared as a file.
+func importMediaType(mimeType string) string {
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return "image"
+	case strings.HasPrefix(mimeType, "video/"):
+		return "video"
+	default:
+		return "file"
+	}
+}
+
+// setImportedMedia points the message at an attachment. Files stay where the
+// source hosts them; the URL is kept as a reference.
+func setImportedMedia(message *models.Message, a importer.Attachment) {
+	message.Type = "media"
+	message.MediaURL = a.URL
+	message.MediaType = importMediaType(a.MimeType)
+	message.MediaMimeType = a.MimeType
+	message.FileName = a.FileName
+}
+
+// truncateReplyText shortens the quoted text shown in a reply preview
+func truncateReplyText(text string) string {
+	runes := []rune(text)
+	if len(runes) > 100 {
+		return string(runes[:100]) + "..."
+	}
+	return text
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github/sabt-dev/realtimeChat/importer"
+	"github/sabt-dev/realtimeChat/models"
+)
+
+// importFixture is a Slack-like archive with one public channel
+func importFixture() *importer.Archive {
+	at := func(minute int) time.Time { return time.Date(2020, 1, 1, 9, minute, 0, 0, time.UTC) }
+	return &importer.Archive{
+		Source: importer.SourceSlack,
+		Users: map[string]*importer.User{
+			"U1": {ExternalID: "U1", Name: "Alice (Slack)", Email: "Alice@Example.com"},
+			"U2": {ExternalID: "U2", Name: "Bob"},
+		},
+		Channels: []*importer.Channel{{
+			ExternalID:        "C1",
+			Name:              "general",
+			Description:       "Company-wide chat",
+			CreatedAt:         at(0),
+			CreatorExternalID: "U1",
+			MemberExternalIDs: []string{"U1", "U2", "U9"},
+			Messages: []importer.Message{
+				{ExternalID: "1", UserExternalID: "U2", Type: "join", Timestamp: at(1)},
+				{ExternalID: "2", UserExternalID: "U1", Type: "message", Text: "hello **team**", Timestamp: at(2),
+					Reactions: []importer.Reaction{{Emoji: "👍", UserExternalIDs: []string{"U1", "U2", "U9"}}, {UserExternalIDs: []string{"U2"}}}},
+				{ExternalID: "3", UserExternalID: "U2", Type: "message", Text: "hi", Timestamp: at(3), ReplyToExternalID: "2"},
+				{ExternalID: "4", UserExternalID: "U1", Type: "message", Timestamp: at(4), Attachments: []importer.Attachment{
+					{URL: "https://files.example.com/a.png", FileName: "a.png", MimeType: "image/png"},
+					{URL: "/uploads/someone-elses.png", FileName: "b.png", MimeType: "image/png"},
+					{URL: "https://files.example.com/c.pdf", FileName: "c.pdf", MimeType: "application/pdf"},
+				}},
+				{ExternalID: "5", UserExternalID: "U9", Type: "message", Text: "who am I", Timestamp: at(5)},
+				{ExternalID: "6", UserExternalID: "U2", Type: "message", Timestamp: at(6), Attachments: []importer.Attachment{
+					{URL: "ftp://files.example.com/d.bin", FileName: "d.bin"},
+				}},
+				{ExternalID: "7", UserExternalID: "U1", Type: "message", Text: "see above", Timestamp: at(7), ReplyToExternalID: "0"},
+			},
+		}},
+	}
+}
+
+func TestImport(t *testing.T) {
+	db := newTestDB(t)
+	alice := createTestUser(t, db, "alice", false)
+	admin := createTestUser(t, db, "admin", false)
+
+	report, err := NewImportService().WithClientIP("203.0.113.7").Import(importFixture(), &admin.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := models.ImportReport{
+		Source:            importer.SourceSlack,
+		RoomsCreated:      1,
+		UsersCreated:      1,
+		MessagesImported:  6,
+		ReactionsImported: 2,
+		SkippedTotal:      8,
+	}
+	if report.RoomsCreated != want.RoomsCreated || report.RoomsReused != 0 || report.UsersCreated != want.UsersCreated ||
+		report.MessagesImported != want.MessagesImported || report.ReactionsImported != want.ReactionsImported ||
+		report.SkippedTotal != want.SkippedTotal || len(report.Skipped) != want.SkippedTotal {
+		t.Errorf("report = %+v, want counts of %+v", report, want)
+	}
+
+	var room models.Room
+	if err := db.Where("name = ?", "general").First(&room).Error; err != nil {
+		t.Fatal(err)
+	}
+	if room.IsPrivate || room.Description != "Company-wide chat" || room.CreatorID == nil || *room.CreatorID != alice.ID {
+		t.Errorf("room = %+v, want a public room created by the existing alice", room)
+	}
+
+	// Users are matched by email; the others get a placeholder address
+	var bob models.User
+	if err := db.Where("email = ?", "slack-u2@imported.invalid").First(&bob).Error; err != nil {
+		t.Fatalf("imported bob: %v", err)
+	}
+	var members []models.RoomMember
+	db.Where("room_id = ?", room.ID).Order("user_id").Find(&members)
+	if len(members) != 2 || members[0].UserID != alice.ID || members[0].Role != "creator" || members[1].UserID != bob.ID || members[1].Role != "member" {
+		t.Errorf("members = %+v, want alice as creator and bob", members)
+	}
+	for _, m := range members {
+		if m.IsActive {
+			t.Errorf("member %d is active, want imported members inactive", m.UserID)
+		}
+	}
+
+	var messages []models.Message
+	db.Where("room_id = ?", room.ID).Order("created_at, id").Find(&messages)
+	if len(messages) != 6 {
+		t.Fatalf("got %d messages, want 6", len(messages))
+	}
+	join, hello, reply, image, pdf, unknownParent := messages[0], messages[1], messages[2], messages[3], messages[4], messages[5]
+	if join.Type != "join" || join.Text != "Bob joined the room" {
+		t.Errorf("join = %+v", join)
+	}
+	if hello.SenderID != alice.ID || hello.Text != "hello **team**" || !hello.CreatedAt.Equal(time.Date(2020, 1, 1, 9, 2, 0, 0, time.UTC)) {
+		t.Errorf("hello = %+v", hello)
+	}
+	if reply.ReplyToID == nil || *reply.ReplyToID != hello.ID || reply.ReplyToSender != "alice" || reply.ReplyToText != "hello **team**" {
+		t.Errorf("reply = %+v, want a reply to hello", reply)
+	}
+	if image.Type != "media" || image.MediaURL != "https://files.example.com/a.png" || image.MediaType != "image" {
+		t.Errorf("image = %+v", image)
+	}
+	if pdf.Type != "media" || pdf.MediaURL != "https://files.example.com/c.pdf" || pdf.MediaType != "file" || pdf.SenderID != alice.ID {
+		t.Errorf("extra attachment = %+v, want a media message from the same sender", pdf)
+	}
+	if unknownParent.ReplyToID != nil {
+		t.Errorf("message replying outside the archive = %+v, want no reply link", unknownParent)
+	}
+
+	var reactions int64
+	db.Model(&models.MessageReaction{}).Where("message_id = ?", hello.ID).Count(&reactions)
+	if reactions != 2 {
+		t.Errorf("got %d reactions on hello, want 2", reactions)
+	}
+
+	var audit models.AuditLog
+	if err := db.Where("action = ?", "admin.import").First(&audit).Error; err != nil {
+		t.Fatalf("audit entry: %v", err)
+	}
+	if audit.ActorID == nil || *audit.ActorID != admin.ID || audit.IP != "203.0.113.7" {
+		t.Errorf("audit = %+v", audit)
+	}
+
+	// A second run only finds what the first one wrote
+	again, err := NewImportService().Import(importFixture(), &admin.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.RoomsCreated != 0 || again.RoomsReused != 1 || again.UsersCreated != 0 || again.MessagesImported != 0 ||
+		again.MessagesAlreadyImported != 6 || again.ReactionsImported != 0 {
+		t.Errorf("second report = %+v, want everything already imported", again)
+	}
+	var count int64
+	db.Model(&models.Message{}).Where("room_id = ?", room.ID).Count(&count)
+	if count != 6 {
+		t.Errorf("got %d messages after the second run, want 6", count)
+	}
+}
+
+func TestImportSkipsRoomWithDifferentPrivacy(t *testing.T) {
+	db := newTestDB(t)
+	owner := createTestUser(t, db, "owner", false)
+	public := createTestRoom(t, db, "general", false, owner)
+
+	archive := importFixture()
+	archive.Channels[0].IsPrivate = true
+	secret := *archive.Channels[0]
+	secret.ExternalID, secret.Name = "G1", "secret"
+	archive.Channels = append(archive.Channels, &secret)
+	existing := createTestRoom(t, db, "secret", true, owner)
+
+	report, err := NewImportService().Import(archive, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.RoomsCreated != 0 || report.RoomsReused != 1 {
+		t.Errorf("report = %+v, want only the private room reused", report)
+	}
+	found := false
+	for _, item := range report.Skipped {
+		if item.Kind == "channel" && item.Ref == "general" && item.Reason == "a public room with this name already exists" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("skipped = %+v, want the private channel refused", report.Skipped)
+	}
+
+	var count int64
+	db.Model(&models.Message{}).Where("room_id = ?", public.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("got %d messages in the public room, want private history kept out", count)
+	}
+	db.Model(&models.RoomMember{}).Where("room_id = ?", public.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("got %d members in the public room, want only its owner", count)
+	}
+	db.Model(&models.Message{}).Where("room_id = ?", existing.ID).Count(&count)
+	if count != 6 {
+		t.Errorf("got %d messages in the private room, want 6", count)
+	}
+}
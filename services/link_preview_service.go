@@ -0,0 +1,405 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github/sabt-dev/realtimeChat/database"
+	"github/sabt-dev/realtimeChat/models"
+
+	"golang.org/x/net/html"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	linkPreviewMaxLinks         = 3         // Links previewed per message
+	linkPreviewMaxPageBytes     = 512 << 10 // Previews come from the page head, which is near the start
+	linkPreviewMaxOEmbedBytes   = 64 << 10
+	linkPreviewMaxRedirects     = 3
+	linkPreviewQueueSize        = 256
+	linkPreviewWorkers          = 2
+	linkPreviewTitleLimit       = 200
+	linkPreviewDescriptionLimit = 500
+	linkPreviewUserAgent        = "realtimeChat-LinkPreview/1.0"
+	linkPreviewFailureTTL       = time.Hour // Failed fetches are retried sooner than the cache TTL
+)
+
+// errNoLinkMetadata is returned for pages without a title or description
+var errNoLinkMetadata = errors.New("page has no preview metadata")
+
+// linkPreviewJob asks the unfurler to preview the links of a new message
+type linkPreviewJob struct {
+	messageID uint
+	urls      []string
+}
+
+// linkPreviewQueue feeds the unfurler; nil until StartLinkUnfurler runs
+var linkPreviewQueue chan linkPreviewJob
+
+type linkUnfurler struct {
+	db       *gorm.DB
+	client   *http.Client
+	cacheTTL time.Duration
+	onUpdate func(*models.Message)
+}
+
+// StartLinkUnfurler starts the background workers that fetch OpenGraph and
+// oEmbed metadata for links in new messages and attach it as previews.
+// onUpdate receives each message once its previews are stored, so it can be
+// broadcast to the room.
+func StartLinkUnfurler(onUpdate func(*models.Message)) {
+	if os.Getenv("LINK_PREVIEWS") == "false" {
+		log.Println("Link previews disabled (LINK_PREVIEWS=false)")
+		return
+	}
+
+	u := &linkUnfurler{
+		db:       database.GetDB(),
+		client:   newOutboundHTTPClient(getEnvDuration("LINK_PREVIEW_TIMEOUT", 5*time.Second), linkPreviewMaxRedirects),
+		cacheTTL: getEnvDuration("LINK_PREVIEW_CACHE_TTL", 24*time.Hour),
+		onUpdate: onUpdate,
+	}
+
+	linkPreviewQueue = make(chan linkPreviewJob, linkPreviewQueueSize)
+	for i := 0; i < linkPreviewWorkers; i++ {
+		go func() {
+			for job := range linkPreviewQueue {
+				u.unfurl(job)
+			}
+		}()
+	}
+}
+
+// enqueueLinkPreviews queues the links of a new message for previewing.
+// Messages are skipped rather than blocking the sender when the queue is full.
+func enqueueLinkPreviews(message *models.Message) {
+	if linkPreviewQueue == nil || len(message.Entities) == 0 {
+		return
+	}
+
+	var entities []models.MessageEntity
+	if err := json.Unmarshal(message.Entities, &entities); err != nil {
+		return
+	}
+	var urls []string
+	seen := make(map[string]bool)
+	for _, entity := range entities {
+		if entity.Type != "link" || len(urls) == linkPreviewMaxLinks {
+			continue
+		}
+		target, err := url.Parse(entity.URL)
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") {
+			continue
+		}
+		target.Fragment = ""
+		if key := target.String(); !seen[key] {
+			seen[key] = true
+			urls = append(urls, key)
+		}
+	}
+	if len(urls) == 0 {
+		return
+	}
+
+	select {
+	case linkPreviewQueue <- linkPreviewJob{messageID: message.ID, urls: urls}:
+	default:
+		log.Printf("Link preview queue full, skipping message %s", message.UUID)
+	}
+}
+
+// unfurl previews the links of one message and stores them on it
+func (u *linkUnfurler) unfurl(job linkPreviewJob) {
+	var previews []models.LinkPreview
+	for _, target := range job.urls {
+		preview, err := u.preview(target)
+		if err != nil {
+			log.Printf("Error previewing %s: %v", target, err)
+			continue
+		}
+		if preview != nil {
+			previews = append(previews, *preview)
+		}
+	}
+	if len(previews) == 0 {
+		return
+	}
+
+	data, err := json.Marshal(previews)
+	if err != nil {
+		log.Printf("Error encoding link previews for message %d: %v", job.messageID, err)
+		return
+	}
+	// Messages deleted in the meantime are skipped by the soft-delete scope
+	result := u.db.Model(&models.Message{}).Where("id = ?", job.messageID).Update("link_previews", data)
+	if result.Error != nil {
+		log.Printf("Error storing link previews for message %d: %v", job.messageID, result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		return
+	}
+
+	var message models.Message
+	if err := preloadMessageAssociations(u.db).First(&message, job.messageID).Error; err != nil {
+		log.Printf("Error loading message %d after link preview: %v", job.messageID, err)
+		return
+	}
+	if u.onUpdate != nil {
+		u.onUpdate(&message)
+	}
+	emitWebhookEvent(message.RoomID, models.WebhookEventMessageUpdated, map[string]interface{}{"message": webhookEventMessage(&message)})
+}
+
+// preview returns the preview of a URL from the cache, fetching it when the
+// cached copy is missing or stale. Pages without metadata return nil.
+func (u *linkUnfurler) preview(target string) (*models.LinkPreview, error) {
+	var cached models.LinkPreview
+	err := u.db.Where("url = ?", target).First(&cached).Error
+	if err == nil {
+		ttl := u.cacheTTL
+		if cached.Failed && ttl > linkPreviewFailureTTL {
+			ttl = linkPreviewFailureTTL
+		}
+		if time.Since(cached.FetchedAt) < ttl {
+			if cached.Failed {
+				return nil, nil
+			}
+			return &cached, nil
+		}
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	preview, fetchErr := u.fetch(target)
+	if fetchErr != nil {
+		// Failures are cached too, so a dead link is not fetched for every message
+		log.Printf("No link preview for %s: %v", target, fetchErr)
+		preview = &models.LinkPreview{URL: target, Failed: true}
+	}
+	preview.FetchedAt = time.Now()
+
+	if err := u.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "url"}},
+		DoUpdates: clause.AssignmentColumns([]string{"title", "description", "image_url", "site_name", "failed", "fetched_at"}),
+	}).Create(preview).Error; err != nil {
+		return nil, fmt.Errorf("failed to cache link preview: %w", err)
+	}
+	if preview.Failed {
+		return nil, nil
+	}
+	return preview, nil
+}
+
+// fetch downloads a page and extracts its preview metadata
+func (u *linkUnfurler) fetch(target string) (*models.LinkPreview, error) {
+	if _, err := validateOutboundURL(target); err != nil {
+		return nil, err
+	}
+	resp, err := u.get(target, "text/html,application/xhtml+xml")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, fmt.Errorf("not an HTML page (%s)", mediaType)
+	}
+
+	meta := parseLinkMetadata(io.LimitReader(resp.Body, linkPreviewMaxPageBytes), resp.Request.URL)
+	if meta.oEmbedURL != "" && (meta.preview.Title == "" || meta.preview.ImageURL == "") {
+		if err := u.applyOEmbed(&meta); err != nil {
+			log.Printf("Error fetching oEmbed for %s: %v", target, err)
+		}
+	}
+
+	preview := meta.preview
+	preview.URL = target
+	preview.Title = truncateRunes(preview.Title, linkPreviewTitleLimit)
+	preview.Description = truncateRunes(preview.Description, linkPreviewDescriptionLimit)
+	preview.SiteName = truncateRunes(preview.SiteName, linkPreviewTitleLimit)
+	if preview.Title == "" && preview.Description == "" {
+		return nil, errNoLinkMetadata
+	}
+	return &preview, nil
+}
+
+// get sends a GET request and checks for a successful response
+func (u *linkUnfurler) get(target, accept string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", linkPreviewUserAgent)
+	req.Header.Set("Accept", accept)
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// applyOEmbed fills in what the page's own tags left out from its oEmbed endpoint
+func (u *linkUnfurler) applyOEmbed(meta *linkMetadata) error {
+	if _, err := validateOutboundURL(meta.oEmbedURL); err != nil {
+		return err
+	}
+	resp, err := u.get(meta.oEmbedURL, "application/json")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var oembed struct {
+		Title        string `json:"title"`
+		AuthorName   string `json:"author_name"`
+		ProviderName string `json:"provider_name"`
+		ThumbnailURL string `json:"thumbnail_url"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, linkPreviewMaxOEmbedBytes)).Decode(&oembed); err != nil {
+		return fmt.Errorf("invalid oEmbed response: %w", err)
+	}
+
+	p := &meta.preview
+	if p.Title == "" {
+		p.Title = cleanText(oembed.Title)
+	}
+	if p.Description == "" && oembed.AuthorName != "" {
+		p.Description = cleanText(oembed.AuthorName)
+	}
+	if p.SiteName == "" {
+		p.SiteName = cleanText(oembed.ProviderName)
+	}
+	if p.ImageURL == "" {
+		p.ImageURL = resolvePreviewURL(meta.base, oembed.ThumbnailURL)
+	}
+	return nil
+}
+
+// linkMetadata is what parseLinkMetadata found in a page
+type linkMetadata struct {
+	preview   models.LinkPreview
+	oEmbedURL string
+	base      *url.URL
+}
+
+// parseLinkMetadata reads OpenGraph, Twitter card and plain HTML metadata from
+// the head of a page. OpenGraph values win over the others.
+func parseLinkMetadata(r io.Reader, base *url.URL) linkMetadata {
+	meta := linkMetadata{base: base}
+	values := make(map[string]string)
+	set := func(key, value string) {
+		if _, ok := values[key]; !ok && strings.TrimSpace(value) != "" {
+			values[key] = value
+		}
+	}
+
+	tokenizer := html.NewTokenizer(r)
+	inTitle := false
+	for done := false; !done; {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			done = true
+		case html.TextToken:
+			if inTitle {
+				set("title", string(tokenizer.Text()))
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "head":
+				done = true
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tokenizer.TagName()
+			attrs := make(map[string]string)
+			for hasAttr {
+				var key, value []byte
+				key, value, hasAttr = tokenizer.TagAttr()
+				attrs[string(key)] = string(value)
+			}
+			switch string(name) {
+			case "title":
+				inTitle = true
+			case "body":
+				done = true
+			case "meta":
+				key := attrs["property"]
+				if key == "" {
+					key = attrs["name"]
+				}
+				set(strings.ToLower(key), attrs["content"])
+			case "link":
+				if strings.EqualFold(attrs["type"], "application/json+oembed") && meta.oEmbedURL == "" {
+					meta.oEmbedURL = resolvePreviewURL(base, attrs["href"])
+				}
+			}
+		}
+	}
+
+	first := func(keys ...string) string {
+		for _, key := range keys {
+			if value := cleanText(values[key]); value != "" {
+				return value
+			}
+		}
+		return ""
+	}
+	meta.preview.Title = first("og:title", "twitter:title", "title")
+	meta.preview.Description = first("og:description", "twitter:description", "description")
+	meta.preview.SiteName = first("og:site_name")
+	meta.preview.ImageURL = resolvePreviewURL(base, first("og:image:secure_url", "og:image", "og:image:url", "twitter:image", "twitter:image:src"))
+	return meta
+}
+
+// resolvePreviewURL resolves ref against the page URL, keeping only http(s) results
+func resolvePreviewURL(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ""
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+	return u.String()
+}
+
+// cleanText collapses whitespace in metadata values
+func cleanText(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// truncateRunes shortens s to at most limit characters, ending with an ellipsis when cut
+func truncateRunes(s string, limit int) string {
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	return string([]rune(s)[:limit-1]) + "…"
+}
@@ -0,0 +1,278 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github/sabt-dev/realtimeChat/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	_ "modernc.org/sqlite"
+)
+
+// previewSite serves the pages the link preview tests fetch and counts the
+// requests for each path
+type previewSite struct {
+	*httptest.Server
+	mu   sync.Mutex
+	hits map[string]int
+}
+
+func newPreviewSite(t *testing.T) *previewSite {
+	t.Helper()
+	site := &previewSite{hits: make(map[string]int)}
+
+	pages := map[string]string{
+		"/opengraph": `<!doctype html><html><head>
+			<title>Plain title</title>
+			<meta name="description" content="Plain description">
+			<meta property="og:title" content="  OpenGraph
+				title ">
+			<meta property="og:description" content="OpenGraph description">
+			<meta property="og:site_name" content="Example">
+			<meta property="og:image" content="/images/cover.png">
+			</head><body><meta property="og:title" content="Not in the head"></body></html>`,
+		"/twitter": `<html><head>
+			<meta name="twitter:title" content="Card title">
+			<meta name="twitter:image" content="https://cdn.example.com/card.jpg">
+			<meta name="description" content="Plain description">
+			</head></html>`,
+		"/plain": `<html><head><title>Just a title</title></head><body>Hello</body></html>`,
+		"/oembed": `<html><head>
+			<meta name="description" content="Page description">
+			<link rel="alternate" type="application/json+oembed" href="/oembed.json?url=video">
+			</head></html>`,
+		"/oembed-broken": `<html><head>
+			<title>Page title</title>
+			<link rel="alternate" type="application/json+oembed" href="/oembed-broken.json">
+			</head></html>`,
+		"/empty":      `<html><head></head><body><h1>No metadata</h1></body></html>`,
+		"/javascript": `<html><head><title>Script image</title><meta property="og:image" content="javascript:alert(1)"></head></html>`,
+	}
+
+	mux := http.NewServeMux()
+	for path, page := range pages {
+		page := page
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, page)
+		})
+	}
+	mux.HandleFunc("/oembed.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"type":"video","title":"Video title","author_name":"Someone","provider_name":"VideoSite","thumbnail_url":"/thumbs/1.jpg"}`)
+	})
+	mux.HandleFunc("/oembed-broken.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"title": `)
+	})
+	mux.HandleFunc("/huge-head", func(w http.ResponseWriter, r *http.Request) {
+		// The metadata comes after the part of the page that is read
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><head><script>"+strings.Repeat("x", linkPreviewMaxPageBytes)+"</script>")
+		fmt.Fprint(w, `<title>Too far down</title></head></html>`)
+	})
+	mux.HandleFunc("/huge-body", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><head><title>Long page</title></head><body>"+strings.Repeat("x", 4*linkPreviewMaxPageBytes)+"</body></html>")
+	})
+	mux.HandleFunc("/image.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		fmt.Fprint(w, "\x89PNG\r\n\x1a\n")
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/plain", http.StatusFound)
+	})
+	mux.HandleFunc("/missing", http.NotFound)
+
+	site.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		site.mu.Lock()
+		site.hits[r.URL.Path]++
+		site.mu.Unlock()
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(site.Close)
+	return site
+}
+
+func (s *previewSite) hitCount(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hits[path]
+}
+
+// newTestUnfurler returns an unfurler with an in-memory preview cache. The
+// test server listens on loopback, which outbound requests may only reach
+// with OUTBOUND_ALLOW_PRIVATE_NETWORKS.
+func newTestUnfurler(t *testing.T) *linkUnfurler {
+	t.Helper()
+	t.Setenv("OUTBOUND_ALLOW_PRIVATE_NETWORKS", "true")
+
+	db, err := gorm.Open(sqlite.Dialector{DriverName: "sqlite", DSN: "file::memory:"}, &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(&models.LinkPreview{}); err != nil {
+		t.Fatal(err)
+	}
+
+	return &linkUnfurler{
+		db:       db,
+		client:   newOutboundHTTPClient(5*time.Second, linkPreviewMaxRedirects),
+		cacheTTL: 24 * time.Hour,
+	}
+}
+
+func TestLinkUnfurlerFetch(t *testing.T) {
+	site := newPreviewSite(t)
+	u := newTestUnfurler(t)
+
+	tests := []struct {
+		path    string
+		want    models.LinkPreview
+		wantErr bool
+	}{
+		{
+			path: "/opengraph",
+			want: models.LinkPreview{
+				Title:       "OpenGraph title",
+				Description: "OpenGraph description",
+				SiteName:    "Example",
+				ImageURL:    site.URL + "/images/cover.png",
+			},
+		},
+		{
+			path: "/twitter",
+			want: models.LinkPreview{Title: "Card title", Description: "Plain description", ImageURL: "https://cdn.example.com/card.jpg"},
+		},
+		{path: "/plain", want: models.LinkPreview{Title: "Just a title"}},
+		{path: "/redirect", want: models.LinkPreview{Title: "Just a title"}},
+		{
+			// The page lacks a title and an image, so they come from oEmbed
+			path: "/oembed",
+			want: models.LinkPreview{
+				Title:       "Video title",
+				Description: "Page description",
+				SiteName:    "VideoSite",
+				ImageURL:    site.URL + "/thumbs/1.jpg",
+			},
+		},
+		{path: "/oembed-broken", want: models.LinkPreview{Title: "Page title"}},
+		{path: "/javascript", want: models.LinkPreview{Title: "Script image"}},
+		{path: "/huge-body", want: models.LinkPreview{Title: "Long page"}},
+		{path: "/huge-head", wantErr: true},
+		{path: "/empty", wantErr: true},
+		{path: "/image.png", wantErr: true},
+		{path: "/missing", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			target := site.URL + tt.path
+			got, err := u.fetch(target)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("fetch(%s) = %+v, want an error", tt.path, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("fetch(%s) error = %v", tt.path, err)
+			}
+			tt.want.URL = target
+			if *got != tt.want {
+				t.Errorf("fetch(%s) = %+v, want %+v", tt.path, *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinkUnfurlerFetchLimits(t *testing.T) {
+	site := newPreviewSite(t)
+	u := newTestUnfurler(t)
+
+	if _, err := u.fetch("ftp://example.com/file"); err == nil {
+		t.Error("fetch() of a non-HTTP URL succeeded")
+	}
+
+	t.Setenv("OUTBOUND_ALLOW_PRIVATE_NETWORKS", "false")
+	if _, err := u.fetch(site.URL + "/plain"); err == nil {
+		t.Error("fetch() of a loopback address succeeded without OUTBOUND_ALLOW_PRIVATE_NETWORKS")
+	}
+	if hits := site.hitCount("/plain"); hits != 0 {
+		t.Errorf("the loopback page was requested %d times, want 0", hits)
+	}
+}
+
+func TestLinkUnfurlerPreviewCache(t *testing.T) {
+	site := newPreviewSite(t)
+	u := newTestUnfurler(t)
+
+	age := func(path string, by time.Duration) {
+		t.Helper()
+		if err := u.db.Model(&models.LinkPreview{}).Where("url = ?", site.URL+path).
+			Update("fetched_at", time.Now().Add(-by)).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		path        string
+		age         time.Duration // How long ago the first fetch happened
+		wantPreview bool
+		wantHits    int // Requests for the page after previewing it twice
+	}{
+		{name: "fresh preview is cached", path: "/plain", wantPreview: true, wantHits: 1},
+		{name: "stale preview is fetched again", path: "/opengraph", age: 25 * time.Hour, wantPreview: true, wantHits: 2},
+		{name: "failure is cached", path: "/missing", wantHits: 1},
+		{name: "failure without metadata is cached", path: "/empty", wantHits: 1},
+		{name: "failure is retried sooner than a preview", path: "/image.png", age: 2 * linkPreviewFailureTTL, wantHits: 2},
+		{name: "preview outlives the failure TTL", path: "/twitter", age: 2 * linkPreviewFailureTTL, wantPreview: true, wantHits: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := site.URL + tt.path
+			for attempt := 0; attempt < 2; attempt++ {
+				preview, err := u.preview(target)
+				if err != nil {
+					t.Fatalf("preview() error = %v", err)
+				}
+				if (preview != nil) != tt.wantPreview {
+					t.Fatalf("preview() = %+v, want a preview: %v", preview, tt.wantPreview)
+				}
+				if attempt == 0 && tt.age > 0 {
+					age(tt.path, tt.age)
+				}
+			}
+			if hits := site.hitCount(tt.path); hits != tt.wantHits {
+				t.Errorf("%s was requested %d times, want %d", tt.path, hits, tt.wantHits)
+			}
+
+			var cached models.LinkPreview
+			if err := u.db.Where("url = ?", target).First(&cached).Error; err != nil {
+				t.Fatalf("preview not cached: %v", err)
+			}
+			if cached.Failed == tt.wantPreview {
+				t.Errorf("cached preview Failed = %v, want %v", cached.Failed, !tt.wantPreview)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github/sabt-dev/realtimeChat/markdown"
+	"github/sabt-dev/realtimeChat/models"
+
+	"gorm.io/gorm"
+)
+
+// MaxMessageLength is the most characters the text of a message may have
+const MaxMessageLength = 4000
+
+// ErrMessageTooLong is returned for message texts over MaxMessageLength
+var ErrMessageTooLong = fmt.Errorf("messages can be at most %d characters", MaxMessageLength)
+
+// checkMessageLength rejects message texts over MaxMessageLength
+func checkMessageLength(text string) error {
+	if utf8.RuneCountInString(text) > MaxMessageLength {
+		return ErrMessageTooLong
+	}
+	return nil
+}
+
+// formatsText reports whether messages of msgType carry user-written Markdown
+func formatsText(msgType string) bool {
+	return msgType == "message" || msgType == "emote" || msgType == "media"
+}
+
+// renderMessageText stores the sanitized HTML rendering and the entities of a
+// message's text on it. Mentions are linked to a user when exactly one user has
+// that name (case-insensitive).
+func renderMessageText(db *gorm.DB, message *models.Message) error {
+	message.HTML, message.Entities = "", nil
+	if !formatsText(message.Type) || strings.TrimSpace(message.Text) == "" {
+		return nil
+	}
+
+	result := markdown.Render(message.Text)
+	message.HTML = result.HTML
+	if len(result.Entities) == 0 {
+		return nil
+	}
+
+	if err := resolveMentions(db, result.Entities); err != nil {
+		return err
+	}
+	entities, err := json.Marshal(result.Entities)
+	if err != nil {
+		return fmt.Errorf("failed to encode message entities: %w", err)
+	}
+	message.Entities = entities
+	return nil
+}
+
+// resolveMentions sets the user ID of mention entities whose name is unambiguous
+func resolveMentions(db *gorm.DB, entities []models.MessageEntity) error {
+	var names []string
+	for _, entity := range entities {
+		if entity.Type == "mention" {
+			names = append(names, strings.ToLower(entity.Username))
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	var users []models.User
+	if err := db.Select("id", "name").Where("LOWER(name) IN ?", names).Find(&users).Error; err != nil {
+		return fmt.Errorf("failed to resolve mentions: %w", err)
+	}
+
+	ids := make(map[string]uint)
+	ambiguous := make(map[string]bool)
+	for _, user := range users {
+		name := strings.ToLower(user.Name)
+		if _, seen := ids[name]; seen {
+			ambiguous[name] = true
+		}
+		ids[name] = user.ID
+	}
+
+	for k := range entities {
+		name := strings.ToLower(entities[k].Username)
+		if id, ok := ids[name]; ok && entities[k].Type == "mention" && !ambiguous[name] {
+			entities[k].UserID = uintPtr(id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenDestination is returned when an outbound request targets a
+// non-public address
+var ErrForbiddenDestination = errors.New("destination address is not allowed")
+
+// carrierGradeNAT (100.64.0.0/10) is shared address space that netip does not class as private
+var carrierGradeNAT = netip.MustParsePrefix("100.64.0.0/10")
+
+// allowPrivateNetworks reports whether outbound requests may reach private
+// addresses, for local development against services on the same machine
+func allowPrivateNetworks() bool {
+	return os.Getenv("OUTBOUND_ALLOW_PRIVATE_NETWORKS") == "true"
+}
+
+// isPublicAddress reports whether ip is a globally routable unicast address
+func isPublicAddress(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !carrierGradeNAT.Contains(ip)
+}
+
+// validateOutboundURL checks that a user-supplied URL is an absolute http(s) URL
+func validateOutboundURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return nil, fmt.Errorf("url must be an absolute http or https url")
+	}
+	if u.User != nil {
+		return nil, fmt.Errorf("url must not contain credentials")
+	}
+	// Literal addresses can be rejected up front; hostnames are checked when dialing
+	if ip, err := netip.ParseAddr(u.Hostname()); err == nil && !allowPrivateNetworks() && !isPublicAddress(ip) {
+		return nil, ErrForbiddenDestination
+	}
+	return u, nil
+}
+
+// newOutboundHTTPClient returns a client for requests to user-supplied URLs.
+// The destination is checked after DNS resolution, on every connection
+// including redirects, so hostnames cannot point it at internal services.
+func newOutboundHTTPClient(timeout time.Duration, maxRedirects int) *http.Client {
+	allowPrivate := allowPrivateNetworks()
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if allowPrivate {
+				return nil
+			}
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !isPublicAddress(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s", ErrForbiddenDestination, addrPort.Addr())
+			}
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:                 nil, // A proxy would hide the real destination from the check above
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   5 * time.Second,
+			ResponseHeaderTimeout: timeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return http.ErrUseLastResponse
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
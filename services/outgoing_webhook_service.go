@@ -0,0 +1,556 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github/sabt-dev/realtimeChat/database"
+	"github/sabt-dev/realtimeChat/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Outgoing webhook delivery settings
+const (
+	outgoingWebhookSecretPrefix  = "whsec_"
+	maxOutgoingWebhooksPerRoom   = 10
+	webhookDeliveryTimeout       = 10 * time.Second
+	webhookDispatchBatchSize     = 50
+	webhookDispatchConcurrency   = 4
+	webhookResponseBodyLimit     = 4 << 10
+	webhookDeliveryLeaseDuration = 2 * webhookDeliveryTimeout // A crashed attempt is retried once its lease runs out
+)
+
+// webhookDispatchWake nudges the dispatcher when new deliveries are queued
+var webhookDispatchWake = make(chan struct{}, 1)
+
+// OutgoingWebhookService handles outgoing webhooks and their delivery outbox
+type OutgoingWebhookService struct {
+	db       *gorm.DB
+	clientIP string // Recorded in audit entries
+}
+
+// NewOutgoingWebhookService creates a new OutgoingWebhookService
+func NewOutgoingWebhookService() *OutgoingWebhookService {
+	return &OutgoingWebhookService{db: database.GetDB()}
+}
+
+// WithClientIP returns a copy of the service that records ip in its audit entries
+func (s *OutgoingWebhookService) WithClientIP(ip string) *OutgoingWebhookService {
+	return &OutgoingWebhookService{db: s.db, clientIP: ip}
+}
+
+// CreateOutgoingWebhook registers an endpoint for a room's events (room creator only).
+// No events means all of them. The returned signing secret is only available now.
+func (s *OutgoingWebhookService) CreateOutgoingWebhook(roomID uint, rawURL string, events []string, userID uint) (*models.OutgoingWebhook, string, error) {
+	if err := requireRoomCreator(roomID, userID, "manage webhooks"); err != nil {
+		return nil, "", err
+	}
+	u, err := validateOutboundURL(strings.TrimSpace(rawURL))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(events) == 0 {
+		events = models.WebhookEventTypes
+	}
+	for _, event := range events {
+		if !isWebhookEventType(event) {
+			return nil, "", fmt.Errorf("unknown event type %q", event)
+		}
+	}
+
+	var count int64
+	if err := s.db.Model(&models.OutgoingWebhook{}).Where("room_id = ?", roomID).Count(&count).Error; err != nil {
+		return nil, "", err
+	}
+	if count >= maxOutgoingWebhooksPerRoom {
+		return nil, "", fmt.Errorf("a room can have at most %d outgoing webhooks", maxOutgoingWebhooksPerRoom)
+	}
+
+	secret, err := newSecretToken(outgoingWebhookSecretPrefix)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+
+	tx := s.db.Begin()
+	if tx.Error != nil {
+		return nil, "", tx.Error
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	webhook := models.OutgoingWebhook{
+		RoomID:      roomID,
+		URL:         u.String(),
+		Events:      strings.Join(events, ","),
+		Secret:      secret,
+		CreatedByID: userID,
+	}
+	if err := tx.Create(&webhook).Error; err != nil {
+		tx.Rollback()
+		return nil, "", err
+	}
+	if err := recordAudit(tx, AuditEntry{
+		ActorID:    uintPtr(userID),
+		Action:     "webhook.create",
+		TargetType: "webhook",
+		TargetID:   fmt.Sprint(webhook.ID),
+		RoomID:     uintPtr(roomID),
+		Metadata:   map[string]interface{}{"direction": "outgoing", "url": webhook.URL, "events": events},
+		IP:         s.clientIP,
+	}); err != nil {
+		tx.Rollback()
+		return nil, "", err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, "", err
+	}
+	return &webhook, secret, nil
+}
+
+func isWebhookEventType(event string) bool {
+	for _, t := range models.WebhookEventTypes {
+		if t == event {
+			return true
+		}
+	}
+	return false
+}
+
+// GetOutgoingWebhooks lists a room's outgoing webhooks (room creator only)
+func (s *OutgoingWebhookService) GetOutgoingWebhooks(roomID, userID uint) ([]models.OutgoingWebhook, error) {
+	if err := requireRoomCreator(roomID, userID, "manage webhooks"); err != nil {
+		return nil, err
+	}
+	var webhooks []models.OutgoingWebhook
+	err := s.db.Where("room_id = ?", roomID).Order("created_at ASC").Find(&webhooks).Error
+	return webhooks, err
+}
+
+// DeleteOutgoingWebhook deletes an outgoing webhook along with its queued
+// deliveries and delivery log (room creator only)
+func (s *OutgoingWebhookService) DeleteOutgoingWebhook(roomID, webhookID, userID uint) error {
+	if err := requireRoomCreator(roomID, userID, "manage webhooks"); err != nil {
+		return err
+	}
+
+	tx := s.db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	result := tx.Where("id = ? AND room_id = ?", webhookID, roomID).Delete(&models.OutgoingWebhook{})
+	if result.Error != nil {
+		tx.Rollback()
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return fmt.Errorf("webhook not found")
+	}
+	if err := removeWebhookDeliveries(tx, "webhook_id = ?", webhookID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := recordAudit(tx, AuditEntry{
+		ActorID:    uintPtr(userID),
+		Action:     "webhook.delete",
+		TargetType: "webhook",
+		TargetID:   fmt.Sprint(webhookID),
+		RoomID:     uintPtr(roomID),
+		Metadata:   map[string]interface{}{"direction": "outgoing"},
+		IP:         s.clientIP,
+	}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// removeWebhookDeliveries deletes the deliveries matching the query and their attempt log
+func removeWebhookDeliveries(tx *gorm.DB, query string, args ...interface{}) error {
+	if err := tx.Where("delivery_id IN (?)", tx.Model(&models.WebhookDelivery{}).Select("id").Where(query, args...)).
+		Delete(&models.WebhookDeliveryAttempt{}).Error; err != nil {
+		return fmt.Errorf("failed to delete webhook delivery attempts: %w", err)
+	}
+	if err := tx.Where(query, args...).Delete(&models.WebhookDelivery{}).Error; err != nil {
+		return fmt.Errorf("failed to delete webhook deliveries: %w", err)
+	}
+	return nil
+}
+
+// getRoomWebhook loads a room's outgoing webhook for its creator
+func (s *OutgoingWebhookService) getRoomWebhook(roomID, webhookID, userID uint) (*models.OutgoingWebhook, error) {
+	if err := requireRoomCreator(roomID, userID, "manage webhooks"); err != nil {
+		return nil, err
+	}
+	var webhook models.OutgoingWebhook
+	if err := s.db.Where("id = ? AND room_id = ?", webhookID, roomID).First(&webhook).Error; err != nil {
+		return nil, fmt.Errorf("webhook not found: %w", err)
+	}
+	return &webhook, nil
+}
+
+// GetDeliveries returns a webhook's delivery log, newest first, with each
+// delivery's attempts (room creator only). status optionally filters by state.
+func (s *OutgoingWebhookService) GetDeliveries(roomID, webhookID, userID uint, status string, limit, offset int) ([]models.WebhookDelivery, int64, error) {
+	webhook, err := s.getRoomWebhook(roomID, webhookID, userID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	query := func() *gorm.DB {
+		q := s.db.Model(&models.WebhookDelivery{}).Where("webhook_id = ?", webhook.ID)
+		if status != "" {
+			q = q.Where("status = ?", status)
+		}
+		return q
+	}
+
+	var total int64
+	if err := query().Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var deliveries []models.WebhookDelivery
+	err = query().Preload("AttemptLog", func(db *gorm.DB) *gorm.DB { return db.Order("attempt ASC") }).
+		Order("id DESC").Limit(limit).Offset(offset).Find(&deliveries).Error
+	return deliveries, total, err
+}
+
+// RetryDelivery queues a dead or delivered delivery again with a fresh set of attempts (room creator only)
+func (s *OutgoingWebhookService) RetryDelivery(roomID, webhookID, deliveryID, userID uint) error {
+	webhook, err := s.getRoomWebhook(roomID, webhookID, userID)
+	if err != nil {
+		return err
+	}
+	result := s.db.Model(&models.WebhookDelivery{}).
+		Where("id = ? AND webhook_id = ? AND status <> ?", deliveryID, webhook.ID, models.WebhookDeliveryPending).
+		Updates(map[string]interface{}{
+			"status":          models.WebhookDeliveryPending,
+			"attempts":        0,
+			"next_attempt_at": time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("delivery not found or already pending")
+	}
+	wakeWebhookDispatcher()
+	return nil
+}
+
+// emitWebhookEvent queues an event for every outgoing webhook of the room that
+// subscribes to it. Failures are only logged; they never affect the chat action.
+func emitWebhookEvent(roomID uint, eventType string, data map[string]interface{}) {
+	db := database.GetDB()
+
+	var webhooks []models.OutgoingWebhook
+	if err := db.Where("room_id = ?", roomID).Find(&webhooks).Error; err != nil {
+		log.Printf("Error loading outgoing webhooks for room %d: %v", roomID, err)
+		return
+	}
+	var subscribed []models.OutgoingWebhook
+	for _, webhook := range webhooks {
+		for _, event := range strings.Split(webhook.Events, ",") {
+			if event == eventType {
+				subscribed = append(subscribed, webhook)
+				break
+			}
+		}
+	}
+	if len(subscribed) == 0 {
+		return
+	}
+
+	var room models.Room
+	if err := db.First(&room, roomID).Error; err != nil {
+		log.Printf("Error loading room %d for webhook event: %v", roomID, err)
+		return
+	}
+
+	event := models.WebhookEvent{
+		ID:        uuid.New().String(),
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		Room:      models.WebhookEventRoom{ID: room.ID, Name: room.Name},
+		Data:      data,
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error encoding webhook event %s: %v", eventType, err)
+		return
+	}
+
+	deliveries := make([]models.WebhookDelivery, 0, len(subscribed))
+	for _, webhook := range subscribed {
+		deliveries = append(deliveries, models.WebhookDelivery{
+			WebhookID:     webhook.ID,
+			EventID:       event.ID,
+			EventType:     eventType,
+			Payload:       string(payload),
+			Status:        models.WebhookDeliveryPending,
+			NextAttemptAt: time.Now(),
+		})
+	}
+	if err := db.Create(&deliveries).Error; err != nil {
+		log.Printf("Error queueing webhook event %s: %v", eventType, err)
+		return
+	}
+	wakeWebhookDispatcher()
+}
+
+// webhookEventMessage describes a message in event data. Media URLs are
+// signed and absolute, as receivers have no session.
+func webhookEventMessage(message *models.Message) models.MessageResponse {
+	response := message.ToResponse()
+	response.MediaURL = externalMediaURL(response.MediaURL)
+	for i := range response.MediaThumbnails {
+		response.MediaThumbnails[i].URL = externalMediaURL(response.MediaThumbnails[i].URL)
+	}
+	return response
+}
+
+// webhookEventUser describes a user in event data
+func webhookEventUser(userID uint) map[string]interface{} {
+	var user models.User
+	if err := database.GetDB().First(&user, userID).Error; err != nil {
+		return map[string]interface{}{"id": userID}
+	}
+	return map[string]interface{}{"id": user.ID, "name": user.Name, "is_bot": user.IsBot}
+}
+
+func wakeWebhookDispatcher() {
+	select {
+	case webhookDispatchWake <- struct{}{}:
+	default:
+	}
+}
+
+// webhookRetryDelay is the exponential backoff before the given retry, with up to 20% jitter
+func webhookRetryDelay(attempt int, base, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+}
+
+// signWebhookPayload returns the hex HMAC-SHA256 of "<timestamp>.<payload>"
+func signWebhookPayload(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookDispatcher delivers due outbox entries
+type webhookDispatcher struct {
+	db          *gorm.DB
+	client      *http.Client
+	maxAttempts int
+	retryBase   time.Duration
+	retryMax    time.Duration
+}
+
+// StartWebhookDispatcher delivers queued outgoing webhook events in the
+// background, retrying failures with exponential backoff until
+// WEBHOOK_MAX_ATTEMPTS (default 8) is reached, after which a delivery is dead.
+// Finished deliveries are removed from the log after WEBHOOK_LOG_RETENTION (default 7 days).
+func StartWebhookDispatcher() {
+	d := &webhookDispatcher{
+		db:          database.GetDB(),
+		client:      newOutboundHTTPClient(webhookDeliveryTimeout, 0),
+		maxAttempts: getEnvInt("WEBHOOK_MAX_ATTEMPTS", 8),
+		retryBase:   getEnvDuration("WEBHOOK_RETRY_BASE", 30*time.Second),
+		retryMax:    getEnvDuration("WEBHOOK_RETRY_MAX", time.Hour),
+	}
+	if d.maxAttempts < 1 {
+		d.maxAttempts = 1
+	}
+	interval := getEnvDuration("WEBHOOK_DISPATCH_INTERVAL", 5*time.Second)
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	retention := getEnvDuration("WEBHOOK_LOG_RETENTION", 7*24*time.Hour)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		lastCleanup := time.Time{}
+
+		for {
+			d.dispatchDue()
+			if retention > 0 && time.Since(lastCleanup) > time.Hour {
+				d.purgeFinished(time.Now().Add(-retention))
+				lastCleanup = time.Now()
+			}
+			select {
+			case <-ticker.C:
+			case <-webhookDispatchWake:
+			}
+		}
+	}()
+}
+
+// dispatchDue sends every delivery that is due, a batch at a time
+func (d *webhookDispatcher) dispatchDue() {
+	for {
+		var due []models.WebhookDelivery
+		if err := d.db.Where("status = ? AND next_attempt_at <= ?", models.WebhookDeliveryPending, time.Now()).
+			Order("next_attempt_at ASC, id ASC").Limit(webhookDispatchBatchSize).Find(&due).Error; err != nil {
+			log.Printf("Error loading due webhook deliveries: %v", err)
+			return
+		}
+		if len(due) == 0 {
+			return
+		}
+
+		var wg sync.WaitGroup
+		slots := make(chan struct{}, webhookDispatchConcurrency)
+		for i := range due {
+			delivery := &due[i]
+			// Lease the delivery so a concurrent or crashed run does not send it twice at once
+			lease := d.db.Model(&models.WebhookDelivery{}).
+				Where("id = ? AND status = ? AND next_attempt_at <= ?", delivery.ID, models.WebhookDeliveryPending, time.Now()).
+				Update("next_attempt_at", time.Now().Add(webhookDeliveryLeaseDuration))
+			if lease.Error != nil || lease.RowsAffected == 0 {
+				continue
+			}
+
+			wg.Add(1)
+			slots <- struct{}{}
+			go func() {
+				defer func() {
+					<-slots
+					wg.Done()
+				}()
+				d.deliver(delivery)
+			}()
+		}
+		wg.Wait()
+
+		if len(due) < webhookDispatchBatchSize {
+			return
+		}
+	}
+}
+
+// deliver makes one attempt at a delivery and records the outcome
+func (d *webhookDispatcher) deliver(delivery *models.WebhookDelivery) {
+	var webhook models.OutgoingWebhook
+	if err := d.db.First(&webhook, delivery.WebhookID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			d.db.Model(delivery).Updates(map[string]interface{}{"status": models.WebhookDeliveryDead, "last_error": "webhook deleted"})
+		}
+		return
+	}
+
+	attempt := delivery.Attempts + 1
+	started := time.Now()
+	statusCode, sendErr := d.send(&webhook, delivery)
+
+	record := models.WebhookDeliveryAttempt{
+		DeliveryID: delivery.ID,
+		WebhookID:  webhook.ID,
+		Attempt:    attempt,
+		StatusCode: statusCode,
+		DurationMs: time.Since(started).Milliseconds(),
+	}
+	if sendErr != nil {
+		record.Error = sendErr.Error()
+	}
+	if err := d.db.Create(&record).Error; err != nil {
+		log.Printf("Error recording webhook attempt: %v", err)
+	}
+
+	updates := map[string]interface{}{
+		"attempts":         attempt,
+		"last_status_code": statusCode,
+		"last_error":       record.Error,
+	}
+	switch {
+	case sendErr == nil:
+		updates["status"] = models.WebhookDeliveryDelivered
+		updates["delivered_at"] = time.Now()
+	case attempt >= d.maxAttempts:
+		updates["status"] = models.WebhookDeliveryDead
+		log.Printf("Webhook delivery %d to %s is dead after %d attempts: %v", delivery.ID, webhook.URL, attempt, sendErr)
+	default:
+		updates["next_attempt_at"] = time.Now().Add(webhookRetryDelay(attempt, d.retryBase, d.retryMax))
+	}
+	if err := d.db.Model(delivery).Updates(updates).Error; err != nil {
+		log.Printf("Error updating webhook delivery %d: %v", delivery.ID, err)
+	}
+}
+
+// send POSTs the signed payload; any 2xx response counts as delivered
+func (d *webhookDispatcher) send(webhook *models.OutgoingWebhook, delivery *models.WebhookDelivery) (int, error) {
+	payload := []byte(delivery.Payload)
+	timestamp := time.Now().Unix()
+
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "realtimeChat-Webhooks/1.0")
+	req.Header.Set("X-Webhook-Event", delivery.EventType)
+	req.Header.Set("X-Webhook-Id", delivery.EventID)
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", "sha256="+signWebhookPayload(webhook.Secret, timestamp, payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, webhookResponseBodyLimit))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// purgeFinished removes delivered and dead deliveries last updated before the cutoff
+func (d *webhookDispatcher) purgeFinished(cutoff time.Time) {
+	err := removeWebhookDeliveries(d.db, "status IN ? AND updated_at < ?",
+		[]string{models.WebhookDeliveryDelivered, models.WebhookDeliveryDead}, cutoff)
+	if err != nil {
+		log.Printf("Error purging webhook delivery log: %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github/sabt-dev/realtimeChat/models"
+
+	"gorm.io/gorm"
+)
+
+// subscribeTestWebhook registers an outgoing webhook for every event of the room
+func subscribeTestWebhook(t *testing.T, db *gorm.DB, room *models.Room) {
+	t.Helper()
+	webhook := models.OutgoingWebhook{
+		RoomID:      room.ID,
+		URL:         "https://hooks.example.com/chat",
+		Events:      models.WebhookEventMemberJoined + "," + models.WebhookEventMemberLeft,
+		Secret:      "secret",
+		CreatedByID: *room.CreatorID,
+	}
+	if err := db.Create(&webhook).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// queuedMemberEvents returns the queued member events as "type:user ID"
+func queuedMemberEvents(t *testing.T, db *gorm.DB) []string {
+	t.Helper()
+	var deliveries []models.WebhookDelivery
+	if err := db.Order("id").Find(&deliveries).Error; err != nil {
+		t.Fatal(err)
+	}
+	var events []string
+	for _, d := range deliveries {
+		var event struct {
+			Data struct {
+				User struct {
+					ID uint `json:"id"`
+				} `json:"user"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(d.Payload), &event); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, fmt.Sprintf("%s:%d", d.EventType, event.Data.User.ID))
+	}
+	return events
+}
+
+func TestMemberEventsOnlyForMembershipChanges(t *testing.T) {
+	r := newModerationRoom(t, true)
+	db := NewRoomService().db
+	subscribeTestWebhook(t, db, r.room)
+	dave := createTestUser(t, db, "dave", false)
+	erin := createTestUser(t, db, "erin", false)
+	rooms := NewRoomService()
+
+	// Connecting and disconnecting toggle an existing membership
+	for i := 0; i < 2; i++ {
+		if err := rooms.JoinRoom(r.member.ID, r.room.ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := rooms.LeaveRoom(r.member.ID, r.room.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if events := queuedMemberEvents(t, db); len(events) != 0 {
+		t.Fatalf("reconnecting queued %v, want no member events", events)
+	}
+
+	// A first join is a new membership
+	if err := rooms.JoinRoom(dave.ID, r.room.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := rooms.LeaveRoom(dave.ID, r.room.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := rooms.JoinRoom(dave.ID, r.room.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	commands := NewCommandService()
+	if _, err := commands.Execute(&CommandContext{User: r.creator, Room: r.room, Name: "invite", Args: "@erin"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := commands.Execute(&CommandContext{User: r.creator, Room: r.room, Name: "kick", Args: "@bob"}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		fmt.Sprintf("%s:%d", models.WebhookEventMemberJoined, dave.ID),
+		fmt.Sprintf("%s:%d", models.WebhookEventMemberJoined, erin.ID),
+		fmt.Sprintf("%s:%d", models.WebhookEventMemberLeft, r.member.ID),
+	}
+	got := queuedMemberEvents(t, db)
+	if len(got) != len(want) {
+		t.Fatalf("queued %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %d = %s, want %s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestKickFromPublicRoomSendsNoMemberEvent(t *testing.T) {
+	r := newModerationRoom(t, false)
+	db := NewRoomService().db
+	subscribeTestWebhook(t, db, r.room)
+
+	if _, err := NewCommandService().Execute(&CommandContext{User: r.creator, Room: r.room, Name: "kick", Args: "@bob"}); err != nil {
+		t.Fatal(err)
+	}
+	if events := queuedMemberEvents(t, db); len(events) != 0 {
+		t.Errorf("kick from a public room queued %v, want none; the membership is kept", events)
+	}
+}
+
+func TestMessageEventsCarrySignedMediaURLs(t *testing.T) {
+	db := newTestDB(t)
+	initTestMediaSigning(t)
+	alice := createTestUser(t, db, "alice", false)
+	room := createTestRoom(t, db, "general", false, alice)
+	if err := db.Create(&models.OutgoingWebhook{
+		RoomID:      room.ID,
+		URL:         "https://hooks.example.com/chat",
+		Events:      models.WebhookEventMessageCreated,
+		Secret:      "secret",
+		CreatedByID: alice.ID,
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+	mediaURL := uploadTestBlob(t, db, alice, "0123abcd.png")
+
+	if _, err := NewMessageService().CreateMessage(alice.ID, room.ID, "", "media", mediaURL, "image", "cat.png", nil, "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	var delivery models.WebhookDelivery
+	if err := db.Where("event_type = ?", models.WebhookEventMessageCreated).First(&delivery).Error; err != nil {
+		t.Fatal(err)
+	}
+	var event struct {
+		Data struct {
+			Message models.MessageResponse `json:"message"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(delivery.Payload), &event); err != nil {
+		t.Fatal(err)
+	}
+	checkExternalMediaURL(t, event.Data.Message.MediaURL, "0123abcd.png")
+}
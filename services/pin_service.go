@@ -0,0 +1,219 @@
+package services
+
+import (
+	"fmt"
+
+	"github/sabt-dev/realtimeChat/database"
+	"github/sabt-dev/realtimeChat/models"
+
+	"gorm.io/gorm"
+)
+
+// maxPinsPerRoom caps how many messages a room can keep pinned
+const maxPinsPerRoom = 50
+
+// PinService handles pinned messages
+type PinService struct {
+	db       *gorm.DB
+	clientIP string // Recorded in audit entries
+}
+
+// NewPinService creates a new PinService
+func NewPinService() *PinService {
+	return &PinService{db: database.GetDB()}
+}
+
+// WithClientIP returns a copy of the service that records ip in its audit entries
+func (s *PinService) WithClientIP(ip string) *PinService {
+	return &PinService{db: s.db, clientIP: ip}
+}
+
+// PinMessage pins a message at the end of its room's pin list (moderators only).
+// Pinning an already pinned message is a no-op. Returns the message's room.
+func (s *PinService) PinMessage(uuid string, userID uint) (*models.Room, error) {
+	var message models.Message
+	if err := s.db.Preload("Room").Where("uuid = ?", uuid).First(&message).Error; err != nil {
+		return nil, fmt.Errorf("message not found: %w", err)
+	}
+	if message.Type != "message" && message.Type != "media" {
+		return nil, fmt.Errorf("only chat messages can be pinned")
+	}
+
+	isModerator, err := NewRoomService().IsRoomModerator(userID, message.RoomID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify moderator: %w", err)
+	}
+	if !isModerator {
+		return nil, fmt.Errorf("not authorized to pin messages in this room")
+	}
+
+	tx := s.db.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var count int64
+	if err := tx.Model(&models.PinnedMessage{}).Where("room_id = ? AND message_id = ?", message.RoomID, message.ID).Count(&count).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if count > 0 {
+		tx.Rollback()
+		return &message.Room, nil
+	}
+
+	var maxPosition struct {
+		Position int
+		Count    int64
+	}
+	if err := tx.Model(&models.PinnedMessage{}).
+		Select("COALESCE(MAX(position), 0) AS position, COUNT(*) AS count").
+		Where("room_id = ?", message.RoomID).
+		Scan(&maxPosition).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if maxPosition.Count >= maxPinsPerRoom {
+		tx.Rollback()
+		return nil, fmt.Errorf("a room can have at most %d pinned messages", maxPinsPerRoom)
+	}
+
+	pin := models.PinnedMessage{
+		RoomID:     message.RoomID,
+		MessageID:  message.ID,
+		PinnedByID: userID,
+		Position:   maxPosition.Position + 1,
+	}
+	if err := tx.Create(&pin).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to pin message: %w", err)
+	}
+
+	if err := recordAudit(tx, AuditEntry{
+		ActorID:    uintPtr(userID),
+		Action:     "message.pin",
+		TargetType: "message",
+		TargetID:   message.UUID,
+		RoomID:     uintPtr(message.RoomID),
+		IP:         s.clientIP,
+	}); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return &message.Room, nil
+}
+
+// UnpinMessage removes a message from its room's pin list (moderators only) and
+// closes the gap in the pin order. Returns the message's room.
+func (s *PinService) UnpinMessage(uuid string, userID uint) (*models.Room, error) {
+	var message models.Message
+	if err := s.db.Unscoped().Preload("Room").Where("uuid = ?", uuid).First(&message).Error; err != nil {
+		return nil, fmt.Errorf("message not found: %w", err)
+	}
+
+	isModerator, err := NewRoomService().IsRoomModerator(userID, message.RoomID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify moderator: %w", err)
+	}
+	if !isModerator {
+		return nil, fmt.Errorf("not authorized to unpin messages in this room")
+	}
+
+	tx := s.db.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var pin models.PinnedMessage
+	if err := tx.Where("room_id = ? AND message_id = ?", message.RoomID, message.ID).First(&pin).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("message is not pinned: %w", err)
+	}
+
+	if err := removePins(tx, "id = ?", pin.ID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := recordAudit(tx, AuditEntry{
+		ActorID:    uintPtr(userID),
+		Action:     "message.unpin",
+		TargetType: "message",
+		TargetID:   message.UUID,
+		RoomID:     uintPtr(message.RoomID),
+		IP:         s.clientIP,
+	}); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return &message.Room, nil
+}
+
+// IsMessagePinned checks if the message with the given UUID is pinned
+func (s *PinService) IsMessagePinned(uuid string) (bool, error) {
+	var count int64
+	err := s.db.Model(&models.PinnedMessage{}).
+		Joins("JOIN messages ON messages.id = pinned_messages.message_id").
+		Where("messages.uuid = ?", uuid).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// GetRoomPins returns the pinned messages of a room in pin order
+func (s *PinService) GetRoomPins(roomID uint) ([]models.PinnedMessage, error) {
+	var pins []models.PinnedMessage
+	err := preloadNestedMessageAssociations(s.db.Preload("PinnedBy").Preload("Message"), "Message.").
+		Where("room_id = ?", roomID).
+		Order("position ASC").
+		Find(&pins).Error
+	return pins, err
+}
+
+// removePins deletes the pins matching the condition and renumbers the remaining
+// pins of each affected room so positions stay contiguous
+func removePins(tx *gorm.DB, query string, args ...interface{}) error {
+	var roomIDs []uint
+	if err := tx.Model(&models.PinnedMessage{}).Where(query, args...).Distinct().Pluck("room_id", &roomIDs).Error; err != nil {
+		return err
+	}
+	if len(roomIDs) == 0 {
+		return nil
+	}
+
+	if err := tx.Where(query, args...).Delete(&models.PinnedMessage{}).Error; err != nil {
+		return fmt.Errorf("failed to remove pins: %w", err)
+	}
+
+	for _, roomID := range roomIDs {
+		var remaining []models.PinnedMessage
+		if err := tx.Where("room_id = ?", roomID).Order("position ASC").Find(&remaining).Error; err != nil {
+			return err
+		}
+		for i, pin := range remaining {
+			if pin.Position != i+1 {
+				if err := tx.Model(&models.PinnedMessage{}).Where("id = ?", pin.ID).Update("position", i+1).Error; err != nil {
+					return fmt.Errorf("failed to reorder pins: %w", err)
+				}
+			}
+		}
+	}
+	return nil
+}
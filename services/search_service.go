@@ -0,0 +1,195 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	"github/sabt-dev/realtimeChat/database"
+	"github/sabt-dev/realtimeChat/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrSearchAccessDenied is returned when a search is restricted to a room the caller cannot access
+var ErrSearchAccessDenied = errors.New("access denied to this room")
+
+// ErrInvalidSearchCursor is returned for a malformed pagination cursor
+var ErrInvalidSearchCursor = errors.New("invalid cursor")
+
+// Snippet highlight markers; control characters cannot appear in a match, and are
+// swapped for <mark> tags after the snippet has been HTML-escaped
+const (
+	snippetMatchStart = "\x02"
+	snippetMatchEnd   = "\x03"
+)
+
+// SearchService handles full-text message search
+type SearchService struct {
+	db *gorm.DB
+}
+
+// NewSearchService creates a new SearchService
+func NewSearchService() *SearchService {
+	return &SearchService{db: database.GetDB()}
+}
+
+// searchHit is a matching message ID with its snippet, before associations are loaded
+type searchHit struct {
+	ID        uint
+	CreatedAt time.Time
+	Snippet   string
+}
+
+// SearchMessages runs a full-text search over the messages the user can access,
+// newest first. It returns the results and a cursor for the next page, which is
+// empty when there are no more results.
+func (s *SearchService) SearchMessages(userID uint, filter models.MessageSearchFilter, cursor string, limit int) ([]models.MessageSearchResult, string, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	match := buildMatchQuery(filter.Query)
+	if match == "" {
+		return nil, "", fmt.Errorf("search query is required")
+	}
+
+	query := s.db.Table("messages_fts").
+		Select("messages.id, messages.created_at, snippet(messages_fts, -1, ?, ?, '…', 16) AS snippet", snippetMatchStart, snippetMatchEnd).
+		Joins("JOIN messages ON messages.id = messages_fts.rowid").
+		Where("messages_fts MATCH ?", match).
+		Where("messages.deleted_at IS NULL AND messages.type IN ?", []string{"message", "media"}).
+		Where("messages.room_id IN (?)", NewRoomService().accessibleRoomIDs(userID))
+
+	if filter.RoomName != "" {
+		canAccess, err := NewRoomService().CanUserAccessRoom(userID, filter.RoomName)
+		if err != nil || !canAccess {
+			return nil, "", ErrSearchAccessDenied
+		}
+		query = query.Where("messages.room_id IN (?)", s.db.Model(&models.Room{}).Select("id").Where("name = ?", filter.RoomName))
+	}
+	if filter.Sender != "" {
+		query = query.Where("messages.sender_id IN (?)", s.db.Model(&models.User{}).Select("id").Where("name = ? COLLATE NOCASE", filter.Sender))
+	}
+	if filter.Since != nil {
+		query = query.Where("messages.created_at >= ?", *filter.Since)
+	}
+	if filter.Until != nil {
+		query = query.Where("messages.created_at < ?", *filter.Until)
+	}
+	if filter.HasMedia != nil {
+		if *filter.HasMedia {
+			query = query.Where("messages.media_url <> ''")
+		} else {
+			query = query.Where("(messages.media_url IS NULL OR messages.media_url = '')")
+		}
+	}
+
+	if cursor != "" {
+		cursorTime, cursorID, err := decodeSearchCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		query = query.Where("messages.created_at < ? OR (messages.created_at = ? AND messages.id < ?)", cursorTime, cursorTime, cursorID)
+	}
+
+	// Fetch one extra hit to know whether another page exists
+	var hits []searchHit
+	if err := query.Order("messages.created_at DESC, messages.id DESC").Limit(limit + 1).Scan(&hits).Error; err != nil {
+		return nil, "", fmt.Errorf("search failed: %w", err)
+	}
+
+	nextCursor := ""
+	if len(hits) > limit {
+		hits = hits[:limit]
+		last := hits[len(hits)-1]
+		nextCursor = encodeSearchCursor(last.CreatedAt, last.ID)
+	}
+	if len(hits) == 0 {
+		return []models.MessageSearchResult{}, "", nil
+	}
+
+	ids := make([]uint, 0, len(hits))
+	for _, hit := range hits {
+		ids = append(ids, hit.ID)
+	}
+	var messages []models.Message
+	if err := preloadMessageAssociations(s.db).Where("id IN ?", ids).Find(&messages).Error; err != nil {
+		return nil, "", err
+	}
+	byID := make(map[uint]*models.Message, len(messages))
+	for i := range messages {
+		byID[messages[i].ID] = &messages[i]
+	}
+
+	results := make([]models.MessageSearchResult, 0, len(hits))
+	for _, hit := range hits {
+		message, ok := byID[hit.ID]
+		if !ok {
+			continue
+		}
+		results = append(results, models.MessageSearchResult{
+			Message: message.ToResponse(),
+			Snippet: highlightSnippet(hit.Snippet),
+		})
+	}
+	return results, nextCursor, nil
+}
+
+// buildMatchQuery turns free text into an FTS5 query that matches all words,
+// quoting each one so user input cannot inject FTS5 syntax
+func buildMatchQuery(text string) string {
+	words := strings.Fields(text)
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		word = strings.ReplaceAll(word, `"`, "")
+		if word == "" {
+			continue
+		}
+		terms = append(terms, `"`+word+`"`)
+	}
+	if len(terms) == 0 {
+		return ""
+	}
+	// Let the last word match as a prefix so partially typed words still hit
+	terms[len(terms)-1] += "*"
+	return strings.Join(terms, " ")
+}
+
+// highlightSnippet HTML-escapes a raw FTS5 snippet and marks up its matches
+func highlightSnippet(snippet string) string {
+	escaped := html.EscapeString(snippet)
+	escaped = strings.ReplaceAll(escaped, snippetMatchStart, "<mark>")
+	return strings.ReplaceAll(escaped, snippetMatchEnd, "</mark>")
+}
+
+// encodeSearchCursor builds an opaque cursor pointing after the given message
+func encodeSearchCursor(createdAt time.Time, id uint) string {
+	raw := strconv.FormatInt(createdAt.UnixNano(), 10) + ":" + strconv.FormatUint(uint64(id), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeSearchCursor parses a cursor produced by encodeSearchCursor
+func decodeSearchCursor(cursor string) (time.Time, uint, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidSearchCursor
+	}
+	nanos, id, found := strings.Cut(string(raw), ":")
+	if !found {
+		return time.Time{}, 0, ErrInvalidSearchCursor
+	}
+	unixNano, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidSearchCursor
+	}
+	messageID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidSearchCursor
+	}
+	return time.Unix(0, unixNano), uint(messageID), nil
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// getEnvDuration reads a duration (e.g. "720h") from the environment, falling back to the default
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Warning: invalid duration %q for %s, using %s", value, key, defaultValue)
+		return defaultValue
+	}
+	return d
+}
+
+// getEnvInt reads an integer from the environment, falling back to the default
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Warning: invalid number %q for %s, using %d", value, key, defaultValue)
+		return defaultValue
+	}
+	return n
+}
+
+// StartTombstonePurger periodically hard-deletes message tombstones once they are older
+// than TOMBSTONE_RETENTION (default 30 days). A retention of 0 disables purging.
+func StartTombstonePurger() {
+	retention := getEnvDuration("TOMBSTONE_RETENTION", 30*24*time.Hour)
+	interval := getEnvDuration("TOMBSTONE_PURGE_INTERVAL", time.Hour)
+	if retention <= 0 {
+		log.Println("Tombstone purge disabled (TOMBSTONE_RETENTION=0)")
+		return
+	}
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			purged, err := NewMessageService().PurgeDeletedMessages(time.Now().Add(-retention))
+			if err != nil {
+				log.Printf("Error purging deleted messages: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d deleted messages older than %s", purged, retention)
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,261 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github/sabt-dev/realtimeChat/database"
+	"github/sabt-dev/realtimeChat/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// tusDir holds the partial files of resumable uploads. It is inside the
+// uploads directory but never served, since only top-level files are.
+var tusDir = filepath.Join("uploads", ".tus")
+
+var (
+	// ErrTusUploadNotFound is returned for resumable uploads that do not exist,
+	// have expired or belong to someone else
+	ErrTusUploadNotFound = errors.New("upload not found")
+	// ErrTusOffsetMismatch is returned when a chunk does not start where the upload ends
+	ErrTusOffsetMismatch = errors.New("upload offset does not match")
+	// ErrTusQuotaExceeded is returned when a user has too many unfinished
+	// uploads, or they would reserve too many bytes between them
+	ErrTusQuotaExceeded = errors.New("too many unfinished uploads")
+)
+
+// tusCreateMu makes checking a user's unfinished uploads and creating a new
+// one atomic, so concurrent requests cannot exceed the limits together
+var tusCreateMu sync.Mutex
+
+// tusLocks serialises the requests for each upload. A lock only exists while
+// requests hold or wait for it, so uploads leave nothing behind.
+var (
+	tusLocksMu sync.Mutex
+	tusLocks   = make(map[string]*tusLock)
+)
+
+type tusLock struct {
+	sync.Mutex
+	holders int // Requests holding or waiting for the lock
+}
+
+// LockUpload locks a resumable upload against concurrent requests and returns
+// the function that unlocks it
+func LockUpload(id string) func() {
+	tusLocksMu.Lock()
+	lock, ok := tusLocks[id]
+	if !ok {
+		lock = &tusLock{}
+		tusLocks[id] = lock
+	}
+	lock.holders++
+	tusLocksMu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		tusLocksMu.Lock()
+		if lock.holders--; lock.holders == 0 {
+			delete(tusLocks, id)
+		}
+		tusLocksMu.Unlock()
+	}
+}
+
+// TusService manages resumable uploads (tus protocol)
+type TusService struct {
+	db *gorm.DB
+}
+
+// NewTusService creates a new resumable upload service
+func NewTusService() *TusService {
+	return &TusService{db: database.GetDB()}
+}
+
+// tusUploadExpiry is how long a resumable upload is kept after its last chunk
+func tusUploadExpiry() time.Duration {
+	return getEnvDuration("TUS_UPLOAD_EXPIRY", 24*time.Hour)
+}
+
+// TusPartialPath returns the path of the partial file of a resumable upload
+func TusPartialPath(id string) string {
+	return filepath.Join(tusDir, id)
+}
+
+// tusUploadLimits returns how many unfinished uploads a user may have, from
+// TUS_MAX_ACTIVE_UPLOADS (default 5), and how many bytes they may reserve
+// between them, from TUS_MAX_RESERVED_BYTES (default 250MB)
+func tusUploadLimits() (int64, int64) {
+	return int64(getEnvInt("TUS_MAX_ACTIVE_UPLOADS", 5)), int64(getEnvInt("TUS_MAX_RESERVED_BYTES", 250<<20))
+}
+
+// CreateUpload registers a resumable upload and creates its empty partial
+// file, unless the user's unfinished uploads are already at their limits
+func (s *TusService) CreateUpload(uploaderID uint, length int64, fileName, fileType string) (*models.TusUpload, error) {
+	if err := os.MkdirAll(tusDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create upload directory: %w", err)
+	}
+
+	tusCreateMu.Lock()
+	defer tusCreateMu.Unlock()
+
+	var active struct {
+		Count    int64
+		Reserved int64
+	}
+	if err := s.db.Model(&models.TusUpload{}).
+		Select("COUNT(*) AS count, COALESCE(SUM(length), 0) AS reserved").
+		Where("uploader_id = ? AND upload_url = ? AND expires_at > ?", uploaderID, "", time.Now()).
+		Scan(&active).Error; err != nil {
+		return nil, fmt.Errorf("failed to count unfinished uploads: %w", err)
+	}
+	maxActive, maxReserved := tusUploadLimits()
+	if active.Count >= maxActive || active.Reserved+length > maxReserved {
+		return nil, ErrTusQuotaExceeded
+	}
+
+	upload := &models.TusUpload{
+		ID:         uuid.New().String(),
+		UploaderID: uploaderID,
+		Length:     length,
+		FileName:   fileName,
+		FileType:   fileType,
+		ExpiresAt:  time.Now().Add(tusUploadExpiry()),
+	}
+	file, err := os.Create(TusPartialPath(upload.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create partial file: %w", err)
+	}
+	file.Close()
+
+	if err := s.db.Create(upload).Error; err != nil {
+		os.Remove(TusPartialPath(upload.ID))
+		return nil, fmt.Errorf("failed to create upload: %w", err)
+	}
+	return upload, nil
+}
+
+// GetUpload returns a resumable upload of the given user
+func (s *TusService) GetUpload(id string, uploaderID uint) (*models.TusUpload, error) {
+	var upload models.TusUpload
+	err := s.db.Where("id = ? AND uploader_id = ? AND expires_at > ?", id, uploaderID, time.Now()).First(&upload).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTusUploadNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
+
+// WriteChunk appends data to a resumable upload, starting at offset, which
+// must be where the upload currently ends. Whatever arrives before the client
+// disconnects is kept, so the upload can resume from there. It returns the
+// upload with its new offset. The caller must hold the upload's lock.
+func (s *TusService) WriteChunk(id string, uploaderID uint, offset int64, data io.Reader) (*models.TusUpload, error) {
+	upload, err := s.GetUpload(id, uploaderID)
+	if err != nil {
+		return nil, err
+	}
+	if upload.UploadURL != "" || offset != upload.Offset {
+		return upload, ErrTusOffsetMismatch
+	}
+
+	file, err := os.OpenFile(TusPartialPath(id), os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open partial file: %w", err)
+	}
+	defer file.Close()
+	// Drop anything past the recorded offset left by an interrupted write
+	if err := file.Truncate(offset); err != nil {
+		return nil, fmt.Errorf("failed to truncate partial file: %w", err)
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek partial file: %w", err)
+	}
+
+	written, copyErr := io.Copy(file, io.LimitReader(data, upload.Length-offset))
+	if copyErr != nil {
+		log.Printf("Resumable upload %s interrupted after %d bytes: %v", id, written, copyErr)
+	}
+
+	upload.Offset += written
+	upload.ExpiresAt = time.Now().Add(tusUploadExpiry())
+	if err := s.db.Model(upload).Updates(map[string]interface{}{
+		"offset":     upload.Offset,
+		"expires_at": upload.ExpiresAt,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to update upload offset: %w", err)
+	}
+	return upload, nil
+}
+
+// CompleteUpload records the stored file a finished upload became and
+// removes its partial file. The upload itself is kept until it expires so
+// the client can still look up the result.
+func (s *TusService) CompleteUpload(upload *models.TusUpload, url string) error {
+	upload.UploadURL = url
+	if err := s.db.Model(upload).Update("upload_url", url).Error; err != nil {
+		return fmt.Errorf("failed to complete upload: %w", err)
+	}
+	removeTusPartialFile(upload.ID)
+	return nil
+}
+
+// DeleteUpload removes a resumable upload and its partial file
+func (s *TusService) DeleteUpload(upload *models.TusUpload) error {
+	if err := s.db.Delete(upload).Error; err != nil {
+		return fmt.Errorf("failed to delete upload: %w", err)
+	}
+	removeTusPartialFile(upload.ID)
+	return nil
+}
+
+// PurgeExpiredUploads removes resumable uploads that expired before the
+// given time, along with the partial files of those never finished
+func (s *TusService) PurgeExpiredUploads(before time.Time) (int, error) {
+	var uploads []models.TusUpload
+	if err := s.db.Where("expires_at <= ?", before).Find(&uploads).Error; err != nil {
+		return 0, fmt.Errorf("failed to find expired uploads: %w", err)
+	}
+	for i := range uploads {
+		if err := s.DeleteUpload(&uploads[i]); err != nil {
+			return i, err
+		}
+	}
+	return len(uploads), nil
+}
+
+func removeTusPartialFile(id string) {
+	if err := os.Remove(TusPartialPath(id)); err != nil && !os.IsNotExist(err) {
+		log.Printf("Error removing partial upload %s: %v", id, err)
+	}
+}
+
+// StartTusUploadSweeper periodically removes resumable uploads that have not
+// received a chunk for TUS_UPLOAD_EXPIRY (default 24 hours)
+func StartTusUploadSweeper() {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for {
+			purged, err := NewTusService().PurgeExpiredUploads(time.Now())
+			if err != nil {
+				log.Printf("Error purging expired uploads: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d expired resumable uploads", purged)
+			}
+			<-ticker.C
+		}
+	}()
+}
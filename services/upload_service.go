@@ -0,0 +1,487 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github/sabt-dev/realtimeChat/database"
+	"github/sabt-dev/realtimeChat/media"
+	"github/sabt-dev/realtimeChat/models"
+	"github/sabt-dev/realtimeChat/storage"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UploadService records files stored by the upload endpoint
+type UploadService struct {
+	db       *gorm.DB
+	clientIP string
+}
+
+// NewUploadService creates a new upload service
+func NewUploadService() *UploadService {
+	return &UploadService{db: database.GetDB()}
+}
+
+// WithClientIP returns a copy of the service that records ip in its audit entries
+func (s *UploadService) WithClientIP(ip string) *UploadService {
+	return &UploadService{db: s.db, clientIP: ip}
+}
+
+// StoreUpload stores the content of an uploaded file under its SHA-256 hash
+// and records the upload, with the thumbnails of an image or the waveform of
+// a voice recording. A file that is already stored is not stored again: the
+// upload takes a reference to the existing blob and shares its URL and
+// thumbnails.
+func (s *UploadService) StoreUpload(upload *models.Upload, content io.Reader, ext string, thumbnails []media.Thumbnail, waveform []int) error {
+	// The key is only known once the whole file has been read
+	spool, err := os.CreateTemp("", "upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}()
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(spool, hash), content); err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	key := sum + ext
+
+	if len(waveform) > 0 {
+		data, err := json.Marshal(waveform)
+		if err != nil {
+			return fmt.Errorf("failed to encode waveform: %w", err)
+		}
+		upload.Waveform = data
+	}
+
+	unlock := lockBlob(key)
+	defer unlock()
+
+	var blob models.Blob
+	var written []string
+	err = s.db.Where("key = ?", key).First(&blob).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		blob, written, err = putBlob(key, sum, spool, upload.ContentType, thumbnails)
+		if err != nil {
+			removeStoredFiles(written)
+			return err
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to look up blob: %w", err)
+	}
+
+	upload.URL = storage.MediaURLPrefix + key
+	upload.Size = blob.Size
+	upload.Thumbnails = blob.Thumbnails
+
+	tx := s.db.Begin()
+	if tx.Error != nil {
+		removeStoredFiles(written)
+		return tx.Error
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Another server sharing the store may have recorded the same blob meanwhile
+	if len(written) > 0 {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&blob).Error; err != nil {
+			tx.Rollback()
+			removeStoredFiles(written)
+			return fmt.Errorf("failed to record blob: %w", err)
+		}
+	}
+	if err := tx.Create(upload).Error; err != nil {
+		tx.Rollback()
+		removeStoredFiles(written)
+		return fmt.Errorf("failed to record upload: %w", err)
+	}
+	if err := tx.Create(&models.BlobReference{BlobKey: key, UploadID: &upload.ID}).Error; err != nil {
+		tx.Rollback()
+		removeStoredFiles(written)
+		return fmt.Errorf("failed to reference blob: %w", err)
+	}
+	if err := tx.Commit().Error; err != nil {
+		removeStoredFiles(written)
+		return err
+	}
+
+	if len(written) == 0 {
+		log.Printf("Upload %s matches stored blob %s", upload.FileName, key)
+	}
+	return nil
+}
+
+// putBlob writes a new blob and its thumbnails to storage. It returns the
+// blob to record and the keys written, which the caller removes on failure.
+func putBlob(key, sum string, content io.Reader, contentType string, thumbnails []media.Thumbnail) (models.Blob, []string, error) {
+	store := storage.GetStorage()
+	blob := models.Blob{Key: key}
+
+	size, err := store.Put(key, content, contentType)
+	if err != nil {
+		return blob, nil, fmt.Errorf("failed to store file: %w", err)
+	}
+	blob.Size = size
+	written := []string{key}
+
+	stored := make([]models.MediaThumbnail, 0, len(thumbnails))
+	for _, thumbnail := range thumbnails {
+		thumbnailKey := fmt.Sprintf("%s_%d%s", sum, thumbnail.Size, thumbnail.Ext)
+		thumbnailType, _ := media.StoredFileType(thumbnailKey)
+		if _, err := store.Put(thumbnailKey, bytes.NewReader(thumbnail.Data), thumbnailType.MIMEType); err != nil {
+			return blob, written, fmt.Errorf("failed to store thumbnail: %w", err)
+		}
+		written = append(written, thumbnailKey)
+		stored = append(stored, models.MediaThumbnail{
+			URL:    storage.MediaURLPrefix + thumbnailKey,
+			Width:  thumbnail.Width,
+			Height: thumbnail.Height,
+		})
+	}
+	if len(stored) > 0 {
+		data, err := json.Marshal(stored)
+		if err != nil {
+			return blob, written, fmt.Errorf("failed to encode thumbnails: %w", err)
+		}
+		blob.Thumbnails = data
+	}
+	return blob, written, nil
+}
+
+// removeStoredFiles cleans up files written for an upload that could not be recorded
+func removeStoredFiles(keys []string) {
+	for _, key := range keys {
+		if err := storage.GetStorage().Delete(key); err != nil {
+			log.Printf("Error removing %s: %v", key, err)
+		}
+	}
+}
+
+// GetUploadByURL finds the record of an uploaded file by the URL it is served at
+func (s *UploadService) GetUploadByURL(url string) (*models.Upload, error) {
+	var upload models.Upload
+	if err := s.db.Where("url = ?", url).First(&upload).Error; err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
+
+// ErrMediaNotUploaded is returned for media messages that use a stored file
+// their sender did not upload
+var ErrMediaNotUploaded = errors.New("media was not uploaded by the sender")
+
+// GetUserUpload finds the latest upload of a file by a user, by the URL it is served at
+func (s *UploadService) GetUserUpload(url string, uploaderID uint) (*models.Upload, error) {
+	var upload models.Upload
+	if err := s.db.Where("url = ? AND uploader_id = ?", url, uploaderID).Order("id DESC").First(&upload).Error; err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
+
+// likeEscaper escapes the LIKE wildcards of a value matched with ESCAPE '\'
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// CanUserAccessUpload reports whether a user may download a stored file or
+// thumbnail: they uploaded it, or it is attached to a message in a room they
+// can access
+func (s *UploadService) CanUserAccessUpload(userID uint, url string) (bool, error) {
+	// Thumbnails are only listed in the JSON of the upload and message they
+	// belong to. The JSON is stored as a blob, which LIKE only matches as text.
+	thumbnailPattern := `%"` + likeEscaper.Replace(url) + `"%`
+
+	var count int64
+	err := s.db.Model(&models.Upload{}).
+		Where("uploader_id = ? AND (url = ? OR CAST(thumbnails AS TEXT) LIKE ? ESCAPE '\\')", userID, url, thumbnailPattern).
+		Count(&count).Error
+	if err != nil || count > 0 {
+		return count > 0, err
+	}
+
+	err = s.db.Model(&models.Message{}).
+		Where("(media_url = ? OR CAST(media_thumbnails AS TEXT) LIKE ? ESCAPE '\\')", url, thumbnailPattern).
+		Where("room_id IN (?)", NewRoomService().accessibleRoomIDs(userID)).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// attachUploadDetails copies the details recorded for an uploaded file onto a
+// media message that uses it. The recorded media type replaces the one sent by
+// the client. Other URLs are left alone.
+func attachUploadDetails(db *gorm.DB, message *models.Message) error {
+	if message.Type != "media" || message.MediaURL == "" {
+		return nil
+	}
+
+	var upload models.Upload
+	err := db.Where("url = ?", message.MediaURL).First(&upload).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load upload details: %w", err)
+	}
+
+	if upload.MediaType != "" {
+		message.MediaType = upload.MediaType
+	}
+	message.MediaSize = upload.Size
+	message.MediaMimeType = upload.ContentType
+	message.MediaWidth = upload.Width
+	message.MediaHeight = upload.Height
+	message.MediaBlurhash = upload.Blurhash
+	message.MediaThumbnails = upload.Thumbnails
+	message.MediaDuration = upload.Duration
+	message.MediaWaveform = upload.Waveform
+	return nil
+}
+
+// blobLocks serialise storing, referencing and deleting blobs with the same
+// key, so a blob is never deleted while an identical upload takes a reference
+// to it. They are striped by the name a file shares with its thumbnails, and
+// must never be taken inside a transaction: holders may wait for the single
+// database connection.
+var blobLocks [64]sync.Mutex
+
+// lockBlob locks the blob stored under key, or the blob a thumbnail key
+// belongs to, and returns the unlock function
+func lockBlob(key string) func() {
+	if stem := strings.IndexAny(key, "_."); stem > 0 {
+		key = key[:stem]
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	lock := &blobLocks[hash.Sum32()%uint32(len(blobLocks))]
+	lock.Lock()
+	return lock.Unlock
+}
+
+// blobKeyOf returns the key of the blob a media URL points at, if it is one
+func blobKeyOf(db *gorm.DB, mediaURL string) (string, bool, error) {
+	key, ok := strings.CutPrefix(mediaURL, storage.MediaURLPrefix)
+	if !ok || !storage.ValidKey(key) {
+		return "", false, nil
+	}
+	var count int64
+	if err := db.Model(&models.Blob{}).Where("key = ?", key).Count(&count).Error; err != nil {
+		return "", false, fmt.Errorf("failed to look up blob: %w", err)
+	}
+	return key, count > 0, nil
+}
+
+// externalMediaURL turns the URL of a stored upload into a signed absolute
+// URL under BASE_URL, so webhook receivers and export readers can fetch the
+// file without a session until the signature expires. Other URLs are
+// returned unchanged.
+func externalMediaURL(mediaURL string) string {
+	key, ok := strings.CutPrefix(mediaURL, storage.MediaURLPrefix)
+	if !ok || !storage.ValidKey(key) {
+		return mediaURL
+	}
+	baseURL := os.Getenv("BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+	return strings.TrimRight(baseURL, "/") + storage.SignMediaURL(mediaURL)
+}
+
+// createMessageWithBlob inserts the message together with the reference a
+// media message holds on the blob it shows, so neither is stored without the
+// other. The blob is locked before the transaction starts.
+func createMessageWithBlob(db *gorm.DB, message *models.Message) error {
+	if key, ok := mediaBlobKey(message); ok {
+		unlock := lockBlob(key)
+		defer unlock()
+	}
+
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Create(message).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := referenceBlob(tx, message); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// mediaBlobKey returns the storage key a media message's URL points at, if any
+func mediaBlobKey(message *models.Message) (string, bool) {
+	if message.Type != "media" || message.MediaURL == "" {
+		return "", false
+	}
+	key, ok := strings.CutPrefix(message.MediaURL, storage.MediaURLPrefix)
+	if !ok || !storage.ValidKey(key) {
+		return "", false
+	}
+	return key, true
+}
+
+// referenceBlob makes a media message hold a reference to the blob it shows.
+// The reference the sender took by uploading the file is handed over if it
+// has not been sent yet; otherwise the message takes a reference of its own.
+// Other URLs are left alone. The caller holds the blob's lock.
+func referenceBlob(db *gorm.DB, message *models.Message) error {
+	key, ok := mediaBlobKey(message)
+	if !ok {
+		return nil
+	}
+
+	_, isBlob, err := blobKeyOf(db, message.MediaURL)
+	if err != nil || !isBlob {
+		return err
+	}
+
+	unsent := db.Model(&models.BlobReference{}).
+		Select("blob_references.id").
+		Joins("JOIN uploads ON uploads.id = blob_references.upload_id").
+		Where("blob_references.blob_key = ? AND uploads.uploader_id = ?", key, message.SenderID).
+		Limit(1)
+	result := db.Model(&models.BlobReference{}).
+		Where("id IN (?)", unsent).
+		Updates(map[string]interface{}{"message_id": message.ID, "upload_id": nil})
+	if result.Error != nil {
+		return fmt.Errorf("failed to hand over blob reference: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+	if err := db.Create(&models.BlobReference{BlobKey: key, MessageID: &message.ID}).Error; err != nil {
+		return fmt.Errorf("failed to reference blob: %w", err)
+	}
+	return nil
+}
+
+// releaseBlob drops the references a message holds on the blob at mediaURL.
+// It returns the blob's key, or false if the URL is not a blob. Once the
+// caller's transaction is committed, DeleteUnreferencedBlob removes the blob
+// if nothing references it anymore.
+func releaseBlob(db *gorm.DB, messageID uint, mediaURL string) (string, bool, error) {
+	key, isBlob, err := blobKeyOf(db, mediaURL)
+	if err != nil || !isBlob {
+		return "", false, err
+	}
+	if err := db.Where("blob_key = ? AND message_id = ?", key, messageID).Delete(&models.BlobReference{}).Error; err != nil {
+		return "", false, fmt.Errorf("failed to release blob: %w", err)
+	}
+	return key, true, nil
+}
+
+// DeleteUnreferencedBlob deletes a blob that nothing references anymore: its
+// file and thumbnails, and the records of the uploads that stored it
+func (s *UploadService) DeleteUnreferencedBlob(key string) error {
+	unlock := lockBlob(key)
+	defer unlock()
+
+	var blob models.Blob
+	err := s.db.Where("key = ?", key).First(&blob).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up blob: %w", err)
+	}
+	var references int64
+	if err := s.db.Model(&models.BlobReference{}).Where("blob_key = ?", key).Count(&references).Error; err != nil {
+		return fmt.Errorf("failed to count blob references: %w", err)
+	}
+	if references > 0 {
+		return nil
+	}
+
+	var thumbnails []models.MediaThumbnail
+	if len(blob.Thumbnails) > 0 {
+		if err := json.Unmarshal(blob.Thumbnails, &thumbnails); err != nil {
+			return fmt.Errorf("failed to decode thumbnails of %s: %w", key, err)
+		}
+	}
+
+	tx := s.db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+	if err := tx.Where("url = ?", storage.MediaURLPrefix+key).Delete(&models.Upload{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to remove upload records: %w", err)
+	}
+	if err := tx.Delete(&blob).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to remove blob: %w", err)
+	}
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+
+	keys := []string{key}
+	for _, thumbnail := range thumbnails {
+		keys = append(keys, strings.TrimPrefix(thumbnail.URL, storage.MediaURLPrefix))
+	}
+	removeStoredFiles(keys)
+	log.Printf("Deleted blob %s, no longer referenced", key)
+	return nil
+}
+
+// removeUploadRecord deletes the record of an uploaded file and returns the
+// URLs of its thumbnails so their files can be removed too
+func removeUploadRecord(db *gorm.DB, mediaURL string) ([]string, error) {
+	var upload models.Upload
+	err := db.Where("url = ?", mediaURL).First(&upload).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var thumbnails []models.MediaThumbnail
+	if len(upload.Thumbnails) > 0 {
+		if err := json.Unmarshal(upload.Thumbnails, &thumbnails); err != nil {
+			return nil, fmt.Errorf("failed to decode thumbnails of %s: %w", mediaURL, err)
+		}
+	}
+	if err := db.Delete(&upload).Error; err != nil {
+		return nil, err
+	}
+
+	urls := make([]string, 0, len(thumbnails))
+	for _, thumbnail := range thumbnails {
+		urls = append(urls, thumbnail.URL)
+	}
+	return urls, nil
+}
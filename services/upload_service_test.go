@@ -0,0 +1,115 @@
+package services
+
+import (
+	"net/url"
+	"testing"
+
+	"github/sabt-dev/realtimeChat/models"
+	"github/sabt-dev/realtimeChat/storage"
+
+	"gorm.io/gorm"
+)
+
+// uploadTestBlob records an upload of a stored blob by user, holding the upload's reference
+func uploadTestBlob(t *testing.T, db *gorm.DB, user *models.User, key string) string {
+	t.Helper()
+	url := storage.MediaURLPrefix + key
+	upload := models.Upload{URL: url, UploaderID: user.ID, FileName: "cat.png", ContentType: "image/png", MediaType: "image"}
+	if err := db.Create(&models.Blob{Key: key, Size: 3}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&upload).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&models.BlobReference{BlobKey: key, UploadID: &upload.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return url
+}
+
+func TestCreateMessageTakesOverBlobReference(t *testing.T) {
+	db := newTestDB(t)
+	alice := createTestUser(t, db, "alice", false)
+	room := createTestRoom(t, db, "general", false, alice)
+	url := uploadTestBlob(t, db, alice, "0123abcd.png")
+
+	message, err := NewMessageService().CreateMessage(alice.ID, room.ID, "", "media", url, "image", "cat.png", nil, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var refs []models.BlobReference
+	db.Where("blob_key = ?", "0123abcd.png").Find(&refs)
+	if len(refs) != 1 || refs[0].MessageID == nil || *refs[0].MessageID != message.ID || refs[0].UploadID != nil {
+		t.Errorf("references = %+v, want the upload's reference handed to message %d", refs, message.ID)
+	}
+
+	// Sending the file again takes a second reference
+	again, err := NewMessageService().CreateMessage(alice.ID, room.ID, "", "media", url, "image", "cat.png", nil, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	db.Model(&models.BlobReference{}).Where("blob_key = ? AND message_id = ?", "0123abcd.png", again.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("got %d references for the second message, want 1", count)
+	}
+}
+
+func TestCreateMessageIsNotStoredWithoutBlobReference(t *testing.T) {
+	db := newTestDB(t)
+	alice := createTestUser(t, db, "alice", false)
+	room := createTestRoom(t, db, "general", false, alice)
+	url := uploadTestBlob(t, db, alice, "0123abcd.png")
+
+	if err := db.Migrator().DropTable(&models.BlobReference{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewMessageService().CreateMessage(alice.ID, room.ID, "", "media", url, "image", "cat.png", nil, "", ""); err == nil {
+		t.Fatal("CreateMessage() succeeded without a blob reference")
+	}
+
+	var count int64
+	db.Unscoped().Model(&models.Message{}).Where("room_id = ?", room.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("got %d messages, want the message rolled back with its reference", count)
+	}
+}
+
+// initTestMediaSigning sets up URL signing with a fixed key and BASE_URL
+func initTestMediaSigning(t *testing.T) {
+	t.Helper()
+	t.Chdir(t.TempDir()) // Local storage creates its directory in the working directory
+	t.Setenv("STORAGE_BACKEND", "local")
+	t.Setenv("SESSION_SECRET", "test-secret")
+	t.Setenv("BASE_URL", "https://chat.example.com/")
+	if err := storage.InitStorage(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkExternalMediaURL fails unless got is a valid signed absolute URL of the upload stored under key
+func checkExternalMediaURL(t *testing.T, got, key string) {
+	t.Helper()
+	u, err := url.Parse(got)
+	if err != nil {
+		t.Fatalf("invalid media URL %q: %v", got, err)
+	}
+	if u.Scheme != "https" || u.Host != "chat.example.com" || u.Path != storage.MediaURLPrefix+key {
+		t.Errorf("media URL = %q, want https://chat.example.com%s%s", got, storage.MediaURLPrefix, key)
+	}
+	if !storage.VerifyMediaURL(key, u.Query().Get("expires"), u.Query().Get("signature")) {
+		t.Errorf("media URL %q is not validly signed", got)
+	}
+}
+
+func TestExternalMediaURL(t *testing.T) {
+	initTestMediaSigning(t)
+
+	checkExternalMediaURL(t, externalMediaURL("/uploads/0123abcd.png"), "0123abcd.png")
+	for _, unchanged := range []string{"", "https://files.example.com/a.png", "/uploads/../secret", "/static/logo.png"} {
+		if got := externalMediaURL(unchanged); got != unchanged {
+			t.Errorf("externalMediaURL(%q) = %q, want it unchanged", unchanged, got)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github/sabt-dev/realtimeChat/models"
+	"github/sabt-dev/realtimeChat/storage"
+
+	"gorm.io/gorm"
+)
+
+// uploadGracePeriod is how old a stored file must be before the sweeper may
+// remove it, from UPLOAD_GC_GRACE (default 24 hours)
+func uploadGracePeriod() time.Duration {
+	return getEnvDuration("UPLOAD_GC_GRACE", 24*time.Hour)
+}
+
+// StartUploadSweeper periodically removes stored files that no message uses,
+// such as uploads that were never sent, every UPLOAD_GC_INTERVAL (default 6
+// hours). A grace period of 0 disables the sweeper.
+func StartUploadSweeper() {
+	grace := uploadGracePeriod()
+	interval := getEnvDuration("UPLOAD_GC_INTERVAL", 6*time.Hour)
+	if grace <= 0 {
+		log.Println("Upload sweeper disabled (UPLOAD_GC_GRACE=0)")
+		return
+	}
+	if interval <= 0 {
+		interval = 6 * time.Hour
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			report, err := NewUploadService().SweepOrphanedUploads(grace, false)
+			if err != nil {
+				log.Printf("Error sweeping orphaned uploads: %v", err)
+			} else if report.Removed > 0 || report.Failed > 0 {
+				log.Printf("Removed %d orphaned uploads, reclaiming %s (%d failed, %d files scanned)",
+					report.Removed, formatByteSize(report.ReclaimedBytes), report.Failed, report.Scanned)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// SweepUploads runs a sweep on demand with the configured grace period, or
+// the default one when the background sweeper is disabled, and records it in
+// the audit log unless it is a dry run
+func (s *UploadService) SweepUploads(actorID *uint, dryRun bool) (*models.UploadSweepReport, error) {
+	grace := uploadGracePeriod()
+	if grace <= 0 {
+		grace = 24 * time.Hour
+	}
+	report, err := s.SweepOrphanedUploads(grace, dryRun)
+	if err != nil || dryRun {
+		return report, err
+	}
+
+	if err := recordAudit(s.db, AuditEntry{
+		ActorID:    actorID,
+		Action:     "admin.upload_sweep",
+		TargetType: "uploads",
+		Metadata: map[string]interface{}{
+			"scanned":         report.Scanned,
+			"removed":         report.Removed,
+			"reclaimed_bytes": report.ReclaimedBytes,
+			"failed":          report.Failed,
+		},
+		IP: s.clientIP,
+	}); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// SweepOrphanedUploads reconciles the store with the database and removes the
+// files that no message uses and that were not uploaded within the grace
+// period, along with their upload records and blob. Files still being
+// written are younger than the grace period, and uploads that reuse an old
+// blob are recorded under its lock, so uploads in progress are never swept.
+// On a dry run the files are only counted.
+func (s *UploadService) SweepOrphanedUploads(grace time.Duration, dryRun bool) (*models.UploadSweepReport, error) {
+	report := &models.UploadSweepReport{
+		DryRun:      dryRun,
+		GracePeriod: grace.String(),
+		StartedAt:   time.Now(),
+	}
+	cutoff := report.StartedAt.Add(-grace)
+
+	referenced, err := s.referencedUploadKeys(cutoff)
+	if err != nil {
+		return nil, err
+	}
+
+	// Candidates are collected first so nothing is removed while listing
+	var orphans []storage.ObjectInfo
+	err = storage.GetStorage().List(func(object storage.ObjectInfo) error {
+		report.Scanned++
+		if !referenced[object.Key] && object.ModTime.Before(cutoff) {
+			orphans = append(orphans, object)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, object := range orphans {
+		removed, err := s.removeOrphanedUpload(object.Key, cutoff, dryRun)
+		if err != nil {
+			log.Printf("Error removing orphaned upload %s: %v", object.Key, err)
+			report.Failed++
+			continue
+		}
+		if removed {
+			report.Removed++
+			report.ReclaimedBytes += object.Size
+		}
+	}
+
+	report.FinishedAt = time.Now()
+	return report, nil
+}
+
+// referencedUploadKeys returns the keys of the stored files that messages use,
+// including tombstones and their thumbnails, and of those uploaded since cutoff
+func (s *UploadService) referencedUploadKeys(cutoff time.Time) (map[string]bool, error) {
+	referenced := make(map[string]bool)
+	add := func(url string, thumbnails json.RawMessage) error {
+		if key, ok := strings.CutPrefix(url, storage.MediaURLPrefix); ok {
+			referenced[key] = true
+		}
+		if len(thumbnails) == 0 {
+			return nil
+		}
+		var decoded []models.MediaThumbnail
+		if err := json.Unmarshal(thumbnails, &decoded); err != nil {
+			return fmt.Errorf("failed to decode thumbnails of %s: %w", url, err)
+		}
+		for _, thumbnail := range decoded {
+			if key, ok := strings.CutPrefix(thumbnail.URL, storage.MediaURLPrefix); ok {
+				referenced[key] = true
+			}
+		}
+		return nil
+	}
+
+	var messages []models.Message
+	if err := s.db.Unscoped().Select("id", "media_url", "media_thumbnails").
+		Where("media_url LIKE ?", storage.MediaURLPrefix+"%").
+		FindInBatches(&messages, 1000, func(batch *gorm.DB, _ int) error {
+			for _, message := range messages {
+				if err := add(message.MediaURL, message.MediaThumbnails); err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error; err != nil {
+		return nil, fmt.Errorf("failed to load message media: %w", err)
+	}
+
+	var uploads []models.Upload
+	if err := s.db.Select("url", "thumbnails").Where("created_at >= ?", cutoff).Find(&uploads).Error; err != nil {
+		return nil, fmt.Errorf("failed to load recent uploads: %w", err)
+	}
+	for _, upload := range uploads {
+		if err := add(upload.URL, upload.Thumbnails); err != nil {
+			return nil, err
+		}
+	}
+	return referenced, nil
+}
+
+// removeOrphanedUpload checks again, under the blob's lock, that nothing has
+// started using a file since the sweep began, then removes the records that
+// point at it and the file itself. It reports whether the file was orphaned.
+func (s *UploadService) removeOrphanedUpload(key string, cutoff time.Time, dryRun bool) (bool, error) {
+	unlock := lockBlob(key)
+	defer unlock()
+
+	url := storage.MediaURLPrefix + key
+	thumbnailPattern := `%"` + likeEscaper.Replace(url) + `"%`
+
+	var count int64
+	if err := s.db.Unscoped().Model(&models.Message{}).
+		Where("media_url = ? OR CAST(media_thumbnails AS TEXT) LIKE ? ESCAPE '\\'", url, thumbnailPattern).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return false, nil
+	}
+	if err := s.db.Model(&models.Upload{}).
+		Where("(url = ? OR CAST(thumbnails AS TEXT) LIKE ? ESCAPE '\\') AND created_at >= ?", url, thumbnailPattern, cutoff).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 || dryRun {
+		return count == 0, nil
+	}
+
+	tx := s.db.Begin()
+	if tx.Error != nil {
+		return false, tx.Error
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+	if err := tx.Where("url = ?", url).Delete(&models.Upload{}).Error; err != nil {
+		tx.Rollback()
+		return false, fmt.Errorf("failed to remove upload records: %w", err)
+	}
+	if err := tx.Where("blob_key = ?", key).Delete(&models.BlobReference{}).Error; err != nil {
+		tx.Rollback()
+		return false, fmt.Errorf("failed to remove blob references: %w", err)
+	}
+	if err := tx.Where("key = ?", key).Delete(&models.Blob{}).Error; err != nil {
+		tx.Rollback()
+		return false, fmt.Errorf("failed to remove blob: %w", err)
+	}
+	if err := tx.Commit().Error; err != nil {
+		return false, err
+	}
+
+	// A file whose records are gone is found again by the next sweep if this fails
+	if err := storage.GetStorage().Delete(key); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// formatByteSize describes a number of bytes for logs, e.g. "3.2 MB"
+func formatByteSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	value, exponent := float64(bytes)/unit, 0
+	for value >= unit && exponent < 4 {
+		value /= unit
+		exponent++
+	}
+	return fmt.Sprintf("%.1f %cB", value, "KMGTP"[exponent])
+}
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github/sabt-dev/realtimeChat/database"
+	"github/sabt-dev/realtimeChat/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Limits for incoming webhooks
+const (
+	incomingWebhookTokenPrefix = "rchook_"
+	maxWebhookNameLength       = 50
+	maxWebhookTextLength       = 4000
+	maxWebhookAttachments      = 10
+)
+
+// ErrInvalidWebhookToken is returned for unknown incoming webhook URLs
+var ErrInvalidWebhookToken = errors.New("unknown webhook")
+
+// ErrInvalidWebhookPayload wraps the reason an incoming webhook payload was rejected
+var ErrInvalidWebhookPayload = errors.New("invalid webhook payload")
+
+// webhookVideoExtensions are the attachment extensions posted as videos; everything else is an image
+var webhookVideoExtensions = map[string]bool{".mp4": true, ".webm": true, ".mov": true, ".ogg": true, ".avi": true}
+
+// WebhookService handles room webhooks
+type WebhookService struct {
+	db       *gorm.DB
+	clientIP string // Recorded in audit entries
+}
+
+// NewWebhookService creates a new WebhookService
+func NewWebhookService() *WebhookService {
+	return &WebhookService{db: database.GetDB()}
+}
+
+// WithClientIP returns a copy of the service that records ip in its audit entries
+func (s *WebhookService) WithClientIP(ip string) *WebhookService {
+	return &WebhookService{db: s.db, clientIP: ip}
+}
+
+// CreateIncomingWebhook creates an incoming webhook for a room (room creator only).
+// Messages are sent as a new bot user named after the webhook. The returned
+// secret is only available now.
+func (s *WebhookService) CreateIncomingWebhook(roomID uint, name string, userID uint) (*models.IncomingWebhook, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxWebhookNameLength {
+		return nil, "", fmt.Errorf("webhook name must be between 1 and %d characters", maxWebhookNameLength)
+	}
+	if err := requireRoomCreator(roomID, userID, "manage webhooks"); err != nil {
+		return nil, "", err
+	}
+
+	token, err := newSecretToken(incomingWebhookTokenPrefix)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+
+	tx := s.db.Begin()
+	if tx.Error != nil {
+		return nil, "", tx.Error
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	sender := models.User{
+		Name:  name,
+		Email: fmt.Sprintf("webhook-%s@bots.invalid", uuid.New().String()),
+		IsBot: true,
+	}
+	if err := tx.Create(&sender).Error; err != nil {
+		tx.Rollback()
+		return nil, "", err
+	}
+
+	webhook := models.IncomingWebhook{
+		RoomID:      roomID,
+		UserID:      sender.ID,
+		Name:        name,
+		TokenHash:   hashSecretToken(token),
+		Prefix:      token[:len(incomingWebhookTokenPrefix)+6],
+		CreatedByID: userID,
+	}
+	if err := tx.Create(&webhook).Error; err != nil {
+		tx.Rollback()
+		return nil, "", err
+	}
+
+	if err := recordAudit(tx, AuditEntry{
+		ActorID:    uintPtr(userID),
+		Action:     "webhook.create",
+		TargetType: "webhook",
+		TargetID:   fmt.Sprint(webhook.ID),
+		RoomID:     uintPtr(roomID),
+		Metadata:   map[string]interface{}{"name": name, "direction": "incoming"},
+		IP:         s.clientIP,
+	}); err != nil {
+		tx.Rollback()
+		return nil, "", err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, "", err
+	}
+	return &webhook, token, nil
+}
+
+// GetIncomingWebhooks lists a room's incoming webhooks (room creator only)
+func (s *WebhookService) GetIncomingWebhooks(roomID, userID uint) ([]models.IncomingWebhook, error) {
+	if err := requireRoomCreator(roomID, userID, "manage webhooks"); err != nil {
+		return nil, err
+	}
+	var webhooks []models.IncomingWebhook
+	err := s.db.Where("room_id = ?", roomID).Order("created_at ASC").Find(&webhooks).Error
+	return webhooks, err
+}
+
+// DeleteIncomingWebhook deletes an incoming webhook, invalidating its URL (room creator only).
+// Messages it posted are kept along with its sender.
+func (s *WebhookService) DeleteIncomingWebhook(roomID, webhookID, userID uint) error {
+	if err := requireRoomCreator(roomID, userID, "manage webhooks"); err != nil {
+		return err
+	}
+
+	tx := s.db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	result := tx.Where("id = ? AND room_id = ?", webhookID, roomID).Delete(&models.IncomingWebhook{})
+	if result.Error != nil {
+		tx.Rollback()
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return fmt.Errorf("webhook not found")
+	}
+	if err := recordAudit(tx, AuditEntry{
+		ActorID:    uintPtr(userID),
+		Action:     "webhook.delete",
+		TargetType: "webhook",
+		TargetID:   fmt.Sprint(webhookID),
+		RoomID:     uintPtr(roomID),
+		Metadata:   map[string]interface{}{"direction": "incoming"},
+		IP:         s.clientIP,
+	}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// ExecuteIncomingWebhook posts a webhook payload into the webhook's room.
+// The text and the first attachment form one message; further attachments
+// follow as media messages. Returns the created messages in order.
+func (s *WebhookService) ExecuteIncomingWebhook(token string, payload models.IncomingWebhookPayload) ([]*models.Message, error) {
+	if !strings.HasPrefix(token, incomingWebhookTokenPrefix) {
+		return nil, ErrInvalidWebhookToken
+	}
+	var webhook models.IncomingWebhook
+	err := s.db.Where("token_hash = ?", hashSecretToken(token)).First(&webhook).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidWebhookToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	text := strings.TrimSpace(payload.Text)
+	if len(text) > maxWebhookTextLength {
+		return nil, fmt.Errorf("%w: text must be at most %d characters", ErrInvalidWebhookPayload, maxWebhookTextLength)
+	}
+	attachments, err := validateWebhookAttachments(payload.Attachments)
+	if err != nil {
+		return nil, err
+	}
+	if text == "" && len(attachments) == 0 {
+		return nil, fmt.Errorf("%w: text or attachments required", ErrInvalidWebhookPayload)
+	}
+
+	messageService := NewMessageService().WithClientIP(s.clientIP)
+	if username := strings.TrimSpace(payload.Username); username != "" {
+		if len(username) > maxWebhookNameLength {
+			return nil, fmt.Errorf("%w: username must be at most %d characters", ErrInvalidWebhookPayload, maxWebhookNameLength)
+		}
+		messageService = messageService.WithDisplayName(username)
+	}
+
+	var messages []*models.Message
+	if len(attachments) == 0 {
+		message, err := messageService.CreateMessage(webhook.UserID, webhook.RoomID, text, "message", "", "", "", nil, "", "")
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	for i, a := range attachments {
+		caption := ""
+		if i == 0 {
+			caption = text
+		}
+		message, err := messageService.CreateMessage(webhook.UserID, webhook.RoomID, caption, "media", a.URL, a.Type, a.FileName, nil, "", "")
+		if err != nil {
+			return messages, err
+		}
+		messages = append(messages, message)
+	}
+
+	if err := s.db.Model(&webhook).Update("last_used_at", time.Now()).Error; err != nil {
+		fmt.Printf("Warning: failed to update webhook last use: %v\n", err)
+	}
+	return messages, nil
+}
+
+// validateWebhookAttachments checks attachment URLs and fills in types and file names
+func validateWebhookAttachments(attachments []models.IncomingWebhookAttachment) ([]models.IncomingWebhookAttachment, error) {
+	if len(attachments) > maxWebhookAttachments {
+		return nil, fmt.Errorf("%w: at most %d attachments allowed", ErrInvalidWebhookPayload, maxWebhookAttachments)
+	}
+
+	result := make([]models.IncomingWebhookAttachment, 0, len(attachments))
+	for i, a := range attachments {
+		u, err := url.Parse(strings.TrimSpace(a.URL))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("%w: attachment %d needs an http(s) url", ErrInvalidWebhookPayload, i+1)
+		}
+		a.URL = u.String()
+
+		if a.FileName == "" {
+			a.FileName = path.Base(u.Path)
+		}
+		switch a.Type {
+		case "image", "video", "file":
+		case "":
+			a.Type = "image"
+			if webhookVideoExtensions[strings.ToLower(path.Ext(u.Path))] {
+				a.Type = "video"
+			}
+		default:
+			return nil, fmt.Errorf("%w: attachment %d type must be image, video or file", ErrInvalidWebhookPayload, i+1)
+		}
+		result = append(result, a)
+	}
+	return result, nil
+}
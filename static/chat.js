@@ -12,6 +12,13 @@ let isUploading = false;
 let isUserScrolledUp = false;
 let pendingMessages = 0;
 let isJoiningRoom = false; // Add state to prevent double room joining
+let canModerateRoom = false; // Whether the user can remove others' messages in the current room
+let pinnedMessageIds = new Set(); // IDs of the messages pinned in the current room
+let historyOldestId = null; // Cursor for loading older history on scroll
+let historyHasMore = false; // Whether older history exists beyond historyOldestId
+let isLoadingOlderHistory = false;
+let historyHasMoreAfter = false; // Set while showing a permalink's context instead of the latest messages
+let pendingPermalinkId = null; // Message to open in context once its room has been joined
 
 const authSection = document.getElementById('authSection');
 const loginOptions = document.getElementById('loginOptions');
@@ -169,6 +176,8 @@ sendBtn.addEventListener('click', sendMessage);
 messageInput.addEventListener('keypress', (e) => {
     if (e.key === 'Enter') sendMessage();
 });
+messageInput.addEventListener('input', updateCommandSuggestions);
+messageInput.addEventListener('keydown', handleCommandSuggestionKeys);
 
 // Add paste event listener for image pasting
 messageInput.addEventListener('paste', handlePaste);
@@ -486,6 +495,9 @@ function createNewWebSocket(wsUrl) {
                     loadRoomHistory(true);
                     // Use instant scroll for initial room join
                     setTimeout(() => {
+                        if (historyHasMoreAfter) {
+                            return; // Showing a permalink, not the latest messages
+                        }
                         debugLog('Scrolling to bottom after room history load');
                         scrollToBottomInstant();
                     }, 1000);
@@ -510,9 +522,13 @@ function createNewWebSocket(wsUrl) {
             
             // Handle different message types
             if (message.type === 'delete') {
-                handleMessageDeletion(message.id);
+                handleMessageDeletion(message.id, message.deletedBy);
             } else if (message.type === 'reaction_update') {
                 updateMessageReactions(message);
+            } else if (message.type === 'message_update') {
+                updateMessageLinkPreviews(message);
+            } else if (message.type === 'pin_update') {
+                renderPinnedMessages(message.pins || []);
             } else if (message.type === 'room_update') {
                 handleRoomUpdate(message);
             } else {
@@ -658,6 +674,7 @@ function sendMessage() {
     try {
         ws.send(JSON.stringify(message));
         messageInput.value = '';
+        document.getElementById('commandSuggestions').style.display = 'none';
         
         // Clear reply state after sending
         if (currentReply) {
@@ -675,19 +692,30 @@ function sendMessage() {
     }
 }
 
-function displayMessage(message, isFromHistory = false) {
+function displayMessage(message, isFromHistory = false, insertBeforeEl = null) {
     debugLog(`Displaying message: ${JSON.stringify(message)}, isFromHistory: ${isFromHistory}`);
     debugLog(`Current username: "${username}", Message sender: "${message.sender}"`);
     
-    // Filter out empty or invalid messages (but allow media, join, and leave messages)
-    if (!message || (message.type !== 'media' && message.type !== 'join' && message.type !== 'leave' && (!message.text || typeof message.text !== 'string' || message.text.trim() === ''))) {
+    // Filter out empty or invalid messages (but allow media, join, leave and tombstone messages)
+    if (!message || (!message.deleted && message.type !== 'media' && !isSystemMessage(message) && (!message.text || typeof message.text !== 'string' || message.text.trim() === ''))) {
         debugLog('Skipping empty or invalid message');
         return;
     }
     
     const messageEl = document.createElement('div');
     
-    if (message.type === 'join' || message.type === 'leave') {
+    if (message.deleted) {
+        // Tombstone of a deleted message - keeps its place in the timeline
+        messageEl.className = `message system tombstone${isFromHistory ? ' no-animation' : ''}`;
+        messageEl.setAttribute('data-message-id', message.id);
+        messageEl.innerHTML = `<div>${escapeHtml(message.text || 'message deleted')}</div>`;
+        debugLog('Created tombstone message element');
+    } else if (message.type === 'ephemeral') {
+        // Command reply that only this user sees; it is not part of the room history
+        messageEl.className = 'message system ephemeral';
+        messageEl.innerHTML = `<div>${processLinksInText(escapeHtml(message.text))}</div><div class="ephemeral-note">Only visible to you</div>`;
+        debugLog('Created ephemeral message element');
+    } else if (isSystemMessage(message)) {
         messageEl.className = `message system${isFromHistory ? ' no-animation' : ''}`;
         messageEl.innerHTML = `<div>${processLinksInText(escapeHtml(message.text))}</div>`;
         debugLog('Created system message element');
@@ -717,7 +745,7 @@ function displayMessage(message, isFromHistory = false) {
         if (message.mediaType === 'image') {
             mediaHtml = `
                 <div class="message-media">
-                    <img src="${escapeHtml(message.mediaUrl)}" alt="Shared image" onclick="openImageModal('${escapeHtml(message.mediaUrl)}')">
+                    ${imageMediaHtml(message)}
                 </div>
             `;
         } else if (message.mediaType === 'video') {
@@ -728,23 +756,49 @@ function displayMessage(message, isFromHistory = false) {
                     </video>
                 </div>
             `;
+        } else if (message.mediaType === 'audio') {
+            mediaHtml = `
+                <div class="message-media message-file">
+                    ${voiceMessageHtml(message)}
+                </div>
+            `;
+        } else if (message.mediaType === 'file') {
+            mediaHtml = `
+                <div class="message-media message-file">
+                    ${fileAttachmentHtml(message)}
+                </div>
+            `;
         }
         
         // Create text content if present
         const textHtml = message.text && message.text.trim() ? 
-            `<div class="message-text">${processLinksInText(escapeHtml(message.text))}</div>` : '';
+            `<div class="message-text">${messageTextHtml(message)}</div>` : '';
         
         // Create delete button for own messages
         const deleteButtonHtml = isOwnMessage ? 
             `<button class="message-delete-btn" onclick="deleteMessage('${escapeHtml(message.id)}')" title="Delete message">×</button>` : '';
         
+        // Create remove button for others' messages when the user moderates this room
+        const moderatorDeleteButtonHtml = (!isOwnMessage && canModerateRoom) ? 
+            `<button class="message-delete-btn" onclick="moderateDeleteMessage('${escapeHtml(message.id)}')" title="Remove message (moderator)">×</button>` : '';
+        
+        // Create bookmark button so the message can be saved for later
+        const bookmarkButtonHtml = `<button class="message-bookmark-btn" onclick="bookmarkMessage('${escapeHtml(message.id)}')" title="Save message">🔖</button>`;
+        
+        // Create copy-link button for sharing a permalink to the message
+        const linkButtonHtml = `<button class="message-bookmark-btn" onclick="copyMessageLink('${escapeHtml(message.id)}')" title="Copy link to message">🔗</button>`;
+        
+        // Create pin button when the user moderates this room
+        const pinButtonHtml = canModerateRoom ? 
+            `<button class="message-pin-btn" onclick="togglePinMessage('${escapeHtml(message.id)}')" title="Pin or unpin message">📌</button>` : '';
+        
         // Create reply button for all messages (except system messages)
         const replyButtonHtml = (message.type !== 'join' && message.type !== 'leave') ? 
             `<button class="message-reply-btn" onclick="replyToMessage('${escapeHtml(message.id)}', '${escapeHtml(message.sender)}', '${escapeHtml(message.text || 'Media message')}')" title="Reply to message">↩</button>` : '';
         
         // Create reply reference if this message is a reply
         const replyReferenceHtml = message.replyTo ? 
-            `<div class="message-reply-reference" onclick="scrollToMessage('${escapeHtml(message.replyTo.id)}')">
+            `<div class="message-reply-reference" data-reply-to-id="${escapeHtml(message.replyTo.id)}" onclick="scrollToMessage('${escapeHtml(message.replyTo.id)}')">
                 <div class="reply-reference-header">
                     <span class="reply-icon">↩</span>
                     <span class="reply-reference-sender">${escapeHtml(message.replyTo.sender)}</span>
@@ -763,7 +817,7 @@ function displayMessage(message, isFromHistory = false) {
             messageEl.innerHTML = `
                 ${avatarHtml}
                 <div class="message-content">
-                    <div class="message-info">${escapeHtml(message.sender)} • ${time}</div>
+                    <div class="message-info">${senderLabelHtml(message)} • ${time}${bookmarkButtonHtml}${linkButtonHtml}</div>
                     ${replyReferenceHtml}
                     ${textHtml}
                     ${mediaHtml}
@@ -771,13 +825,14 @@ function displayMessage(message, isFromHistory = false) {
                 </div>
                 ${replyButtonHtml}
                 ${emojiButtonHtml}
+                ${pinButtonHtml}
                 ${deleteButtonHtml}
             `;
         } else {
             messageEl.innerHTML = `
                 ${avatarHtml}
                 <div class="message-content">
-                    <div class="message-info">${escapeHtml(message.sender)} • ${time}</div>
+                    <div class="message-info">${senderLabelHtml(message)} • ${time}${bookmarkButtonHtml}${linkButtonHtml}</div>
                     ${replyReferenceHtml}
                     ${textHtml}
                     ${mediaHtml}
@@ -785,6 +840,8 @@ function displayMessage(message, isFromHistory = false) {
                 </div>
                 ${replyButtonHtml}
                 ${emojiButtonHtml}
+                ${pinButtonHtml}
+                ${moderatorDeleteButtonHtml}
             `;
         }
         
@@ -814,13 +871,27 @@ function displayMessage(message, isFromHistory = false) {
         const deleteButtonHtml = isOwnMessage ? 
             `<button class="message-delete-btn" onclick="deleteMessage('${escapeHtml(message.id)}')" title="Delete message">×</button>` : '';
         
+        // Create remove button for others' messages when the user moderates this room
+        const moderatorDeleteButtonHtml = (!isOwnMessage && canModerateRoom) ? 
+            `<button class="message-delete-btn" onclick="moderateDeleteMessage('${escapeHtml(message.id)}')" title="Remove message (moderator)">×</button>` : '';
+        
+        // Create bookmark button so the message can be saved for later
+        const bookmarkButtonHtml = `<button class="message-bookmark-btn" onclick="bookmarkMessage('${escapeHtml(message.id)}')" title="Save message">🔖</button>`;
+        
+        // Create copy-link button for sharing a permalink to the message
+        const linkButtonHtml = `<button class="message-bookmark-btn" onclick="copyMessageLink('${escapeHtml(message.id)}')" title="Copy link to message">🔗</button>`;
+        
+        // Create pin button when the user moderates this room
+        const pinButtonHtml = canModerateRoom ? 
+            `<button class="message-pin-btn" onclick="togglePinMessage('${escapeHtml(message.id)}')" title="Pin or unpin message">📌</button>` : '';
+        
         // Create reply button for all messages (except system messages)
         const replyButtonHtml = (message.type !== 'join' && message.type !== 'leave') ? 
             `<button class="message-reply-btn" onclick="replyToMessage('${escapeHtml(message.id)}', '${escapeHtml(message.sender)}', '${escapeHtml(message.text || 'Media message')}')" title="Reply to message">↩</button>` : '';
         
         // Create reply reference if this message is a reply
         const replyReferenceHtml = message.replyTo ? 
-            `<div class="message-reply-reference" onclick="scrollToMessage('${escapeHtml(message.replyTo.id)}')">
+            `<div class="message-reply-reference" data-reply-to-id="${escapeHtml(message.replyTo.id)}" onclick="scrollToMessage('${escapeHtml(message.replyTo.id)}')">
                 <div class="reply-reference-header">
                     <span class="reply-icon">↩</span>
                     <span class="reply-reference-sender">${escapeHtml(message.replyTo.sender)}</span>
@@ -831,6 +902,11 @@ function displayMessage(message, isFromHistory = false) {
         // Create reactions display
         const reactionsHtml = createReactionsHtml(message.reactions || [], message.id);
 
+        // Emotes from /me read as "* sender action"
+        const bodyHtml = message.type === 'emote' ?
+            `<div class="message-emote">* ${escapeHtml(message.sender)} ${messageTextHtml(message)}</div>` :
+            `<div class="message-body">${messageTextHtml(message)}</div>`;
+
         // Create emoji picker button (only for non-system messages)
         const emojiButtonHtml = (message.type !== 'join' && message.type !== 'leave') ? 
             `<button class="message-emoji-btn" onclick="toggleEmojiPicker('${escapeHtml(message.id)}')" title="Add reaction">😀</button>` : '';
@@ -839,26 +915,31 @@ function displayMessage(message, isFromHistory = false) {
             messageEl.innerHTML = `
                 ${avatarHtml}
                 <div class="message-content">
-                    <div class="message-info">${escapeHtml(message.sender)} • ${time}</div>
+                    <div class="message-info">${senderLabelHtml(message)} • ${time}${bookmarkButtonHtml}${linkButtonHtml}</div>
                     ${replyReferenceHtml}
-                    <div>${processLinksInText(escapeHtml(message.text))}</div>
+                    ${bodyHtml}
+                    ${linkPreviewsHtml(message.linkPreviews)}
                     ${reactionsHtml}
                 </div>
                 ${replyButtonHtml}
                 ${emojiButtonHtml}
+                ${pinButtonHtml}
                 ${deleteButtonHtml}
             `;
         } else {
             messageEl.innerHTML = `
                 ${avatarHtml}
                 <div class="message-content">
-                    <div class="message-info">${escapeHtml(message.sender)} • ${time}</div>
+                    <div class="message-info">${senderLabelHtml(message)} • ${time}${bookmarkButtonHtml}${linkButtonHtml}</div>
                     ${replyReferenceHtml}
-                    <div>${processLinksInText(escapeHtml(message.text))}</div>
+                    ${bodyHtml}
+                    ${linkPreviewsHtml(message.linkPreviews)}
                     ${reactionsHtml}
                 </div>
                 ${replyButtonHtml}
                 ${emojiButtonHtml}
+                ${pinButtonHtml}
+                ${moderatorDeleteButtonHtml}
             `;
         }
         
@@ -866,6 +947,12 @@ function displayMessage(message, isFromHistory = false) {
     }
 
     debugLog(`Messages container exists: ${!!messagesContainer}`);
+    // Older history is inserted above the existing messages without touching scroll state
+    if (insertBeforeEl) {
+        messagesContainer.insertBefore(messageEl, insertBeforeEl);
+        return;
+    }
+    
     debugLog(`Appending message element to container`);
     messagesContainer.appendChild(messageEl);
     
@@ -994,7 +1081,7 @@ function displayMessage(message, isFromHistory = false) {
         }
     } else {
         // User is scrolled up and this is another user's message - show notification for regular messages only
-        if (message.type !== 'join' && message.type !== 'leave') {
+        if (!isSystemMessage(message)) {
             pendingMessages++;
             showNewMessageNotification();
             debugLog(`User scrolled up - added to pending messages (${pendingMessages})`);
@@ -1013,6 +1100,8 @@ function clearMessages() {
     
     // Reset scroll state when clearing messages
     isUserScrolledUp = false;
+    historyOldestId = null;
+    historyHasMore = false;
     pendingMessages = 0;
     hideNewMessageNotification();
     
@@ -1098,9 +1187,21 @@ function handleScroll() {
     const scrollHeight = messagesContainer.scrollHeight;
     const clientHeight = messagesContainer.clientHeight;
     
+    // Load older history when the user scrolls near the top
+    if (scrollTop < 100 && historyHasMore && !isLoadingOlderHistory) {
+        loadOlderHistory();
+    }
+    
     // Check if user is near the bottom (within 50px)
     const isNearBottom = scrollHeight - scrollTop - clientHeight < 50;
     
+    // Jump back to the latest messages when scrolling past a permalink's context
+    if (isNearBottom && historyHasMoreAfter) {
+        historyHasMoreAfter = false;
+        loadRoomHistory(true);
+        return;
+    }
+    
     // Update scroll state
     const wasScrolledUp = isUserScrolledUp;
     isUserScrolledUp = !isNearBottom;
@@ -1192,8 +1293,15 @@ function loadRoomHistory(clearFirst = true) {
         clearMessages();
     }
     
+    // Open a permalink in context, or the latest messages otherwise
+    const permalinkId = pendingPermalinkId;
+    pendingPermalinkId = null;
+    historyHasMoreAfter = false;
+    const historyQuery = permalinkId ? `?around=${encodeURIComponent(permalinkId)}` : '';
+    
     debugLog(`Loading room history for: ${currentRoom}`);
-    fetch(`/api/rooms/${encodeURIComponent(currentRoom)}/messages`)
+    loadRoomPins();
+    fetch(`/api/rooms/${encodeURIComponent(currentRoom)}/messages${historyQuery}`)
         .then(response => {
             if (response.status === 401) {
                 debugLog('Unauthorized - redirecting to login');
@@ -1206,22 +1314,22 @@ function loadRoomHistory(clearFirst = true) {
         .then(data => {
             if (!data) return;
             debugLog(`Room history response: ${JSON.stringify(data)}`);
+            historyOldestId = data.messages && data.messages.length > 0 ? data.messages[0].id : null;
+            historyHasMore = data.has_more === true;
             if (data.messages && data.messages.length > 0) {
-                // Sort messages by timestamp
-                data.messages.sort((a, b) => new Date(a.timestamp) - new Date(b.timestamp));
-                
-                // Display historical messages - include text, media, join, and leave messages
+                // Display the newest page of history (the server returns it oldest first)
                 data.messages.forEach(message => {
-                    // Display message if it has valid content or is a system message
-                    if (message && 
-                        (message.type === 'join' || 
-                         message.type === 'leave' ||
-                         (message.type === 'media' && message.mediaUrl) || 
-                         (message.text && typeof message.text === 'string' && message.text.trim() !== ''))) {
+                    if (isDisplayableHistoryMessage(message)) {
                         displayMessage(message, true); // Pass true for isFromHistory
                     }
                 });
                 
+                if (permalinkId) {
+                    historyHasMoreAfter = data.has_more_after === true;
+                    setTimeout(() => scrollToMessage(permalinkId), 300);
+                    return;
+                }
+                
                 // Ensure instant scroll to bottom after all messages are loaded when joining/refreshing
                 // Use multiple timeouts to handle different loading scenarios
                 setTimeout(() => scrollToBottomInstant(), 50);
@@ -1234,6 +1342,341 @@ function loadRoomHistory(clearFirst = true) {
         });
 }
 
+// Join/leave notices, command notices such as topic changes, and ephemeral command replies
+function isSystemMessage(message) {
+    return ['join', 'leave', 'system', 'ephemeral'].includes(message.type);
+}
+
+// Display message if it has valid content or is a system message
+function isDisplayableHistoryMessage(message) {
+    return message && 
+        (message.deleted ||
+         isSystemMessage(message) ||
+         (message.type === 'media' && message.mediaUrl) || 
+         (message.text && typeof message.text === 'string' && message.text.trim() !== ''));
+}
+
+function loadOlderHistory() {
+    if (!historyOldestId) {
+        return;
+    }
+    
+    isLoadingOlderHistory = true;
+    const room = currentRoom;
+    debugLog(`Loading history before ${historyOldestId} for: ${room}`);
+    fetch(`/api/rooms/${encodeURIComponent(room)}/messages?before=${encodeURIComponent(historyOldestId)}`)
+        .then(response => response.json())
+        .then(data => {
+            // Ignore the page if the user switched rooms meanwhile
+            if (room !== currentRoom || !data.messages) {
+                return;
+            }
+            
+            historyHasMore = data.has_more === true;
+            if (data.messages.length === 0) {
+                return;
+            }
+            historyOldestId = data.messages[0].id;
+            
+            // Insert above the current first message and keep the viewport where it was
+            const firstExisting = messagesContainer.firstChild;
+            const previousHeight = messagesContainer.scrollHeight;
+            data.messages.forEach(message => {
+                if (isDisplayableHistoryMessage(message)) {
+                    displayMessage(message, true, firstExisting);
+                }
+            });
+            messagesContainer.scrollTop += messagesContainer.scrollHeight - previousHeight;
+        })
+        .catch(error => {
+            debugLog(`Error loading older history: ${error}`);
+        })
+        .finally(() => {
+            isLoadingOlderHistory = false;
+        });
+}
+
+function copyMessageLink(messageId) {
+    const link = `${window.location.origin}/?message=${encodeURIComponent(messageId)}`;
+    navigator.clipboard.writeText(link)
+        .then(() => debugLog(`Copied permalink: ${link}`))
+        .catch(() => prompt('Copy this link:', link));
+}
+
+// Open a message in its room, showing the surrounding history
+function openPermalink(messageId) {
+    fetch(`/api/messages/${encodeURIComponent(messageId)}`)
+        .then(response => response.json().then(data => ({ ok: response.ok, data })))
+        .then(({ ok, data }) => {
+            if (!ok) {
+                alert(data.error || 'Message not found');
+                return;
+            }
+            
+            pendingPermalinkId = messageId;
+            if (currentRoom === data.room && isConnected) {
+                loadRoomHistory(true);
+            } else {
+                joinRoomByName(data.room);
+            }
+        })
+        .catch(error => {
+            debugLog(`Error opening permalink: ${error}`);
+        });
+}
+
+// Handle links of the form /?message=<id>
+function openPermalinkFromUrl() {
+    const messageId = new URLSearchParams(window.location.search).get('message');
+    if (!messageId) {
+        return;
+    }
+    window.history.replaceState(null, '', '/');
+    openPermalink(messageId);
+}
+
+function loadRoomPins() {
+    fetch(`/api/rooms/${encodeURIComponent(currentRoom)}/pins`)
+        .then(response => response.ok ? response.json() : null)
+        .then(data => {
+            renderPinnedMessages(data && data.pins ? data.pins : []);
+        })
+        .catch(error => {
+            debugLog(`Error loading pinned messages: ${error}`);
+        });
+}
+
+function renderPinnedMessages(pins) {
+    const pinnedBar = document.getElementById('pinnedMessages');
+    pinnedMessageIds = new Set(pins.map(pin => pin.message.id));
+    
+    if (pins.length === 0) {
+        pinnedBar.style.display = 'none';
+        pinnedBar.innerHTML = '';
+        return;
+    }
+    
+    pinnedBar.innerHTML = pins.map(pin => {
+        const preview = pin.message.text || pin.message.fileName || 'Media message';
+        const unpinButtonHtml = canModerateRoom ?
+            `<button class="pinned-message-unpin" onclick="event.stopPropagation(); togglePinMessage('${escapeHtml(pin.message.id)}')" title="Unpin message">×</button>` : '';
+        return `
+            <div class="pinned-message" onclick="scrollToMessage('${escapeHtml(pin.message.id)}')" title="Pinned by ${escapeHtml(pin.pinnedBy)}">
+                <span class="pinned-message-icon">📌</span>
+                <span class="pinned-message-sender">${escapeHtml(pin.message.sender)}</span>
+                <span class="pinned-message-text">${escapeHtml(preview)}</span>
+                ${unpinButtonHtml}
+            </div>`;
+    }).join('');
+    pinnedBar.style.display = 'block';
+}
+
+function togglePinMessage(messageId) {
+    if (!ws || ws.readyState !== WebSocket.OPEN) {
+        alert('Connection lost. Please refresh and try again.');
+        return;
+    }
+    
+    const type = pinnedMessageIds.has(messageId) ? 'unpin' : 'pin';
+    debugLog(`Sending ${type} request for message: ${messageId}`);
+    ws.send(JSON.stringify({ type: type, messageId: messageId }));
+}
+
+function bookmarkMessage(messageId) {
+    // Ask for an optional note; cancelling aborts
+    const note = prompt('Save this message? Optionally add a note:', '');
+    if (note === null) {
+        return;
+    }
+    
+    fetch('/api/bookmarks', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ messageId: messageId, note: note.trim() })
+    })
+        .then(response => response.json().then(data => ({ ok: response.ok, data })))
+        .then(({ ok, data }) => {
+            if (!ok) {
+                alert(data.error || 'Failed to save message');
+                return;
+            }
+            debugLog(`Message ${messageId} bookmarked`);
+        })
+        .catch(error => {
+            debugLog(`Error saving bookmark: ${error}`);
+            alert('Failed to save message. Please try again.');
+        });
+}
+
+function showBookmarksModal() {
+    document.getElementById('bookmarksModal').style.display = 'flex';
+    loadBookmarks(0);
+}
+
+function closeBookmarksModal() {
+    document.getElementById('bookmarksModal').style.display = 'none';
+}
+
+function loadBookmarks(offset) {
+    const list = document.getElementById('bookmarksList');
+    const pageSize = 20;
+    
+    fetch(`/api/bookmarks?limit=${pageSize}&offset=${offset}`)
+        .then(response => response.json())
+        .then(data => {
+            const bookmarks = data.bookmarks || [];
+            if (offset === 0) {
+                list.innerHTML = '';
+            }
+            if (bookmarks.length === 0 && offset === 0) {
+                list.innerHTML = '<div class="bookmarks-empty">No saved messages yet</div>';
+                return;
+            }
+            
+            const oldMore = list.querySelector('.bookmarks-more');
+            if (oldMore) {
+                oldMore.remove();
+            }
+            
+            bookmarks.forEach(bookmark => {
+                const item = document.createElement('div');
+                item.className = 'bookmark-item';
+                item.setAttribute('data-message-id', bookmark.message.id);
+                item.onclick = (e) => {
+                    if (!e.target.closest('.bookmark-remove')) {
+                        closeBookmarksModal();
+                        openPermalink(bookmark.message.id);
+                    }
+                };
+                const time = new Date(bookmark.message.timestamp).toLocaleString();
+                const noteHtml = bookmark.note ? `<div class="bookmark-note">${escapeHtml(bookmark.note)}</div>` : '';
+                item.innerHTML = `
+                    <div class="bookmark-header">
+                        <span>#${escapeHtml(bookmark.message.room)} • ${escapeHtml(bookmark.message.sender)} • ${escapeHtml(time)}</span>
+                        <button class="bookmark-remove" onclick="removeBookmark('${escapeHtml(bookmark.message.id)}')" title="Remove">×</button>
+                    </div>
+                    <div class="bookmark-text">${escapeHtml(bookmark.message.text || bookmark.message.fileName || 'Media message')}</div>
+                    ${noteHtml}
+                `;
+                list.appendChild(item);
+            });
+            
+            if (offset + bookmarks.length < data.total) {
+                const more = document.createElement('button');
+                more.className = 'bookmarks-more btn-cancel';
+                more.textContent = 'Load more';
+                more.onclick = () => loadBookmarks(offset + bookmarks.length);
+                list.appendChild(more);
+            }
+        })
+        .catch(error => {
+            debugLog(`Error loading bookmarks: ${error}`);
+        });
+}
+
+function removeBookmark(messageId) {
+    fetch(`/api/bookmarks/${encodeURIComponent(messageId)}`, { method: 'DELETE' })
+        .then(response => {
+            if (response.ok) {
+                const item = document.querySelector(`#bookmarksList [data-message-id="${messageId}"]`);
+                if (item) {
+                    item.remove();
+                }
+            }
+        })
+        .catch(error => {
+            debugLog(`Error removing bookmark: ${error}`);
+        });
+}
+
+function showSearchModal() {
+    const modal = document.getElementById('searchModal');
+    const input = document.getElementById('searchQuery');
+    
+    modal.style.display = 'flex';
+    setTimeout(() => input.focus(), 100);
+    
+    input.onkeypress = function(e) {
+        if (e.key === 'Enter') {
+            searchMessages();
+        }
+    };
+}
+
+function closeSearchModal() {
+    document.getElementById('searchModal').style.display = 'none';
+}
+
+function searchMessages(cursor = '') {
+    const query = document.getElementById('searchQuery').value.trim();
+    const resultsContainer = document.getElementById('searchResults');
+    if (!query) {
+        return;
+    }
+    
+    const params = new URLSearchParams({ q: query });
+    if (document.getElementById('searchCurrentRoom').checked && currentRoom) {
+        params.set('room', currentRoom);
+    }
+    if (document.getElementById('searchHasMedia').checked) {
+        params.set('has_media', 'true');
+    }
+    if (cursor) {
+        params.set('cursor', cursor);
+    }
+    
+    fetch(`/api/search?${params.toString()}`)
+        .then(response => response.json())
+        .then(data => {
+            if (!cursor) {
+                resultsContainer.innerHTML = '';
+            }
+            const oldMore = resultsContainer.querySelector('.bookmarks-more');
+            if (oldMore) {
+                oldMore.remove();
+            }
+            
+            if (data.error) {
+                resultsContainer.innerHTML = `<div class="bookmarks-empty">${escapeHtml(data.error)}</div>`;
+                return;
+            }
+            const results = data.results || [];
+            if (results.length === 0 && !cursor) {
+                resultsContainer.innerHTML = '<div class="bookmarks-empty">No messages found</div>';
+                return;
+            }
+            
+            results.forEach(result => {
+                const item = document.createElement('div');
+                item.className = 'bookmark-item';
+                item.onclick = () => {
+                    closeSearchModal();
+                    openPermalink(result.message.id);
+                };
+                const time = new Date(result.message.timestamp).toLocaleString();
+                // The snippet is escaped server-side; only <mark> highlights are HTML
+                item.innerHTML = `
+                    <div class="bookmark-header">
+                        <span>#${escapeHtml(result.message.room)} • ${escapeHtml(result.message.sender)} • ${escapeHtml(time)}</span>
+                    </div>
+                    <div class="bookmark-text search-snippet">${result.snippet}</div>
+                `;
+                resultsContainer.appendChild(item);
+            });
+            
+            if (data.has_more) {
+                const more = document.createElement('button');
+                more.className = 'bookmarks-more btn-cancel';
+                more.textContent = 'Load more';
+                more.onclick = () => searchMessages(data.next_cursor);
+                resultsContainer.appendChild(more);
+            }
+        })
+        .catch(error => {
+            debugLog(`Error searching messages: ${error}`);
+        });
+}
+
 function loadActiveRooms() {
     if (!isAuthenticated) {
         document.getElementById('rooms').innerHTML = '<div style="opacity: 0.6; font-size: 14px;">Login to see active rooms</div>';
@@ -1266,6 +1709,7 @@ function loadActiveRooms() {
                         roomEl.className = 'room-item';
                         if (room.name === currentRoom) {
                             roomEl.classList.add('active');
+                            canModerateRoom = room.is_moderator === true;
                         }
                         
                         // Add visual indicators for inactive membership
@@ -1318,6 +1762,9 @@ function loadActiveRooms() {
                             <div class="room-actions">
                                 <button class="room-menu-btn" aria-label="Room actions" title="Actions">⋯</button>
                                 <div class="room-menu">
+                                    ${exportMenuItemsHtml(room.name)}
+                                    ${isCreator ? `<button class="room-menu-item room-webhooks" data-room-id="${room.id}" data-room-name="${escapeHtml(room.name)}">Webhooks</button>` : ''}
+                                    ${isCreator ? `<button class="room-menu-item room-bots" data-room-id="${room.id}" data-room-name="${escapeHtml(room.name)}">Manage bots</button>` : ''}
                                     ${isCreator ? `<button class="room-menu-item room-delete" data-room-id="${room.id}" data-room-name="${escapeHtml(room.name)}">Delete room</button>` : ''}
                                 </div>
                             </div>
@@ -1345,6 +1792,22 @@ function loadActiveRooms() {
                                 menu.classList.toggle('show');
                             });
                         }
+                        const webhooksBtn = roomEl.querySelector('.room-webhooks');
+                        if (webhooksBtn) {
+                            webhooksBtn.addEventListener('click', (e) => {
+                                e.stopPropagation();
+                                closeAllRoomMenus();
+                                showRoomWebhooksModal(webhooksBtn.getAttribute('data-room-id'), webhooksBtn.getAttribute('data-room-name'));
+                            });
+                        }
+                        const botsBtn = roomEl.querySelector('.room-bots');
+                        if (botsBtn) {
+                            botsBtn.addEventListener('click', (e) => {
+                                e.stopPropagation();
+                                closeAllRoomMenus();
+                                showRoomBotsModal(botsBtn.getAttribute('data-room-id'), botsBtn.getAttribute('data-room-name'));
+                            });
+                        }
                         const delBtn = roomEl.querySelector('.room-delete');
                         if (delBtn) {
                             delBtn.addEventListener('click', (e) => {
@@ -1407,6 +1870,7 @@ function updateActiveRoomsDisplay(activeRooms) {
                     roomEl.className = 'room-item';
                     if (room.name === currentRoom) {
                         roomEl.classList.add('active');
+                        canModerateRoom = room.is_moderator === true;
                     }
                     
                     // Add visual indicators for inactive membership
@@ -1464,6 +1928,9 @@ function updateActiveRoomsDisplay(activeRooms) {
                         <div class="room-actions">
                             <button class="room-menu-btn" aria-label="Room actions" title="Actions">⋯</button>
                             <div class="room-menu">
+                                ${exportMenuItemsHtml(room.name)}
+                                ${isCreator ? `<button class="room-menu-item room-webhooks" data-room-id="${room.id}" data-room-name="${escapeHtml(room.name)}">Webhooks</button>` : ''}
+                                ${isCreator ? `<button class="room-menu-item room-bots" data-room-id="${room.id}" data-room-name="${escapeHtml(room.name)}">Manage bots</button>` : ''}
                                 ${isCreator ? `<button class="room-menu-item room-delete" data-room-id="${room.id}" data-room-name="${escapeHtml(room.name)}">Delete room</button>` : ''}
                             </div>
                         </div>
@@ -1491,6 +1958,22 @@ function updateActiveRoomsDisplay(activeRooms) {
                             menu.classList.toggle('show');
                         });
                     }
+                    const webhooksBtn = roomEl.querySelector('.room-webhooks');
+                    if (webhooksBtn) {
+                        webhooksBtn.addEventListener('click', (e) => {
+                            e.stopPropagation();
+                            closeAllRoomMenus();
+                            showRoomWebhooksModal(webhooksBtn.getAttribute('data-room-id'), webhooksBtn.getAttribute('data-room-name'));
+                        });
+                    }
+                    const botsBtn = roomEl.querySelector('.room-bots');
+                    if (botsBtn) {
+                        botsBtn.addEventListener('click', (e) => {
+                            e.stopPropagation();
+                            closeAllRoomMenus();
+                            showRoomBotsModal(botsBtn.getAttribute('data-room-id'), botsBtn.getAttribute('data-room-name'));
+                        });
+                    }
                     const delBtn = roomEl.querySelector('.room-delete');
                     if (delBtn) {
                         delBtn.addEventListener('click', (e) => {
@@ -1537,78 +2020,470 @@ function updateActiveRoomsDisplay(activeRooms) {
         });
 }
 
-// Close any open room menus
-function closeAllRoomMenus() {
-    document.querySelectorAll('.room-menu.show').forEach(m => m.classList.remove('show'));
+// Sender name for the message header, with a badge for bot accounts
+function senderLabelHtml(message) {
+    const badge = message.isBot ? ' <span class="bot-badge">BOT</span>' : '';
+    return `${escapeHtml(message.sender)}${badge}`;
 }
 
-// Delete a room via REST API
-function deleteRoom(roomId, roomName) {
-    if (!roomId) return;
-    if (!confirm(`Delete room "${roomName}"? This will remove all messages and media.`)) return;
-    fetch(`/api/rooms/${roomId}`, {
-        method: 'DELETE',
-        credentials: 'include'
-    })
-    .then(async (resp) => {
-        const data = await resp.json().catch(() => ({}));
-        if (!resp.ok || data.error) {
-            throw new Error(data.error || `HTTP ${resp.status}`);
-        }
-        // If deleting the current room, clear UI and return to start screen
-        if (currentRoom === roomName) {
-            clearMessages();
-            currentRoom = '';
-            updateConnectionStatus('Disconnected');
-            if (ws) {
-                try { ws.close(); } catch {}
-            }
-            // Hide chat, show start screen
-            chatInterface.classList.add('hidden');
-            if (startScreen) startScreen.classList.remove('hidden');
-        }
-        loadActiveRooms();
-        closeAllRoomMenus();
-    })
-    .catch(err => {
-        alert(`Failed to delete room: ${err.message}`);
-    });
+// Room bot allowlist management (room creators)
+let botsModalRoom = null;
+
+function showRoomBotsModal(roomId, roomName) {
+    botsModalRoom = { id: roomId, name: roomName };
+    document.getElementById('roomBotsTitle').textContent = `Bots in ${roomName}`;
+    document.getElementById('roomBotsModal').style.display = 'flex';
+    loadRoomBots();
 }
 
-function escapeHtml(text) {
-    const div = document.createElement('div');
-    div.textContent = text;
-    return div.innerHTML;
+function closeRoomBotsModal() {
+    document.getElementById('roomBotsModal').style.display = 'none';
+    botsModalRoom = null;
 }
 
-// URL media detection and handling
-function detectMediaUrl(text) {
-    // URL regex pattern to match HTTP/HTTPS URLs
-    const urlRegex = /(https?:\/\/[^\s]+)/gi;
-    const urls = text.match(urlRegex);
-    
-    if (!urls) return null;
-    
-    // Check each URL to see if it's a media file
-    for (const url of urls) {
-        if (isMediaUrl(url)) {
-            return url;
-        }
+function loadRoomBots() {
+    if (!botsModalRoom) {
+        return;
     }
-    
-    return null;
+    const list = document.getElementById('roomBotsList');
+    const select = document.getElementById('roomBotsSelect');
+    
+    Promise.all([
+        fetch(`/api/rooms/${encodeURIComponent(botsModalRoom.name)}/bots`).then(response => response.json()),
+        fetch('/api/bots').then(response => response.json())
+    ])
+        .then(([roomData, allData]) => {
+            const allowed = roomData.bots || [];
+            const allowedIds = new Set(allowed.map(bot => bot.id));
+            
+            list.innerHTML = allowed.length === 0
+                ? '<div class="bookmarks-empty">No bots are allowed in this room</div>'
+                : allowed.map(bot => `
+                    <div class="bookmark-item room-bot-item">
+                        <div class="bookmark-header">
+                            <span>${escapeHtml(bot.name)} <span class="bot-badge">BOT</span></span>
+                            <button class="bookmark-remove" onclick="removeRoomBot(${bot.id})" title="Remove">×</button>
+                        </div>
+                    </div>
+                `).join('');
+            
+            const available = (allData.bots || []).filter(bot => !allowedIds.has(bot.id));
+            select.innerHTML = available.length === 0
+                ? '<option value="">No other bots available</option>'
+                : available.map(bot => `<option value="${bot.id}">${escapeHtml(bot.name)}</option>`).join('');
+            document.getElementById('roomBotsAddBtn').disabled = available.length === 0;
+        })
+        .catch(error => {
+            debugLog(`Error loading room bots: ${error}`);
+        });
 }
 
-function isMediaUrl(url) {
-    // Remove query parameters for extension checking
-    const urlWithoutParams = url.split('?')[0];
-    
-    // Common image extensions
-    const imageExtensions = ['.jpg', '.jpeg', '.png', '.gif', '.webp', '.bmp', '.svg'];
-    // Common video extensions  
-    const videoExtensions = ['.mp4', '.webm', '.mov', '.avi', '.mkv', '.flv', '.wmv'];
+function allowRoomBot() {
+    const botId = parseInt(document.getElementById('roomBotsSelect').value, 10);
+    if (!botsModalRoom || !botId) {
+        return;
+    }
     
-    // Check if URL ends with media extension
+    fetch(`/api/rooms/${encodeURIComponent(botsModalRoom.name)}/bots`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ botId: botId })
+    })
+        .then(response => response.json().then(data => ({ ok: response.ok, data })))
+        .then(({ ok, data }) => {
+            if (!ok) {
+                throw new Error(data.error || 'Failed to allow bot');
+            }
+            loadRoomBots();
+        })
+        .catch(error => {
+            debugLog(`Error allowing bot: ${error}`);
+            alert(error.message);
+        });
+}
+
+function removeRoomBot(botId) {
+    if (!botsModalRoom) {
+        return;
+    }
+    
+    fetch(`/api/rooms/${encodeURIComponent(botsModalRoom.id)}/bots/${botId}`, { method: 'DELETE' })
+        .then(response => {
+            if (response.ok) {
+                loadRoomBots();
+            }
+        })
+        .catch(error => {
+            debugLog(`Error removing bot: ${error}`);
+        });
+}
+
+// Incoming and outgoing webhook management (room creators)
+let webhooksModalRoom = null;
+
+function showRoomWebhooksModal(roomId, roomName) {
+    webhooksModalRoom = { id: roomId, name: roomName };
+    document.getElementById('roomWebhooksTitle').textContent = `Webhooks for ${roomName}`;
+    document.getElementById('roomWebhookUrl').style.display = 'none';
+    document.getElementById('roomWebhookName').value = '';
+    document.getElementById('roomOutgoingWebhookSecret').style.display = 'none';
+    document.getElementById('roomOutgoingWebhookUrl').value = '';
+    document.getElementById('roomWebhooksModal').style.display = 'flex';
+    loadRoomWebhooks();
+    loadRoomOutgoingWebhooks();
+}
+
+function closeRoomWebhooksModal() {
+    document.getElementById('roomWebhooksModal').style.display = 'none';
+    webhooksModalRoom = null;
+}
+
+function loadRoomWebhooks() {
+    if (!webhooksModalRoom) {
+        return;
+    }
+    const list = document.getElementById('roomWebhooksList');
+    
+    fetch(`/api/rooms/${encodeURIComponent(webhooksModalRoom.name)}/webhooks`)
+        .then(response => response.json())
+        .then(data => {
+            const webhooks = data.webhooks || [];
+            list.innerHTML = webhooks.length === 0
+                ? '<div class="bookmarks-empty">No webhooks yet</div>'
+                : webhooks.map(webhook => {
+                    const lastUsed = webhook.last_used_at ? new Date(webhook.last_used_at).toLocaleString() : 'never';
+                    return `
+                        <div class="bookmark-item room-bot-item">
+                            <div class="bookmark-header">
+                                <span>${escapeHtml(webhook.name)} • ${escapeHtml(webhook.prefix)}… • last used ${escapeHtml(lastUsed)}</span>
+                                <button class="bookmark-remove" onclick="deleteRoomWebhook(${webhook.id})" title="Delete">×</button>
+                            </div>
+                        </div>
+                    `;
+                }).join('');
+        })
+        .catch(error => {
+            debugLog(`Error loading webhooks: ${error}`);
+        });
+}
+
+function createRoomWebhook() {
+    const name = document.getElementById('roomWebhookName').value.trim();
+    if (!webhooksModalRoom || !name) {
+        return;
+    }
+    
+    fetch(`/api/rooms/${encodeURIComponent(webhooksModalRoom.name)}/webhooks`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ name: name })
+    })
+        .then(response => response.json().then(data => ({ ok: response.ok, data })))
+        .then(({ ok, data }) => {
+            if (!ok) {
+                throw new Error(data.error || 'Failed to create webhook');
+            }
+            // The secret URL is only returned once
+            const urlBox = document.getElementById('roomWebhookUrl');
+            urlBox.textContent = `Copy this URL now, it will not be shown again: ${data.url}`;
+            urlBox.style.display = 'block';
+            document.getElementById('roomWebhookName').value = '';
+            loadRoomWebhooks();
+        })
+        .catch(error => {
+            debugLog(`Error creating webhook: ${error}`);
+            alert(error.message);
+        });
+}
+
+function deleteRoomWebhook(webhookId) {
+    if (!webhooksModalRoom || !confirm('Delete this webhook? Its URL will stop working.')) {
+        return;
+    }
+    
+    fetch(`/api/rooms/${encodeURIComponent(webhooksModalRoom.id)}/webhooks/${webhookId}`, { method: 'DELETE' })
+        .then(response => {
+            if (response.ok) {
+                loadRoomWebhooks();
+            }
+        })
+        .catch(error => {
+            debugLog(`Error deleting webhook: ${error}`);
+        });
+}
+
+function loadRoomOutgoingWebhooks() {
+    if (!webhooksModalRoom) {
+        return;
+    }
+    const list = document.getElementById('roomOutgoingWebhooksList');
+    
+    fetch(`/api/rooms/${encodeURIComponent(webhooksModalRoom.name)}/outgoing-webhooks`)
+        .then(response => response.json())
+        .then(data => {
+            const webhooks = data.webhooks || [];
+            list.innerHTML = webhooks.length === 0
+                ? '<div class="bookmarks-empty">No outgoing webhooks yet</div>'
+                : webhooks.map(webhook => `
+                    <div class="bookmark-item room-bot-item">
+                        <div class="bookmark-header">
+                            <span>${escapeHtml(webhook.url)}</span>
+                            <button class="bookmark-remove" onclick="deleteRoomOutgoingWebhook(${webhook.id})" title="Delete">×</button>
+                        </div>
+                        <div class="room-webhook-events">${escapeHtml(webhook.events.split(',').join(', '))}</div>
+                        <button class="room-webhook-deliveries-btn" onclick="toggleOutgoingWebhookDeliveries(${webhook.id})">Recent deliveries</button>
+                        <div id="outgoingWebhookDeliveries-${webhook.id}" class="room-webhook-deliveries" style="display: none;"></div>
+                    </div>
+                `).join('');
+        })
+        .catch(error => {
+            debugLog(`Error loading outgoing webhooks: ${error}`);
+        });
+}
+
+function createRoomOutgoingWebhook() {
+    const url = document.getElementById('roomOutgoingWebhookUrl').value.trim();
+    if (!webhooksModalRoom || !url) {
+        return;
+    }
+    
+    fetch(`/api/rooms/${encodeURIComponent(webhooksModalRoom.name)}/outgoing-webhooks`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ url: url })
+    })
+        .then(response => response.json().then(data => ({ ok: response.ok, data })))
+        .then(({ ok, data }) => {
+            if (!ok) {
+                throw new Error(data.error || 'Failed to add webhook');
+            }
+            // The signing secret is only returned once
+            const secretBox = document.getElementById('roomOutgoingWebhookSecret');
+            secretBox.textContent = `Copy this signing secret now, it will not be shown again: ${data.secret}`;
+            secretBox.style.display = 'block';
+            document.getElementById('roomOutgoingWebhookUrl').value = '';
+            loadRoomOutgoingWebhooks();
+        })
+        .catch(error => {
+            debugLog(`Error adding outgoing webhook: ${error}`);
+            alert(error.message);
+        });
+}
+
+function deleteRoomOutgoingWebhook(webhookId) {
+    if (!webhooksModalRoom || !confirm('Delete this webhook? Queued deliveries will be dropped.')) {
+        return;
+    }
+    
+    fetch(`/api/rooms/${encodeURIComponent(webhooksModalRoom.id)}/outgoing-webhooks/${webhookId}`, { method: 'DELETE' })
+        .then(response => {
+            if (response.ok) {
+                loadRoomOutgoingWebhooks();
+            }
+        })
+        .catch(error => {
+            debugLog(`Error deleting outgoing webhook: ${error}`);
+        });
+}
+
+function toggleOutgoingWebhookDeliveries(webhookId) {
+    const box = document.getElementById(`outgoingWebhookDeliveries-${webhookId}`);
+    if (box.style.display === 'block') {
+        box.style.display = 'none';
+        return;
+    }
+    box.style.display = 'block';
+    loadOutgoingWebhookDeliveries(webhookId);
+}
+
+function loadOutgoingWebhookDeliveries(webhookId) {
+    const box = document.getElementById(`outgoingWebhookDeliveries-${webhookId}`);
+    if (!webhooksModalRoom || !box) {
+        return;
+    }
+    
+    fetch(`/api/rooms/${encodeURIComponent(webhooksModalRoom.name)}/outgoing-webhooks/${webhookId}/deliveries?limit=10`)
+        .then(response => response.json())
+        .then(data => {
+            const deliveries = data.deliveries || [];
+            box.innerHTML = deliveries.length === 0
+                ? '<div class="bookmarks-empty">No deliveries yet</div>'
+                : deliveries.map(delivery => `
+                    <div class="room-webhook-delivery ${escapeHtml(delivery.status)}">
+                        <span>${escapeHtml(delivery.event_type)} • ${escapeHtml(delivery.status)} • ${delivery.attempts} attempt${delivery.attempts === 1 ? '' : 's'}${delivery.last_error ? ' • ' + escapeHtml(delivery.last_error) : ''}</span>
+                        ${delivery.status === 'dead' ? `<button onclick="retryOutgoingWebhookDelivery(${webhookId}, ${delivery.id})">Retry</button>` : ''}
+                    </div>
+                `).join('');
+        })
+        .catch(error => {
+            debugLog(`Error loading webhook deliveries: ${error}`);
+        });
+}
+
+function retryOutgoingWebhookDelivery(webhookId, deliveryId) {
+    if (!webhooksModalRoom) {
+        return;
+    }
+    
+    fetch(`/api/rooms/${encodeURIComponent(webhooksModalRoom.name)}/outgoing-webhooks/${webhookId}/deliveries/${deliveryId}/retry`, { method: 'POST' })
+        .then(() => loadOutgoingWebhookDeliveries(webhookId))
+        .catch(error => {
+            debugLog(`Error retrying webhook delivery: ${error}`);
+        });
+}
+
+// Slash command autocomplete; the room's commands are fetched once per room
+let roomCommandsCache = { room: null, commands: [] };
+
+function updateCommandSuggestions() {
+    const box = document.getElementById('commandSuggestions');
+    const match = messageInput.value.match(/^\/([a-z0-9_-]*)$/i);
+    if (!match || !currentRoom) {
+        box.style.display = 'none';
+        return;
+    }
+
+    const render = () => {
+        const prefix = match[1].toLowerCase();
+        const commands = roomCommandsCache.commands.filter(command => command.name.startsWith(prefix));
+        if (commands.length === 0) {
+            box.style.display = 'none';
+            return;
+        }
+        box.innerHTML = commands.map(command => `
+            <div class="command-suggestion" data-command="${escapeHtml(command.name)}">
+                <span class="command-name">/${escapeHtml(command.name)}</span>
+                ${command.usage ? `<span class="command-usage">${escapeHtml(command.usage)}</span>` : ''}
+                <span class="command-description">${escapeHtml(command.description || '')}${command.source !== 'builtin' ? ` • ${escapeHtml(command.source)}` : ''}</span>
+            </div>
+        `).join('');
+        box.querySelectorAll('.command-suggestion').forEach(el => {
+            el.addEventListener('mousedown', (e) => {
+                e.preventDefault();
+                completeCommand(el.getAttribute('data-command'));
+            });
+        });
+        box.style.display = 'block';
+    };
+
+    if (roomCommandsCache.room === currentRoom) {
+        render();
+        return;
+    }
+    const room = currentRoom;
+    fetch(`/api/rooms/${encodeURIComponent(room)}/commands`)
+        .then(response => response.json())
+        .then(data => {
+            roomCommandsCache = { room: room, commands: data.commands || [] };
+            render();
+        })
+        .catch(error => {
+            debugLog(`Error loading commands: ${error}`);
+        });
+}
+
+function completeCommand(name) {
+    messageInput.value = `/${name} `;
+    document.getElementById('commandSuggestions').style.display = 'none';
+    messageInput.focus();
+}
+
+function handleCommandSuggestionKeys(e) {
+    const box = document.getElementById('commandSuggestions');
+    if (box.style.display === 'none') {
+        return;
+    }
+    if (e.key === 'Escape') {
+        box.style.display = 'none';
+    } else if (e.key === 'Tab') {
+        const first = box.querySelector('.command-suggestion');
+        if (first) {
+            e.preventDefault();
+            completeCommand(first.getAttribute('data-command'));
+        }
+    }
+}
+
+// Download links for the room history export formats
+function exportMenuItemsHtml(roomName) {
+    const base = `/api/rooms/${encodeURIComponent(roomName)}/export`;
+    return ['json', 'csv', 'html'].map(format =>
+        `<a class="room-menu-item" href="${escapeHtml(base)}?format=${format}" download onclick="event.stopPropagation()">Export ${format.toUpperCase()}</a>`
+    ).join('');
+}
+
+// Close any open room menus
+function closeAllRoomMenus() {
+    document.querySelectorAll('.room-menu.show').forEach(m => m.classList.remove('show'));
+}
+
+// Delete a room via REST API
+function deleteRoom(roomId, roomName) {
+    if (!roomId) return;
+    if (!confirm(`Delete room "${roomName}"? This will remove all messages and media.`)) return;
+    fetch(`/api/rooms/${roomId}`, {
+        method: 'DELETE',
+        credentials: 'include'
+    })
+    .then(async (resp) => {
+        const data = await resp.json().catch(() => ({}));
+        if (!resp.ok || data.error) {
+            throw new Error(data.error || `HTTP ${resp.status}`);
+        }
+        // If deleting the current room, clear UI and return to start screen
+        if (currentRoom === roomName) {
+            clearMessages();
+            currentRoom = '';
+            updateConnectionStatus('Disconnected');
+            if (ws) {
+                try { ws.close(); } catch {}
+            }
+            // Hide chat, show start screen
+            chatInterface.classList.add('hidden');
+            if (startScreen) startScreen.classList.remove('hidden');
+        }
+        loadActiveRooms();
+        closeAllRoomMenus();
+    })
+    .catch(err => {
+        alert(`Failed to delete room: ${err.message}`);
+    });
+}
+
+function escapeHtml(text) {
+    const div = document.createElement('div');
+    div.textContent = text;
+    return div.innerHTML;
+}
+
+// URL media detection and handling
+function detectMediaUrl(text) {
+    // URL regex pattern to match HTTP/HTTPS URLs
+    const urlRegex = /(https?:\/\/[^\s]+)/gi;
+    const urls = text.match(urlRegex);
+    
+    if (!urls) return null;
+    
+    // Check each URL to see if it's a media file
+    for (const url of urls) {
+        if (isMediaUrl(url)) {
+            return url;
+        }
+    }
+    
+    return null;
+}
+
+function isMediaUrl(url) {
+    // Remove query parameters for extension checking
+    const urlWithoutParams = url.split('?')[0];
+    
+    // Common image extensions
+    const imageExtensions = ['.jpg', '.jpeg', '.png', '.gif', '.webp', '.bmp', '.svg'];
+    // Common video extensions  
+    const videoExtensions = ['.mp4', '.webm', '.mov', '.avi', '.mkv', '.flv', '.wmv'];
+    
+    // Check if URL ends with media extension
     const hasMediaExtension = [...imageExtensions, ...videoExtensions].some(ext => 
         urlWithoutParams.toLowerCase().endsWith(ext)
     );
@@ -1653,6 +2528,279 @@ function extractFilenameFromUrl(url) {
     }
 }
 
+// Uploaded images come with thumbnails, dimensions and a blurhash, so the
+// timeline can reserve their space and show a placeholder while they load
+function imageMediaHtml(message) {
+    const attributes = [];
+    const thumbnails = message.mediaThumbnails || [];
+    if (thumbnails.length > 0) {
+        const sources = thumbnails.map(t => `${escapeHtml(t.url)} ${t.width}w`);
+        if (message.mediaWidth) {
+            sources.push(`${escapeHtml(message.mediaUrl)} ${message.mediaWidth}w`);
+        }
+        attributes.push(`srcset="${sources.join(', ')}"`, 'sizes="300px"');
+    }
+    if (message.mediaWidth && message.mediaHeight) {
+        attributes.push(`width="${message.mediaWidth}"`, `height="${message.mediaHeight}"`);
+    }
+    const placeholder = message.mediaBlurhash ? blurhashToDataUrl(message.mediaBlurhash) : null;
+    if (placeholder) {
+        attributes.push(`style="background-image: url(${placeholder})"`, 'onload="this.style.backgroundImage = \'\'"');
+    }
+    return `<img src="${escapeHtml(message.mediaUrl)}" alt="Shared image" loading="lazy" ${attributes.join(' ')} onclick="openImageModal('${escapeHtml(message.mediaUrl)}')">`;
+}
+
+// Other uploads are shown as a download card with the file's name, type and size
+function fileAttachmentHtml(message) {
+    const name = message.fileName || message.mediaUrl.split('?')[0].split('/').pop();
+    const href = /^(https?:\/\/|\/)/i.test(message.mediaUrl) ? message.mediaUrl : '#';
+    const details = [message.mediaMimeType, message.mediaSize ? formatFileSize(message.mediaSize) : '']
+        .filter(Boolean).join(' · ');
+    return `
+        <a class="file-attachment" href="${escapeHtml(href)}" download="${escapeHtml(name)}" target="_blank" rel="noopener noreferrer">
+            <span class="file-attachment-icon">${fileIcon(message.mediaMimeType, name)}</span>
+            <span class="file-attachment-info">
+                <span class="file-attachment-name">${escapeHtml(name)}</span>
+                ${details ? `<span class="file-attachment-meta">${escapeHtml(details)}</span>` : ''}
+            </span>
+        </a>`;
+}
+
+// Voice messages show a waveform scrubber drawn from the levels computed by
+// the server; the audio itself is only downloaded once played
+function voiceMessageHtml(message) {
+    const levels = message.mediaWaveform && message.mediaWaveform.length ? message.mediaWaveform : new Array(40).fill(0);
+    const bars = levels.map(level => `<span class="voice-bar" style="height: ${Math.max(8, Math.min(100, Number(level) || 0))}%"></span>`).join('');
+    return `
+        <div class="voice-message" data-duration="${Number(message.mediaDuration) || 0}">
+            <button class="voice-play-btn" onclick="toggleVoicePlayback(this)" title="Play voice message">▶</button>
+            <div class="voice-waveform" onclick="seekVoiceMessage(event, this)">${bars}</div>
+            <span class="voice-duration">${formatDuration(message.mediaDuration)}</span>
+            <audio preload="none" src="${escapeHtml(message.mediaUrl)}"></audio>
+        </div>`;
+}
+
+function formatDuration(seconds) {
+    const total = Math.round(Number(seconds) || 0);
+    return `${Math.floor(total / 60)}:${String(total % 60).padStart(2, '0')}`;
+}
+
+function toggleVoicePlayback(button) {
+    const container = button.closest('.voice-message');
+    const audio = container.querySelector('audio');
+    if (!audio.paused) {
+        audio.pause();
+        return;
+    }
+    // Only one voice message plays at a time
+    document.querySelectorAll('.voice-message audio').forEach(other => {
+        if (other !== audio) other.pause();
+    });
+    bindVoiceMessageEvents(container, audio);
+    audio.play().catch(error => debugLog(`Voice message playback failed: ${error}`));
+}
+
+function bindVoiceMessageEvents(container, audio) {
+    if (audio.dataset.bound) return;
+    audio.dataset.bound = 'true';
+    
+    const button = container.querySelector('.voice-play-btn');
+    const label = container.querySelector('.voice-duration');
+    const duration = () => Number(container.dataset.duration) || audio.duration || 0;
+    
+    audio.addEventListener('play', () => { button.textContent = '⏸'; });
+    audio.addEventListener('pause', () => { button.textContent = '▶'; });
+    audio.addEventListener('ended', () => {
+        updateVoiceProgress(container, 0);
+        label.textContent = formatDuration(duration());
+    });
+    audio.addEventListener('timeupdate', () => {
+        const total = duration();
+        updateVoiceProgress(container, total ? audio.currentTime / total : 0);
+        label.textContent = formatDuration(audio.currentTime);
+    });
+}
+
+function updateVoiceProgress(container, fraction) {
+    const bars = container.querySelectorAll('.voice-bar');
+    const played = Math.round(fraction * bars.length);
+    bars.forEach((bar, i) => bar.classList.toggle('played', i < played));
+}
+
+// Clicking the waveform seeks to that point, using the duration from the
+// server since recordings often carry none the browser can read
+function seekVoiceMessage(event, waveform) {
+    const container = waveform.closest('.voice-message');
+    const audio = container.querySelector('audio');
+    const rect = waveform.getBoundingClientRect();
+    const fraction = Math.max(0, Math.min(1, (event.clientX - rect.left) / rect.width));
+    const total = Number(container.dataset.duration) || audio.duration || 0;
+    
+    bindVoiceMessageEvents(container, audio);
+    updateVoiceProgress(container, fraction);
+    const seek = () => { audio.currentTime = fraction * total; };
+    if (audio.readyState >= 1) {
+        seek();
+    } else {
+        audio.addEventListener('loadedmetadata', seek, { once: true });
+    }
+    if (audio.paused) {
+        toggleVoicePlayback(container.querySelector('.voice-play-btn'));
+    }
+}
+
+let voiceRecorder = null;
+
+// Records a voice message from the microphone as Opus audio. When recording
+// stops it is attached like a selected file, so it can get a caption or be removed.
+async function toggleVoiceRecording() {
+    const button = document.getElementById('voiceRecordBtn');
+    if (voiceRecorder && voiceRecorder.state === 'recording') {
+        voiceRecorder.stop();
+        return;
+    }
+    if (!navigator.mediaDevices || !window.MediaRecorder) {
+        alert('Voice recording is not supported in this browser.');
+        return;
+    }
+    const mimeType = ['audio/webm;codecs=opus', 'audio/ogg;codecs=opus'].find(type => MediaRecorder.isTypeSupported(type));
+    if (!mimeType) {
+        alert('This browser cannot record voice messages.');
+        return;
+    }
+    
+    let stream;
+    try {
+        stream = await navigator.mediaDevices.getUserMedia({ audio: true });
+    } catch (error) {
+        debugLog(`Microphone access failed: ${error}`);
+        alert('Could not access the microphone.');
+        return;
+    }
+    
+    const chunks = [];
+    voiceRecorder = new MediaRecorder(stream, { mimeType });
+    voiceRecorder.ondataavailable = (e) => {
+        if (e.data.size > 0) chunks.push(e.data);
+    };
+    voiceRecorder.onstop = () => {
+        stream.getTracks().forEach(track => track.stop());
+        button.classList.remove('recording');
+        button.title = 'Record voice message';
+        voiceRecorder = null;
+        
+        const type = mimeType.split(';')[0];
+        const file = new File(chunks, `Voice message.${type === 'audio/ogg' ? 'ogg' : 'webm'}`, { type });
+        debugLog(`Voice message recorded: ${file.size} bytes`);
+        selectedFile = file;
+        showMediaPreview(file);
+    };
+    voiceRecorder.start();
+    button.classList.add('recording');
+    button.title = 'Stop recording';
+    debugLog(`Recording voice message as ${mimeType}`);
+}
+
+function formatFileSize(bytes) {
+    const units = ['B', 'KB', 'MB', 'GB'];
+    let size = bytes;
+    let unit = 0;
+    while (size >= 1024 && unit < units.length - 1) {
+        size /= 1024;
+        unit++;
+    }
+    return `${unit === 0 ? size : size.toFixed(1)} ${units[unit]}`;
+}
+
+function fileIcon(mimeType, name) {
+    const type = mimeType || '';
+    if (type.startsWith('audio/')) return name.startsWith('Voice message') ? '🎤' : '🎵';
+    if (type === 'application/pdf') return '📕';
+    if (type.startsWith('text/') || type === 'application/json') return '📄';
+    if (/zip|gzip|tar|rar|7z|bzip|xz/.test(type)) return '🗜️';
+    if (/spreadsheet|excel|\.(xlsx?|ods|csv)$/i.test(type + ' ' + name)) return '📊';
+    if (/presentation|powerpoint/.test(type)) return '📽️';
+    if (/word|opendocument\.text/.test(type)) return '📝';
+    return '📎';
+}
+
+const BLURHASH_CHARS = '0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~';
+
+// Decodes a blurhash into a small image data URL, or null if it is invalid
+function blurhashToDataUrl(hash, width = 32, height = 32) {
+    const decode83 = str => {
+        let value = 0;
+        for (const c of str) {
+            const digit = BLURHASH_CHARS.indexOf(c);
+            if (digit < 0) return NaN;
+            value = value * 83 + digit;
+        }
+        return value;
+    };
+    const srgbToLinear = value => {
+        const v = value / 255;
+        return v <= 0.04045 ? v / 12.92 : Math.pow((v + 0.055) / 1.055, 2.4);
+    };
+    const linearToSrgb = value => {
+        const v = Math.max(0, Math.min(1, value));
+        return v <= 0.0031308 ? Math.round(v * 12.92 * 255) : Math.round((1.055 * Math.pow(v, 1 / 2.4) - 0.055) * 255);
+    };
+    const signPow = (value, exp) => Math.sign(value) * Math.pow(Math.abs(value), exp);
+
+    if (!hash || hash.length < 6) return null;
+    const sizeFlag = decode83(hash[0]);
+    const numY = Math.floor(sizeFlag / 9) + 1;
+    const numX = (sizeFlag % 9) + 1;
+    if (hash.length !== 4 + 2 * numX * numY) return null;
+    const maximum = (decode83(hash[1]) + 1) / 166;
+
+    const colors = [];
+    const dc = decode83(hash.substring(2, 6));
+    colors.push([srgbToLinear(dc >> 16), srgbToLinear((dc >> 8) & 255), srgbToLinear(dc & 255)]);
+    for (let i = 1; i < numX * numY; i++) {
+        const value = decode83(hash.substring(4 + i * 2, 6 + i * 2));
+        const quant = q => signPow((q - 9) / 9, 2) * maximum;
+        colors.push([quant(Math.floor(value / 361)), quant(Math.floor(value / 19) % 19), quant(value % 19)]);
+    }
+    if (colors.some(color => color.some(Number.isNaN))) return null;
+
+    const canvas = document.createElement('canvas');
+    canvas.width = width;
+    canvas.height = height;
+    const context = canvas.getContext('2d');
+    const imageData = context.createImageData(width, height);
+    for (let y = 0; y < height; y++) {
+        for (let x = 0; x < width; x++) {
+            let r = 0, g = 0, b = 0;
+            for (let j = 0; j < numY; j++) {
+                for (let i = 0; i < numX; i++) {
+                    const basis = Math.cos(Math.PI * x * i / width) * Math.cos(Math.PI * y * j / height);
+                    const color = colors[i + j * numX];
+                    r += color[0] * basis;
+                    g += color[1] * basis;
+                    b += color[2] * basis;
+                }
+            }
+            const offset = 4 * (x + y * width);
+            imageData.data[offset] = linearToSrgb(r);
+            imageData.data[offset + 1] = linearToSrgb(g);
+            imageData.data[offset + 2] = linearToSrgb(b);
+            imageData.data[offset + 3] = 255;
+        }
+    }
+    context.putImageData(imageData, 0, 0);
+    return canvas.toDataURL();
+}
+
+// The server sends a sanitized HTML rendering of the message's Markdown;
+// messages stored before rendering existed fall back to escaped text with links
+function messageTextHtml(message) {
+    if (message.html) {
+        return message.html;
+    }
+    return processLinksInText(escapeHtml(message.text));
+}
+
 // Function to convert URLs in text to clickable links
 function processLinksInText(text) {
     if (!text) return text;
@@ -1761,10 +2909,9 @@ function handlePaste(event) {
             if (file) {
                 debugLog(`Pasted image file: ${file.name}, size: ${file.size}, type: ${file.type}`);
 
-                // Validate file size (10MB for dev tunnel compatibility)
-                const maxSize = 10 * 1024 * 1024; // 10MB
-                if (file.size > maxSize) {
-                    alert('Image too large. Maximum size is 10MB.');
+                // Validate file size
+                if (file.size > MAX_UPLOAD_SIZE) {
+                    alert('Image too large. Maximum size is 50MB.');
                     return;
                 }
 
@@ -1787,19 +2934,12 @@ function handleFileSelect(event) {
 
     debugLog(`File selected: name=${file.name}, size=${file.size}, type=${file.type}`);
 
-    // Validate file type
-    const allowedTypes = ['image/jpeg', 'image/jpg', 'image/png', 'image/gif', 'image/webp', 'video/mp4', 'video/webm', 'video/mov', 'video/avi'];
-    if (!allowedTypes.includes(file.type)) {
-        alert('File type not supported. Please upload an image (JPEG, PNG, GIF, WebP) or video (MP4, WebM, MOV, AVI).');
-        debugLog(`File type not allowed: ${file.type}`);
-        return;
-    }
+    // The server checks the file's content against the allowed types on upload
 
-    // Validate file size (10MB for dev tunnel compatibility)
-    const maxSize = 10 * 1024 * 1024; // 10MB
-    if (file.size > maxSize) {
-        alert('File too large. Maximum size is 10MB.');
-        debugLog(`File too large: ${file.size} bytes (max: ${maxSize} bytes)`);
+    // Validate file size
+    if (file.size > MAX_UPLOAD_SIZE) {
+        alert('File too large. Maximum size is 50MB.');
+        debugLog(`File too large: ${file.size} bytes (max: ${MAX_UPLOAD_SIZE} bytes)`);
         return;
     }
 
@@ -1814,6 +2954,8 @@ function clearExistingPreviews() {
     
     debugLog('Clearing existing previews only...');
     
+    hideFilePreview();
+    
     // Clear image preview
     imagePreview.classList.remove('show');
     imagePreview.style.display = 'none';
@@ -1952,10 +3094,44 @@ function showMediaPreview(file) {
         
         debugLog('Video preview shown');
     } else {
-        debugLog(`Unknown file type: ${file.type}`);
+        URL.revokeObjectURL(url);
+        showFilePreview(file);
     }
 }
 
+// Other files are previewed as a card with their name and size
+function showFilePreview(file) {
+    const filePreview = document.getElementById('filePreview');
+    filePreview.innerHTML = `
+        <span class="file-attachment-icon">${fileIcon(file.type, file.name)}</span>
+        <span class="file-attachment-info">
+            <span class="file-attachment-name">${escapeHtml(file.name)}</span>
+            <span class="file-attachment-meta">${escapeHtml(formatFileSize(file.size))}</span>
+        </span>`;
+    filePreview.title = 'Click to remove attachment';
+    filePreview.onclick = (e) => {
+        e.preventDefault();
+        e.stopPropagation();
+        clearMediaPreview();
+        debugLog('File preview deleted by clicking on preview');
+    };
+    filePreview.classList.add('show');
+    
+    // Add visual feedback to input
+    messageInput.classList.add('has-media');
+    messageInput.focus();
+    messageInput.placeholder = '📎 File ready! Click the file to remove, or add caption and press Enter to share.';
+    
+    debugLog('File preview shown');
+}
+
+function hideFilePreview() {
+    const filePreview = document.getElementById('filePreview');
+    filePreview.classList.remove('show');
+    filePreview.innerHTML = '';
+    filePreview.onclick = null;
+}
+
 function addDeleteButton(previewElement) {
     // Ensure the preview element has relative positioning
     previewElement.style.position = 'relative';
@@ -2015,6 +3191,8 @@ function clearMediaPreview() {
     
     debugLog('Clearing media preview...');
     
+    hideFilePreview();
+    
     // Clear image preview
     imagePreview.classList.remove('show');
     imagePreview.style.display = 'none';
@@ -2057,7 +3235,17 @@ function clearMediaPreview() {
     debugLog('Media preview cleared and placeholder reset');
 }
 
+// Files larger than one chunk are sent with the tus resumable upload protocol,
+// in chunks small enough for dev tunnels, and resume after a dropped connection
+const MAX_UPLOAD_SIZE = 50 * 1024 * 1024; // 50MB
+const TUS_ENDPOINT = '/api/uploads/tus';
+const TUS_CHUNK_SIZE = 2 * 1024 * 1024; // 2MB
+const TUS_MAX_RETRIES = 5;
+
 function uploadFile(file) {
+    if (file.size > TUS_CHUNK_SIZE) {
+        return uploadFileResumable(file);
+    }
     return new Promise((resolve, reject) => {
         debugLog(`Starting upload for file: ${file.name} (${file.size} bytes, ${file.type})`);
         
@@ -2107,7 +3295,13 @@ function uploadFile(file) {
                 }
             } else {
                 debugLog(`Upload failed - HTTP ${xhr.status}: ${xhr.responseText}`);
-                reject(new Error(`Upload failed with status ${xhr.status}`));
+                let message = `Upload failed with status ${xhr.status}`;
+                try {
+                    message = JSON.parse(xhr.responseText).error || message;
+                } catch (e) {
+                    // Not a JSON error response
+                }
+                reject(new Error(message));
             }
         };
 
@@ -2122,6 +3316,138 @@ function uploadFile(file) {
     });
 }
 
+function setUploadProgress(percent, text) {
+    document.getElementById('uploadProgress').classList.add('show');
+    document.getElementById('uploadProgressFill').style.width = `${percent}%`;
+    document.getElementById('uploadPercent').textContent = `${percent}%`;
+    document.getElementById('uploadText').textContent = text;
+}
+
+function tusRequest(method, url, headers = {}, body = null) {
+    return fetch(url, {
+        method,
+        headers: { 'Tus-Resumable': '1.0.0', ...headers },
+        body,
+        credentials: 'same-origin'
+    });
+}
+
+// The key under which an unfinished upload of this file is remembered
+function tusResumeKey(file) {
+    return `tusUpload:${file.name}:${file.size}:${file.lastModified}`;
+}
+
+async function createTusUpload(file) {
+    const metadata = [
+        `filename ${btoa(unescape(encodeURIComponent(file.name)))}`,
+        `filetype ${btoa(file.type || 'application/octet-stream')}`
+    ].join(',');
+    const response = await tusRequest('POST', TUS_ENDPOINT, {
+        'Upload-Length': String(file.size),
+        'Upload-Metadata': metadata
+    });
+    if (response.status !== 201) {
+        let message = `Upload failed with status ${response.status}`;
+        try {
+            message = (await response.json()).error || message;
+        } catch (e) {
+            // Not a JSON error response
+        }
+        throw new Error(message);
+    }
+    return response.headers.get('Location');
+}
+
+// Returns how much of an earlier upload the server has, or null if it is gone
+async function getTusOffset(url) {
+    const response = await tusRequest('HEAD', url);
+    if (response.status !== 200) {
+        return null;
+    }
+    return parseInt(response.headers.get('Upload-Offset'), 10);
+}
+
+async function uploadFileResumable(file) {
+    debugLog(`Starting resumable upload for file: ${file.name} (${file.size} bytes, ${file.type})`);
+    setUploadProgress(0, 'Uploading');
+
+    const resumeKey = tusResumeKey(file);
+    try {
+        let url = localStorage.getItem(resumeKey);
+        let offset = url ? await getTusOffset(url) : null;
+        if (offset === null) {
+            url = await createTusUpload(file);
+            offset = 0;
+            localStorage.setItem(resumeKey, url);
+        } else {
+            debugLog(`Resuming upload ${url} at ${offset} bytes`);
+        }
+
+        let retries = 0;
+        while (true) {
+            if (offset >= file.size) {
+                // The last chunk arrived but its response was lost
+                const response = await tusRequest('GET', url);
+                return await finishTusUpload(response, resumeKey);
+            }
+
+            setUploadProgress(Math.round((offset / file.size) * 100), 'Uploading');
+            let response;
+            try {
+                response = await tusRequest('PATCH', url, {
+                    'Content-Type': 'application/offset+octet-stream',
+                    'Upload-Offset': String(offset)
+                }, file.slice(offset, offset + TUS_CHUNK_SIZE));
+            } catch (e) {
+                response = null;
+            }
+
+            if (response && response.status === 204) {
+                offset = parseInt(response.headers.get('Upload-Offset'), 10);
+                retries = 0;
+                continue;
+            }
+            if (response && response.status === 200) {
+                setUploadProgress(100, 'Processing');
+                return await finishTusUpload(response, resumeKey);
+            }
+            if (response && response.status !== 409 && response.status < 500) {
+                return await finishTusUpload(response, resumeKey);
+            }
+
+            // Network error, server error or offset mismatch: ask the server where to resume
+            if (++retries > TUS_MAX_RETRIES) {
+                throw new Error('Network error during upload');
+            }
+            debugLog(`Upload chunk failed, retry ${retries} of ${TUS_MAX_RETRIES}`);
+            await new Promise(resolve => setTimeout(resolve, 1000 * retries));
+            const serverOffset = await getTusOffset(url).catch(() => null);
+            if (serverOffset === null) {
+                continue;
+            }
+            offset = serverOffset;
+        }
+    } finally {
+        document.getElementById('uploadProgress').classList.remove('show');
+    }
+}
+
+async function finishTusUpload(response, resumeKey) {
+    let result = null;
+    try {
+        result = await response.json();
+    } catch (e) {
+        // Not a JSON response
+    }
+    localStorage.removeItem(resumeKey);
+
+    if (response.status === 200 && result && result.success) {
+        return result;
+    }
+    debugLog(`Upload failed - HTTP ${response.status}: ${JSON.stringify(result)}`);
+    throw new Error((result && result.error) || `Upload failed with status ${response.status}`);
+}
+
 function sendMediaMessage() {
     if (!selectedFile || isUploading) {
         return;
@@ -2241,25 +3567,50 @@ function deleteMessage(messageId) {
     }
 }
 
-function handleMessageDeletion(messageId) {
+function moderateDeleteMessage(messageId) {
+    debugLog(`Attempting to remove message as moderator: ${messageId}`);
+    
+    // Ask for an optional reason; cancelling aborts the removal
+    const reason = prompt('Remove this message? Optionally enter a reason:', '');
+    if (reason === null) {
+        return;
+    }
+    
+    if (!ws || ws.readyState !== WebSocket.OPEN) {
+        alert('Connection lost. Please refresh and try again.');
+        return;
+    }
+    
+    try {
+        ws.send(JSON.stringify({
+            type: 'delete',
+            messageId: messageId,
+            reason: reason.trim()
+        }));
+    } catch (error) {
+        debugLog(`Error sending moderator delete request: ${error}`);
+        alert('Failed to remove message. Please try again.');
+    }
+}
+
+function handleMessageDeletion(messageId, deletedBy) {
     debugLog(`Handling message deletion for ID: ${messageId}`);
     
-    // Find and remove the message element from the UI using data attribute
+    // Find the message element and replace it with a tombstone in place
     const messageEl = messagesContainer.querySelector(`[data-message-id="${messageId}"]`);
     if (messageEl) {
-        // Add deletion animation class
-        messageEl.classList.add('deleting');
-        
-        // Remove the element after animation completes
-        setTimeout(() => {
-            if (messageEl.parentNode) {
-                messageEl.parentNode.removeChild(messageEl);
-            }
-            debugLog(`Message ${messageId} removed from UI`);
-        }, 500); // Match animation duration
+        const tombstoneText = deletedBy === 'moderator' ? 'message removed by moderator' : 'message deleted';
+        messageEl.className = 'message system tombstone no-animation';
+        messageEl.innerHTML = `<div>${escapeHtml(tombstoneText)}</div>`;
+        debugLog(`Message ${messageId} replaced with tombstone`);
     } else {
         debugLog(`Message element with ID ${messageId} not found in UI`);
     }
+
+    // Replies quoting the deleted message lose the quoted content
+    messagesContainer.querySelectorAll(`[data-reply-to-id="${messageId}"] .reply-reference-content`).forEach(content => {
+        content.textContent = 'message deleted';
+    });
 }
 
 // Reply functionality
@@ -2448,6 +3799,63 @@ function toggleReaction(messageId, emoji) {
     addReaction(messageId, emoji);
 }
 
+// Link previews are fetched by the server after a message is sent
+function linkPreviewsHtml(previews) {
+    if (!previews || previews.length === 0) {
+        return '';
+    }
+    const cards = previews.map(preview => {
+        const imageHtml = preview.image ?
+            `<img class="link-preview-image" src="${escapeHtml(preview.image)}" alt="" loading="lazy" referrerpolicy="no-referrer">` : '';
+        const siteHtml = preview.siteName ?
+            `<div class="link-preview-site">${escapeHtml(preview.siteName)}</div>` : '';
+        const descriptionHtml = preview.description ?
+            `<div class="link-preview-description">${escapeHtml(preview.description)}</div>` : '';
+        return `
+            <a class="link-preview" href="${escapeHtml(preview.url)}" target="_blank" rel="noopener noreferrer nofollow">
+                <div class="link-preview-text">
+                    ${siteHtml}
+                    <div class="link-preview-title">${escapeHtml(preview.title || preview.url)}</div>
+                    ${descriptionHtml}
+                </div>
+                ${imageHtml}
+            </a>`;
+    }).join('');
+    return `<div class="link-previews">${cards}</div>`;
+}
+
+function updateMessageLinkPreviews(messageData) {
+    const messageElement = document.querySelector(`[data-message-id="${messageData.id}"]`);
+    if (!messageElement) {
+        return;
+    }
+    const messageContent = messageElement.querySelector('.message-content');
+    if (!messageContent) {
+        return;
+    }
+
+    const existing = messageContent.querySelector('.link-previews');
+    if (existing) {
+        existing.remove();
+    }
+    const previewsHtml = linkPreviewsHtml(messageData.linkPreviews);
+    if (!previewsHtml) {
+        return;
+    }
+    const reactionsContainer = messageContent.querySelector('.message-reactions');
+    if (reactionsContainer) {
+        reactionsContainer.insertAdjacentHTML('beforebegin', previewsHtml);
+    } else {
+        messageContent.insertAdjacentHTML('beforeend', previewsHtml);
+    }
+
+    // Keep the newest message in view when its preview makes it taller
+    if (!isUserScrolledUp) {
+        scrollToBottom();
+    }
+    debugLog(`Updated link previews for message ${messageData.id}`);
+}
+
 // Update message with new reaction data
 function updateMessageReactions(messageData) {
     const messageElement = document.querySelector(`[data-message-id="${messageData.id}"]`);
@@ -2504,6 +3912,7 @@ window.addEventListener('load', () => {
             
             // Load active rooms after authentication is confirmed
             loadActiveRooms();
+            openPermalinkFromUrl();
         } else {
             debugLog('User not authenticated');
             // Clear any saved room if not authenticated
@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// LocalStorage keeps files in a directory on the local filesystem. The app
+// serves them itself, so it hands out no signed URLs.
+type LocalStorage struct {
+	dir string
+}
+
+// NewLocalStorage creates a store in dir, creating the directory if needed
+func NewLocalStorage(dir string) (*LocalStorage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create upload directory: %w", err)
+	}
+	return &LocalStorage{dir: dir}, nil
+}
+
+func (s *LocalStorage) path(key string) (string, error) {
+	if !ValidKey(key) {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(s.dir, key), nil
+}
+
+// Put writes data to a file named key
+func (s *LocalStorage) Put(key string, data io.Reader, contentType string) (int64, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return 0, err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create file: %w", err)
+	}
+	size, err := io.Copy(file, data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return 0, fmt.Errorf("failed to write file: %w", err)
+	}
+	return size, nil
+}
+
+// Get opens the file named key
+func (s *LocalStorage) Get(key string) (*Object, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, ErrNotFound
+	}
+	return &Object{ReadSeekCloser: file, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// Delete removes the file named key
+func (s *LocalStorage) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// List calls fn for every file in the directory. Subdirectories, such as the
+// one holding partial resumable uploads, and hidden files are skipped.
+func (s *LocalStorage) List(fn func(ObjectInfo) error) error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("failed to list upload directory: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !ValidKey(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if os.IsNotExist(err) {
+			continue // Deleted since the directory was read
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(ObjectInfo{Key: entry.Name(), Size: info.Size(), ModTime: info.ModTime()}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SignedURL is not supported: local files are only reachable through the app
+func (s *LocalStorage) SignedURL(key string, expiry time.Duration, options SignedURLOptions) (string, error) {
+	return "", ErrSignedURLsUnsupported
+}
@@ -0,0 +1,523 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSignedURLExpiry is the longest a SigV4 presigned URL may be valid
+const maxSignedURLExpiry = 7 * 24 * time.Hour
+
+// S3Config describes an S3-compatible bucket
+type S3Config struct {
+	Endpoint        string // e.g. "https://s3.eu-west-1.amazonaws.com" or "http://localhost:9000" for MinIO
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	Prefix          string // Prepended to every key, e.g. "uploads/"
+	PathStyle       bool   // Address the bucket as endpoint/bucket rather than bucket.endpoint
+}
+
+// S3Storage keeps files in an S3-compatible bucket (AWS S3, MinIO, R2...).
+// Requests are signed with AWS Signature Version 4.
+type S3Storage struct {
+	config   S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+// NewS3StorageFromEnv creates an S3 store from the S3_* environment variables
+func NewS3StorageFromEnv() (*S3Storage, error) {
+	pathStyle := true
+	if value := os.Getenv("S3_PATH_STYLE"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3_PATH_STYLE %q", value)
+		}
+		pathStyle = parsed
+	}
+	return NewS3Storage(S3Config{
+		Endpoint:        os.Getenv("S3_ENDPOINT"),
+		Region:          os.Getenv("S3_REGION"),
+		Bucket:          os.Getenv("S3_BUCKET"),
+		AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		Prefix:          os.Getenv("S3_PREFIX"),
+		PathStyle:       pathStyle,
+	})
+}
+
+// NewS3Storage creates a store for the bucket described by config
+func NewS3Storage(config S3Config) (*S3Storage, error) {
+	if config.Bucket == "" || config.AccessKeyID == "" || config.SecretAccessKey == "" {
+		return nil, errors.New("S3 storage needs a bucket, an access key ID and a secret access key")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = "https://s3." + config.Region + ".amazonaws.com"
+	}
+	endpoint, err := url.Parse(strings.TrimRight(config.Endpoint, "/"))
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", config.Endpoint)
+	}
+
+	return &S3Storage{
+		config:   config,
+		endpoint: endpoint,
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:                 http.ProxyFromEnvironment,
+				DialContext:           (&net.Dialer{Timeout: 10 * time.Second}).DialContext,
+				TLSHandshakeTimeout:   10 * time.Second,
+				ResponseHeaderTimeout: 30 * time.Second,
+				MaxIdleConnsPerHost:   16,
+			},
+		},
+	}, nil
+}
+
+// bucketURL returns the unsigned URL of the bucket
+func (s *S3Storage) bucketURL() url.URL {
+	bucketURL := *s.endpoint
+	if s.config.PathStyle {
+		bucketURL.Path = s.endpoint.Path + "/" + s.config.Bucket
+	} else {
+		bucketURL.Host = s.config.Bucket + "." + s.endpoint.Host
+		bucketURL.Path = s.endpoint.Path
+	}
+	bucketURL.RawPath = ""
+	return bucketURL
+}
+
+// objectURL returns the unsigned URL of the object stored under key
+func (s *S3Storage) objectURL(key string) (*url.URL, error) {
+	if !ValidKey(key) {
+		return nil, ErrInvalidKey
+	}
+	objectURL := s.bucketURL()
+	objectURL.Path += "/" + s.config.Prefix + key
+	return &objectURL, nil
+}
+
+// Put uploads data to the bucket. S3 needs the length and, for a signed
+// payload, the hash of the body up front, so data is spooled to a temporary
+// file first.
+func (s *S3Storage) Put(key string, data io.Reader, contentType string) (int64, error) {
+	objectURL, err := s.objectURL(key)
+	if err != nil {
+		return 0, err
+	}
+
+	spool, err := os.CreateTemp("", "s3-upload-*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(spool, hash), data)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read upload: %w", err)
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("failed to rewind temporary file: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPut, objectURL.String(), spool)
+	if err != nil {
+		return 0, err
+	}
+	req.ContentLength = size
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.signRequest(req, hex.EncodeToString(hash.Sum(nil)), time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, s3Error(resp, "upload "+key)
+	}
+	return size, nil
+}
+
+// Get looks the object up and returns a reader that fetches its content
+// lazily with range requests, so seeking does not download anything
+func (s *S3Storage) Get(key string) (*Object, error) {
+	objectURL, err := s.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodHead, objectURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	s.signRequest(req, emptyPayloadHash, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up %s: %w", key, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, s3Error(resp, "look up "+key)
+	}
+
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return &Object{
+		ReadSeekCloser: &s3Reader{storage: s, url: objectURL, key: key, size: resp.ContentLength},
+		Size:           resp.ContentLength,
+		ModTime:        modTime,
+	}, nil
+}
+
+// Delete removes the object from the bucket
+func (s *S3Storage) Delete(key string) error {
+	objectURL, err := s.objectURL(key)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodDelete, objectURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	s.signRequest(req, emptyPayloadHash, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s3Error(resp, "delete "+key)
+	}
+	return nil
+}
+
+// SignedURL returns a presigned GET URL for the object. The bucket answers it
+// with the Content-Type and Content-Disposition given in options.
+func (s *S3Storage) SignedURL(key string, expiry time.Duration, options SignedURLOptions) (string, error) {
+	return s.presign(key, expiry, options, time.Now())
+}
+
+func (s *S3Storage) presign(key string, expiry time.Duration, options SignedURLOptions, now time.Time) (string, error) {
+	objectURL, err := s.objectURL(key)
+	if err != nil {
+		return "", err
+	}
+	expiry = min(max(expiry, time.Second), maxSignedURLExpiry)
+
+	now = now.UTC()
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", s.config.AccessKeyID+"/"+s.credentialScope(now))
+	query.Set("X-Amz-Date", now.Format(amzDateFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expiry.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	if options.ContentType != "" {
+		query.Set("response-content-type", options.ContentType)
+	}
+	if options.ContentDisposition != "" {
+		query.Set("response-content-disposition", options.ContentDisposition)
+	}
+
+	canonicalQuery := canonicalQueryString(query)
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		canonicalURI(objectURL.Path),
+		canonicalQuery,
+		"host:" + objectURL.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	signature := s.sign(canonicalRequest, now)
+
+	objectURL.RawQuery = canonicalQuery + "&X-Amz-Signature=" + signature
+	return objectURL.String(), nil
+}
+
+// listObjectsResult is the part of a ListObjectsV2 response List reads
+type listObjectsResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List pages through the objects under the prefix with ListObjectsV2. Keys
+// that could not have been stored, such as ones below a further "/", are
+// skipped.
+func (s *S3Storage) List(fn func(ObjectInfo) error) error {
+	continuationToken := ""
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		if s.config.Prefix != "" {
+			query.Set("prefix", s.config.Prefix)
+		}
+		if continuationToken != "" {
+			query.Set("continuation-token", continuationToken)
+		}
+		listURL := s.bucketURL()
+		listURL.RawQuery = canonicalQueryString(query)
+
+		req, err := http.NewRequest(http.MethodGet, listURL.String(), nil)
+		if err != nil {
+			return err
+		}
+		s.signRequest(req, emptyPayloadHash, time.Now())
+
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to list objects: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			defer resp.Body.Close()
+			return s3Error(resp, "list objects")
+		}
+		var result listObjectsResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read object list: %w", err)
+		}
+
+		for _, object := range result.Contents {
+			key, ok := strings.CutPrefix(object.Key, s.config.Prefix)
+			if !ok || !ValidKey(key) {
+				continue
+			}
+			if err := fn(ObjectInfo{Key: key, Size: object.Size, ModTime: object.LastModified}); err != nil {
+				return err
+			}
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return nil
+		}
+		continuationToken = result.NextContinuationToken
+	}
+}
+
+// s3Reader reads an object with ranged GET requests from its current offset
+type s3Reader struct {
+	storage *S3Storage
+	url     *url.URL
+	key     string
+	size    int64
+	offset  int64
+	body    io.ReadCloser
+}
+
+func (r *s3Reader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		req, err := http.NewRequest(http.MethodGet, r.url.String(), nil)
+		if err != nil {
+			return 0, err
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", r.offset))
+		r.storage.signRequest(req, emptyPayloadHash, time.Now())
+
+		resp, err := r.storage.client.Do(req)
+		if err != nil {
+			return 0, fmt.Errorf("failed to download %s: %w", r.key, err)
+		}
+		if resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusOK {
+			defer resp.Body.Close()
+			return 0, s3Error(resp, "download "+r.key)
+		}
+		if resp.StatusCode == http.StatusOK && r.offset > 0 {
+			// The range was ignored; skip to the offset
+			if _, err := io.CopyN(io.Discard, resp.Body, r.offset); err != nil {
+				resp.Body.Close()
+				return 0, fmt.Errorf("failed to download %s: %w", r.key, err)
+			}
+		}
+		r.body = resp.Body
+	}
+
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *s3Reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return 0, errors.New("seek before start of object")
+	}
+	if offset != r.offset {
+		r.Close()
+		r.offset = offset
+	}
+	return offset, nil
+}
+
+func (r *s3Reader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
+
+// s3Error describes an unexpected response, with the error code S3 sent
+func s3Error(resp *http.Response, action string) error {
+	var body struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body); err == nil && body.Code != "" {
+		return fmt.Errorf("failed to %s: %s: %s", action, body.Code, body.Message)
+	}
+	return fmt.Errorf("failed to %s: %s", action, resp.Status)
+}
+
+// AWS Signature Version 4
+// (https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-authenticating-requests.html)
+
+const (
+	amzDateFormat = "20060102T150405Z"
+	// emptyPayloadHash is the SHA-256 of an empty body
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// signRequest adds the SigV4 Authorization header to a request whose body has
+// the given SHA-256 hash. Host, Range and x-amz-* headers are signed.
+func (s *S3Storage) signRequest(req *http.Request, payloadHash string, now time.Time) {
+	now = now.UTC()
+	req.Header.Set("X-Amz-Date", now.Format(amzDateFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") || name == "range" || name == "content-type" {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI(req.URL.Path),
+		canonicalQueryString(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.config.AccessKeyID, s.credentialScope(now), signedHeaders, s.sign(canonicalRequest, now),
+	))
+}
+
+func (s *S3Storage) credentialScope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.config.Region + "/s3/aws4_request"
+}
+
+// sign returns the hex signature of a canonical request made at now
+func (s *S3Storage) sign(canonicalRequest string, now time.Time) string {
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		now.Format(amzDateFormat),
+		s.credentialScope(now),
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.config.SecretAccessKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalURI encodes each segment of a path as SigV4 expects for S3
+func canonicalURI(path string) string {
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = uriEncode(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// canonicalQueryString sorts and encodes query parameters as SigV4 expects
+func canonicalQueryString(query url.Values) string {
+	pairs := make([]string, 0, len(query))
+	for key, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(key)+"="+uriEncode(value))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent-encodes everything but the RFC 3986 unreserved characters
+func uriEncode(value string) string {
+	var encoded strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			encoded.WriteByte(c)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", c)
+		}
+	}
+	return encoded.String()
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MediaURLPrefix starts the URL of every stored upload
+const MediaURLPrefix = "/uploads/"
+
+var (
+	mediaURLSecret []byte
+	mediaURLExpiry = 24 * time.Hour
+)
+
+// initMediaURLSigning reads the key media URLs are signed with from
+// MEDIA_URL_SECRET, falling back to SESSION_SECRET. Without either, a random
+// key is used and signed URLs stop working when the server restarts.
+func initMediaURLSigning() {
+	secret := os.Getenv("MEDIA_URL_SECRET")
+	if secret == "" {
+		secret = os.Getenv("SESSION_SECRET")
+	}
+	if secret != "" {
+		key := hmac.New(sha256.New, []byte(secret))
+		key.Write([]byte("media-urls"))
+		mediaURLSecret = key.Sum(nil)
+	} else {
+		mediaURLSecret = make([]byte, 32)
+		if _, err := rand.Read(mediaURLSecret); err != nil {
+			log.Fatalf("Failed to generate media URL key: %v", err)
+		}
+		log.Println("Warning: neither MEDIA_URL_SECRET nor SESSION_SECRET is set; signed media URLs will not survive a restart")
+	}
+
+	if value := os.Getenv("MEDIA_URL_EXPIRY"); value != "" {
+		if expiry, err := time.ParseDuration(value); err == nil && expiry > 0 {
+			mediaURLExpiry = expiry
+		} else {
+			log.Printf("Invalid MEDIA_URL_EXPIRY %q, using %v", value, mediaURLExpiry)
+		}
+	}
+}
+
+// SignMediaURL adds an expiry and an HMAC signature to the URL of a stored
+// upload, so it can be fetched without a session until it expires. Expiries
+// are rounded up to the hour so the URL of a file stays the same for a
+// while and browsers can cache it. Other URLs are returned unchanged.
+func SignMediaURL(mediaURL string) string {
+	key, ok := strings.CutPrefix(mediaURL, MediaURLPrefix)
+	if !ok || !ValidKey(key) || mediaURLSecret == nil {
+		return mediaURL
+	}
+	expires := time.Now().Add(mediaURLExpiry).Truncate(time.Hour).Add(time.Hour).Unix()
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("signature", mediaURLSignature(key, expires))
+	return mediaURL + "?" + query.Encode()
+}
+
+// UnsignedMediaURL removes the expiry and signature from a signed upload URL
+func UnsignedMediaURL(mediaURL string) string {
+	if strings.HasPrefix(mediaURL, MediaURLPrefix) {
+		mediaURL, _, _ = strings.Cut(mediaURL, "?")
+	}
+	return mediaURL
+}
+
+// VerifyMediaURL reports whether expires and signature, the query parameters
+// added by SignMediaURL, are valid for the upload stored under key
+func VerifyMediaURL(key, expires, signature string) bool {
+	if mediaURLSecret == nil || expires == "" || signature == "" {
+		return false
+	}
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return false
+	}
+	expected := mediaURLSignature(key, expiresAt)
+	return hmac.Equal([]byte(signature), []byte(expected))
+}
+
+func mediaURLSignature(key string, expires int64) string {
+	mac := hmac.New(sha256.New, mediaURLSecret)
+	mac.Write([]byte(key + "\n" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned for objects that do not exist
+	ErrNotFound = errors.New("object not found")
+	// ErrSignedURLsUnsupported is returned by stores that cannot hand out
+	// URLs to their objects, so the app has to serve them itself
+	ErrSignedURLsUnsupported = errors.New("signed URLs are not supported")
+	// ErrInvalidKey is returned for keys that are empty or contain a path
+	ErrInvalidKey = errors.New("invalid object key")
+)
+
+// Object is a stored file opened for reading. Seeking is cheap, so it can be
+// served with http.ServeContent, including range requests.
+type Object struct {
+	io.ReadSeekCloser
+	Size    int64
+	ModTime time.Time
+}
+
+// ObjectInfo describes a stored object without opening it
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// SignedURLOptions are the response headers a signed URL makes the store send
+type SignedURLOptions struct {
+	ContentType        string
+	ContentDisposition string
+}
+
+// Storage keeps uploaded files. Keys are flat file names such as
+// "<sha256>.jpg", the part of a media URL after "/uploads/".
+type Storage interface {
+	// Put stores data under key and returns the number of bytes stored
+	Put(key string, data io.Reader, contentType string) (int64, error)
+	// Get opens a stored object for reading
+	Get(key string) (*Object, error)
+	// Delete removes an object. Deleting an object that does not exist is not an error.
+	Delete(key string) error
+	// SignedURL returns a URL the object can be downloaded from directly
+	// until expiry has passed
+	SignedURL(key string, expiry time.Duration, options SignedURLOptions) (string, error)
+	// List calls fn for every stored object, in no particular order, and
+	// stops at the first error fn returns
+	List(fn func(ObjectInfo) error) error
+}
+
+var store Storage
+
+// InitStorage sets up the store chosen by STORAGE_BACKEND: "local" (the
+// default) keeps files in the uploads directory, "s3" in an S3-compatible
+// bucket. It also loads the key media URLs are signed with.
+func InitStorage() error {
+	backend := strings.ToLower(strings.TrimSpace(os.Getenv("STORAGE_BACKEND")))
+	if backend == "" {
+		backend = "local"
+	}
+	switch backend {
+	case "local":
+		local, err := NewLocalStorage("uploads")
+		if err != nil {
+			return err
+		}
+		store = local
+	case "s3":
+		s3, err := NewS3StorageFromEnv()
+		if err != nil {
+			return err
+		}
+		store = s3
+	default:
+		return fmt.Errorf("unknown STORAGE_BACKEND %q", backend)
+	}
+	log.Printf("Storing uploads in %s storage", backend)
+
+	initMediaURLSigning()
+	return nil
+}
+
+// GetStorage returns the store uploads are kept in
+func GetStorage() Storage {
+	return store
+}
+
+// ValidKey reports whether key is a flat file name that can be stored
+func ValidKey(key string) bool {
+	return key != "" && key != "." && key != ".." && !strings.ContainsAny(key, "/\\") && !strings.HasPrefix(key, ".")
+}